@@ -4,12 +4,17 @@ go 1.13
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.4.1
-	github.com/aws/aws-sdk-go v1.37.32
+	github.com/apache/arrow/go/v12 v12.0.1
+	github.com/aws/aws-sdk-go v1.55.8
 	github.com/jedib0t/go-pretty/v6 v6.2.7
 	github.com/json-iterator/go v1.1.12
-	github.com/stretchr/testify v1.7.0
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/prometheus/client_golang v1.11.1
+	github.com/prometheus/client_model v0.2.0
+	github.com/stretchr/testify v1.8.0
 	github.com/uber-go/tally v3.3.17+incompatible
 	github.com/xwb1989/sqlparser v0.0.0-20180606152119-120387863bf2
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
 	go.uber.org/zap v1.15.0
-	golang.org/x/tools v0.0.0-20191114200427-caa0b0f7d508 // indirect
 )
@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"strings"
+	"text/template"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// DefaultQueryAnnotation is a query annotation template with the service, team and request ID labels, and
+// the trace ID of the query.
+const DefaultQueryAnnotation = "service={{.Labels.service}} team={{.Labels.team}} " +
+	"request_id={{.Labels.request_id}} trace_id={{.TraceID}}"
+
+// QueryAnnotation is the data of the query annotation template of Config.
+type QueryAnnotation struct {
+	// Labels are the query labels of Config, and of the context, which take precedence.
+	Labels map[string]string
+	// TraceID and SpanID are the OpenTelemetry trace context of the query, empty if it isn't traced.
+	TraceID   string
+	SpanID    string
+	Workgroup string
+	Database  string
+	// Caller is the cost tag of the query, set with WithCostTag.
+	Caller string
+}
+
+// parseQueryAnnotation is to parse a query annotation template. Labels missing in the map are empty.
+func parseQueryAnnotation(text string) (*template.Template, error) {
+	return template.New("queryAnnotation").Option("missingkey=zero").Parse(text)
+}
+
+// queryAnnotationComment is to get the SQL comment annotating the query with ctx in workgroup wgName, like
+// `/* service=api team=data */ `, or "" if there is no query annotation template in Config.
+func (c *Connection) queryAnnotationComment(ctx context.Context, wgName string) string {
+	config := c.connector.config
+	text := config.GetQueryAnnotation()
+	if text == "" {
+		return ""
+	}
+	// the template is checked by SetQueryAnnotation, but the DSN can be set by hand
+	tmpl, err := parseQueryAnnotation(text)
+	if err != nil {
+		c.connector.tracer.Log(WarnLevel, "invalid query annotation", zap.String("error", err.Error()))
+		return ""
+	}
+	annotation := QueryAnnotation{
+		Labels:    config.GetQueryLabels(),
+		Workgroup: wgName,
+		Database:  getDatabase(ctx, config),
+		Caller:    getCostTag(ctx),
+	}
+	for k, v := range getQueryLabels(ctx) {
+		annotation.Labels[k] = v
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		annotation.TraceID, annotation.SpanID = sc.TraceID().String(), sc.SpanID().String()
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, annotation); err != nil {
+		c.connector.tracer.Log(WarnLevel, "query annotation failed", zap.String("error", err.Error()))
+		return ""
+	}
+	// the labels can't end the comment
+	comment := strings.ReplaceAll(strings.TrimSpace(b.String()), "*/", "* /")
+	if comment == "" {
+		return ""
+	}
+	return "/* " + comment + " */ "
+}
+
+// queryCommentsLength is to get the length of the comments startQueryExecution prepends to the queries run with
+// ctx, the query annotation and the trace context. The span of a query isn't started yet, so it takes IDs of
+// the same length.
+func (c *Connection) queryCommentsLength(ctx context.Context) int {
+	config := c.connector.config
+	if config.GetTracerProvider() != nil && !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled}))
+	}
+	wgName := getWorkgroup(ctx, config).Name
+	if wgName == "" {
+		wgName = DefaultWGName
+	}
+	return len(c.queryAnnotationComment(ctx, wgName) + traceparentComment(ctx))
+}
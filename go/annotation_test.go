@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnection_QueryContext_QueryAnnotation(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	config := c.connector.config
+	assert.Nil(t, config.SetQueryAnnotation(DefaultQueryAnnotation))
+	config.SetQueryLabels(map[string]string{"service": "api", "team": "data", "request_id": "none"})
+
+	ctx := WithQueryLabels(context.Background(), map[string]string{"request_id": "r-1"})
+	_, err := c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "/* service=api team=data request_id=r-1 trace_id= */ SELECT 1",
+		*athenaClient.inputs[0].QueryString)
+
+	// the labels can't end the comment
+	assert.Nil(t, config.SetQueryAnnotation("wg={{.Workgroup}} caller={{.Caller}} {{.Labels.x}}"))
+	ctx = WithQueryLabels(WithCostTag(context.Background(), "finance"), map[string]string{"x": "*/ DROP"})
+	_, err = c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "/* wg=primary caller=finance * / DROP */ SELECT 1", *athenaClient.inputs[1].QueryString)
+
+	// Athena only reuses the results of the same query text
+	_, err = c.QueryContext(WithResultReuse(ctx, true, 60), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT 1", *athenaClient.inputs[2].QueryString)
+}
+
+func TestConfig_SetQueryAnnotation(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, "", testConf.GetQueryAnnotation())
+	assert.Empty(t, testConf.GetQueryLabels())
+	assert.Equal(t, ErrConfigQueryAnnotation, testConf.SetQueryAnnotation("{{.Labels"))
+	assert.Nil(t, testConf.SetQueryAnnotation(DefaultQueryAnnotation))
+	assert.Equal(t, DefaultQueryAnnotation, testConf.GetQueryAnnotation())
+
+	testConf.SetQueryLabels(map[string]string{"team": "data, science", "service": "a&b"})
+	assert.Equal(t, map[string]string{"team": "data, science", "service": "a&b"}, testConf.GetQueryLabels())
+	assert.Equal(t, map[string]string{"team": "data", "service": "api"}, decodeKeyValues("team=data, service=api"))
+
+	// the annotation is part of the DSN
+	conf, err := NewConfig(testConf.Stringify())
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultQueryAnnotation, conf.GetQueryAnnotation())
+	assert.Equal(t, "a&b", conf.GetQueryLabels()["service"])
+}
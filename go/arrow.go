@@ -0,0 +1,339 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/decimal128"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// arrowBatchSize is the number of rows of the Arrow records columnarized from the result rows.
+const arrowBatchSize = 1024
+
+// QueryArrow is to run query and get its rows as Arrow records, for the analytics consumers which want columnar
+// data instead of a driver.Value for every cell. In ResultModeUnload, the records are the ones read from the
+// Parquet files, without copy, but for the masked columns. Otherwise, the raw values are columnarized in records of 1024 rows, with the Arrow
+// type of each Athena type, like int64 for bigint, and strings for the types without one, like arrays. A record is
+// only valid until the next call of Next, unless it is retained. The reader must be released to close the rows.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) QueryArrow(ctx context.Context, query string, args ...driver.NamedValue) (array.RecordReader,
+	error) {
+	rows, err := c.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := rows.(*Rows)
+	if !ok {
+		rows.Close()
+		return nil, ErrArrowUnsupported
+	}
+	return newArrowRecordReader(r), nil
+}
+
+// arrowRecordReader is an array.RecordReader of Rows.
+type arrowRecordReader struct {
+	refCount int64
+	rows     *Rows
+	schema   *arrow.Schema
+	// builder and appenders columnarize the raw values of the rows, they are nil for the Parquet files of
+	// ResultModeUnload.
+	builder   *array.RecordBuilder
+	appenders []arrowAppender
+	// masked are the masked values of the masked columns of the Parquet records, by index.
+	masked map[int]string
+	record arrow.Record
+	err    error
+}
+
+// arrowAppender is to append a raw value, nil for NULL, to the builder of a column.
+type arrowAppender func(b array.Builder, v *string) error
+
+func newArrowRecordReader(rows *Rows) *arrowRecordReader {
+	r := &arrowRecordReader{refCount: 1, rows: rows}
+	// no file is written for empty results, their schema is the one of their columns
+	if rows.unload != nil && rows.unload.schema != nil {
+		r.schema = rows.unload.schema
+		fields := append([]arrow.Field(nil), r.schema.Fields()...)
+		for i, field := range fields {
+			if value, masked := rows.config.CheckColumnMasked(field.Name); masked {
+				if r.masked == nil {
+					r.masked = map[int]string{}
+				}
+				r.masked[i] = fmt.Sprint(value)
+				fields[i] = arrow.Field{Name: field.Name, Type: arrow.BinaryTypes.String, Nullable: true}
+			}
+		}
+		if r.masked != nil {
+			r.schema = arrow.NewSchema(fields, nil)
+		}
+		return r
+	}
+	columns := rows.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo
+	fields := make([]arrow.Field, len(columns))
+	r.appenders = make([]arrowAppender, len(columns))
+	for i, column := range columns {
+		fields[i], r.appenders[i] = arrowField(column, rows.config)
+	}
+	r.schema = arrow.NewSchema(fields, nil)
+	r.builder = array.NewRecordBuilder(memory.DefaultAllocator, r.schema)
+	return r
+}
+
+// Retain is to implement array.RecordReader.
+func (r *arrowRecordReader) Retain() {
+	atomic.AddInt64(&r.refCount, 1)
+}
+
+// Release is to implement array.RecordReader. The rows are closed once the reader is released by all its users.
+func (r *arrowRecordReader) Release() {
+	if atomic.AddInt64(&r.refCount, -1) != 0 {
+		return
+	}
+	r.releaseRecord()
+	if r.builder != nil {
+		r.builder.Release()
+	}
+	r.rows.Close()
+}
+
+// Schema is to implement array.RecordReader.
+func (r *arrowRecordReader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+// Record is to implement array.RecordReader.
+func (r *arrowRecordReader) Record() arrow.Record {
+	return r.record
+}
+
+// Err is to implement array.RecordReader.
+func (r *arrowRecordReader) Err() error {
+	return r.err
+}
+
+// Next is to implement array.RecordReader.
+func (r *arrowRecordReader) Next() bool {
+	r.releaseRecord()
+	if r.err != nil {
+		return false
+	}
+	if r.builder == nil {
+		r.record, r.err = r.rows.unload.nextRecord()
+		if r.err == nil && r.masked != nil {
+			r.record = r.maskRecord(r.record)
+		}
+	} else {
+		r.record, r.err = r.columnarize()
+	}
+	if r.err == io.EOF {
+		r.err = nil
+	}
+	return r.record != nil
+}
+
+func (r *arrowRecordReader) releaseRecord() {
+	// the records of the Parquet files are released by their reader, the masked ones are copies
+	if r.record != nil && (r.builder != nil || r.masked != nil) {
+		r.record.Release()
+	}
+	r.record = nil
+}
+
+// maskRecord is to copy a record of the Parquet files with the masked columns replaced by strings of their
+// masked value. The other columns are shared.
+func (r *arrowRecordReader) maskRecord(record arrow.Record) arrow.Record {
+	columns := make([]arrow.Array, record.NumCols())
+	for i, column := range record.Columns() {
+		value, masked := r.masked[i]
+		if !masked {
+			columns[i] = column
+			continue
+		}
+		b := array.NewStringBuilder(memory.DefaultAllocator)
+		for j := int64(0); j < record.NumRows(); j++ {
+			b.Append(value)
+		}
+		columns[i] = b.NewArray()
+		b.Release()
+		defer columns[i].Release()
+	}
+	return array.NewRecord(r.schema, columns, record.NumRows())
+}
+
+// columnarize is to build a record of the next rows, at most arrowBatchSize of them. It returns io.EOF after
+// the last row.
+func (r *arrowRecordReader) columnarize() (arrow.Record, error) {
+	n := 0
+	for ; n < arrowBatchSize; n++ {
+		data, err := r.rows.nextData()
+		if err == io.EOF {
+			break
+		}
+		if err == nil && len(data) != len(r.appenders) {
+			err = fmt.Errorf("row has %d values for %d columns", len(data), len(r.appenders))
+		}
+		for i := 0; err == nil && i < len(data); i++ {
+			if data[i] == nil {
+				err = ErrAthenaNilDatum
+			} else {
+				err = r.appenders[i](r.builder.Field(i), data[i].VarCharValue)
+			}
+		}
+		if err != nil {
+			// the reader stops at the first error, so the rows built so far are left in the builder
+			return nil, err
+		}
+	}
+	if n == 0 {
+		return nil, io.EOF
+	}
+	return r.builder.NewRecord(), nil
+}
+
+// arrowField is to get the Arrow field of a result column, and the appender of its raw values. Masked columns
+// are strings of their masked value.
+func arrowField(column *athena.ColumnInfo, config *Config) (arrow.Field, arrowAppender) {
+	field := arrow.Field{Name: aws.StringValue(column.Name), Type: arrow.BinaryTypes.String, Nullable: true}
+	if value, masked := config.CheckColumnMasked(field.Name); masked {
+		s := fmt.Sprint(value)
+		return field, func(b array.Builder, v *string) error {
+			b.(*array.StringBuilder).Append(s)
+			return nil
+		}
+	}
+	var appender func(b array.Builder, v string) error
+	switch aws.StringValue(column.Type) {
+	case "boolean":
+		field.Type = arrow.FixedWidthTypes.Boolean
+		appender = func(b array.Builder, v string) error {
+			x, err := strconv.ParseBool(v)
+			b.(*array.BooleanBuilder).Append(x)
+			return err
+		}
+	case "tinyint":
+		field.Type = arrow.PrimitiveTypes.Int8
+		appender = func(b array.Builder, v string) error {
+			x, err := strconv.ParseInt(v, 10, 8)
+			b.(*array.Int8Builder).Append(int8(x))
+			return err
+		}
+	case "smallint":
+		field.Type = arrow.PrimitiveTypes.Int16
+		appender = func(b array.Builder, v string) error {
+			x, err := strconv.ParseInt(v, 10, 16)
+			b.(*array.Int16Builder).Append(int16(x))
+			return err
+		}
+	case "integer":
+		field.Type = arrow.PrimitiveTypes.Int32
+		appender = func(b array.Builder, v string) error {
+			x, err := strconv.ParseInt(v, 10, 32)
+			b.(*array.Int32Builder).Append(int32(x))
+			return err
+		}
+	case "bigint":
+		field.Type = arrow.PrimitiveTypes.Int64
+		appender = func(b array.Builder, v string) error {
+			x, err := strconv.ParseInt(v, 10, 64)
+			b.(*array.Int64Builder).Append(x)
+			return err
+		}
+	case "float", "real":
+		field.Type = arrow.PrimitiveTypes.Float32
+		appender = func(b array.Builder, v string) error {
+			x, err := strconv.ParseFloat(v, 32)
+			b.(*array.Float32Builder).Append(float32(x))
+			return err
+		}
+	case "double":
+		field.Type = arrow.PrimitiveTypes.Float64
+		appender = func(b array.Builder, v string) error {
+			x, err := strconv.ParseFloat(v, 64)
+			b.(*array.Float64Builder).Append(x)
+			return err
+		}
+	case "decimal":
+		precision, scale := int32(aws.Int64Value(column.Precision)), int32(aws.Int64Value(column.Scale))
+		if precision < 1 || precision > 38 {
+			break
+		}
+		field.Type = &arrow.Decimal128Type{Precision: precision, Scale: scale}
+		appender = func(b array.Builder, v string) error {
+			x, err := decimal128.FromString(v, precision, scale)
+			b.(*array.Decimal128Builder).Append(x)
+			return err
+		}
+	case "date":
+		field.Type = arrow.FixedWidthTypes.Date32
+		appender = func(b array.Builder, v string) error {
+			t, err := parseArrowTime(v)
+			b.(*array.Date32Builder).Append(arrow.Date32FromTime(t))
+			return err
+		}
+	case "timestamp", "timestamp with time zone":
+		unit := &arrow.TimestampType{Unit: arrow.Millisecond}
+		if aws.StringValue(column.Type) == "timestamp with time zone" {
+			unit.TimeZone = "UTC"
+		}
+		field.Type = unit
+		appender = func(b array.Builder, v string) error {
+			t, err := parseArrowTime(v)
+			b.(*array.TimestampBuilder).Append(arrow.Timestamp(t.UnixNano() / int64(time.Millisecond)))
+			return err
+		}
+	}
+	if appender == nil {
+		field.Type = arrow.BinaryTypes.String
+		appender = func(b array.Builder, v string) error {
+			b.(*array.StringBuilder).Append(v)
+			return nil
+		}
+	}
+	return field, func(b array.Builder, v *string) error {
+		if v == nil {
+			b.AppendNull()
+			return nil
+		}
+		return appender(b, *v)
+	}
+}
+
+// parseArrowTime is to parse an Athena date or timestamp, in UTC if it has no time zone, as the Arrow dates and
+// timestamps without time zone are.
+func parseArrowTime(v string) (time.Time, error) {
+	t, err := scanTimeInLocation(v, time.UTC)
+	if err == nil && !t.Valid {
+		err = fmt.Errorf("invalid time %q", v)
+	}
+	return t.Time, err
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestArrowRows(columnTypes []string, data [][]*string) *Rows {
+	names := make([]*string, len(columnTypes))
+	for i := range columnTypes {
+		names[i] = aws.String(fmt.Sprintf("c%d", i))
+	}
+	return &Rows{
+		ctx:          context.Background(),
+		config:       NewNoOpsConfig(),
+		tracer:       NewNoOpsObservability(),
+		ResultOutput: newHeaderlessResultPage(names, columnTypes, data),
+	}
+}
+
+func TestArrowRecordReader_Columnarize(t *testing.T) {
+	rows := newTestArrowRows(
+		[]string{"boolean", "tinyint", "integer", "bigint", "double", "decimal", "date", "timestamp", "varchar", "array"},
+		[][]*string{
+			{aws.String("true"), aws.String("1"), aws.String("2"), aws.String("3"), aws.String("1.5"),
+				aws.String("12.50"), aws.String("2020-01-02"), aws.String("2020-01-02 03:04:05.678"), aws.String("x"),
+				aws.String("[1, 2]")},
+			{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil},
+		})
+	rows.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[5].Precision = aws.Int64(10)
+	rows.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[5].Scale = aws.Int64(2)
+	reader := newArrowRecordReader(rows)
+	defer reader.Release()
+
+	schema := reader.Schema()
+	assert.Equal(t, "c0", schema.Field(0).Name)
+	assert.Equal(t, arrow.FixedWidthTypes.Boolean, schema.Field(0).Type)
+	assert.Equal(t, arrow.PrimitiveTypes.Int8, schema.Field(1).Type)
+	assert.Equal(t, &arrow.Decimal128Type{Precision: 10, Scale: 2}, schema.Field(5).Type)
+	assert.Equal(t, arrow.BinaryTypes.String, schema.Field(9).Type)
+
+	assert.True(t, reader.Next())
+	record := reader.Record()
+	assert.Equal(t, int64(2), record.NumRows())
+	assert.Equal(t, true, record.Column(0).(*array.Boolean).Value(0))
+	assert.Equal(t, int32(2), record.Column(2).(*array.Int32).Value(0))
+	assert.Equal(t, int64(3), record.Column(3).(*array.Int64).Value(0))
+	assert.Equal(t, 1.5, record.Column(4).(*array.Float64).Value(0))
+	assert.Equal(t, "12.50", record.Column(5).(*array.Decimal128).Value(0).ToString(2))
+	assert.Equal(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), record.Column(6).(*array.Date32).Value(0).ToTime())
+	assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 678000000, time.UTC),
+		record.Column(7).(*array.Timestamp).Value(0).ToTime(arrow.Millisecond))
+	assert.Equal(t, "[1, 2]", record.Column(9).(*array.String).Value(0))
+	for i := range record.Columns() {
+		assert.True(t, record.Column(i).IsNull(1))
+	}
+	assert.False(t, reader.Next())
+	assert.Nil(t, reader.Err())
+}
+
+func TestArrowRecordReader_Batches(t *testing.T) {
+	data := make([][]*string, arrowBatchSize+10)
+	for i := range data {
+		data[i] = []*string{aws.String(fmt.Sprint(i))}
+	}
+	reader := newArrowRecordReader(newTestArrowRows([]string{"bigint"}, data))
+	defer reader.Release()
+	var counts []int64
+	for reader.Next() {
+		counts = append(counts, reader.Record().NumRows())
+	}
+	assert.Nil(t, reader.Err())
+	assert.Equal(t, []int64{arrowBatchSize, 10}, counts)
+}
+
+func TestArrowRecordReader_Error(t *testing.T) {
+	rows := newTestArrowRows([]string{"integer"}, [][]*string{{aws.String("x")}})
+	reader := newArrowRecordReader(rows)
+	defer reader.Release()
+	assert.False(t, reader.Next())
+	assert.NotNil(t, reader.Err())
+	assert.False(t, reader.Next())
+}
+
+func TestArrowRecordReader_Masked(t *testing.T) {
+	rows := newTestArrowRows([]string{"varchar"}, [][]*string{{aws.String("secret")}, {nil}})
+	rows.config.SetMaskedColumnValue("c0", "xxx")
+	reader := newArrowRecordReader(rows)
+	defer reader.Release()
+	assert.True(t, reader.Next())
+	column := reader.Record().Column(0).(*array.String)
+	assert.Equal(t, "xxx", column.Value(0))
+	assert.Equal(t, "xxx", column.Value(1))
+}
+
+func TestConnection_QueryArrow_ResultModeUnload(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API: &unloadS3Client{
+			athenaClient: athenaClient,
+			files: [][]byte{
+				newParquetFile(t, []int32{1, 2}, []string{"x", ""}, []bool{true, false}),
+				newParquetFile(t, []int32{3}, []string{"z"}, []bool{true}),
+			},
+		},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeUnload)
+
+	reader, err := c.QueryArrow(context.Background(), "SELECT id, name, ts, tags FROM t")
+	assert.Nil(t, err)
+	defer reader.Release()
+	assert.Equal(t, []string{"id", "name", "ts", "tags"}, []string{reader.Schema().Field(0).Name,
+		reader.Schema().Field(1).Name, reader.Schema().Field(2).Name, reader.Schema().Field(3).Name})
+	var ids []int32
+	for reader.Next() {
+		column := reader.Record().Column(0).(*array.Int32)
+		ids = append(ids, column.Int32Values()...)
+	}
+	assert.Nil(t, reader.Err())
+	assert.Equal(t, []int32{1, 2, 3}, ids)
+}
+
+func TestConnection_QueryArrow_ResultModeUnload_Masked(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API: &unloadS3Client{
+			athenaClient: athenaClient,
+			files:        [][]byte{newParquetFile(t, []int32{1, 2}, []string{"x", ""}, []bool{true, false})},
+		},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeUnload)
+	c.connector.config.SetMaskedColumnValue("id", "xxx")
+
+	reader, err := c.QueryArrow(context.Background(), "SELECT id, name, ts, tags FROM t")
+	assert.Nil(t, err)
+	defer reader.Release()
+	assert.Equal(t, arrow.BinaryTypes.String, reader.Schema().Field(0).Type)
+	assert.True(t, reader.Next())
+	record := reader.Record()
+	assert.Equal(t, []string{"xxx", "xxx"}, []string{record.Column(0).(*array.String).Value(0),
+		record.Column(0).(*array.String).Value(1)})
+	assert.Equal(t, "x", record.Column(1).(*array.String).Value(0))
+	assert.False(t, reader.Next())
+	assert.Nil(t, reader.Err())
+}
+
+func TestConnection_QueryArrow(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	reader, err := c.QueryArrow(context.Background(), "SELECT 1")
+	assert.Nil(t, err)
+	defer reader.Release()
+	assert.Equal(t, len(reader.Schema().Fields()), len(reader.(*arrowRecordReader).rows.Columns()))
+	for reader.Next() {
+	}
+	assert.Nil(t, reader.Err())
+
+	_, err = c.QueryArrow(context.Background(), "")
+	assert.Equal(t, ErrInvalidQuery, err)
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"go.uber.org/zap"
+)
+
+// MinCapacityReservationDPUs is the min number of data processing units of an Athena capacity reservation.
+const MinCapacityReservationDPUs = 24
+
+// CapacityReservation is a wrapper of Athena capacity reservation, the provisioned capacity which runs the
+// queries of the workgroups assigned to it.
+type CapacityReservation struct {
+	Name       string
+	TargetDPUs int64
+	Tags       *WGTags
+}
+
+// NewCapacityReservation is to create a new CapacityReservation.
+func NewCapacityReservation(name string, targetDPUs int64, tags *WGTags) *CapacityReservation {
+	return &CapacityReservation{
+		Name:       name,
+		TargetDPUs: targetDPUs,
+		Tags:       tags,
+	}
+}
+
+// CreateRemotely is to create the CapacityReservation remotely. Athena allocates its DPUs asynchronously,
+// the reservation is ACTIVE then.
+func (r *CapacityReservation) CreateRemotely(athenaService athenaiface.AthenaAPI) error {
+	if athenaService == nil {
+		return ErrAthenaNilAPI
+	}
+	if r.TargetDPUs < MinCapacityReservationDPUs {
+		return ErrCapacityReservationDPUs
+	}
+	if err := r.Tags.Validate(); err != nil {
+		return err
+	}
+	input := &athena.CreateCapacityReservationInput{
+		Name:       aws.String(r.Name),
+		TargetDpus: aws.Int64(r.TargetDPUs),
+	}
+	if tags := r.Tags.Get(); len(tags) > 0 {
+		input.Tags = tags
+	}
+	_, err := athenaService.CreateCapacityReservation(input)
+	return err
+}
+
+// AssignRemotely is to assign the workgroups to the CapacityReservation remotely, so it runs their queries.
+// The workgroups replace the ones assigned before, and none unassigns them all.
+func (r *CapacityReservation) AssignRemotely(athenaService athenaiface.AthenaAPI, wgNames ...string) error {
+	if athenaService == nil {
+		return ErrAthenaNilAPI
+	}
+	assignments := []*athena.CapacityAssignment{}
+	if len(wgNames) > 0 {
+		assignments = append(assignments, &athena.CapacityAssignment{WorkGroupNames: aws.StringSlice(wgNames)})
+	}
+	_, err := athenaService.PutCapacityAssignmentConfiguration(&athena.PutCapacityAssignmentConfigurationInput{
+		CapacityReservationName: aws.String(r.Name),
+		CapacityAssignments:     assignments,
+	})
+	return err
+}
+
+// CapacityReservationSummary is the state of an Athena capacity reservation, as listed by
+// ListCapacityReservations.
+type CapacityReservationSummary struct {
+	Name          string
+	Status        string
+	TargetDPUs    int64
+	AllocatedDPUs int64
+}
+
+// ListCapacityReservations is to list all Athena capacity reservations remotely.
+func ListCapacityReservations(ctx context.Context, athenaService athenaiface.AthenaAPI) (
+	[]CapacityReservationSummary, error) {
+	if athenaService == nil {
+		return nil, ErrAthenaNilAPI
+	}
+	var reservations []CapacityReservationSummary
+	err := athenaService.ListCapacityReservationsPagesWithContext(ctx, &athena.ListCapacityReservationsInput{},
+		func(page *athena.ListCapacityReservationsOutput, lastPage bool) bool {
+			for _, r := range page.CapacityReservations {
+				reservations = append(reservations, CapacityReservationSummary{
+					Name:          aws.StringValue(r.Name),
+					Status:        aws.StringValue(r.Status),
+					TargetDPUs:    aws.Int64Value(r.TargetDpus),
+					AllocatedDPUs: aws.Int64Value(r.AllocatedDpus),
+				})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+// getCapacityReservation is to get the name of the active capacity reservation the workgroup is assigned to
+// remotely, empty if none.
+func getCapacityReservation(ctx context.Context, athenaService athenaiface.AthenaAPI, wgName string) (
+	string, error) {
+	reservations, err := ListCapacityReservations(ctx, athenaService)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range reservations {
+		if r.Status != athena.CapacityReservationStatusActive &&
+			r.Status != athena.CapacityReservationStatusUpdatePending {
+			continue
+		}
+		out, err := athenaService.GetCapacityAssignmentConfigurationWithContext(ctx,
+			&athena.GetCapacityAssignmentConfigurationInput{CapacityReservationName: aws.String(r.Name)})
+		if err != nil {
+			return "", err
+		}
+		if out.CapacityAssignmentConfiguration == nil {
+			continue
+		}
+		for _, assignment := range out.CapacityAssignmentConfiguration.CapacityAssignments {
+			for _, name := range assignment.WorkGroupNames {
+				if aws.StringValue(name) == wgName {
+					return r.Name, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// checkCapacity is to check if the workgroup is assigned to an active capacity reservation, when Config
+// requires capacity-backed execution. The workgroups found assigned are cached by the SQLConnector.
+func (c *Connection) checkCapacity(ctx context.Context, obs *DriverTracer, wgName string) error {
+	if !c.connector.config.IsCapacityRequired() {
+		return nil
+	}
+	if _, ok := c.connector.capacityWGs.Load(wgName); ok {
+		return nil
+	}
+	reservation, err := getCapacityReservation(ctx, c.athenaAPI, wgName)
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.querycontext.getcapacityreservation").Inc(1)
+		return err
+	}
+	if reservation == "" {
+		obs.Scope().Counter(DriverName + ".failure.querycontext.nocapacity").Inc(1)
+		obs.Log(WarnLevel, "workgroup isn't assigned to a capacity reservation", zap.String("workgroup", wgName))
+		return fmt.Errorf("%w: workgroup %q", ErrCapacityRequired, wgName)
+	}
+	c.connector.capacityWGs.Store(wgName, reservation)
+	obs.Log(DebugLevel, "workgroup "+wgName+" is assigned to capacity reservation "+reservation+".")
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// capacityAthenaClient has capacity reservations with the workgroups assigned to them.
+type capacityAthenaClient struct {
+	queryContextAthenaClient
+	reservations []*athena.CapacityReservation
+	assignments  map[string][]string
+	creates      []*athena.CreateCapacityReservationInput
+	listed       int
+}
+
+func (m *capacityAthenaClient) CreateCapacityReservation(input *athena.CreateCapacityReservationInput) (
+	*athena.CreateCapacityReservationOutput, error) {
+	m.creates = append(m.creates, input)
+	return &athena.CreateCapacityReservationOutput{}, nil
+}
+
+func (m *capacityAthenaClient) PutCapacityAssignmentConfiguration(input *athena.PutCapacityAssignmentConfigurationInput) (
+	*athena.PutCapacityAssignmentConfigurationOutput, error) {
+	var wgNames []string
+	for _, assignment := range input.CapacityAssignments {
+		wgNames = append(wgNames, aws.StringValueSlice(assignment.WorkGroupNames)...)
+	}
+	m.assignments[*input.CapacityReservationName] = wgNames
+	return &athena.PutCapacityAssignmentConfigurationOutput{}, nil
+}
+
+func (m *capacityAthenaClient) ListCapacityReservationsPagesWithContext(ctx aws.Context,
+	input *athena.ListCapacityReservationsInput, fn func(*athena.ListCapacityReservationsOutput, bool) bool,
+	opts ...request.Option) error {
+	m.listed++
+	fn(&athena.ListCapacityReservationsOutput{CapacityReservations: m.reservations}, true)
+	return nil
+}
+
+func (m *capacityAthenaClient) GetCapacityAssignmentConfigurationWithContext(ctx aws.Context,
+	input *athena.GetCapacityAssignmentConfigurationInput, opts ...request.Option) (
+	*athena.GetCapacityAssignmentConfigurationOutput, error) {
+	return &athena.GetCapacityAssignmentConfigurationOutput{
+		CapacityAssignmentConfiguration: &athena.CapacityAssignmentConfiguration{
+			CapacityReservationName: input.CapacityReservationName,
+			CapacityAssignments: []*athena.CapacityAssignment{{
+				WorkGroupNames: aws.StringSlice(m.assignments[*input.CapacityReservationName]),
+			}},
+		},
+	}, nil
+}
+
+func newCapacityAthenaClient() *capacityAthenaClient {
+	return &capacityAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		reservations: []*athena.CapacityReservation{
+			{Name: aws.String("etl"), Status: aws.String(athena.CapacityReservationStatusActive),
+				TargetDpus: aws.Int64(48), AllocatedDpus: aws.Int64(48)},
+			{Name: aws.String("old"), Status: aws.String(athena.CapacityReservationStatusCancelled),
+				TargetDpus: aws.Int64(24), AllocatedDpus: aws.Int64(0)},
+		},
+		assignments: map[string][]string{"old": {DefaultWGName}},
+	}
+}
+
+func TestCapacityReservation_CreateRemotely(t *testing.T) {
+	r := NewCapacityReservation("etl", 16, nil)
+	assert.Equal(t, ErrAthenaNilAPI, r.CreateRemotely(nil))
+	athenaClient := newCapacityAthenaClient()
+	assert.Equal(t, ErrCapacityReservationDPUs, r.CreateRemotely(athenaClient))
+
+	tags := NewWGTags()
+	tags.AddTag("aws:reserved", "v")
+	r = NewCapacityReservation("etl", 48, tags)
+	assert.True(t, errors.Is(r.CreateRemotely(athenaClient), ErrWGTagInvalid))
+
+	r.Tags = NewWGTags()
+	r.Tags.AddTag("Uber User", "henry.wu")
+	assert.Nil(t, r.CreateRemotely(athenaClient))
+	if assert.Len(t, athenaClient.creates, 1) {
+		assert.Equal(t, "etl", *athenaClient.creates[0].Name)
+		assert.Equal(t, int64(48), *athenaClient.creates[0].TargetDpus)
+		assert.Equal(t, r.Tags.Get(), athenaClient.creates[0].Tags)
+	}
+}
+
+func TestCapacityReservation_AssignRemotely(t *testing.T) {
+	r := NewCapacityReservation("etl", 48, nil)
+	assert.Equal(t, ErrAthenaNilAPI, r.AssignRemotely(nil, "henry_wu"))
+	athenaClient := newCapacityAthenaClient()
+	assert.Nil(t, r.AssignRemotely(athenaClient, "henry_wu", "analytics"))
+	assert.Equal(t, []string{"henry_wu", "analytics"}, athenaClient.assignments["etl"])
+	assert.Nil(t, r.AssignRemotely(athenaClient))
+	assert.Empty(t, athenaClient.assignments["etl"])
+}
+
+func TestListCapacityReservations(t *testing.T) {
+	_, err := ListCapacityReservations(context.Background(), nil)
+	assert.Equal(t, ErrAthenaNilAPI, err)
+	reservations, err := ListCapacityReservations(context.Background(), newCapacityAthenaClient())
+	assert.Nil(t, err)
+	assert.Equal(t, []CapacityReservationSummary{
+		{Name: "etl", Status: athena.CapacityReservationStatusActive, TargetDPUs: 48, AllocatedDPUs: 48},
+		{Name: "old", Status: athena.CapacityReservationStatusCancelled, TargetDPUs: 24},
+	}, reservations)
+}
+
+func TestConnection_QueryContext_CapacityRequired(t *testing.T) {
+	athenaClient := newCapacityAthenaClient()
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, athenaClient.listed)
+
+	// the primary workgroup is only assigned to a cancelled reservation
+	c.connector.config.SetCapacityRequired(true)
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.True(t, errors.Is(err, ErrCapacityRequired))
+	assert.Len(t, athenaClient.inputs, 1)
+
+	athenaClient.assignments["etl"] = []string{DefaultWGName}
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 3)
+	assert.Equal(t, 2, athenaClient.listed)
+}
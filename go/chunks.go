@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+)
+
+// chunkRows is the number of rows of the chunks of QueryChunks which aren't a result page nor a Parquet record,
+// the max number of rows of a result page.
+const chunkRows = 1000
+
+// QueryChunks is to run query and call fn with its rows in chunks, for bulk exports which copy large results to
+// another store without the overhead of database/sql reading a row at a time. A chunk is a result page in
+// ResultModeAPI, a record of the Parquet files in ResultModeUnload, and 1000 rows of the result object in
+// ResultModeDL. The next chunk is read once fn returns, so a slow fn slows down the reading instead of
+// buffering the results, and the rows of a chunk can be kept by fn. Reading stops at the first error of fn,
+// which is returned. It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) QueryChunks(ctx context.Context, query string, fn func(rows [][]driver.Value) error,
+	args ...driver.NamedValue) error {
+	rows, err := c.QueryContext(ctx, query, args)
+	if err != nil {
+		return err
+	}
+	err = readChunks(rows, fn)
+	if closeErr := rows.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readChunks is to call fn with the chunks of rows, until the last row is read.
+func readChunks(rows driver.Rows, fn func(rows [][]driver.Value) error) error {
+	r, _ := rows.(*Rows)
+	columns := len(rows.Columns())
+	for {
+		var chunk [][]driver.Value
+		var err error
+		for err == nil && !chunkDone(r, len(chunk)) {
+			dest := make([]driver.Value, columns)
+			if err = rows.Next(dest); err == nil {
+				chunk = append(chunk, dest)
+			}
+		}
+		if len(chunk) > 0 {
+			if fnErr := fn(chunk); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// chunkDone is to check if a chunk of n rows of r is complete: at the end of a result page or a Parquet record,
+// or after chunkRows rows otherwise. r is nil for rows which aren't Rows.
+func chunkDone(r *Rows, n int) bool {
+	if n == 0 {
+		return false
+	}
+	switch {
+	case r == nil || r.download != nil:
+		return n >= chunkRows
+	case r.unload != nil:
+		return r.unload.record == nil || r.unload.row+1 >= int(r.unload.record.NumRows())
+	}
+	return len(r.ResultOutput.ResultSet.Rows) == 0
+}
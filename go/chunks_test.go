@@ -0,0 +1,112 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadChunks_Pages(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	client := &pageCountingAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	r, err := NewRows(context.Background(), client, "SELECT_OK", testConf, NewDefaultObservability(testConf))
+	assert.Nil(t, err)
+	var sizes []int
+	err = readChunks(r, func(rows [][]driver.Value) error {
+		sizes = append(sizes, len(rows))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, int(client.pages), len(sizes))
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	assert.Equal(t, 35, total)
+}
+
+func TestReadChunks_Error(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	client := &pageCountingAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	r, err := NewRows(context.Background(), client, "SELECT_OK", testConf, NewDefaultObservability(testConf))
+	assert.Nil(t, err)
+	stop := errors.New("stop")
+	calls := 0
+	err = readChunks(r, func(rows [][]driver.Value) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, int32(1), client.pages)
+}
+
+func TestConnection_QueryChunks_ResultModeUnload(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API: &unloadS3Client{
+			athenaClient: athenaClient,
+			files: [][]byte{
+				newParquetFile(t, []int32{1, 2}, []string{"x", ""}, []bool{true, false}),
+				newParquetFile(t, []int32{3}, []string{"z"}, []bool{true}),
+			},
+		},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeUnload)
+
+	var chunks [][]driver.Value
+	err := c.QueryChunks(context.Background(), "SELECT id, name, ts, tags FROM t", func(rows [][]driver.Value) error {
+		var ids []driver.Value
+		for _, row := range rows {
+			ids = append(ids, row[0])
+		}
+		chunks = append(chunks, ids)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]driver.Value{{int32(1), int32(2)}, {int32(3)}}, chunks)
+}
+
+func TestConnection_QueryChunks(t *testing.T) {
+	c := &Connection{
+		athenaAPI: &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		connector: NoopsSQLConnector(),
+	}
+	err := c.QueryChunks(context.Background(), "SELECT 1", func(rows [][]driver.Value) error {
+		assert.NotEmpty(t, rows)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	err = c.QueryChunks(context.Background(), "", func(rows [][]driver.Value) error {
+		return nil
+	})
+	assert.Equal(t, ErrInvalidQuery, err)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"encoding/json"
+)
+
+// Athena returns the values of complex types in the Presto text form, like
+//
+//	array:      [1, 2, 3]
+//	map:        {a=1, b=2}
+//	row:        {x=1, y=[a, b]}
+//
+// The elements aren't quoted or typed, so scalar elements are kept as strings.
+
+// parseComplexValue is to parse a value of a complex type in the Presto text form into
+// []interface{} for arrays and map[string]interface{} for maps and rows. Other values are returned as they are.
+func parseComplexValue(val string) interface{} {
+	switch {
+	case val == "null":
+		return nil
+	case isEnclosed(val, '[', ']'):
+		items := splitComplexItems(val[1 : len(val)-1])
+		array := make([]interface{}, len(items))
+		for i, item := range items {
+			array[i] = parseComplexValue(item)
+		}
+		return array
+	case isEnclosed(val, '{', '}'):
+		items := splitComplexItems(val[1 : len(val)-1])
+		m := make(map[string]interface{}, len(items))
+		for _, item := range items {
+			if i := indexTopLevel(item, '='); i >= 0 {
+				m[item[:i]] = parseComplexValue(item[i+1:])
+			} else {
+				m[item] = nil
+			}
+		}
+		return m
+	}
+	return val
+}
+
+// parseRowValue is to parse a value of a row type into the JSON of its fields, which can be unmarshaled into a
+// struct. Values which aren't in the Presto text form are returned as they are.
+func parseRowValue(val string) (interface{}, error) {
+	if !isEnclosed(val, '{', '}') {
+		return val, nil
+	}
+	b, err := json.Marshal(parseComplexValue(val))
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
+}
+
+func isEnclosed(val string, open, close byte) bool {
+	return len(val) >= 2 && val[0] == open && val[len(val)-1] == close
+}
+
+// splitComplexItems is to split the items of an array, map or row by the ", " separators which aren't nested.
+func splitComplexItems(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var items []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 && i+1 < len(s) && s[i+1] == ' ' {
+				items = append(items, s[start:i])
+				start = i + 2
+				i++
+			}
+		}
+	}
+	return append(items, s[start:])
+}
+
+// indexTopLevel is to find the first c in s which isn't nested in an array, map or row.
+func indexTopLevel(s string, c byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case c:
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseComplexValue(t *testing.T) {
+	tests := []struct {
+		val      string
+		expected interface{}
+	}{
+		{"[]", []interface{}{}},
+		{"[a, b, null]", []interface{}{"a", "b", nil}},
+		{"[a,b, c]", []interface{}{"a,b", "c"}},
+		{"[[1, 2], [3]]", []interface{}{[]interface{}{"1", "2"}, []interface{}{"3"}}},
+		{"{}", map[string]interface{}{}},
+		{"{a=1, b=x=y}", map[string]interface{}{"a": "1", "b": "x=y"}},
+		{"{k=[1, 2], m={x=1}}", map[string]interface{}{
+			"k": []interface{}{"1", "2"},
+			"m": map[string]interface{}{"x": "1"},
+		}},
+		{"[{x=1}, {x=2}]", []interface{}{map[string]interface{}{"x": "1"}, map[string]interface{}{"x": "2"}}},
+		{"abc", "abc"},
+		{"null", nil},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, parseComplexValue(test.val), test.val)
+	}
+}
+
+func TestParseRowValue(t *testing.T) {
+	v, err := parseRowValue("{name=abc, tags=[a, b], address={city=x}}")
+	assert.Nil(t, err)
+	var row struct {
+		Name    string   `json:"name"`
+		Tags    []string `json:"tags"`
+		Address struct {
+			City string `json:"city"`
+		} `json:"address"`
+	}
+	assert.Nil(t, json.Unmarshal(v.(json.RawMessage), &row))
+	assert.Equal(t, "abc", row.Name)
+	assert.Equal(t, []string{"a", "b"}, row.Tags)
+	assert.Equal(t, "x", row.Address.City)
+
+	v, err = parseRowValue("012")
+	assert.Nil(t, err)
+	assert.Equal(t, "012", v)
+}
+
+func TestRows_AthenaTypeToGoType_ComplexTypes(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	r := &Rows{config: testConf, tracer: NewDefaultObservability(testConf)}
+	val := "[a, b]"
+	g, err := r.athenaTypeToGoType(newColumnInfo("a", "array"), &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", "b"}, g)
+	val = "{a=1}"
+	g, err = r.athenaTypeToGoType(newColumnInfo("m", "map"), &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": "1"}, g)
+	g, err = r.athenaTypeToGoType(newColumnInfo("r", "row"), &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, json.RawMessage(`{"a":"1"}`), g)
+	assert.Equal(t, reflect.TypeOf(json.RawMessage{}), r.scanTypeOfColumnType("row"))
+	assert.Equal(t, reflect.TypeOf(map[string]interface{}{}), r.scanTypeOfColumnType("map"))
+
+	testConf.SetRawComplexTypes(true)
+	for _, athenaType := range []string{"array", "map", "row"} {
+		g, err = r.athenaTypeToGoType(newColumnInfo("c", athenaType), &val, testConf)
+		assert.Nil(t, err)
+		assert.Equal(t, val, g)
+		assert.Equal(t, reflect.TypeOf(""), r.scanTypeOfColumnType(athenaType))
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucketnamingrules.html
+var reBucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// ConfigErrors are all the violations found by ConfigBuilder.Build.
+type ConfigErrors []error
+
+// Error is to implement interface error.
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid driver config: " + strings.Join(msgs, "; ")
+}
+
+// Is is to make errors.Is match any of the violations.
+func (e ConfigErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigBuilder is a fluent builder of Config, like
+//
+//	config, err := NewConfigBuilder().Region("us-east-1").OutputBucket("s3://bucket/path").Build()
+//
+// Unlike the setters of Config, it doesn't stop at the first invalid value: Build validates all the fields
+// together and returns all violations at once.
+type ConfigBuilder struct {
+	config *Config
+	errs   ConfigErrors
+}
+
+// NewConfigBuilder is to create a ConfigBuilder with the same defaults as NewNoOpsConfig, except that
+// region and output bucket are required.
+func NewConfigBuilder() *ConfigBuilder {
+	config := &Config{
+		dsn:    url.URL{Scheme: "s3"},
+		values: make(url.Values, 32),
+	}
+	config.SetDB(DefaultDBName)
+	config.SetMissingAsEmptyString(true)
+	config.SetWGRemoteCreationAllowed(true)
+	return &ConfigBuilder{config: config}
+}
+
+func (b *ConfigBuilder) check(err error) *ConfigBuilder {
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+	return b
+}
+
+// Region is to set the region.
+func (b *ConfigBuilder) Region(region string) *ConfigBuilder {
+	return b.check(b.config.SetRegion(region))
+}
+
+// OutputBucket is to set the S3 output location, like s3://bucket/path.
+func (b *ConfigBuilder) OutputBucket(outputBucket string) *ConfigBuilder {
+	return b.check(b.config.SetOutputBucket(outputBucket))
+}
+
+// Database is to set the database.
+func (b *ConfigBuilder) Database(db string) *ConfigBuilder {
+	b.config.SetDB(db)
+	return b
+}
+
+// DataSource is to set the data catalog.
+func (b *ConfigBuilder) DataSource(dataSource string) *ConfigBuilder {
+	b.config.SetDataSource(dataSource)
+	return b
+}
+
+// Workgroup is to set the workgroup.
+func (b *ConfigBuilder) Workgroup(wg *Workgroup) *ConfigBuilder {
+	return b.check(b.config.SetWorkGroup(wg))
+}
+
+// Credentials is to set static AWS credentials, sessionToken is optional.
+func (b *ConfigBuilder) Credentials(accessID, secretAccessKey, sessionToken string) *ConfigBuilder {
+	b.check(b.config.SetAccessID(accessID))
+	b.check(b.config.SetSecretAccessKey(secretAccessKey))
+	if sessionToken != "" {
+		b.config.SetSessionToken(sessionToken)
+	}
+	return b
+}
+
+// AWSProfile is to set the AWS profile.
+func (b *ConfigBuilder) AWSProfile(profile string) *ConfigBuilder {
+	b.config.SetAWSProfile(profile)
+	return b
+}
+
+// CredentialsMode is to set how credentials are resolved.
+func (b *ConfigBuilder) CredentialsMode(mode CredentialsMode) *ConfigBuilder {
+	b.config.SetCredentialsMode(mode)
+	return b
+}
+
+// AssumeRole is to set the IAM role to assume.
+func (b *ConfigBuilder) AssumeRole(roleARN, externalID, sessionName string) *ConfigBuilder {
+	return b.check(b.config.SetAssumeRole(roleARN, externalID, sessionName))
+}
+
+// Endpoint is to set a custom Athena endpoint URL.
+func (b *ConfigBuilder) Endpoint(endpoint string) *ConfigBuilder {
+	return b.check(b.config.SetEndpoint(endpoint))
+}
+
+// FIPSEndpoint is to set if FIPS endpoints are used.
+func (b *ConfigBuilder) FIPSEndpoint(enabled bool) *ConfigBuilder {
+	b.config.SetFIPSEndpoint(enabled)
+	return b
+}
+
+// PollInterval is to set the interval between two status checks of a running query.
+func (b *ConfigBuilder) PollInterval(interval time.Duration) *ConfigBuilder {
+	if interval <= 0 {
+		return b.check(fmt.Errorf("poll interval must be positive, got %s", interval))
+	}
+	b.config.SetPollInterval(interval)
+	return b
+}
+
+// ReadOnly is to set the read-only mode.
+func (b *ConfigBuilder) ReadOnly(enabled bool) *ConfigBuilder {
+	b.config.SetReadOnly(enabled)
+	return b
+}
+
+// MoneyWise is to set the moneywise mode.
+func (b *ConfigBuilder) MoneyWise(enabled bool) *ConfigBuilder {
+	b.config.SetMoneyWise(enabled)
+	return b
+}
+
+// MissingAsEmptyString is to set if missing values are returned as empty string.
+func (b *ConfigBuilder) MissingAsEmptyString(enabled bool) *ConfigBuilder {
+	b.config.SetMissingAsEmptyString(enabled)
+	return b
+}
+
+// MissingAsNil is to set if missing values are returned as nil, instead of empty string.
+func (b *ConfigBuilder) MissingAsNil(enabled bool) *ConfigBuilder {
+	b.config.SetMissingAsNil(enabled)
+	if enabled {
+		b.config.SetMissingAsEmptyString(false)
+	}
+	return b
+}
+
+// MissingAsDefault is to set if missing values are returned as default data.
+func (b *ConfigBuilder) MissingAsDefault(enabled bool) *ConfigBuilder {
+	b.config.SetMissingAsDefault(enabled)
+	return b
+}
+
+// WGRemoteCreationAllowed is to set if a missing workgroup is created remotely.
+func (b *ConfigBuilder) WGRemoteCreationAllowed(allowed bool) *ConfigBuilder {
+	b.config.SetWGRemoteCreationAllowed(allowed)
+	return b
+}
+
+// Logging is to set if logging is enabled.
+func (b *ConfigBuilder) Logging(enabled bool) *ConfigBuilder {
+	b.config.SetLogging(enabled)
+	return b
+}
+
+// Metrics is to set if metrics are enabled.
+func (b *ConfigBuilder) Metrics(enabled bool) *ConfigBuilder {
+	b.config.SetMetrics(enabled)
+	return b
+}
+
+// Build is to validate the fields together and return the Config, or ConfigErrors with all violations.
+func (b *ConfigBuilder) Build() (*Config, error) {
+	errs := append(ConfigErrors{}, b.errs...)
+	c := b.config
+
+	if region := c.values.Get("region"); region == "" {
+		if !errs.Is(ErrConfigRegion) {
+			errs = append(errs, ErrConfigRegion)
+		}
+	} else if _, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); !ok {
+		errs = append(errs, fmt.Errorf("%w: unknown region %q", ErrConfigRegion, region))
+	}
+	if c.dsn.Host == "" {
+		if !errs.Is(ErrConfigOutputLocation) {
+			errs = append(errs, ErrConfigOutputLocation)
+		}
+	} else if !reBucketName.MatchString(c.dsn.Host) || strings.Contains(c.dsn.Host, "..") {
+		errs = append(errs, fmt.Errorf("%w: invalid bucket name %q", ErrConfigOutputLocation, c.dsn.Host))
+	}
+	if c.IsMissingAsEmptyString() && c.IsMissingAsDefault() {
+		errs = append(errs, errors.New("missingAsEmptyString and missingAsDefault are exclusive"))
+	}
+	if c.IsMissingAsNil() && (c.IsMissingAsEmptyString() || c.IsMissingAsDefault()) {
+		errs = append(errs, errors.New("missingAsNil is exclusive with missingAsEmptyString and missingAsDefault"))
+	}
+	if wg := c.GetWorkgroup(); wg.Name != "" && wg.Name != DefaultWGName && c.IsMoneyWise() &&
+		!c.IsWGRemoteCreationAllowed() {
+		errs = append(errs, fmt.Errorf("moneywise mode needs workgroup remote creation for workgroup %q, "+
+			"so the bytes scanned cutoff of the workgroup config is enforced", wg.Name))
+	}
+	if c.values.Get("accessID") != "" && c.GetCredentialsMode() != CredentialsModeDefault {
+		errs = append(errs, fmt.Errorf("static credentials conflict with credentials mode %q",
+			c.GetCredentialsMode()))
+	}
+	if c.GetEndpoint() != "" && c.IsFIPSEndpoint() {
+		errs = append(errs, errors.New("a custom endpoint overrides the FIPS endpoint"))
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigBuilder_Build(t *testing.T) {
+	config, err := NewConfigBuilder().
+		Region("us-west-2").
+		OutputBucket("s3://query-results-bucket/athena").
+		Database("sampledb").
+		ReadOnly(true).
+		PollInterval(500 * time.Millisecond).
+		Build()
+	assert.Nil(t, err)
+	assert.Equal(t, "us-west-2", config.GetRegion())
+	assert.Equal(t, "s3://query-results-bucket/athena", config.GetOutputBucket())
+	assert.Equal(t, "sampledb", config.GetDB())
+	assert.True(t, config.IsReadOnly())
+	assert.True(t, config.IsMissingAsEmptyString())
+	assert.True(t, config.IsWGRemoteCreationAllowed())
+	assert.Equal(t, 500*time.Millisecond, config.GetPollInterval())
+}
+
+func TestConfigBuilder_Build_Required(t *testing.T) {
+	_, err := NewConfigBuilder().Build()
+	var errs ConfigErrors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 2)
+	assert.True(t, errors.Is(err, ErrConfigRegion))
+	assert.True(t, errors.Is(err, ErrConfigOutputLocation))
+}
+
+func TestConfigBuilder_MissingAsNil(t *testing.T) {
+	config, err := NewConfigBuilder().Region("us-east-1").OutputBucket("s3://bucket/path").MissingAsNil(true).Build()
+	assert.Nil(t, err)
+	assert.True(t, config.IsMissingAsNil())
+	assert.False(t, config.IsMissingAsEmptyString())
+
+	_, err = NewConfigBuilder().Region("us-east-1").OutputBucket("s3://bucket/path").
+		MissingAsNil(true).MissingAsDefault(true).Build()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "missingAsNil is exclusive")
+}
+
+func TestConfigBuilder_Build_AllViolations(t *testing.T) {
+	_, err := NewConfigBuilder().
+		Region("mars-central-1").
+		OutputBucket("s3://Invalid_Bucket/path").
+		MissingAsDefault(true).
+		Workgroup(NewWG("etl", nil, nil)).
+		MoneyWise(true).
+		WGRemoteCreationAllowed(false).
+		CredentialsMode(CredentialsModeSSO).
+		Credentials("AKIAEXAMPLE", "secret", "").
+		Endpoint("https://athena.example.com").
+		FIPSEndpoint(true).
+		PollInterval(0).
+		Build()
+	var errs ConfigErrors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 7)
+	assert.Contains(t, err.Error(), `unknown region "mars-central-1"`)
+	assert.Contains(t, err.Error(), `invalid bucket name "Invalid_Bucket"`)
+	assert.Contains(t, err.Error(), "exclusive")
+	assert.Contains(t, err.Error(), "moneywise")
+	assert.Contains(t, err.Error(), `credentials mode "sso"`)
+	assert.Contains(t, err.Error(), "FIPS")
+	assert.Contains(t, err.Error(), "poll interval")
+}
+
+func TestConfigBuilder_Build_SetterErrors(t *testing.T) {
+	_, err := NewConfigBuilder().
+		Region("").
+		OutputBucket("query-results-bucket").
+		Credentials("", "", "").
+		Workgroup(nil).
+		Build()
+	var errs ConfigErrors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 5)
+	assert.True(t, errors.Is(err, ErrConfigRegion))
+	assert.True(t, errors.Is(err, ErrConfigOutputLocation))
+	assert.True(t, errors.Is(err, ErrConfigAccessIDRequired))
+	assert.True(t, errors.Is(err, ErrConfigAccessKeyRequired))
+	assert.True(t, errors.Is(err, ErrConfigWGPointer))
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of environment variables overriding Config.
+const EnvPrefix = "ATHENADRIVER_"
+
+// envOverride is an environment variable overriding a Config field.
+type envOverride struct {
+	name  string
+	apply func(c *Config, val string) error
+}
+
+// envOverrides are all environment variables applied by NewConfig after parsing the DSN:
+//
+//	ATHENADRIVER_REGION                     region
+//	ATHENADRIVER_OUTPUT_BUCKET              output bucket, s3://bucket/path
+//	ATHENADRIVER_WG_OUTPUT_BUCKETS          output buckets of workgroups, like etl=s3://etl/,adhoc=s3://adhoc/
+//	ATHENADRIVER_WORKGROUP                  workgroup name
+//	ATHENADRIVER_DB                         database
+//	ATHENADRIVER_DATASOURCE                 data catalog
+//	ATHENADRIVER_AWS_PROFILE                AWS profile
+//	ATHENADRIVER_CREDENTIALS_MODE           credentials mode: sso, webIdentity or sharedConfig
+//	ATHENADRIVER_ROLE_ARN                   IAM role to assume
+//	ATHENADRIVER_EXTERNAL_ID                external ID of the IAM role
+//	ATHENADRIVER_ROLE_SESSION_NAME          session name of the IAM role
+//	ATHENADRIVER_SOURCE_IDENTITY            source identity of the IAM role session
+//	ATHENADRIVER_MFA_SERIAL                 MFA device of the IAM role
+//	ATHENADRIVER_STS_REGIONAL_ENDPOINT      true to use regional STS endpoints
+//	ATHENADRIVER_EC2_METADATA_DISABLED      true to never get credentials from EC2 instance metadata
+//	ATHENADRIVER_CREDENTIAL_REFRESH_WINDOW  duration, like 5m
+//	ATHENADRIVER_ENDPOINT                   custom Athena endpoint URL
+//	ATHENADRIVER_USE_FIPS_ENDPOINT          true to use FIPS endpoints
+//	ATHENADRIVER_USE_DUALSTACK_ENDPOINT     true to use dual-stack endpoints
+//	ATHENADRIVER_FALLBACK_REGIONS           comma separated regions
+//	ATHENADRIVER_HTTP_PROXY                 proxy URL
+//	ATHENADRIVER_HTTP_CONNECT_TIMEOUT       duration
+//	ATHENADRIVER_HTTP_TIMEOUT               duration
+//	ATHENADRIVER_HTTP_MAX_IDLE_CONNS        integer
+//	ATHENADRIVER_PING_PROBE                 getWorkGroup, listDataCatalogs or query
+//	ATHENADRIVER_POLL_INTERVAL              duration, like 500ms
+//	ATHENADRIVER_POLL_MAX_INTERVAL          duration, like 10s
+//	ATHENADRIVER_POLL_MODE                  backoff or fixed
+//	ATHENADRIVER_FEDERATED_POLL_INTERVAL    duration, like 2s
+//	ATHENADRIVER_QUERY_TIMEOUT              duration, like 15m
+//	ATHENADRIVER_QUERY_RETRY_ATTEMPTS       integer, max runs of a query failing transiently
+//	ATHENADRIVER_QUERY_RETRY_BACKOFF        duration, like 1s
+//	ATHENADRIVER_MAX_SCANNED_BYTES          integer, in bytes
+//	ATHENADRIVER_SLOW_QUERY_THRESHOLD       duration, like 1m
+//	ATHENADRIVER_SLOW_QUERY_SAMPLE_RATE     fraction of the slow queries logged, like 0.1
+//	ATHENADRIVER_MAX_CONCURRENT_QUERIES     integer
+//	ATHENADRIVER_CONCURRENCY_PER_WORKGROUP  true to limit concurrent queries by workgroup
+//	ATHENADRIVER_PRIORITY_AGING             duration, like 30s
+//	ATHENADRIVER_START_QUERY_RATE           StartQueryExecution calls per second, like 5
+//	ATHENADRIVER_START_QUERY_BURST          integer
+//	ATHENADRIVER_GET_QUERY_RESULTS_RATE     GetQueryResults calls per second
+//	ATHENADRIVER_GET_QUERY_RESULTS_BURST    integer
+//	ATHENADRIVER_QUERY_EVENTS_QUEUE         SQS queue URL of Athena query state change events
+//	ATHENADRIVER_QUERY_DEDUPLICATION        true to deduplicate queries by client request token
+//	ATHENADRIVER_QUERY_DEDUPLICATION_WINDOW duration, like 15m
+//	ATHENADRIVER_QUERY_ANNOTATION           text/template of the query comment, like DefaultQueryAnnotation
+//	ATHENADRIVER_QUERY_LABELS               labels of the query annotation, like team=data,service=api
+//	ATHENADRIVER_MULTI_STATEMENTS           true to run scripts of statements in ExecContext
+//	ATHENADRIVER_QUERY_STAGING              true to stage the WITH subqueries of queries too long in tables
+//	ATHENADRIVER_TRANSACTION_EMULATION      true to emulate transactions with Iceberg staging tables
+//	ATHENADRIVER_TX_TIMEOUT                 duration, like 10m
+//	ATHENADRIVER_FAKE_TRANSACTIONS          true for transactions which don't do anything
+//	ATHENADRIVER_MIGRATION_MODE             true to run the migrations of golang-migrate or goose
+//	ATHENADRIVER_PARTITION_GUARD            warn or strict, for SELECTs without a partition filter
+//	ATHENADRIVER_RESULT_PREFETCH            integer, pages fetched ahead
+//	ATHENADRIVER_RESULT_MODE                API, DL or UNLOAD
+//	ATHENADRIVER_RAGGED_ROW_POLICY          error, pad or skip
+//	ATHENADRIVER_RESULT_COMPRESSION         true to gzip compress unloaded results
+//	ATHENADRIVER_RESULT_CLEANUP             true to delete the result objects when Rows is closed
+//	ATHENADRIVER_RESULT_ENCRYPTION          SSE_S3, SSE_KMS or CSE_KMS
+//	ATHENADRIVER_RESULT_KMS_KEY             KMS key ARN or ID of the result encryption
+//	ATHENADRIVER_RESULT_BUCKET_OWNER        12-digit AWS account ID of the result buckets
+//	ATHENADRIVER_RESULT_ACL                 BUCKET_OWNER_FULL_CONTROL
+//	ATHENADRIVER_RESULT_REQUESTER_PAYS      true if the requester pays for the requests on the result objects
+//	ATHENADRIVER_RESULT_S3_ROLE_ARN         IAM role to assume to access the result objects
+//	ATHENADRIVER_RESULT_S3_EXTERNAL_ID      external ID of the IAM role of the result objects
+//	ATHENADRIVER_RESULT_REGION_DETECTION    true to look up the region of the result buckets
+//	ATHENADRIVER_RESULT_CACHE_TTL           duration, like 1m, of the rows in the result cache
+//	ATHENADRIVER_RESULT_CACHE_MAX_ROWS      integer
+//	ATHENADRIVER_RESULT_TTL                 duration, like 24h, of the result objects in the output location
+//	ATHENADRIVER_DOWNLOAD_CONCURRENCY       integer
+//	ATHENADRIVER_DOWNLOAD_PART_SIZE         integer, in bytes
+//	ATHENADRIVER_DECIMAL_MODE               string or bigRat
+//	ATHENADRIVER_RAW_COMPLEX_TYPES          true to return array, map and row values as text
+//	ATHENADRIVER_SESSION_TIME_ZONE          time zone of values without time zone, like UTC
+//	ATHENADRIVER_RAW_BINARY                 true to return varbinary values as hex text
+//	ATHENADRIVER_UNMARSHAL_JSON             true to unmarshal json values into interface{}
+//	ATHENADRIVER_GEOMETRY_WKB               true to return geometry values as WKB
+//	ATHENADRIVER_READ_ONLY                  true or false
+//	ATHENADRIVER_MONEY_WISE                 true or false
+//	ATHENADRIVER_REDACT_QUERIES             true to mask the literals of the queries logged
+//	ATHENADRIVER_LOGGING                    true or false
+//	ATHENADRIVER_METRICS                    true or false
+//	ATHENADRIVER_MISSING_AS_EMPTY_STRING    true or false
+//	ATHENADRIVER_MISSING_AS_DEFAULT         true or false
+//	ATHENADRIVER_MISSING_AS_NIL             true or false
+//	ATHENADRIVER_WG_REMOTE_CREATION         true or false
+//	ATHENADRIVER_WG_BYTES_SCANNED_CUTOFF    integer, in bytes, of the workgroups created remotely
+//	ATHENADRIVER_WG_ENFORCE_CONFIGURATION   true or false
+//	ATHENADRIVER_WG_PUBLISH_CLOUDWATCH      true or false
+//	ATHENADRIVER_WG_ENGINE_VERSION          like Athena engine version 3
+//	ATHENADRIVER_ENGINE_VERSION_CHECK       true to check the engine version of the workgroup at Connect
+//	ATHENADRIVER_CAPACITY_REQUIRED          true to run queries only on provisioned capacity
+//	ATHENADRIVER_METADATA_API               true to run SHOW SCHEMAS and SHOW TABLES with the metadata API
+//	ATHENADRIVER_LAKE_FORMATION_PREFLIGHT   true to check Lake Formation permissions before queries
+//	ATHENADRIVER_WG_ENCRYPTION              SSE_S3, SSE_KMS or CSE_KMS
+//	ATHENADRIVER_WG_KMS_KEY                 KMS key ARN or ID of the workgroup encryption
+//	ATHENADRIVER_WG_RECONCILE               update or strict, for existing workgroups which drifted
+//
+// AWS credentials are not overridden here, the standard AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are
+// used for them.
+var envOverrides = []envOverride{
+	{"REGION", func(c *Config, val string) error { return c.SetRegion(val) }},
+	{"OUTPUT_BUCKET", func(c *Config, val string) error { return c.SetOutputBucket(val) }},
+	{"WG_OUTPUT_BUCKETS", func(c *Config, val string) error { return c.SetWGOutputBuckets(decodeKeyValues(val)) }},
+	{"WORKGROUP", envString("workgroupName")},
+	{"DB", envString("db")},
+	{"DATASOURCE", envString("datasource")},
+	{"AWS_PROFILE", envString("AWSProfile")},
+	{"CREDENTIALS_MODE", envString("credentialsMode")},
+	{"ROLE_ARN", envString("roleARN")},
+	{"EXTERNAL_ID", envString("externalID")},
+	{"ROLE_SESSION_NAME", envString("roleSessionName")},
+	{"SOURCE_IDENTITY", envString("sourceIdentity")},
+	{"MFA_SERIAL", envString("mfaSerial")},
+	{"STS_REGIONAL_ENDPOINT", envBool("stsRegionalEndpoint")},
+	{"EC2_METADATA_DISABLED", envBool("ec2MetadataDisabled")},
+	{"CREDENTIAL_REFRESH_WINDOW", envDuration("credentialRefreshWindow")},
+	{"ENDPOINT", func(c *Config, val string) error { return c.SetEndpoint(val) }},
+	{"USE_FIPS_ENDPOINT", envBool("useFIPSEndpoint")},
+	{"USE_DUALSTACK_ENDPOINT", envBool("useDualStackEndpoint")},
+	{"FALLBACK_REGIONS", envString("fallbackRegions")},
+	{"HTTP_PROXY", func(c *Config, val string) error { return c.SetHTTPProxy(val) }},
+	{"HTTP_CONNECT_TIMEOUT", envDuration("httpConnectTimeout")},
+	{"HTTP_TIMEOUT", envDuration("httpTimeout")},
+	{"HTTP_MAX_IDLE_CONNS", envInt("httpMaxIdleConns")},
+	{"PING_PROBE", envString("pingProbe")},
+	{"POLL_INTERVAL", envDuration("pollInterval")},
+	{"POLL_MAX_INTERVAL", envDuration("pollMaxInterval")},
+	{"POLL_MODE", envString("pollMode")},
+	{"FEDERATED_POLL_INTERVAL", envDuration("federatedPollInterval")},
+	{"QUERY_TIMEOUT", envDuration("queryTimeout")},
+	{"QUERY_RETRY_ATTEMPTS", envInt("queryRetryAttempts")},
+	{"QUERY_RETRY_BACKOFF", envDuration("queryRetryBackoff")},
+	{"MAX_SCANNED_BYTES", envInt("maxScannedBytes")},
+	{"SLOW_QUERY_THRESHOLD", envDuration("slowQueryThreshold")},
+	{"SLOW_QUERY_SAMPLE_RATE", envFloat("slowQuerySampleRate")},
+	{"MAX_CONCURRENT_QUERIES", envInt("maxConcurrentQueries")},
+	{"CONCURRENCY_PER_WORKGROUP", envBool("maxConcurrentQueriesPerWorkgroup")},
+	{"PRIORITY_AGING", envDuration("priorityAging")},
+	{"START_QUERY_RATE", envFloat("startQueryRate")},
+	{"START_QUERY_BURST", envInt("startQueryBurst")},
+	{"GET_QUERY_RESULTS_RATE", envFloat("getQueryResultsRate")},
+	{"GET_QUERY_RESULTS_BURST", envInt("getQueryResultsBurst")},
+	{"QUERY_EVENTS_QUEUE", envString("queryEventsQueue")},
+	{"QUERY_DEDUPLICATION", envBool("queryDeduplication")},
+	{"QUERY_DEDUPLICATION_WINDOW", envDuration("queryDeduplicationWindow")},
+	{"QUERY_ANNOTATION", func(c *Config, val string) error { return c.SetQueryAnnotation(val) }},
+	{"QUERY_LABELS", envString("queryLabels")},
+	{"MULTI_STATEMENTS", envBool("multiStatements")},
+	{"QUERY_STAGING", envBool("queryStaging")},
+	{"TRANSACTION_EMULATION", envBool("transactionEmulation")},
+	{"TX_TIMEOUT", envDuration("txTimeout")},
+	{"FAKE_TRANSACTIONS", envBool("fakeTransactions")},
+	{"MIGRATION_MODE", envBool("migrationMode")},
+	{"PARTITION_GUARD", envString("partitionGuard")},
+	{"RESULT_PREFETCH", envInt("resultPrefetch")},
+	{"RESULT_MODE", envString("resultMode")},
+	{"RAGGED_ROW_POLICY", envString("raggedRowPolicy")},
+	{"RESULT_COMPRESSION", envBool("resultCompression")},
+	{"RESULT_CLEANUP", envBool("resultCleanup")},
+	{"RESULT_TTL", envDuration("resultTTL")},
+	{"RESULT_CACHE_TTL", envDuration("resultCacheTTL")},
+	{"RESULT_CACHE_MAX_ROWS", envInt("resultCacheMaxRows")},
+	{"RESULT_ENCRYPTION", envString("resultEncryption")},
+	{"RESULT_BUCKET_OWNER", envString("resultBucketOwner")},
+	{"RESULT_ACL", envString("resultACL")},
+	{"RESULT_REQUESTER_PAYS", envBool("resultRequesterPays")},
+	{"RESULT_S3_ROLE_ARN", envString("resultS3RoleARN")},
+	{"RESULT_S3_EXTERNAL_ID", envString("resultS3ExternalID")},
+	{"RESULT_REGION_DETECTION", envBool("resultBucketRegionDetection")},
+	{"RESULT_KMS_KEY", envString("resultKMSKey")},
+	{"DOWNLOAD_CONCURRENCY", envInt("downloadConcurrency")},
+	{"DOWNLOAD_PART_SIZE", envInt("downloadPartSize")},
+	{"DECIMAL_MODE", envString("decimalMode")},
+	{"RAW_COMPLEX_TYPES", envBool("rawComplexTypes")},
+	{"SESSION_TIME_ZONE", func(c *Config, val string) error { return c.SetSessionTimeZone(val) }},
+	{"RAW_BINARY", envBool("rawBinary")},
+	{"UNMARSHAL_JSON", envBool("unmarshalJSON")},
+	{"GEOMETRY_WKB", envBool("geometryWKB")},
+	{"READ_ONLY", envBool("ReadOnly")},
+	{"MONEY_WISE", envBool("MoneyWise")},
+	{"REDACT_QUERIES", envBool("redactQueries")},
+	{"LOGGING", envBool("LoggingEnabled")},
+	{"METRICS", envBool("MetricsEnabled")},
+	{"MISSING_AS_EMPTY_STRING", envBool("missingAsEmptyString")},
+	{"MISSING_AS_DEFAULT", envBool("missingAsDefault")},
+	{"MISSING_AS_NIL", envBool("missingAsNil")},
+	{"WG_REMOTE_CREATION", envBool("WGRemoteCreation")},
+	{"WG_BYTES_SCANNED_CUTOFF", envInt("wgBytesScannedCutoff")},
+	{"WG_ENFORCE_CONFIGURATION", envBool("wgEnforceConfiguration")},
+	{"WG_PUBLISH_CLOUDWATCH", envBool("wgPublishCloudWatchMetrics")},
+	{"WG_ENGINE_VERSION", envString("wgEngineVersion")},
+	{"ENGINE_VERSION_CHECK", envBool("engineVersionCheck")},
+	{"CAPACITY_REQUIRED", envBool("capacityRequired")},
+	{"METADATA_API", envBool("metadataAPI")},
+	{"LAKE_FORMATION_PREFLIGHT", envBool("lakeFormationPreflight")},
+	{"WG_ENCRYPTION", envString("wgEncryption")},
+	{"WG_KMS_KEY", envString("wgKMSKey")},
+	{"WG_RECONCILE", envString("wgReconcile")},
+}
+
+// applyEnvOverrides is to override Config with the ATHENADRIVER_* environment variables which are set.
+// The precedence is: setters called after NewConfig > environment variables > DSN.
+func (c *Config) applyEnvOverrides() error {
+	for _, o := range envOverrides {
+		val, ok := os.LookupEnv(EnvPrefix + o.name)
+		if !ok {
+			continue
+		}
+		if err := o.apply(c, val); err != nil {
+			return fmt.Errorf("invalid %s%s %q: %w", EnvPrefix, o.name, val, err)
+		}
+	}
+	return nil
+}
+
+func envString(key string) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		c.values.Set(key, val)
+		return nil
+	}
+}
+
+func envBool(key string) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		c.values.Set(key, strconv.FormatBool(b))
+		return nil
+	}
+}
+
+func envDuration(key string) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		c.setDuration(key, d)
+		return nil
+	}
+}
+
+func envInt(key string) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil {
+			return err
+		}
+		c.values.Set(key, strconv.Itoa(n))
+		return nil
+	}
+}
+
+func envFloat(key string) func(c *Config, val string) error {
+	return func(c *Config, val string) error {
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return err
+		}
+		c.values.Set(key, strconv.FormatFloat(f, 'f', -1, 64))
+		return nil
+	}
+}
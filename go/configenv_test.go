@@ -0,0 +1,186 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setEnvForTest(t *testing.T, env map[string]string) {
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	t.Cleanup(func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestNewConfig_EnvOverrides(t *testing.T) {
+	setEnvForTest(t, map[string]string{
+		"ATHENADRIVER_REGION":                     "eu-west-1",
+		"ATHENADRIVER_OUTPUT_BUCKET":              "s3://env-bucket/results",
+		"ATHENADRIVER_WORKGROUP":                  "env_wg",
+		"ATHENADRIVER_DB":                         "env_db",
+		"ATHENADRIVER_AWS_PROFILE":                "env-profile",
+		"ATHENADRIVER_CREDENTIALS_MODE":           "sharedConfig",
+		"ATHENADRIVER_ROLE_ARN":                   "arn:aws:iam::123456789012:role/env",
+		"ATHENADRIVER_STS_REGIONAL_ENDPOINT":      "1",
+		"ATHENADRIVER_EC2_METADATA_DISABLED":      "true",
+		"ATHENADRIVER_CREDENTIAL_REFRESH_WINDOW":  "5m",
+		"ATHENADRIVER_ENDPOINT":                   "https://vpce.example.com",
+		"ATHENADRIVER_USE_FIPS_ENDPOINT":          "true",
+		"ATHENADRIVER_FALLBACK_REGIONS":           "us-west-2,us-east-2",
+		"ATHENADRIVER_HTTP_PROXY":                 "http://proxy:3128",
+		"ATHENADRIVER_HTTP_CONNECT_TIMEOUT":       "2s",
+		"ATHENADRIVER_HTTP_TIMEOUT":               "1m",
+		"ATHENADRIVER_HTTP_MAX_IDLE_CONNS":        "16",
+		"ATHENADRIVER_PING_PROBE":                 "listDataCatalogs",
+		"ATHENADRIVER_POLL_INTERVAL":              "500ms",
+		"ATHENADRIVER_READ_ONLY":                  "true",
+		"ATHENADRIVER_MONEY_WISE":                 "true",
+		"ATHENADRIVER_MISSING_AS_EMPTY_STRING":    "false",
+		"ATHENADRIVER_WG_REMOTE_CREATION":         "false",
+		"ATHENADRIVER_WG_OUTPUT_BUCKETS":          "etl=s3://etl/results/,adhoc=s3://adhoc/",
+		"ATHENADRIVER_ENGINE_VERSION_CHECK":       "true",
+		"ATHENADRIVER_CAPACITY_REQUIRED":          "true",
+		"ATHENADRIVER_METADATA_API":               "true",
+		"ATHENADRIVER_FEDERATED_POLL_INTERVAL":    "7s",
+		"ATHENADRIVER_LAKE_FORMATION_PREFLIGHT":   "true",
+		"ATHENADRIVER_RESULT_CLEANUP":             "true",
+		"ATHENADRIVER_RESULT_TTL":                 "24h",
+		"ATHENADRIVER_RESULT_CACHE_TTL":           "1m",
+		"ATHENADRIVER_RESULT_CACHE_MAX_ROWS":      "100",
+		"ATHENADRIVER_QUERY_STAGING":              "true",
+		"ATHENADRIVER_TRANSACTION_EMULATION":      "true",
+		"ATHENADRIVER_TX_TIMEOUT":                 "10m",
+		"ATHENADRIVER_QUERY_DEDUPLICATION_WINDOW": "1h",
+		"ATHENADRIVER_FAKE_TRANSACTIONS":          "true",
+		"ATHENADRIVER_MIGRATION_MODE":             "true",
+		"ATHENADRIVER_PARTITION_GUARD":            "strict",
+		"ATHENADRIVER_RESULT_ENCRYPTION":          "SSE_KMS",
+		"ATHENADRIVER_RESULT_KMS_KEY":             "arn:aws:kms:us-east-1:1:key/k",
+		"ATHENADRIVER_RESULT_BUCKET_OWNER":        "123456789012",
+		"ATHENADRIVER_RESULT_ACL":                 "BUCKET_OWNER_FULL_CONTROL",
+		"ATHENADRIVER_RESULT_REQUESTER_PAYS":      "true",
+		"ATHENADRIVER_RESULT_S3_ROLE_ARN":         "arn:aws:iam::123456789012:role/results",
+		"ATHENADRIVER_RESULT_S3_EXTERNAL_ID":      "ext",
+		"ATHENADRIVER_RESULT_REGION_DETECTION":    "true",
+	})
+	conf, err := NewConfig("s3://dsn-bucket/?region=us-east-1&db=dsn_db&workgroupName=dsn_wg&MoneyWise=false")
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-west-1", conf.GetRegion())
+	assert.Equal(t, "s3://env-bucket/results", conf.GetOutputBucket())
+	assert.Equal(t, "env_wg", conf.GetWorkgroup().Name)
+	assert.Equal(t, "env_db", conf.GetDB())
+	assert.Equal(t, "env-profile", conf.GetAWSProfile())
+	assert.Equal(t, CredentialsModeSharedConfig, conf.GetCredentialsMode())
+	assert.Equal(t, "arn:aws:iam::123456789012:role/env", conf.GetRoleARN())
+	assert.True(t, conf.IsSTSRegionalEndpoint())
+	assert.True(t, conf.IsEC2MetadataDisabled())
+	assert.Equal(t, 5*time.Minute, conf.GetCredentialRefreshWindow())
+	assert.Equal(t, "https://vpce.example.com", conf.GetEndpoint())
+	assert.True(t, conf.IsFIPSEndpoint())
+	assert.Equal(t, []string{"us-west-2", "us-east-2"}, conf.GetFallbackRegions())
+	assert.Equal(t, "http://proxy:3128", conf.GetHTTPProxy())
+	assert.Equal(t, 2*time.Second, conf.GetHTTPConnectTimeout())
+	assert.Equal(t, time.Minute, conf.GetHTTPTimeout())
+	assert.Equal(t, 16, conf.GetHTTPMaxIdleConns())
+	assert.Equal(t, PingProbeListDataCatalogs, conf.GetPingProbe())
+	assert.Equal(t, 500*time.Millisecond, conf.GetPollInterval())
+	assert.True(t, conf.IsReadOnly())
+	assert.True(t, conf.IsMoneyWise())
+	assert.False(t, conf.IsMissingAsEmptyString())
+	assert.False(t, conf.IsWGRemoteCreationAllowed())
+	assert.Equal(t, map[string]string{"etl": "s3://etl/results/", "adhoc": "s3://adhoc/"}, conf.GetWGOutputBuckets())
+	assert.True(t, conf.IsEngineVersionCheck())
+	assert.True(t, conf.IsCapacityRequired())
+	assert.True(t, conf.IsMetadataAPI())
+	assert.Equal(t, 7*time.Second, conf.GetFederatedPollInterval())
+	assert.True(t, conf.IsLakeFormationPreflight())
+	assert.True(t, conf.IsResultCleanup())
+	assert.Equal(t, 24*time.Hour, conf.GetResultTTL())
+	option, kmsKey := conf.GetResultEncryption()
+	assert.Equal(t, "SSE_KMS", option)
+	assert.Equal(t, "arn:aws:kms:us-east-1:1:key/k", kmsKey)
+	assert.Equal(t, "123456789012", conf.GetResultBucketOwner())
+	assert.Equal(t, "BUCKET_OWNER_FULL_CONTROL", conf.GetResultACL())
+	assert.True(t, conf.IsResultRequesterPays())
+	roleARN, externalID := conf.GetResultS3Role()
+	assert.Equal(t, "arn:aws:iam::123456789012:role/results", roleARN)
+	assert.Equal(t, "ext", externalID)
+	assert.True(t, conf.IsResultBucketRegionDetection())
+	assert.Equal(t, time.Minute, conf.GetResultCacheTTL())
+	assert.Equal(t, 100, conf.GetResultCacheMaxRows())
+	assert.True(t, conf.IsQueryStaging())
+	assert.True(t, conf.IsTransactionEmulation())
+	assert.Equal(t, 10*time.Minute, conf.GetTxTimeout())
+	assert.Equal(t, time.Hour, conf.GetQueryDeduplicationWindow())
+	assert.True(t, conf.IsFakeTransactions())
+	assert.True(t, conf.IsMigrationMode())
+	assert.Equal(t, PartitionGuardStrict, conf.GetPartitionGuardMode())
+
+	// setters called after NewConfig take precedence
+	conf.SetDB("code_db")
+	assert.Equal(t, "code_db", conf.GetDB())
+
+	conf, err = NewConfig("awsathena://us-east-1/uri-bucket?db=uri_db")
+	assert.Nil(t, err)
+	assert.Equal(t, "env_db", conf.GetDB())
+	assert.Equal(t, "s3://env-bucket/results", conf.GetOutputBucket())
+}
+
+func TestNewConfig_EnvOverrides_Invalid(t *testing.T) {
+	dsn := "s3://bucket/?region=us-east-1"
+	for name, val := range map[string]string{
+		"ATHENADRIVER_OUTPUT_BUCKET":       "bucket",
+		"ATHENADRIVER_READ_ONLY":           "yes please",
+		"ATHENADRIVER_POLL_INTERVAL":       "3",
+		"ATHENADRIVER_HTTP_MAX_IDLE_CONNS": "many",
+		"ATHENADRIVER_ENDPOINT":            "vpce.example.com",
+		"ATHENADRIVER_WG_OUTPUT_BUCKETS":   "etl=bucket",
+	} {
+		os.Setenv(name, val)
+		_, err := NewConfig(dsn)
+		os.Unsetenv(name)
+		assert.NotNil(t, err, name)
+		assert.Contains(t, err.Error(), name)
+	}
+	os.Setenv("ATHENADRIVER_REGION", "")
+	defer os.Unsetenv("ATHENADRIVER_REGION")
+	_, err := NewConfig(dsn)
+	assert.True(t, errors.Is(err, ErrConfigRegion))
+}
+
+func TestConfig_SetPollInterval(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, PoolInterval*time.Second, testConf.GetPollInterval())
+	testConf.SetPollInterval(200 * time.Millisecond)
+	assert.Equal(t, 200*time.Millisecond, testConf.GetPollInterval())
+	testConf.SetPollInterval(0)
+	assert.Equal(t, PoolInterval*time.Second, testConf.GetPollInterval())
+}
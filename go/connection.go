@@ -22,17 +22,24 @@ package athenadriver
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"github.com/aws/aws-sdk-go/service/lakeformation/lakeformationiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -43,8 +50,36 @@ import (
 // Connection is assumed to be stateful.
 type Connection struct {
 	athenaAPI athenaiface.AthenaAPI
+	// s3API is nil when only an Athena client is passed to NewConnectorWithClient.
+	s3API     s3iface.S3API
+	fallbacks []regionalAthenaAPI
 	connector *SQLConnector
 	numInput  int
+
+	// credentialsRejected is set once Athena rejects the credentials of the connection.
+	credentialsRejected bool
+	// preparedStatements are the names of the server-side prepared statements created by the connection.
+	preparedStatements map[string]bool
+	// cost is the cost of the queries run by the connection.
+	cost CostTotals
+	// lastStats are the stats of the last query execution complete, for the Hooks.
+	lastStats *QueryStats
+	// engineVersion is the major effective engine version of the workgroup engineVersionWG of Config,
+	// 0 if unknown.
+	engineVersion   int
+	engineVersionWG string
+	// lakeFormationAPI and stsAPI are set when Config enables the Lake Formation preflight, and the clients
+	// are not passed to NewConnectorWithClient.
+	lakeFormationAPI lakeformationiface.LakeFormationAPI
+	stsAPI           stsiface.STSAPI
+	// lakeFormationPrincipal, lakeFormationGoverned and lakeFormationTables are cached by the preflight.
+	lakeFormationPrincipal string
+	lakeFormationGoverned  *bool
+	lakeFormationTables    map[string]bool
+	// partitionKeys are the partition keys of the tables, cached by the partition guard.
+	partitionKeys map[string][]string
+	// tx is the transaction in progress, if it's emulated with staging tables.
+	tx *emulatedTx
 }
 
 func (c *Connection) interpolateParams(query string, args []driver.Value) (string, error) {
@@ -135,11 +170,11 @@ func (c *Connection) interpolateParams(query string, args []driver.Value) (strin
 			}
 		case []byte:
 			queryBuffer = append(queryBuffer, "_binary'"...)
-			queryBuffer = escapeBytesBackslash(queryBuffer, v)
+			queryBuffer = escapeBytesQuotes(queryBuffer, v)
 			queryBuffer = append(queryBuffer, '\'')
 		case string:
 			queryBuffer = append(queryBuffer, '\'')
-			queryBuffer = escapeStringBackslash(queryBuffer, v)
+			queryBuffer = escapeStringQuotes(queryBuffer, v)
 			queryBuffer = append(queryBuffer, '\'')
 		default:
 			return "", ErrQueryUnknownType
@@ -152,6 +187,41 @@ func (c *Connection) interpolateParams(query string, args []driver.Value) (strin
 	return string(queryBuffer), nil
 }
 
+// executionParameters is to convert args to the SQL literals Athena substitutes for the ? placeholders
+// of the query server-side, instead of interpolating them into the query.
+func (c *Connection) executionParameters(query string, args []driver.Value) ([]*string, error) {
+	c.numInput = len(args)
+	if strings.Count(query, "?") != c.numInput {
+		return nil, ErrInvalidQuery
+	}
+	params := make([]*string, 0, len(args))
+	for _, arg := range args {
+		var param string
+		switch v := arg.(type) {
+		case nil:
+			param = "NULL"
+		case int64:
+			param = strconv.FormatInt(v, 10)
+		case uint64:
+			param = strconv.FormatUint(v, 10)
+		case float64:
+			param = strconv.FormatFloat(v, 'g', -1, 64)
+		case bool:
+			param = strconv.FormatBool(v)
+		case time.Time:
+			param = "TIMESTAMP '" + v.In(time.UTC).Format(TimestampUniXFormat) + "'"
+		case []byte:
+			param = "X'" + hex.EncodeToString(v) + "'"
+		case string:
+			param = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		default:
+			return nil, ErrQueryUnknownType
+		}
+		params = append(params, aws.String(param))
+	}
+	return params, nil
+}
+
 // CheckNamedValue is to implement interface driver.NamedValueChecker.
 func (c *Connection) CheckNamedValue(nv *driver.NamedValue) (err error) {
 	nv.Value, err = driver.DefaultParameterConverter.ConvertValue(nv.Value)
@@ -160,36 +230,70 @@ func (c *Connection) CheckNamedValue(nv *driver.NamedValue) (err error) {
 
 // ExecContext executes a query that doesn't return rows, such as an INSERT or UPDATE.
 func (c *Connection) ExecContext(ctx context.Context, query string, namedArgs []driver.NamedValue) (driver.Result, error) {
-	var obs = c.connector.tracer
-	var err error
+	var obs = c.queryTracer(ctx)
+	query, namedArgs, err := bindNamedArgs(query, namedArgs)
+	if err != nil {
+		return nil, err
+	}
 	args := namedValueToValue(namedArgs)
-	if len(namedArgs) > 0 {
+	// with execution parameters, args are passed on to Athena by QueryContext
+	if len(namedArgs) > 0 && !c.connector.config.IsExecutionParameters() {
 		query, err = c.interpolateParams(query, args)
 		if err != nil {
 			return nil, err
 		}
 		obs.Scope().Counter(DriverName + ".execcontext").Inc(1)
+		namedArgs = []driver.NamedValue{}
 	}
-	if !isQueryValid(query) {
-		return nil, ErrInvalidQuery
+	if c.connector.config.IsMultiStatements() && !strings.HasPrefix(query, "pc:") {
+		if statements := splitStatements(query); len(statements) > 1 {
+			return c.execStatements(ctx, statements, namedArgs)
+		}
 	}
-	rows, err := c.QueryContext(ctx, query, []driver.NamedValue{})
-	if err != nil {
+	if c.connector.config.IsMigrationMode() {
+		query = idempotentDDL(query)
+	}
+	if err := validateQuery(query); err != nil {
 		return nil, err
 	}
-	var rowAffected int64 = 0
-	r := rows.(*Rows)
-	if r != nil && r.ResultOutput != nil && r.ResultOutput.UpdateCount != nil {
-		rowAffected = *r.ResultOutput.UpdateCount
+	rows, err := c.QueryContext(ctx, query, namedArgs)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
+	rowAffected := rowsAffected(rows.(*Rows))
 	var lastInsertedID int64 = -1
 	result := AthenaResult{
 		lastInsertedID: lastInsertedID,
 		rowAffected:    rowAffected,
+		queryID:        rows.(*Rows).queryID,
 	}
 	return result, nil
 }
 
+// rowsAffected is to get the number of rows written by a DML query, like INSERT INTO, or UPDATE, DELETE and
+// MERGE INTO on Iceberg tables. It is the UpdateCount of the result, or the single `rows` column Athena returns
+// for some statements instead.
+func rowsAffected(r *Rows) int64 {
+	if r == nil || r.ResultOutput == nil {
+		return 0
+	}
+	if r.ResultOutput.UpdateCount != nil {
+		return *r.ResultOutput.UpdateCount
+	}
+	rs := r.ResultOutput.ResultSet
+	if rs == nil || rs.ResultSetMetadata == nil || len(rs.ResultSetMetadata.ColumnInfo) != 1 ||
+		aws.StringValue(rs.ResultSetMetadata.ColumnInfo[0].Name) != "rows" || len(rs.Rows) != 1 ||
+		len(rs.Rows[0].Data) != 1 || rs.Rows[0].Data[0] == nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(aws.StringValue(rs.Rows[0].Data[0].VarCharValue), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
 func (c *Connection) cachedQuery(ctx context.Context, QID string) (driver.Rows, error) {
 	if c.connector.config.IsMoneyWise() {
 		dataScanned := int64(0)
@@ -220,6 +324,170 @@ func (c *Connection) getHeaderlessSingleRowResultPage(ctx context.Context, qid s
 	return r, err
 }
 
+// startQueryExecution is to start the query in the workgroup wg in the region of Config, and if Athena is
+// unavailable there, in the fallback regions in order, with wg prepared in each region first. The Athena client
+// of the region running the query is returned. failedExecutions is the number of executions of the query which
+// were started by the attempts before and failed.
+func (c *Connection) startQueryExecution(ctx context.Context, query string, params []*string,
+	wg Workgroup, attempt int, failedExecutions int, firstStart time.Time) (resp *athena.StartQueryExecutionOutput,
+	athenaAPI athenaiface.AthenaAPI, err error) {
+	var obs = c.connector.tracer
+	wgName := wg.Name
+	config := c.connector.config
+	ctx, span := startSpan(ctx, config, "athena.StartQueryExecution",
+		attribute.String("athena.workgroup", wgName), attribute.Int("athena.attempt", attempt))
+	defer func() {
+		if resp != nil && resp.QueryExecutionId != nil {
+			span.SetAttributes(attribute.String("athena.query_execution_id", *resp.QueryExecutionId))
+		}
+		endSpan(span, err)
+	}()
+	input := &athena.StartQueryExecutionInput{
+		QueryString: aws.String(query),
+		QueryExecutionContext: &athena.QueryExecutionContext{
+			Database: aws.String(getDatabase(ctx, config)),
+			Catalog:  aws.String(getCatalog(ctx, config)),
+		},
+		ResultConfiguration: &athena.ResultConfiguration{
+			OutputLocation: aws.String(getOutputLocation(ctx, config)),
+		},
+		WorkGroup:           aws.String(wgName),
+		ExecutionParameters: params,
+	}
+	if option, kmsKey := config.GetResultEncryption(); option != "" {
+		input.ResultConfiguration.EncryptionConfiguration = &athena.EncryptionConfiguration{
+			EncryptionOption: aws.String(option),
+		}
+		if kmsKey != "" {
+			input.ResultConfiguration.EncryptionConfiguration.KmsKey = aws.String(kmsKey)
+		}
+	}
+	input.ResultConfiguration.ExpectedBucketOwner = config.expectedBucketOwner()
+	if acl := config.GetResultACL(); acl != "" {
+		input.ResultConfiguration.AclConfiguration = &athena.AclConfiguration{S3AclOption: aws.String(acl)}
+	}
+	if config.IsQueryDeduplication() {
+		window := firstStart.UnixNano() / int64(config.GetQueryDeduplicationWindow())
+		input.ClientRequestToken = aws.String(clientRequestToken(input, failedExecutions, window))
+	}
+	if reuse := getResultReuse(ctx, config); reuse.Enabled {
+		if err = c.checkEngineFeature(wgName, EngineFeatureResultReuse); err != nil {
+			return nil, nil, err
+		}
+		input.ResultReuseConfiguration = &athena.ResultReuseConfiguration{
+			ResultReuseByAgeConfiguration: &athena.ResultReuseByAgeConfiguration{
+				Enabled:         aws.Bool(true),
+				MaxAgeInMinutes: aws.Int64(int64(reuse.MaxAgeMinutes)),
+			},
+		}
+	} else if comment := c.queryAnnotationComment(ctx, wgName) + traceparentComment(ctx); comment != "" {
+		// after the client request token, which is the same for each run of the query
+		input.QueryString = aws.String(comment + query)
+	}
+	// the query is validated before, but not with the comment, nor UNLOAD around it
+	if err = validateQuery(*input.QueryString); err != nil {
+		return nil, nil, err
+	}
+	resp, failures, err := c.startInRegion(ctx, obs, c.athenaAPI, wg, input)
+	if isCredentialsError(err) {
+		c.credentialsRejected = true
+	}
+	for _, fallback := range c.fallbacks {
+		if err == nil || !isRegionOutageError(err, failures) {
+			break
+		}
+		obs.Log(WarnLevel, "Athena is unavailable, failing over to region "+fallback.region,
+			zap.String("workgroup", wgName),
+			zap.String("error", err.Error()))
+		obs.Scope().Counter(DriverName + ".querycontext.regionfailover").Inc(1)
+		input.ResultConfiguration.OutputLocation = aws.String(config.GetRegionOutputBucket(fallback.region))
+		resp, failures, err = c.startInRegion(ctx, obs, fallback.athenaAPI, wg, input)
+		if err == nil {
+			return resp, fallback.athenaAPI, nil
+		}
+	}
+	return resp, c.athenaAPI, err
+}
+
+// startInRegion is to prepare the workgroup wg, then start the query of input, with Athena of athenaAPI.
+// A server error is retried in the region until there are regionOutageFailures of them in a row, whose
+// number is returned with the error.
+func (c *Connection) startInRegion(ctx context.Context, obs *DriverTracer, athenaAPI athenaiface.AthenaAPI,
+	wg Workgroup, input *athena.StartQueryExecutionInput) (resp *athena.StartQueryExecutionOutput,
+	failures int, err error) {
+	for {
+		if err = c.prepareWG(ctx, obs, athenaAPI, wg); err == nil {
+			resp, err = athenaAPI.StartQueryExecutionWithContext(ctx, input)
+		}
+		if err == nil {
+			return resp, 0, nil
+		}
+		failures++
+		if !isServerError(err) || failures >= regionOutageFailures {
+			return nil, failures, err
+		}
+	}
+}
+
+// clientRequestToken is to derive the client request token of a query execution from its SQL, database, catalog,
+// workgroup and execution parameters, and the time window it was started in, so the same query gets the same
+// token in the window. The retries of a query after failedExecutions of its executions failed get their own
+// token, as they are run again on purpose. The retries after StartQueryExecution itself failed keep the token,
+// as the execution may have been created anyway.
+func clientRequestToken(input *athena.StartQueryExecutionInput, failedExecutions int, window int64) string {
+	h := sha256.New()
+	io.WriteString(h, strconv.FormatInt(window, 10))
+	h.Write([]byte{0})
+	if failedExecutions > 0 {
+		io.WriteString(h, strconv.Itoa(failedExecutions))
+		h.Write([]byte{0})
+	}
+	for _, s := range []*string{input.QueryString, input.QueryExecutionContext.Database,
+		input.QueryExecutionContext.Catalog, input.WorkGroup} {
+		io.WriteString(h, aws.StringValue(s))
+		h.Write([]byte{0})
+	}
+	for _, param := range input.ExecutionParameters {
+		io.WriteString(h, aws.StringValue(param))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reportResultReuse is to report whether the result of a succeeded query was reused, to the tracer and
+// the *bool in context under ResultReusedKey.
+func (c *Connection) reportResultReuse(ctx context.Context, execution *athena.QueryExecution) {
+	reused := execution.Statistics != nil && execution.Statistics.ResultReuseInformation != nil &&
+		aws.BoolValue(execution.Statistics.ResultReuseInformation.ReusedPreviousResult)
+	if reused {
+		c.connector.tracer.Log(DebugLevel, "query result is reused",
+			zap.String("queryID", aws.StringValue(execution.QueryExecutionId)))
+		c.connector.tracer.Scope().Counter(DriverName + ".query.resultreused").Inc(1)
+	}
+	if p, ok := ctx.Value(ResultReusedKey).(*bool); ok && p != nil {
+		*p = reused
+	}
+}
+
+// queryTracer is to get the tracer of the queries with ctx, with the metrics tagged with the workgroup,
+// the database, the result mode and the caller of the queries, so they can be sliced by tenant. The caller
+// is the cost tag set with WithCostTag, empty if there is none.
+func (c *Connection) queryTracer(ctx context.Context) *DriverTracer {
+	obs := c.connector.tracer.withContext(ctx)
+	wgName := getWorkgroup(ctx, c.connector.config).Name
+	if wgName == "" {
+		wgName = DefaultWGName
+	}
+	tagged := *obs
+	tagged.scope = obs.scope.Tagged(map[string]string{
+		"workgroup":  wgName,
+		"database":   getDatabase(ctx, c.connector.config),
+		"resultmode": string(getResultMode(ctx, c.connector.config)),
+		"caller":     getCostTag(ctx),
+	})
+	return &tagged
+}
+
 // QueryContext is implemented to be called by `DB.Query` (QueryerContext interface).
 //
 // "QueryerContext is an optional interface that may be implemented by a Conn.
@@ -231,7 +499,7 @@ func (c *Connection) getHeaderlessSingleRowResultPage(ctx context.Context, qid s
 // With QueryContext implemented, we don't need Queryer.
 // QueryerContext must honor the context timeout and return when the context is canceled.
 func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs []driver.NamedValue) (driver.Rows, error) {
-	var obs = c.connector.tracer
+	var obs = c.queryTracer(ctx)
 	var pseudoCommand = ""
 	if strings.HasPrefix(query, "pc:") {
 		query = strings.Trim(query[3:], " ")
@@ -241,60 +509,88 @@ func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs [
 			query = strings.Trim(query[len(pseudoCommand):], " ")
 		} else if pseudoCommand = PCStopQID; strings.HasPrefix(query, pseudoCommand+" ") {
 			query = strings.Trim(query[len(pseudoCommand):], " ")
+		} else if pseudoCommand = PCAttachQID; strings.HasPrefix(query, pseudoCommand+" ") {
+			query = strings.Trim(query[len(pseudoCommand):], " ")
 		} else if pseudoCommand = PCGetDriverVersion; strings.HasPrefix(query, pseudoCommand) {
 			return c.getHeaderlessSingleRowResultPage(ctx, DriverVersion)
+		} else if pseudoCommand = PCGetQueryExecution; strings.HasPrefix(query, pseudoCommand+" ") {
+			return c.getQueryExecution(ctx, obs, strings.Trim(query[len(pseudoCommand):], " "))
+		} else if pseudoCommand = PCStop; strings.HasPrefix(query, pseudoCommand+" ") {
+			return c.stopQuery(ctx, strings.Trim(query[len(pseudoCommand):], " "))
+		} else if pseudoCommand = PCListExecutions; query == pseudoCommand || strings.HasPrefix(query, pseudoCommand+" ") {
+			return c.listQueryExecutions(ctx, obs, strings.Trim(query[len(pseudoCommand):], " "))
 		} else {
-			return nil, fmt.Errorf("pseudo command " + query + "doesn't exist")
+			return nil, fmt.Errorf("pseudo command " + c.connector.config.redactQuery(query) + "doesn't exist")
 		}
 	}
 	if c.connector.config.IsReadOnly() {
-		if !isReadOnlyStatement(query) {
+		// prepared statements are checked when they are prepared
+		if !isReadOnlyStatement(query) && !c.preparedStatements[executedStatementName(query)] {
 			obs.Scope().Counter(DriverName + ".failure.querycontext.writeviolation").Inc(1)
-			obs.Log(WarnLevel, "write db violation", zap.String("query", query))
+			obs.Log(WarnLevel, "write db violation", zap.String("query", c.connector.config.redactQuery(query)))
 			return nil, fmt.Errorf("writing to Athena database is disallowed in read-only mode")
 		}
 	}
+	if c.tx != nil {
+		staged, err := c.tx.statement(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		query = staged
+	}
+	if len(namedArgs) == 0 {
+		if rows, ok, err := c.metadataQuery(ctx, query); ok {
+			return rows, err
+		}
+	}
 	now := time.Now()
+	query, namedArgs, err := bindNamedArgs(query, namedArgs)
+	if err != nil {
+		return nil, err
+	}
 	args := namedValueToValue(namedArgs)
-	var err error
+	var params []*string
 	if len(namedArgs) > 0 {
-		query, err = c.interpolateParams(query, args)
+		if c.connector.config.IsExecutionParameters() {
+			params, err = c.executionParameters(query, args)
+		} else {
+			query, err = c.interpolateParams(query, args)
+		}
 		if err != nil {
 			return nil, err
 		}
 		obs.Scope().Counter(DriverName + ".prepared.querycontext").Inc(1)
 	}
-	if !isQueryValid(query) {
-		return nil, ErrInvalidQuery
+	if err := validateQuery(query); err != nil {
+		if errors.Is(err, ErrQueryTooLong) && pseudoCommand == "" && params == nil &&
+			c.connector.config.IsQueryStaging() {
+			return c.stagedQueryContext(ctx, query)
+		}
+		return nil, err
 	}
-	wg := c.connector.config.GetWorkgroup()
+	if err := c.lakeFormationPreflight(ctx, obs, query); err != nil {
+		return nil, err
+	}
+	if err := c.partitionGuard(ctx, obs, query); err != nil {
+		return nil, err
+	}
+	if query, err = timeTravelQuery(ctx, c.connector.config, query); err != nil {
+		return nil, err
+	}
+	cacheKey := c.resultCacheKey(ctx, query, params, pseudoCommand)
+	if cacheKey != "" {
+		if rows := c.getCachedRows(ctx, obs, cacheKey); rows != nil {
+			c.lastStats = nil
+			return rows, nil
+		}
+	}
+	wg := getWorkgroup(ctx, c.connector.config)
 	if wg.Name == "" {
 		wg.Name = DefaultWGName
-	} else if wg.Name != DefaultWGName {
-		athenaWG, err := getWG(ctx, c.athenaAPI, wg.Name)
-		if err != nil {
-			obs.Scope().Counter(DriverName + ".failure.querycontext.getwg").Inc(1)
-			obs.Log(WarnLevel, "Didn't find workgroup "+wg.Name+" due to: "+err.Error())
-			if c.connector.config.IsWGRemoteCreationAllowed() {
-				err = wg.CreateWGRemotely(c.athenaAPI)
-				if err != nil {
-					obs.Scope().Counter(DriverName + ".failure.querycontext.createwgremotely").Inc(1)
-					return nil, err
-				}
-				obs.Log(DebugLevel, "workgroup "+wg.Name+" is created successfully.")
-			} else {
-				obs.Log(WarnLevel, "workgroup "+DefaultWGName+" is used for "+wg.Name+".")
-				return nil,
-					fmt.Errorf("workgroup %q doesn't exist and workgroup remote creation is disabled", wg.Name)
-			}
-		} else {
-			if *athenaWG.State != athena.WorkGroupStateEnabled {
-				obs.Log(WarnLevel, "workgroup "+DefaultWGName+" is disabled.")
-				obs.Scope().Counter(DriverName + ".failure.querycontext.wgdisabled").Inc(1)
-				return nil, fmt.Errorf("workgroup %q is disabled", wg.Name)
-			}
-			obs.Log(DebugLevel, "workgroup "+DefaultWGName+" is enabled.")
-		}
+	}
+
+	if err := c.checkCapacity(ctx, obs, wg.Name); err != nil {
+		return nil, err
 	}
 
 	timeWorkgroup := time.Since(now)
@@ -302,7 +598,13 @@ func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs [
 	obs.Scope().Timer(DriverName + ".query.workgroup").Record(timeWorkgroup)
 
 	// case 1 - query directly using QID
+	if pseudoCommand == PCAttachQID && !IsQID(query) {
+		return nil, fmt.Errorf("%w: %q is not a query execution id", ErrInvalidQuery, query)
+	}
 	if IsQID(query) {
+		if pseudoCommand == PCAttachQID {
+			return c.attachQuery(ctx, query, wg.Name, startOfStartQueryExecution)
+		}
 		if pseudoCommand == PCGetQIDStatus {
 			statusResp, err := c.athenaAPI.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
 				QueryExecutionId: aws.String(query),
@@ -335,139 +637,482 @@ func (c *Connection) QueryContext(ctx context.Context, query string, namedArgs [
 	}
 
 	//  case 2 - TODO
-	resp, err := c.athenaAPI.StartQueryExecution(&athena.StartQueryExecutionInput{
-		QueryString: aws.String(query),
-		QueryExecutionContext: &athena.QueryExecutionContext{
-			Database: aws.String(c.connector.config.GetDB()),
-			Catalog:  aws.String(c.connector.config.GetDataSource()),
-		},
-		ResultConfiguration: &athena.ResultConfiguration{
-			OutputLocation: aws.String(c.connector.config.GetOutputBucket()),
-		},
-		WorkGroup: aws.String(wg.Name),
-	})
-	if err != nil {
-		if pseudoCommand == PCGetQID {
-			if reqerr, ok := err.(awserr.RequestFailure); ok {
-				return c.getHeaderlessSingleRowResultPage(ctx, reqerr.RequestID())
+	var unloadLocation, queryID string
+	var athenaAPI athenaiface.AthenaAPI
+	var execution *athena.QueryExecution
+	statement := query
+	hooks := c.connector.config.GetHooks()
+	var attempt, failedExecutions int
+	// the retries are in the deduplication window of the first run
+	firstStart := startOfStartQueryExecution
+	// fail is to return err, once the Hooks know the query failed
+	fail := func(err error) (driver.Rows, error) {
+		if hooks != nil {
+			hooks.OnError(ctx, c.queryEvent(statement, wg.Name, queryID, attempt, startOfStartQueryExecution, err))
+		}
+		return nil, err
+	}
+	for attempt = 1; ; attempt++ {
+		unloadLocation, queryID, query = "", "", statement
+		c.lastStats = nil
+		if getResultMode(ctx, c.connector.config) == ResultModeUnload && c.s3API != nil && isUnloadable(query) {
+			unloadLocation = newUnloadLocation(ctx, c.connector.config)
+			query = unloadQuery(query, unloadLocation, c.connector.config)
+		}
+		// pc:get_query_id doesn't wait for the query, so it doesn't hold a slot while the query runs
+		release := func() {}
+		if pseudoCommand != PCGetQID {
+			if release, err = c.acquireQuerySlot(ctx, wg.Name); err != nil {
+				return fail(err)
 			}
 		}
+		resp, regionalAPI, err := c.startQueryExecution(ctx, query, params, wg, attempt, failedExecutions, firstStart)
+		started := err == nil
+		if err != nil {
+			if pseudoCommand == PCGetQID {
+				if reqerr, ok := err.(awserr.RequestFailure); ok {
+					return c.getHeaderlessSingleRowResultPage(ctx, reqerr.RequestID())
+				}
+			}
+			err = classifyError("", err)
+		} else {
+			timeStartQueryExecution := time.Since(startOfStartQueryExecution)
+			obs.Scope().Timer(DriverName + ".query.startqueryexecution").Record(timeStartQueryExecution)
+
+			athenaAPI, queryID = regionalAPI, *resp.QueryExecutionId
+			if hooks != nil {
+				hooks.OnQueryStart(ctx, c.queryEvent(statement, wg.Name, queryID, attempt, startOfStartQueryExecution, nil))
+			}
+			if pseudoCommand == PCGetQID {
+				return c.getHeaderlessSingleRowResultPage(ctx, queryID)
+			}
+			execution, err = c.waitForQueryExecution(ctx, athenaAPI, queryID, query, wg.Name, startOfStartQueryExecution)
+			c.reportSlowQuery(obs, statement, wg.Name, queryID, startOfStartQueryExecution)
+		}
+		release()
+		if err == nil {
+			if hooks != nil {
+				hooks.OnQueryEnd(ctx, c.queryEvent(statement, wg.Name, queryID, attempt, startOfStartQueryExecution, nil))
+			}
+			break
+		}
+		reason := retryReason(err, started, isReadOnlyStatement(statement))
+		if reason == "" || attempt >= c.connector.config.GetQueryRetryAttempts() {
+			return fail(err)
+		}
+		obs.Log(WarnLevel, "query failed transiently, retrying",
+			zap.String("workgroup", wg.Name),
+			zap.String("queryID", queryID),
+			zap.String("reason", reason),
+			zap.String("error", err.Error()))
+		obs.Scope().Counter(DriverName + ".query.retry." + reason).Inc(1)
+		// the status checks of started queries aren't retried, so the execution failed
+		if started {
+			failedExecutions++
+		}
+		if hooks != nil {
+			hooks.OnRetry(ctx, c.queryEvent(statement, wg.Name, queryID, attempt, startOfStartQueryExecution, err))
+		}
+		select {
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		case <-time.After(c.connector.config.GetQueryRetryBackoff() << uint(attempt-1)):
+		}
+		startOfStartQueryExecution = time.Now()
+	}
+
+	var rows *Rows
+	if unloadLocation != "" {
+		rows, err = NewUnloadRows(ctx, athenaAPI, c.s3API, queryID, unloadLocation, c.connector.config, obs)
+	} else if getResultMode(ctx, c.connector.config) == ResultModeDL && c.s3API != nil && isCSVResult(execution) {
+		rows, err = NewDownloadRows(ctx, athenaAPI, c.s3API, execution, c.connector.config, obs)
+	} else {
+		rows, err = newRows(ctx, athenaAPI, queryID, c.connector.config, obs, queryLimit(query))
+	}
+	if err != nil {
 		return nil, err
 	}
+	c.withResultCleanup(ctx, rows, execution)
+	c.withResultCache(rows, cacheKey)
+	return rows, nil
+}
 
-	timeStartQueryExecution := time.Since(startOfStartQueryExecution)
-	now = time.Now()
-	obs.Scope().Timer(DriverName + ".query.startqueryexecution").Record(timeStartQueryExecution)
+// AttachQuery is to get the Rows of the query execution queryID, started before by this or another process,
+// like with the pseudo command `pc:get_query_id`. It waits for the query to complete, and stops it if ctx is done.
+// It is the same as the pseudo command `pc:attach <queryID>`, and is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) AttachQuery(ctx context.Context, queryID string) (driver.Rows, error) {
+	return c.QueryContext(ctx, "pc:"+PCAttachQID+" "+queryID, nil)
+}
 
-	queryID := *resp.QueryExecutionId
-	if pseudoCommand == PCGetQID {
-		return c.getHeaderlessSingleRowResultPage(ctx, queryID)
+// attachQuery is to wait for the query execution queryID to complete and get its Rows.
+func (c *Connection) attachQuery(ctx context.Context, queryID string, wgName string,
+	start time.Time) (driver.Rows, error) {
+	execution, err := c.waitForQueryExecution(ctx, c.athenaAPI, queryID, queryID, wgName, start)
+	if err != nil {
+		return nil, err
 	}
-WAITING_FOR_RESULT:
-	for {
-		statusResp, err := c.athenaAPI.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
+	obs := c.queryTracer(ctx)
+	obs.Scope().Counter(DriverName + ".query.attach").Inc(1)
+	rows, err := c.executionRows(ctx, execution, obs)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// OpenRowsFromQueryID is to get the Rows of the query execution queryID, run before by this or another process,
+// without running the query again, so a process reads the results of a query run by another job. Unlike
+// AttachQuery, it doesn't wait: the execution must have succeeded, it fails with a QueryError of ErrQueryRunning
+// if the execution is queued or running, and of the failure if it failed or it was cancelled. The results are
+// downloaded from S3 in ResultModeDL, and read from the Parquet files of UNLOAD queries. It is reached from
+// database/sql with sql.Conn.Raw.
+func (c *Connection) OpenRowsFromQueryID(ctx context.Context, queryID string) (driver.Rows, error) {
+	if !IsQID(queryID) {
+		return nil, fmt.Errorf("%w: %q is not a query execution id", ErrInvalidQuery, queryID)
+	}
+	obs := c.queryTracer(ctx)
+	resp, err := c.athenaAPI.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
+		QueryExecutionId: aws.String(queryID),
+	})
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.openrows.getqueryexecution").Inc(1)
+		return nil, classifyError(queryID, err)
+	}
+	execution := resp.QueryExecution
+	switch aws.StringValue(execution.Status.State) {
+	case athena.QueryExecutionStateSucceeded:
+	case athena.QueryExecutionStateFailed:
+		reason := c.connector.config.redactQuery(aws.StringValue(execution.Status.StateChangeReason))
+		queryErr := newQueryError(execution, errors.New(reason))
+		queryErr.Reason = reason
+		return nil, queryErr
+	case athena.QueryExecutionStateCancelled:
+		return nil, newQueryError(execution, context.Canceled)
+	default:
+		return nil, newQueryError(execution, ErrQueryRunning)
+	}
+	obs.Scope().Counter(DriverName + ".query.openrows").Inc(1)
+	rows, err := c.executionRows(ctx, execution, obs)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// executionRows is to get the Rows of a succeeded query execution, from the Parquet files of an UNLOAD query,
+// or from the result object in S3 in ResultModeDL, if the S3 client is set, and from GetQueryResults otherwise.
+func (c *Connection) executionRows(ctx context.Context, execution *athena.QueryExecution,
+	obs *DriverTracer) (*Rows, error) {
+	queryID := aws.StringValue(execution.QueryExecutionId)
+	if location := unloadLocation(aws.StringValue(execution.Query)); location != "" && c.s3API != nil {
+		return NewUnloadRows(ctx, c.athenaAPI, c.s3API, queryID, location, c.connector.config, obs)
+	}
+	if getResultMode(ctx, c.connector.config) == ResultModeDL && c.s3API != nil && isCSVResult(execution) {
+		return NewDownloadRows(ctx, c.athenaAPI, c.s3API, execution, c.connector.config, obs)
+	}
+	return NewRows(ctx, c.athenaAPI, queryID, c.connector.config, obs)
+}
+
+// waitForQueryExecution is to poll the execution of query until it completes, and get it if it succeeded.
+// The query is stopped if ctx is done or the service limit of the statement type is exceeded since start.
+func (c *Connection) waitForQueryExecution(ctx context.Context, athenaAPI athenaiface.AthenaAPI, queryID string,
+	query string, wgName string, start time.Time) (*athena.QueryExecution, error) {
+	ctx, span := startSpan(ctx, c.connector.config, "athena.WaitForQueryExecution",
+		attribute.String("athena.workgroup", wgName), attribute.String("athena.query_execution_id", queryID))
+	execution, err := c.pollQueryExecution(ctx, athenaAPI, queryID, query, wgName, start)
+	if execution != nil && execution.Statistics != nil {
+		span.SetAttributes(attribute.Int64("athena.data_scanned_bytes",
+			aws.Int64Value(execution.Statistics.DataScannedInBytes)))
+	}
+	endSpan(span, err)
+	return execution, err
+}
+
+// pollQueryExecution is to poll the status of the query execution queryID until it is complete.
+func (c *Connection) pollQueryExecution(ctx context.Context, athenaAPI athenaiface.AthenaAPI, queryID string,
+	query string, wgName string, start time.Time) (*athena.QueryExecution, error) {
+	var obs = c.queryTracer(ctx)
+	now := time.Now()
+	catalog := getCatalog(ctx, c.connector.config)
+	poll := c.connector.config.GetPollStrategy()
+	if isFederatedCatalog(catalog) {
+		poll = c.connector.config.GetFederatedPollStrategy()
+	}
+	// with query events, the status is checked when the query completes, and the polling is only a fallback
+	var completed <-chan struct{}
+	if c.connector.queryEvents != nil {
+		ch, unsubscribe := c.connector.queryEvents.subscribe(queryID)
+		defer unsubscribe()
+		completed = ch
+		poll = FixedPoll(c.connector.config.GetPollMaxInterval())
+	}
+	var timedOut <-chan time.Time
+	timeout := getQueryTimeout(ctx, c.connector.config)
+	if timeout > 0 {
+		timer := time.NewTimer(timeout - time.Since(start))
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+	for n := 0; ; n++ {
+		statusResp, err := athenaAPI.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
 			QueryExecutionId: aws.String(queryID),
 		})
 		if err != nil {
 			obs.Log(ErrorLevel, "GetQueryExecutionWithContext failed",
-				zap.String("workgroup", wg.Name),
+				zap.String("workgroup", wgName),
 				zap.String("queryID", queryID),
 				zap.String("error", err.Error()))
 			obs.Scope().Counter(DriverName + ".failure.querycontext.getqueryexecutionwithcontext").Inc(1)
-			return nil, err
+			// the request is aborted when ctx is done, the query still runs then
+			if ctx.Err() != nil {
+				c.stopQueryExecution(athenaAPI, queryID)
+				return nil, ctx.Err()
+			}
+			return nil, classifyError(queryID, err)
+		}
+		var scanned int64
+		if statusResp.QueryExecution.Statistics != nil {
+			scanned = aws.Int64Value(statusResp.QueryExecution.Statistics.DataScannedInBytes)
 		}
+		obs.Log(DebugLevel, "query execution polled",
+			zap.String("workgroup", wgName),
+			zap.String("queryID", queryID),
+			zap.Int("poll", n),
+			zap.String("state", aws.StringValue(statusResp.QueryExecution.Status.State)),
+			zap.Int64("scannedBytes", scanned),
+			zap.Duration("elapsed", time.Since(now)))
 		//statementType = statusResp.QueryExecution.StatementType
 		switch *statusResp.QueryExecution.Status.State {
 		case athena.QueryExecutionStateCancelled:
 			timeCanceled := time.Since(now)
 			obs.Log(ErrorLevel, "QueryExecutionStateCancelled",
-				zap.String("workgroup", wg.Name),
+				zap.String("workgroup", wgName),
 				zap.String("queryID", queryID))
 			obs.Scope().Timer(DriverName + ".query.canceled").Record(timeCanceled)
-			if c.connector.config.IsMoneyWise() {
-				printCost(statusResp)
-			}
-			return nil, context.Canceled
+			c.recordCost(ctx, wgName, statusResp)
+			c.reportStats(ctx, statusResp)
+			return nil, newQueryError(statusResp.QueryExecution, context.Canceled)
 		case athena.QueryExecutionStateFailed:
-			reason := *statusResp.QueryExecution.Status.StateChangeReason
+			// the reason may quote the query, like the literals of a syntax error
+			reason := c.connector.config.redactQuery(aws.StringValue(statusResp.QueryExecution.Status.StateChangeReason))
 			timeQueryExecutionStateFailed := time.Since(now)
 			obs.Log(ErrorLevel, "QueryExecutionStateFailed",
-				zap.String("workgroup", wg.Name),
+				zap.String("workgroup", wgName),
+				zap.String("catalog", catalog),
 				zap.String("queryID", queryID),
 				zap.String("reason", reason))
 			obs.Scope().Timer(DriverName + ".query.queryexecutionstatefailed").Record(timeQueryExecutionStateFailed)
-			return nil, errors.New(reason)
-		case athena.QueryExecutionStateSucceeded:
-			if c.connector.config.IsMoneyWise() {
-				printCost(statusResp)
+			c.reportStats(ctx, statusResp)
+			queryErr := newQueryError(statusResp.QueryExecution, errors.New(reason))
+			queryErr.Reason = reason
+			if isFederatedCatalog(catalog) {
+				queryErr.Catalog = catalog
 			}
+			return nil, queryErr
+		case athena.QueryExecutionStateSucceeded:
+			c.recordCost(ctx, wgName, statusResp)
+			c.reportStats(ctx, statusResp)
 			timeQueryExecutionStateSucceeded := time.Since(now)
 			obs.Scope().Timer(DriverName + ".query.queryexecutionstatesucceeded").Record(timeQueryExecutionStateSucceeded)
-			break WAITING_FOR_RESULT
+			c.reportResultReuse(ctx, statusResp.QueryExecution)
+			return statusResp.QueryExecution, nil
 		// for athena.QueryExecutionStateQueued and athena.QueryExecutionStateRunning
 		default:
+			if err := c.checkScannedBytes(ctx, athenaAPI, statusResp.QueryExecution, wgName); err != nil {
+				return nil, err
+			}
 		}
 
 		select {
 		case <-ctx.Done():
-			_, err := c.athenaAPI.
-				StopQueryExecutionWithContext(context.Background(), &athena.StopQueryExecutionInput{
-					QueryExecutionId: aws.String(queryID),
-				})
+			statusRespFinal, err := c.stopQueryExecution(athenaAPI, queryID)
 			if err != nil {
-				obs.Log(ErrorLevel, "StopQueryExecution failed",
-					zap.String("workgroup", wg.Name),
-					zap.String("queryID", queryID),
-					zap.String("query", query))
-				obs.Scope().Counter(DriverName + ".failure.querycontext.stopqueryexecution.failed").Inc(1)
 				return nil, err
 			}
-			if c.connector.config.IsMoneyWise() {
-				statusRespFinal, _ := c.athenaAPI.GetQueryExecutionWithContext(context.Background(), &athena.GetQueryExecutionInput{
-					QueryExecutionId: aws.String(queryID),
-				})
-				printCost(statusRespFinal)
+			if statusRespFinal != nil {
+				c.recordCost(ctx, wgName, statusRespFinal)
+				c.reportStats(ctx, statusRespFinal)
 			}
 			obs.Scope().Counter(DriverName + ".failure.querycontext.stopqueryexecution.succeeded").Inc(1)
 			timeStopQueryExecution := time.Since(now)
 			obs.Scope().Timer(DriverName + ".query.StopQueryExecution").Record(timeStopQueryExecution)
 			obs.Log(ErrorLevel, "query canceled", zap.String("queryID", queryID))
 			return nil, ctx.Err()
-		case <-time.After(PoolInterval * time.Second):
-			if isQueryTimeOut(startOfStartQueryExecution, *statusResp.QueryExecution.StatementType, c.connector.config.GetServiceLimitOverride()) {
+		case <-timedOut:
+			obs.Log(ErrorLevel, "Query timeout failure",
+				zap.String("workgroup", wgName),
+				zap.String("queryID", queryID),
+				zap.Duration("timeout", timeout))
+			obs.Scope().Counter(DriverName + ".failure.querycontext.querytimeout").Inc(1)
+			// the timeout is returned even if the query couldn't be stopped, with the error of the stop
+			statusRespFinal, err := c.stopQueryExecution(athenaAPI, queryID)
+			if statusRespFinal != nil {
+				c.recordCost(ctx, wgName, statusRespFinal)
+				c.reportStats(ctx, statusRespFinal)
+			}
+			return nil, &QueryTimeoutError{QueryID: queryID, Timeout: timeout, StopErr: err}
+		case <-completed:
+			completed = nil
+			continue
+		case <-time.After(poll.Interval(n)):
+			if isQueryTimeOut(start, *statusResp.QueryExecution.StatementType, c.connector.config.GetServiceLimitOverride()) {
 				obs.Log(ErrorLevel, "Query timeout failure",
-					zap.String("workgroup", wg.Name),
+					zap.String("workgroup", wgName),
 					zap.String("queryID", queryID),
-					zap.String("query", query))
+					zap.String("query", c.connector.config.redactQuery(query)))
 				obs.Scope().Counter(DriverName + ".failure.querycontext.timeout").Inc(1)
 				return nil, ErrQueryTimeout
 			}
 			continue
 		}
 	}
+}
 
-	return NewRows(ctx, c.athenaAPI, queryID, c.connector.config, obs)
+// checkScannedBytes is to stop the running query execution if it scanned more bytes than the max scanned bytes
+// in Config. The statistics of a running query are only as up to date as the last poll.
+func (c *Connection) checkScannedBytes(ctx context.Context, athenaAPI athenaiface.AthenaAPI,
+	execution *athena.QueryExecution, wgName string) error {
+	maxBytes := c.connector.config.GetMaxScannedBytes()
+	if maxBytes <= 0 || execution.Statistics == nil {
+		return nil
+	}
+	scanned := aws.Int64Value(execution.Statistics.DataScannedInBytes)
+	if scanned <= maxBytes {
+		return nil
+	}
+	var obs = c.connector.tracer
+	queryID := aws.StringValue(execution.QueryExecutionId)
+	obs.Log(ErrorLevel, "query budget exceeded",
+		zap.String("workgroup", wgName),
+		zap.String("queryID", queryID),
+		zap.Int64("scannedBytes", scanned),
+		zap.Int64("maxScannedBytes", maxBytes))
+	obs.Scope().Counter(DriverName + ".failure.querycontext.budgetexceeded").Inc(1)
+	statusResp, err := c.stopQueryExecution(athenaAPI, queryID)
+	if err != nil {
+		return err
+	}
+	if statusResp != nil {
+		if statusResp.QueryExecution.Statistics != nil {
+			scanned = aws.Int64Value(statusResp.QueryExecution.Statistics.DataScannedInBytes)
+		}
+		c.recordCost(ctx, wgName, statusResp)
+		c.reportStats(ctx, statusResp)
+	}
+	return &BudgetExceededError{QueryID: queryID, DataScannedInBytes: scanned, MaxScannedBytes: maxBytes}
+}
+
+// stopConfirmChecks is how many times the state of a stopped query is checked, stopConfirmInterval apart.
+const (
+	stopConfirmChecks   = 5
+	stopConfirmInterval = 100 * time.Millisecond
+)
+
+// stopQueryExecution is to stop the query execution queryID, and get its final status. It uses a detached
+// context of StopQueryTimeout seconds, as the context of the query may be done already. The stop is confirmed
+// by checking the state of the query, and a metric is emitted if it isn't.
+func (c *Connection) stopQueryExecution(athenaAPI athenaiface.AthenaAPI,
+	queryID string) (*athena.GetQueryExecutionOutput, error) {
+	var obs = c.connector.tracer
+	ctx, cancel := context.WithTimeout(context.Background(), StopQueryTimeout*time.Second)
+	defer cancel()
+	_, err := athenaAPI.StopQueryExecutionWithContext(ctx, &athena.StopQueryExecutionInput{
+		QueryExecutionId: aws.String(queryID),
+	})
+	if err != nil {
+		obs.Log(ErrorLevel, "StopQueryExecution failed",
+			zap.String("queryID", queryID),
+			zap.String("error", err.Error()))
+		obs.Scope().Counter(DriverName + ".failure.querycontext.stopqueryexecution.failed").Inc(1)
+		return nil, err
+	}
+	var statusResp *athena.GetQueryExecutionOutput
+	for i := 0; i < stopConfirmChecks && ctx.Err() == nil; i++ {
+		resp, err := athenaAPI.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
+			QueryExecutionId: aws.String(queryID),
+		})
+		if err == nil && resp != nil && resp.QueryExecution != nil && resp.QueryExecution.Status != nil {
+			statusResp = resp
+			switch aws.StringValue(resp.QueryExecution.Status.State) {
+			case athena.QueryExecutionStateCancelled, athena.QueryExecutionStateFailed,
+				athena.QueryExecutionStateSucceeded:
+				return statusResp, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(stopConfirmInterval):
+		}
+	}
+	obs.Log(WarnLevel, "StopQueryExecution not confirmed", zap.String("queryID", queryID))
+	obs.Scope().Counter(DriverName + ".failure.querycontext.stopqueryexecution.unconfirmed").Inc(1)
+	return statusResp, nil
 }
 
+// PingProbe is the Athena API call made by Connection.Ping.
+type PingProbe string
+
+const (
+	// PingProbeGetWorkGroup gets the workgroup in Config. It is the default probe.
+	PingProbeGetWorkGroup PingProbe = "getWorkGroup"
+
+	// PingProbeListDataCatalogs lists the data catalogs, for principals not allowed to get the workgroup.
+	PingProbeListDataCatalogs PingProbe = "listDataCatalogs"
+
+	// PingProbeQuery runs `SELECT 1`, which checks query execution too, but is slow and billed.
+	PingProbeQuery PingProbe = "query"
+)
+
 // Ping implements driver.Pinger interface.
 // Ping is a good first step in a health check: If the Ping succeeds,
 // make a simple query, then make a complex query which depends on proper
 // DB scheme. This will make troubleshooting simpler as the error now is:
 // "We've got network connectivity, we can Ping the DB, so we have valid
 // credentials for a SELECT xxx; but ...".
+// The probe is a cheap API call set by config.SetPingProbe(probe), so revoked credentials
+// or region outages are detected without running a query. A workgroup not found isn't a ping failure,
+// as it may be created remotely by the first query.
 func (c *Connection) Ping(ctx context.Context) error {
-	rows, err := c.QueryContext(ctx, "SELECT 1", nil)
+	var err error
+	switch c.connector.config.GetPingProbe() {
+	case PingProbeQuery:
+		var rows driver.Rows
+		rows, err = c.QueryContext(WithoutResultCache(ctx), "SELECT 1", nil)
+		if err == nil {
+			defer rows.Close()
+		}
+	case PingProbeListDataCatalogs:
+		_, err = c.athenaAPI.ListDataCatalogsWithContext(ctx, &athena.ListDataCatalogsInput{
+			MaxResults: aws.Int64(2),
+		})
+	default:
+		wg := c.connector.config.GetWorkgroup()
+		if wg.Name == "" {
+			wg.Name = DefaultWGName
+		}
+		_, err = getWG(ctx, c.athenaAPI, wg.Name)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == athena.ErrCodeInvalidRequestException {
+			err = nil
+		}
+	}
 	if err != nil {
+		c.connector.tracer.Log(WarnLevel, "ping failed", zap.String("error", err.Error()))
+		c.connector.tracer.Scope().Counter(DriverName + ".failure.ping").Inc(1)
 		return driver.ErrBadConn // https://golang.org/pkg/database/sql/driver/#Pinger
 	}
-	defer rows.Close()
 	return nil
 }
 
 // Prepare is inherited from Conn interface.
 func (c *Connection) Prepare(query string) (driver.Stmt, error) {
-	if !isQueryValid(query) {
-		return nil, ErrInvalidQuery
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext is to implement driver.ConnPrepareContext. The server-side prepared statements are created with
+// ctx, in the workgroup of the queries with it.
+func (c *Connection) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := validateQuery(query); err != nil {
+		return nil, err
 	}
 	stmt := &Statement{
 		connection: c,
@@ -475,14 +1120,14 @@ func (c *Connection) Prepare(query string) (driver.Stmt, error) {
 		closed:     false,
 		numInput:   strings.Count(query, "?"),
 	}
+	if c.connector.config.IsServerSidePreparedStatements() {
+		if err := stmt.prepare(ctx); err != nil {
+			return nil, err
+		}
+	}
 	return stmt, nil
 }
 
-// Begin is from Conn interface, but no implementation for AWS Athena.
-func (c *Connection) Begin() (driver.Tx, error) {
-	return nil, ErrAthenaTransactionUnsupported
-}
-
 // BeginTx is to replace Begin as it is deprecated.
 func (c *Connection) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
 	return nil, ErrAthenaTransactionUnsupported
@@ -500,5 +1145,28 @@ func (c *Connection) Close() error {
 	return nil
 }
 
+// IsValid implements driver.Validator interface.
+// A connection is invalid once it is closed or Athena rejected its credentials, so the sql.DB pool discards it
+// instead of returning errors to the application on the next query. Expired credentials don't make it invalid,
+// the AWS SDK retrieves them again on the next request.
+func (c *Connection) IsValid() bool {
+	return c.athenaAPI != nil && !c.credentialsRejected
+}
+
+// ResetSession implements driver.SessionResetter interface.
+// It is called before the connection is reused, and returns driver.ErrBadConn for an invalid connection.
+func (c *Connection) ResetSession(ctx context.Context) error {
+	if !c.IsValid() {
+		if c.connector != nil {
+			c.connector.tracer.Scope().Counter(DriverName + ".connection.invalid").Inc(1)
+		}
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
 var _ driver.QueryerContext = (*Connection)(nil)
 var _ driver.ExecerContext = (*Connection)(nil)
+var _ driver.ConnPrepareContext = (*Connection)(nil)
+var _ driver.Validator = (*Connection)(nil)
+var _ driver.SessionResetter = (*Connection)(nil)
@@ -24,15 +24,21 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
 	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
 )
 
 var regions = []string{"ap-east-1", "eu-central-1", "eu-north-1", "eu-west-1", "eu-west-2", "eu-west-3",
@@ -463,6 +469,7 @@ func TestConnection_QueryContext6(t *testing.T) {
 func TestConnection_QueryContext7(t *testing.T) {
 	t.Parallel()
 	c := createConnectionFixture()
+	c.connector.config.SetPingProbe(PingProbeQuery)
 
 	e := c.Ping(context.Background())
 	assert.Nil(t, e)
@@ -533,7 +540,8 @@ func TestConnection_QueryContext7(t *testing.T) {
 
 	query = randString(MAXQueryStringLength * 10)
 	driverRows, err = c.QueryContext(context.Background(), query, []driver.NamedValue{})
-	assert.Equal(t, err, ErrInvalidQuery)
+	assert.Equal(t, &QueryTooLongError{Length: MAXQueryStringLength * 10}, err)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
 	assert.Nil(t, driverRows)
 
 	// Cancelled by AWS Athena
@@ -564,6 +572,7 @@ func TestConnection_QueryContext7(t *testing.T) {
 func BenchmarkConnection_QueryContext(b *testing.B) {
 	for i := 0; i < 10000; i++ {
 		c := createConnectionFixture()
+		c.connector.config.SetPingProbe(PingProbeQuery)
 		assert.Nil(b, c.Ping(context.Background()))
 	}
 }
@@ -757,3 +766,745 @@ func Test_PseudoCommand(t *testing.T) {
 	assert.Nil(t, er)
 	assert.NotNil(t, dr)
 }
+
+type regionOutageAthenaClient struct {
+	*mockAthenaClient
+	outputLocations []string
+	statusCode      int
+	// failures is the number of calls failing with statusCode, all of them if it's 0
+	failures     int
+	wgStatusCode int
+}
+
+func (m *regionOutageAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	m.outputLocations = append(m.outputLocations, *s.ResultConfiguration.OutputLocation)
+	if m.statusCode != 0 && (m.failures == 0 || len(m.outputLocations) <= m.failures) {
+		return nil, awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "region down", nil),
+			m.statusCode, "req")
+	}
+	return m.mockAthenaClient.StartQueryExecutionWithContext(ctx, s, opts...)
+}
+
+func (m *regionOutageAthenaClient) GetWorkGroupWithContext(ctx aws.Context, gwi *athena.GetWorkGroupInput,
+	opt ...request.Option) (*athena.GetWorkGroupOutput, error) {
+	if m.wgStatusCode != 0 {
+		return nil, awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "region down", nil),
+			m.wgStatusCode, "req")
+	}
+	return m.mockAthenaClient.GetWorkGroupWithContext(ctx, gwi, opt...)
+}
+
+func TestConnection_QueryContext_RegionFailover(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetRegionOutputBucket("us-west-2", "s3://results-us-west-2/")
+	primary := &regionOutageAthenaClient{mockAthenaClient: newMockAthenaClient(), statusCode: 503}
+	down := &regionOutageAthenaClient{mockAthenaClient: newMockAthenaClient(), statusCode: 500}
+	fallback := &regionOutageAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: primary,
+		fallbacks: []regionalAthenaAPI{
+			{region: "eu-west-1", athenaAPI: down},
+			{region: "us-west-2", athenaAPI: fallback},
+		},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config = testConf
+	rows, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, fallback, rows.(*Rows).athena)
+	// a server error is retried once in the region before failing over
+	assert.Equal(t, []string{testConf.GetOutputBucket(), testConf.GetOutputBucket()}, primary.outputLocations)
+	assert.Equal(t, []string{testConf.GetOutputBucket(), testConf.GetOutputBucket()}, down.outputLocations)
+	assert.Equal(t, []string{"s3://results-us-west-2/"}, fallback.outputLocations)
+
+	// a single server error doesn't fail over
+	primary.outputLocations, primary.failures = nil, 1
+	fallback.outputLocations = nil
+	rows, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, primary, rows.(*Rows).athena)
+	assert.Len(t, primary.outputLocations, 2)
+	assert.Nil(t, fallback.outputLocations)
+
+	// errors other than a region outage are not retried in another region
+	primary.statusCode, primary.failures = 400, 0
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, fallback.outputLocations)
+}
+
+func TestConnection_QueryContext_RegionFailover_Workgroup(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetRegionOutputBucket("us-west-2", "s3://results-us-west-2/")
+	primary := &regionOutageAthenaClient{mockAthenaClient: newMockAthenaClient(), wgStatusCode: 503}
+	fallback := &regionOutageAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	fallback.GetWGStatus = true
+	c := &Connection{
+		athenaAPI: primary,
+		fallbacks: []regionalAthenaAPI{{region: "us-west-2", athenaAPI: fallback}},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config = testConf
+	_ = testConf.SetWorkGroup(NewDefaultWG("etl", nil, nil))
+	rows, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, fallback, rows.(*Rows).athena)
+	// the workgroup is got in each region, the query isn't started in the primary one
+	assert.Nil(t, primary.outputLocations)
+	assert.Equal(t, []string{"s3://results-us-west-2/"}, fallback.outputLocations)
+}
+
+type queryContextAthenaClient struct {
+	*mockAthenaClient
+	inputs []*athena.StartQueryExecutionInput
+}
+
+// newQueryContextAthenaClient is to create the queryContextAthenaClient the mock clients of the other tests embed.
+func newQueryContextAthenaClient() queryContextAthenaClient {
+	return queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+}
+
+// newMockConnection is to create a Connection of a NoopsSQLConnector to the mock client athenaAPI.
+func newMockConnection(athenaAPI athenaiface.AthenaAPI) *Connection {
+	return &Connection{
+		athenaAPI: athenaAPI,
+		connector: NoopsSQLConnector(),
+	}
+}
+
+func (m *queryContextAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	m.inputs = append(m.inputs, s)
+	return &athena.StartQueryExecutionOutput{QueryExecutionId: aws.String("PING_OK_QID")}, nil
+}
+
+func TestConnection_QueryContext_ResultEncryption(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, athenaClient.inputs[0].ResultConfiguration.EncryptionConfiguration)
+
+	assert.Nil(t, c.connector.config.SetResultEncryption(athena.EncryptionOptionSseKms, "arn:aws:kms:us-east-1:1:key/k"))
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &athena.EncryptionConfiguration{
+		EncryptionOption: aws.String(athena.EncryptionOptionSseKms),
+		KmsKey:           aws.String("arn:aws:kms:us-east-1:1:key/k"),
+	}, athenaClient.inputs[1].ResultConfiguration.EncryptionConfiguration)
+
+	assert.Nil(t, c.connector.config.SetResultEncryption(athena.EncryptionOptionSseS3, ""))
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &athena.EncryptionConfiguration{EncryptionOption: aws.String(athena.EncryptionOptionSseS3)},
+		athenaClient.inputs[2].ResultConfiguration.EncryptionConfiguration)
+}
+
+func TestConnection_QueryContext_ResultBucketOwnerAndACL(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, athenaClient.inputs[0].ResultConfiguration.ExpectedBucketOwner)
+	assert.Nil(t, athenaClient.inputs[0].ResultConfiguration.AclConfiguration)
+
+	assert.Nil(t, c.connector.config.SetResultBucketOwner("123456789012"))
+	assert.Nil(t, c.connector.config.SetResultACL(athena.S3AclOptionBucketOwnerFullControl))
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "123456789012", *athenaClient.inputs[1].ResultConfiguration.ExpectedBucketOwner)
+	assert.Equal(t, athena.S3AclOptionBucketOwnerFullControl,
+		*athenaClient.inputs[1].ResultConfiguration.AclConfiguration.S3AclOption)
+}
+
+func TestConnection_QueryContext_Catalog(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+
+	c.connector.config.SetCatalog("hive_metastore")
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+
+	ctx := context.WithValue(context.Background(), CatalogKey, "dynamodb_federated")
+	_, err = c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+
+	var catalogs []string
+	for _, input := range athenaClient.inputs {
+		catalogs = append(catalogs, *input.QueryExecutionContext.Catalog)
+	}
+	assert.Equal(t, []string{DefaultDataSource, "hive_metastore", "dynamodb_federated"}, catalogs)
+}
+
+func TestConnection_QueryContext_ContextOverrides(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	ctx := WithDatabase(context.Background(), "tenant_a")
+	ctx = WithOutputLocation(ctx, "s3://tenant-a-results/athena/")
+	ctx = WithWorkgroup(ctx, DefaultWGName)
+	_, err := c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	_, err = c.ExecContext(WithCatalog(context.Background(), "hive_metastore"), "SELECT 1", nil)
+	assert.Nil(t, err)
+
+	assert.Len(t, athenaClient.inputs, 2)
+	input := athenaClient.inputs[0]
+	assert.Equal(t, "tenant_a", *input.QueryExecutionContext.Database)
+	assert.Equal(t, DefaultDataSource, *input.QueryExecutionContext.Catalog)
+	assert.Equal(t, "s3://tenant-a-results/athena/", *input.ResultConfiguration.OutputLocation)
+	assert.Equal(t, DefaultWGName, *input.WorkGroup)
+
+	// the Config is used for the values not overridden in context
+	input = athenaClient.inputs[1]
+	assert.Equal(t, c.connector.config.GetDB(), *input.QueryExecutionContext.Database)
+	assert.Equal(t, "hive_metastore", *input.QueryExecutionContext.Catalog)
+	assert.Equal(t, c.connector.config.GetOutputBucket(), *input.ResultConfiguration.OutputLocation)
+}
+
+func TestConnection_QueryContext_WGOutputBuckets(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	athenaClient.GetWGStatus = true
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	assert.Nil(t, c.connector.config.SetWGOutputBuckets(map[string]string{
+		"etl": "s3://etl-results/",
+	}))
+	ctx := WithWorkgroup(context.Background(), "etl")
+	_, err := c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	_, err = c.QueryContext(WithOutputLocation(ctx, "s3://tenant-a-results/"), "SELECT 1", nil)
+	assert.Nil(t, err)
+
+	var locations []string
+	for _, input := range athenaClient.inputs {
+		locations = append(locations, *input.ResultConfiguration.OutputLocation)
+	}
+	assert.Equal(t, []string{"s3://etl-results/", c.connector.config.GetOutputBucket(), "s3://tenant-a-results/"},
+		locations)
+}
+
+type resultReuseAthenaClient struct {
+	queryContextAthenaClient
+}
+
+func (m *resultReuseAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	out, err := m.mockAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+	if err == nil && out != nil {
+		reuse := m.inputs[len(m.inputs)-1].ResultReuseConfiguration
+		out.QueryExecution.Statistics = &athena.QueryExecutionStatistics{
+			ResultReuseInformation: &athena.ResultReuseInformation{
+				ReusedPreviousResult: aws.Bool(reuse != nil),
+			},
+		}
+	}
+	return out, err
+}
+
+func TestConnection_QueryContext_ResultReuse(t *testing.T) {
+	athenaClient := &resultReuseAthenaClient{
+		queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+	}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	reused := true
+	ctx := context.WithValue(context.Background(), ResultReusedKey, &reused)
+	_, err := c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, athenaClient.inputs[0].ResultReuseConfiguration)
+	assert.False(t, reused)
+
+	assert.Nil(t, c.connector.config.SetResultReuse(true, 0))
+	_, err = c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	byAge := athenaClient.inputs[1].ResultReuseConfiguration.ResultReuseByAgeConfiguration
+	assert.True(t, *byAge.Enabled)
+	assert.Equal(t, int64(DefaultResultReuseMaxAge), *byAge.MaxAgeInMinutes)
+	assert.True(t, reused)
+
+	// the result reuse in context overrides the one in Config
+	_, err = c.QueryContext(WithResultReuse(ctx, true, 15), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15), *athenaClient.inputs[2].ResultReuseConfiguration.ResultReuseByAgeConfiguration.MaxAgeInMinutes)
+	_, err = c.QueryContext(WithResultReuse(ctx, false, 0), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, athenaClient.inputs[3].ResultReuseConfiguration)
+	assert.False(t, reused)
+}
+
+func TestConnection_ExecutionParameters(t *testing.T) {
+	c := &Connection{}
+	ts := time.Date(2022, 3, 4, 5, 6, 7, 8e6, time.UTC)
+	params, err := c.executionParameters("SELECT ?, ?, ?, ?, ?, ?, ?",
+		[]driver.Value{nil, int64(-42), 1.5, true, ts, []byte("go"), "it's"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"NULL", "-42", "1.5", "true", "TIMESTAMP '2022-03-04 05:06:07.008'", "X'676f'", "'it''s'"},
+		aws.StringValueSlice(params))
+
+	_, err = c.executionParameters("SELECT ?", []driver.Value{int64(1), int64(2)})
+	assert.Equal(t, ErrInvalidQuery, err)
+	_, err = c.executionParameters("SELECT ?", []driver.Value{int32(1)})
+	assert.Equal(t, ErrQueryUnknownType, err)
+}
+
+func TestConnection_QueryContext_ExecutionParameters(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	args := []driver.NamedValue{{Ordinal: 1, Value: "x' OR '1'='1"}}
+	_, err := c.QueryContext(context.Background(), "SELECT * FROM t WHERE c = ?", args)
+	assert.Nil(t, err)
+	assert.Nil(t, athenaClient.inputs[0].ExecutionParameters)
+	assert.Equal(t, `SELECT * FROM t WHERE c = 'x'' OR ''1''=''1'`, *athenaClient.inputs[0].QueryString)
+
+	c.connector.config.SetExecutionParameters(true)
+	_, err = c.QueryContext(context.Background(), "SELECT * FROM t WHERE c = ?", args)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE c = ?", *athenaClient.inputs[1].QueryString)
+	assert.Equal(t, []string{"'x'' OR ''1''=''1'"}, aws.StringValueSlice(athenaClient.inputs[1].ExecutionParameters))
+
+	_, err = c.ExecContext(context.Background(), "INSERT INTO t VALUES (?)", []driver.NamedValue{{Ordinal: 1, Value: int64(7)}})
+	assert.Nil(t, err)
+	assert.Equal(t, "INSERT INTO t VALUES (?)", *athenaClient.inputs[2].QueryString)
+	assert.Equal(t, []string{"7"}, aws.StringValueSlice(athenaClient.inputs[2].ExecutionParameters))
+}
+
+type pingAthenaClient struct {
+	*mockAthenaClient
+	listDataCatalogsErr error
+}
+
+func (m *pingAthenaClient) ListDataCatalogsWithContext(ctx aws.Context, input *athena.ListDataCatalogsInput,
+	opts ...request.Option) (*athena.ListDataCatalogsOutput, error) {
+	return &athena.ListDataCatalogsOutput{}, m.listDataCatalogsErr
+}
+
+func (m *pingAthenaClient) GetWorkGroupWithContext(ctx aws.Context, input *athena.GetWorkGroupInput,
+	opts ...request.Option) (*athena.GetWorkGroupOutput, error) {
+	if *input.WorkGroup == "not_created_yet" {
+		return nil, awserr.NewRequestFailure(
+			awserr.New(athena.ErrCodeInvalidRequestException, "WorkGroup is not found.", nil), 400, "req")
+	}
+	if *input.WorkGroup == "revoked" {
+		return nil, awserr.NewRequestFailure(
+			awserr.New("UnrecognizedClientException", "The security token included in the request is invalid.", nil),
+			400, "req")
+	}
+	return m.mockAthenaClient.GetWorkGroupWithContext(ctx, input, opts...)
+}
+
+func TestConnection_Ping(t *testing.T) {
+	mock := &pingAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: mock,
+		connector: NoopsSQLConnector(),
+	}
+	assert.Equal(t, PingProbeGetWorkGroup, c.connector.config.GetPingProbe())
+	assert.Equal(t, driver.ErrBadConn, c.Ping(context.Background()))
+	mock.GetWGStatus = true
+	assert.Nil(t, c.Ping(context.Background()))
+
+	_ = c.connector.config.SetWorkGroup(NewDefaultWG("not_created_yet", nil, nil))
+	assert.Nil(t, c.Ping(context.Background()))
+	_ = c.connector.config.SetWorkGroup(NewDefaultWG("revoked", nil, nil))
+	assert.Equal(t, driver.ErrBadConn, c.Ping(context.Background()))
+
+	c.connector.config.SetPingProbe(PingProbeListDataCatalogs)
+	assert.Nil(t, c.Ping(context.Background()))
+	mock.listDataCatalogsErr = ErrTestMockGeneric
+	assert.Equal(t, driver.ErrBadConn, c.Ping(context.Background()))
+
+	_ = c.connector.config.SetWorkGroup(NewDefaultWG(DefaultWGName, nil, nil))
+	c.connector.config.SetPingProbe(PingProbeQuery)
+	assert.Equal(t, PingProbeQuery, c.connector.config.GetPingProbe())
+	assert.Nil(t, c.Ping(context.Background()))
+}
+
+type expiredTokenAthenaClient struct {
+	*mockAthenaClient
+}
+
+func (m *expiredTokenAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	return nil, awserr.NewRequestFailure(
+		awserr.New("ExpiredTokenException", "The security token included in the request is expired", nil), 400, "req")
+}
+
+func TestConnection_IsValid(t *testing.T) {
+	c := &Connection{
+		athenaAPI: newMockAthenaClient(),
+		connector: NoopsSQLConnector(),
+	}
+	assert.True(t, c.IsValid())
+	assert.Nil(t, c.ResetSession(context.Background()))
+
+	c = &Connection{
+		athenaAPI: &expiredTokenAthenaClient{newMockAthenaClient()},
+		connector: NoopsSQLConnector(),
+	}
+	assert.True(t, c.IsValid())
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.NotNil(t, err)
+	assert.False(t, c.IsValid())
+	assert.Equal(t, driver.ErrBadConn, c.ResetSession(context.Background()))
+
+	c = &Connection{
+		athenaAPI: newMockAthenaClient(),
+		connector: NoopsSQLConnector(),
+	}
+	assert.Nil(t, c.Close())
+	assert.False(t, c.IsValid())
+	assert.Equal(t, driver.ErrBadConn, c.ResetSession(context.Background()))
+}
+
+func TestRowsAffected(t *testing.T) {
+	assert.Equal(t, int64(0), rowsAffected(nil))
+	assert.Equal(t, int64(0), rowsAffected(&Rows{}))
+
+	updateCount := int64(42)
+	assert.Equal(t, int64(42), rowsAffected(&Rows{ResultOutput: &athena.GetQueryResultsOutput{UpdateCount: &updateCount}}))
+
+	// Iceberg UPDATE, DELETE and MERGE INTO
+	rowsColumn := newHeaderlessResultPage([]*string{aws.String("rows")}, []string{"bigint"},
+		[][]*string{{aws.String("7")}})
+	assert.Equal(t, int64(7), rowsAffected(&Rows{ResultOutput: rowsColumn}))
+
+	otherColumn := newHeaderlessResultPage([]*string{aws.String("id")}, []string{"bigint"},
+		[][]*string{{aws.String("7")}})
+	assert.Equal(t, int64(0), rowsAffected(&Rows{ResultOutput: otherColumn}))
+}
+
+// attachAthenaClient runs the query execution of the zero QID for a poll before it succeeds.
+type attachAthenaClient struct {
+	*mockAthenaClient
+	polls int
+}
+
+func (m *attachAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	if *input.QueryExecutionId != "00000000-0000-0000-0000-000000000000" {
+		return m.mockAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+	}
+	m.polls++
+	state := athena.QueryExecutionStateRunning
+	if m.polls > 1 {
+		state = athena.QueryExecutionStateSucceeded
+	}
+	return &athena.GetQueryExecutionOutput{
+		QueryExecution: &athena.QueryExecution{
+			QueryExecutionId: input.QueryExecutionId,
+			Status:           &athena.QueryExecutionStatus{State: aws.String(state)},
+			StatementType:    aws.String(athena.StatementTypeDml),
+		},
+	}, nil
+}
+
+func TestConnection_AttachQuery(t *testing.T) {
+	athenaClient := &attachAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetPollInterval(time.Millisecond)
+
+	rows, err := c.AttachQuery(context.Background(), "00000000-0000-0000-0000-000000000000")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, athenaClient.polls)
+	assert.NotNil(t, rows)
+	assert.Nil(t, rows.Close())
+
+	rows, err = c.QueryContext(context.Background(), "pc:attach 00000000-0000-0000-0000-000000000000", nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+
+	// a failed query execution can't be attached
+	_, err = c.QueryContext(context.Background(), "pc:attach c89088ab-595d-4ee6-a9ce-73b55aeb8111", nil)
+	assert.Equal(t, ErrTestMockGeneric, err)
+
+	_, err = c.QueryContext(context.Background(), "pc:attach SELECT 1", nil)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
+
+// openRowsAthenaClient has query executions in the states of states.
+type openRowsAthenaClient struct {
+	*mockAthenaClient
+	states map[string]string
+}
+
+func (m *openRowsAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	state, ok := m.states[*input.QueryExecutionId]
+	if !ok {
+		return m.mockAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+	}
+	return &athena.GetQueryExecutionOutput{
+		QueryExecution: &athena.QueryExecution{
+			QueryExecutionId: input.QueryExecutionId,
+			Status: &athena.QueryExecutionStatus{
+				State:             aws.String(state),
+				StateChangeReason: aws.String("SYNTAX_ERROR: line 1:8"),
+			},
+			StatementType: aws.String(athena.StatementTypeDml),
+		},
+	}, nil
+}
+
+func TestConnection_OpenRowsFromQueryID(t *testing.T) {
+	athenaClient := &openRowsAthenaClient{
+		mockAthenaClient: newMockAthenaClient(),
+		states: map[string]string{
+			"00000000-0000-0000-0000-000000000000": athena.QueryExecutionStateSucceeded,
+			"00000000-0000-0000-0000-000000000001": athena.QueryExecutionStateRunning,
+			"00000000-0000-0000-0000-000000000002": athena.QueryExecutionStateFailed,
+			"00000000-0000-0000-0000-000000000003": athena.QueryExecutionStateCancelled,
+		},
+	}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+
+	rows, err := c.OpenRowsFromQueryID(context.Background(), "00000000-0000-0000-0000-000000000000")
+	assert.Nil(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", rows.(*Rows).QueryExecutionID())
+	assert.Nil(t, rows.Close())
+
+	// the query execution isn't waited for
+	_, err = c.OpenRowsFromQueryID(context.Background(), "00000000-0000-0000-0000-000000000001")
+	assert.True(t, errors.Is(err, ErrQueryRunning))
+	var queryErr *QueryError
+	assert.True(t, errors.As(err, &queryErr))
+	assert.Equal(t, athena.QueryExecutionStateRunning, queryErr.State)
+
+	_, err = c.OpenRowsFromQueryID(context.Background(), "00000000-0000-0000-0000-000000000002")
+	assert.True(t, errors.Is(err, ErrSyntax))
+	_, err = c.OpenRowsFromQueryID(context.Background(), "00000000-0000-0000-0000-000000000003")
+	assert.True(t, errors.Is(err, ErrQueryCancelled))
+
+	_, err = c.OpenRowsFromQueryID(context.Background(), "c89088ab-595d-4ee6-a9ce-73b55aeb8111")
+	assert.Equal(t, ErrTestMockGeneric, err)
+	_, err = c.OpenRowsFromQueryID(context.Background(), "SELECT 1")
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
+
+func TestConnection_QueryContext_QueryDeduplication(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, athenaClient.inputs[0].ClientRequestToken)
+
+	c.connector.config.SetQueryDeduplication(true)
+	for _, ctx := range []context.Context{
+		context.Background(),
+		context.Background(),
+		WithDatabase(context.Background(), "tenant_a"),
+	} {
+		_, err = c.QueryContext(ctx, "SELECT 1", nil)
+		assert.Nil(t, err)
+	}
+	_, err = c.QueryContext(context.Background(), "SELECT 2", nil)
+	assert.Nil(t, err)
+	tokens := make([]string, 0, 4)
+	for _, input := range athenaClient.inputs[1:] {
+		tokens = append(tokens, *input.ClientRequestToken)
+	}
+	assert.Len(t, tokens[0], 64)
+	assert.Equal(t, tokens[0], tokens[1])
+	assert.NotEqual(t, tokens[0], tokens[2])
+	assert.NotEqual(t, tokens[0], tokens[3])
+
+	// the same query gets another token in the next time window
+	input := athenaClient.inputs[1]
+	assert.NotEqual(t, clientRequestToken(input, 0, 1), clientRequestToken(input, 0, 2))
+	c.connector.config.SetQueryDeduplicationWindow(time.Nanosecond)
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.NotEqual(t, tokens[0], *athenaClient.inputs[5].ClientRequestToken)
+}
+
+// runningAthenaClient runs the queries until they are stopped.
+type runningAthenaClient struct {
+	queryContextAthenaClient
+	mu      sync.Mutex
+	stopped []string
+	stopErr error
+}
+
+func (m *runningAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	if ctx.Err() != nil {
+		return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := athena.QueryExecutionStateRunning
+	for _, id := range m.stopped {
+		if id == *input.QueryExecutionId {
+			state = athena.QueryExecutionStateCancelled
+		}
+	}
+	return &athena.GetQueryExecutionOutput{
+		QueryExecution: &athena.QueryExecution{
+			QueryExecutionId: input.QueryExecutionId,
+			Status:           &athena.QueryExecutionStatus{State: aws.String(state)},
+			StatementType:    aws.String(athena.StatementTypeDml),
+		},
+	}, nil
+}
+
+func (m *runningAthenaClient) StopQueryExecutionWithContext(ctx aws.Context, input *athena.StopQueryExecutionInput,
+	opts ...request.Option) (*athena.StopQueryExecutionOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopErr != nil {
+		return nil, m.stopErr
+	}
+	m.stopped = append(m.stopped, *input.QueryExecutionId)
+	return &athena.StopQueryExecutionOutput{}, nil
+}
+
+func TestConnection_QueryContext_QueryTimeout(t *testing.T) {
+	athenaClient := &runningAthenaClient{queryContextAthenaClient: queryContextAthenaClient{
+		mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetPollInterval(time.Millisecond)
+	c.connector.config.SetQueryTimeout(20 * time.Millisecond)
+
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.True(t, errors.Is(err, ErrQueryTimeout))
+	var timeoutErr *QueryTimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, "PING_OK_QID", timeoutErr.QueryID)
+	assert.Equal(t, 20*time.Millisecond, timeoutErr.Timeout)
+	assert.Equal(t, []string{"PING_OK_QID"}, athenaClient.stopped)
+
+	// the timeout in context overrides the one in Config
+	athenaClient.stopped = nil
+	start := time.Now()
+	_, err = c.QueryContext(WithQueryTimeout(context.Background(), 5*time.Millisecond), "SELECT 1", nil)
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, 5*time.Millisecond, timeoutErr.Timeout)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// the timeout isn't replaced by the error of the stop
+	athenaClient.stopped = nil
+	athenaClient.stopErr = awserr.New(athena.ErrCodeInternalServerException, "internal error", nil)
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.True(t, errors.Is(err, ErrQueryTimeout))
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, athenaClient.stopErr, timeoutErr.StopErr)
+	var awsErr awserr.Error
+	assert.True(t, errors.As(err, &awsErr))
+	assert.Contains(t, err.Error(), "failed to stop")
+}
+
+func TestConnection_QueryContext_StopOnCancel(t *testing.T) {
+	athenaClient := &runningAthenaClient{queryContextAthenaClient: queryContextAthenaClient{
+		mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetPollInterval(time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, []string{"PING_OK_QID"}, athenaClient.stopped)
+
+	// the query is stopped if ctx is done while its status is checked too
+	athenaClient.stopped = nil
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"PING_OK_QID"}, athenaClient.stopped)
+}
+
+// scanningAthenaClient runs queries scanning 100 more bytes at each poll.
+type scanningAthenaClient struct {
+	runningAthenaClient
+	scanned int64
+}
+
+func (m *scanningAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	out, err := m.runningAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.scanned += 100
+	out.QueryExecution.Statistics = &athena.QueryExecutionStatistics{DataScannedInBytes: aws.Int64(m.scanned)}
+	return out, nil
+}
+
+func TestConnection_QueryContext_MaxScannedBytes(t *testing.T) {
+	athenaClient := &scanningAthenaClient{runningAthenaClient: runningAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetPollInterval(time.Millisecond)
+	c.connector.config.SetMaxScannedBytes(250)
+
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.True(t, errors.Is(err, ErrBudgetExceeded))
+	var budgetErr *BudgetExceededError
+	assert.True(t, errors.As(err, &budgetErr))
+	assert.Equal(t, "PING_OK_QID", budgetErr.QueryID)
+	assert.Equal(t, int64(250), budgetErr.MaxScannedBytes)
+	// the final statistics are checked when the stop is confirmed
+	assert.Equal(t, int64(400), budgetErr.DataScannedInBytes)
+	assert.Equal(t, []string{"PING_OK_QID"}, athenaClient.stopped)
+}
+
+func TestConnection_QueryContext_MetricsTags(t *testing.T) {
+	c := &Connection{
+		athenaAPI: &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetMetrics(true)
+	c.connector.config.SetDB("sales")
+	scope := tally.NewTestScope("", nil)
+	c.connector.tracer.SetScope(scope)
+
+	ctx := WithCostTag(WithWorkgroup(context.Background(), DefaultWGName), "finance")
+	_, err := c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	timers := scope.Snapshot().Timers()
+	assert.NotNil(t, timers[DriverName+
+		".query.queryexecutionstatesucceeded+caller=finance,database=sales,resultmode=API,workgroup=primary"])
+	assert.Nil(t, timers[DriverName+".query.queryexecutionstatesucceeded+"])
+}
@@ -23,9 +23,11 @@ package athenadriver
 import (
 	"context"
 	"database/sql/driver"
+	"net/http"
 
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/uber-go/tally"
@@ -33,14 +35,84 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"github.com/aws/aws-sdk-go/service/lakeformation"
+	"github.com/aws/aws-sdk-go/service/lakeformation/lakeformationiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 )
 
 // SQLConnector is the connector for AWS Athena Driver.
+// There is no package-level client cache: unless a client or session is injected, every connection gets
+// its own Athena client, so credentials are never shared across separate sql.DB pools.
 type SQLConnector struct {
 	config *Config
 	tracer *DriverTracer
+
+	// session, athenaAPI and s3API are set when the application manages its own AWS setup.
+	session   *session.Session
+	athenaAPI athenaiface.AthenaAPI
+	s3API     s3iface.S3API
+
+	// httpClient is shared by all connections, so they share the HTTP connection pool.
+	httpClientOnce sync.Once
+	httpClient     *http.Client
+
+	// queryEvents is shared by all connections, so a single goroutine receives the query events.
+	queryEventsOnce sync.Once
+	queryEvents     *queryEventListener
+
+	// rateLimiters are shared by all connections, by region, so they back off together when throttled.
+	rateLimitersMu sync.Mutex
+	rateLimiters   map[string]*rateLimiters
+
+	// costs are the totals of all connections.
+	costs costAccountant
+
+	// capacityWGs are the workgroups found assigned to capacity reservations, by all connections.
+	capacityWGs sync.Map
+
+	// resultReaper deletes the expired result objects of all connections, if a result TTL is set in Config.
+	resultReaperOnce sync.Once
+	resultReaper     *resultReaper
+}
+
+// NewConnector is to create a SQLConnector from Config, to be used with sql.OpenDB.
+// Unlike a DSN, the Config can carry objects like a custom credentials provider.
+func NewConnector(config *Config) *SQLConnector {
+	return &SQLConnector{
+		config: config,
+		tracer: NewDefaultObservability(config),
+	}
+}
+
+// NewConnectorWithSession is to create a SQLConnector reusing an AWS session managed by the application,
+// with its own credentials, retryer, HTTP client and request handlers.
+func NewConnectorWithSession(config *Config, sess *session.Session) *SQLConnector {
+	c := NewConnector(config)
+	c.session = sess
+	return c
+}
+
+// NewConnectorWithClient is to create a SQLConnector using an existing Athena client, like a mock in unit tests.
+// No AWS session is created by the connector then, credential settings in Config are not used.
+func NewConnectorWithClient(config *Config, client athenaiface.AthenaAPI) *SQLConnector {
+	c := NewConnector(config)
+	c.athenaAPI = client
+	return c
+}
+
+// NewConnectorWithClients is to create a SQLConnector using existing Athena and S3 clients.
+// The S3 client downloads query results in ResultModeDL.
+func NewConnectorWithClients(config *Config, athenaClient athenaiface.AthenaAPI, s3Client s3iface.S3API) *SQLConnector {
+	c := NewConnectorWithClient(config, athenaClient)
+	c.s3API = s3Client
+	return c
 }
 
 // NoopsSQLConnector is to create a noops SQLConnector.
@@ -57,32 +129,132 @@ func (c *SQLConnector) Driver() driver.Driver {
 	return &SQLDriver{}
 }
 
-// Connect is to create an AWS session.
-// The order to find auth information to create session is:
-// 1. Manually set  AWS profile in Config by calling config.SetAWSProfile(profileName)
-// 2. AWS_SDK_LOAD_CONFIG
-// 3. Static Credentials
-// Ref: https://docs.aws.amazon.com/sdk-for-go/v1/developer-guide/configuring-sdk.html
+// Connect is to create a connection with the Athena client passed to NewConnectorWithClient,
+// or a client of a new AWS session. With a new session, clients of the fallback regions in Config are
+// created as well, so queries can fail over when Athena in the region of Config is unavailable.
 func (c *SQLConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	ctx, span := startSpan(ctx, c.config, "athenadriver.Connect")
+	conn, err := c.connect(ctx)
+	endSpan(span, err)
+	return conn, err
+}
+
+func (c *SQLConnector) connect(ctx context.Context) (driver.Conn, error) {
 	now := time.Now()
 	c.tracer = NewDefaultObservability(c.config)
 	if metrics, ok := ctx.Value(MetricsKey).(tally.Scope); ok {
 		c.tracer.SetScope(metrics)
+	} else if registerer := c.config.GetPrometheusRegisterer(); registerer != nil {
+		c.tracer.SetScope(getPrometheusScope(registerer, c.tracer))
 	}
 	if logger, ok := ctx.Value(LoggerKey).(*zap.Logger); ok {
 		c.tracer.SetLogger(logger)
+	} else if c.config.logger != nil {
+		c.tracer.SetLogger(c.config.logger)
 	}
 
+	athenaAPI := c.athenaAPI
+	s3API := c.s3API
+	var fallbacks []regionalAthenaAPI
+	var lakeFormationAPI lakeformationiface.LakeFormationAPI
+	var stsAPI stsiface.STSAPI
+	if athenaAPI == nil {
+		awsAthenaSession, err := c.newSession(ctx)
+		if err != nil {
+			c.tracer.Scope().Counter(DriverName + ".failure.sqlconnector.newsession").Inc(1)
+			return nil, err
+		}
+		athenaAPI = athena.New(awsAthenaSession, c.athenaClientConfig())
+		s3API = newResultS3API(awsAthenaSession, c.config, c.tracer)
+		if c.config.IsLakeFormationPreflight() {
+			lakeFormationAPI = lakeformation.New(awsAthenaSession)
+			stsAPI = sts.New(awsAthenaSession)
+		}
+		if queueURL := c.config.GetQueryEventsQueue(); queueURL != "" {
+			c.queryEventsOnce.Do(func() {
+				c.queryEvents = newQueryEventListener(sqs.New(awsAthenaSession), queueURL, c.tracer)
+			})
+		}
+		for _, region := range c.config.GetFallbackRegions() {
+			clientConfig := c.athenaClientConfig().WithRegion(region)
+			fallbacks = append(fallbacks, regionalAthenaAPI{
+				region:    region,
+				athenaAPI: limitAthenaAPI(athena.New(awsAthenaSession, clientConfig), c.getRateLimiters(region), c.tracer),
+			})
+		}
+	}
+	athenaAPI = limitAthenaAPI(athenaAPI, c.getRateLimiters(c.config.GetRegion()), c.tracer)
+	if s3API != nil && c.config.GetResultTTL() > 0 {
+		c.resultReaperOnce.Do(func() {
+			c.resultReaper = newResultReaper(s3API, c.config, c.tracer)
+			go c.resultReaper.run()
+		})
+	}
+	timeConnect := time.Since(now)
+	conn := &Connection{
+		athenaAPI: athenaAPI,
+		s3API:     s3API,
+		fallbacks: fallbacks,
+		connector: c,
+
+		lakeFormationAPI: lakeFormationAPI,
+		stsAPI:           stsAPI,
+	}
+	if c.config.IsEngineVersionCheck() {
+		conn.detectEngineVersion(ctx)
+	}
+	c.tracer.Scope().Timer(DriverName + ".connector.connect").Record(timeConnect)
+	return conn, nil
+}
+
+// newSession is to create an AWS session, or reuse the one passed to NewConnectorWithSession.
+// A custom credentials.Provider in context with key CredentialsProviderKey, or set in Config by calling
+// config.SetCredentialsProvider(provider), takes precedence over any other way to get credentials.
+// If an AWS SSO profile is set in Config by calling config.SetSSOProfile(profileName), credentials of
+// that profile are used. With config.SetCredentialsMode(CredentialsModeWebIdentity), the web identity
+// token in ${AWS_WEB_IDENTITY_TOKEN_FILE} is exchanged for credentials of ${AWS_ROLE_ARN}.
+// With config.SetCredentialsMode(CredentialsModeSharedConfig), the AWS profile is loaded from shared config
+// files, credential_process included, even if AWS_SDK_LOAD_CONFIG is not set.
+// Otherwise, the order to find auth information to create session is:
+// 1. Manually set  AWS profile in Config by calling config.SetAWSProfile(profileName)
+// 2. AWS_SDK_LOAD_CONFIG
+// 3. Static Credentials
+// If an IAM role is set in Config by calling config.SetAssumeRole(roleARN, externalID, sessionName),
+// the credentials found above are used to assume the role with STS. Roles requiring MFA get the token code
+// from the MFATokenProvider in context with key MFATokenProviderKey, or set by config.SetMFATokenProvider.
+// Ref: https://docs.aws.amazon.com/sdk-for-go/v1/developer-guide/configuring-sdk.html
+func (c *SQLConnector) newSession(ctx context.Context) (*session.Session, error) {
 	var awsAthenaSession *session.Session
 	var err error
+	httpClient := c.getHTTPClient()
 	// respect AWS_SDK_LOAD_CONFIG and local ~/.aws/credentials, ~/.aws/config
-	if ok, _ := strconv.ParseBool(os.Getenv("AWS_SDK_LOAD_CONFIG")); ok {
+	if c.session != nil {
+		awsAthenaSession = c.session
+	} else if provider := c.getCredentialsProvider(ctx); provider != nil {
+		awsAthenaSession, err = newAWSSession(c.config, &aws.Config{
+			Region:      aws.String(c.config.GetRegion()),
+			Credentials: credentials.NewCredentials(provider),
+			HTTPClient:  httpClient,
+		})
+	} else if c.config.GetCredentialsMode() == CredentialsModeSSO {
+		awsAthenaSession, err = newSSOSession(ctx, c.config, httpClient)
+	} else if c.config.GetCredentialsMode() == CredentialsModeWebIdentity {
+		awsAthenaSession, err = newWebIdentitySession(c.config, httpClient)
+	} else if c.config.GetCredentialsMode() == CredentialsModeSharedConfig {
+		awsAthenaSession, err = newSharedConfigSession(c.config, c.getMFATokenProvider(ctx), httpClient)
+	} else if ok, _ := strconv.ParseBool(os.Getenv("AWS_SDK_LOAD_CONFIG")); ok {
 		if profile := c.config.GetAWSProfile(); profile != "" {
-			awsAthenaSession, err = session.NewSession(&aws.Config{
+			awsAthenaSession, err = newAWSSession(c.config, &aws.Config{
 				Credentials: credentials.NewSharedCredentials("", profile),
+				HTTPClient:  httpClient,
 			})
 		} else {
-			awsAthenaSession, err = session.NewSession(&aws.Config{})
+			awsAthenaSession, err = newAWSSessionWithOptions(c.config, session.Options{
+				Config: aws.Config{
+					HTTPClient: httpClient,
+				},
+				AssumeRoleTokenProvider: c.getMFATokenProvider(ctx),
+			})
 		}
 	} else if c.config.GetAccessID() != "" {
 		staticCredentials := credentials.NewStaticCredentials(c.config.GetAccessID(),
@@ -91,24 +263,81 @@ func (c *SQLConnector) Connect(ctx context.Context) (driver.Conn, error) {
 		awsConfig := &aws.Config{
 			Region:      aws.String(c.config.GetRegion()),
 			Credentials: staticCredentials,
+			HTTPClient:  httpClient,
 		}
-		awsAthenaSession, err = session.NewSession(awsConfig)
+		awsAthenaSession, err = newAWSSession(c.config, awsConfig)
 	} else {
-		awsAthenaSession, err = session.NewSession(&aws.Config{
-			Region: aws.String(c.config.GetRegion()),
+		awsAthenaSession, err = newAWSSession(c.config, &aws.Config{
+			Region:     aws.String(c.config.GetRegion()),
+			HTTPClient: httpClient,
 		})
 	}
 	if err != nil {
-		c.tracer.Scope().Counter(DriverName + ".failure.sqlconnector.newsession").Inc(1)
 		return nil, err
 	}
+	if c.config.GetRoleARN() != "" {
+		awsAthenaSession = awsAthenaSession.Copy(&aws.Config{
+			Credentials: newAssumeRoleCredentials(awsAthenaSession, c.config, c.getMFATokenProvider(ctx)),
+		})
+	}
+	if window := c.config.GetCredentialRefreshWindow(); window > 0 {
+		awsAthenaSession = awsAthenaSession.Copy(&aws.Config{
+			Credentials: newRefreshingCredentials(awsAthenaSession.Config.Credentials, window),
+		})
+	}
+	return awsAthenaSession, nil
+}
 
-	athenaAPI := athena.New(awsAthenaSession)
-	timeConnect := time.Since(now)
-	conn := &Connection{
-		athenaAPI: athenaAPI,
-		connector: c,
+// athenaClientConfig is to get the client settings applied on top of the session to create the Athena client.
+func (c *SQLConnector) athenaClientConfig() *aws.Config {
+	clientConfig := &aws.Config{}
+	if c.config.IsFIPSEndpoint() {
+		clientConfig.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
 	}
-	c.tracer.Scope().Timer(DriverName + ".connector.connect").Record(timeConnect)
-	return conn, nil
+	if c.config.IsDualStackEndpoint() {
+		clientConfig.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+	if endpoint := c.config.GetEndpoint(); endpoint != "" {
+		clientConfig.Endpoint = aws.String(endpoint)
+	}
+	return clientConfig
+}
+
+// getHTTPClient is to get the HTTP client with the HTTP settings in Config, created at the first call.
+func (c *SQLConnector) getHTTPClient() *http.Client {
+	c.httpClientOnce.Do(func() {
+		c.httpClient = newHTTPClient(c.config)
+	})
+	return c.httpClient
+}
+
+// getRateLimiters is to get the limiters of the Athena APIs in region, nil if no rate limit is set in Config.
+func (c *SQLConnector) getRateLimiters(region string) *rateLimiters {
+	c.rateLimitersMu.Lock()
+	defer c.rateLimitersMu.Unlock()
+	if l, ok := c.rateLimiters[region]; ok {
+		return l
+	}
+	if c.rateLimiters == nil {
+		c.rateLimiters = make(map[string]*rateLimiters)
+	}
+	l := newRateLimiters(c.config)
+	c.rateLimiters[region] = l
+	return l
+}
+
+// getCredentialsProvider is to get the custom credentials provider from context or Config.
+func (c *SQLConnector) getCredentialsProvider(ctx context.Context) credentials.Provider {
+	if provider, ok := ctx.Value(CredentialsProviderKey).(credentials.Provider); ok && provider != nil {
+		return provider
+	}
+	return c.config.GetCredentialsProvider()
+}
+
+// getMFATokenProvider is to get the MFA token provider from context or Config.
+func (c *SQLConnector) getMFATokenProvider(ctx context.Context) MFATokenProvider {
+	if tokenProvider, ok := ctx.Value(MFATokenProviderKey).(MFATokenProvider); ok && tokenProvider != nil {
+		return tokenProvider
+	}
+	return c.config.GetMFATokenProvider()
 }
@@ -22,10 +22,16 @@ package athenadriver
 
 import (
 	"context"
+	"database/sql"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/stretchr/testify/assert"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
@@ -163,3 +169,207 @@ func TestSQLConnector_Driver(t *testing.T) {
 	}
 	assert.NotNil(t, connector.Driver())
 }
+
+func TestSQLConnector_Connect_AssumeRole(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetRegion("ap-southeast-1")
+	_ = testConf.SetAccessID("testid")
+	_ = testConf.SetSecretAccessKey("testkey")
+	_ = testConf.SetAssumeRole("arn:aws:iam::123456789012:role/athena-reader", "ext-123", "")
+	connector := &SQLConnector{
+		config: testConf,
+		tracer: NewDefaultObservability(testConf),
+	}
+
+	conn, err := connector.Connect(context.Background())
+	assert.Nil(t, err)
+	assert.NotNil(t, conn)
+}
+
+func TestSQLConnector_Connect_CredentialRefreshWindow(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetAccessID("testid")
+	_ = testConf.SetSecretAccessKey("testkey")
+	testConf.SetCredentialRefreshWindow(5 * time.Minute)
+	connector := &SQLConnector{
+		config: testConf,
+		tracer: NewDefaultObservability(testConf),
+	}
+
+	conn, err := connector.Connect(context.Background())
+	assert.Nil(t, err)
+	v, err := conn.(*Connection).athenaAPI.(*athena.Athena).Config.Credentials.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "testid", v.AccessKeyID)
+}
+
+func TestNewConnector(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	connector := NewConnector(testConf)
+	assert.Equal(t, testConf, connector.config)
+	assert.NotNil(t, connector.tracer)
+	db := sql.OpenDB(connector)
+	assert.NotNil(t, db)
+	assert.Nil(t, db.Close())
+}
+
+func TestSQLConnector_Connect_CredentialsProvider(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetAccessID("testid")
+	_ = testConf.SetSecretAccessKey("testkey")
+	testConf.SetCredentialsProvider(&credentials.StaticProvider{Value: credentials.Value{
+		AccessKeyID:     "configid",
+		SecretAccessKey: "configkey",
+	}})
+	connector := NewConnector(testConf)
+
+	conn, err := connector.Connect(context.Background())
+	assert.Nil(t, err)
+	v, err := conn.(*Connection).athenaAPI.(*athena.Athena).Config.Credentials.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "configid", v.AccessKeyID)
+
+	ctx := context.WithValue(context.Background(), CredentialsProviderKey,
+		credentials.Provider(&credentials.StaticProvider{Value: credentials.Value{
+			AccessKeyID:     "contextid",
+			SecretAccessKey: "contextkey",
+		}}))
+	conn, err = connector.Connect(ctx)
+	assert.Nil(t, err)
+	v, err = conn.(*Connection).athenaAPI.(*athena.Athena).Config.Credentials.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "contextid", v.AccessKeyID)
+}
+
+func TestNewConnectorWithClient(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	mock := newMockAthenaClient()
+	mock.GetWGStatus = true
+	db := sql.OpenDB(NewConnectorWithClient(testConf, mock))
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	assert.Nil(t, err)
+	defer conn.Close()
+	err = conn.Raw(func(driverConn interface{}) error {
+		assert.Equal(t, mock, driverConn.(*Connection).athenaAPI)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, conn.PingContext(context.Background()))
+}
+
+func TestNewConnectorWithSession(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("sessionid", "sessionkey", ""),
+		MaxRetries:  aws.Int(7),
+	})
+	assert.Nil(t, err)
+	conn, err := NewConnectorWithSession(testConf, sess).Connect(context.Background())
+	assert.Nil(t, err)
+	client := conn.(*Connection).athenaAPI.(*athena.Athena)
+	assert.Equal(t, "eu-west-1", *client.Config.Region)
+	assert.Equal(t, 7, *client.Config.MaxRetries)
+	v, err := client.Config.Credentials.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "sessionid", v.AccessKeyID)
+	assert.Equal(t, "eu-west-1", *conn.(*Connection).s3API.(*s3.S3).Config.Region)
+}
+
+func TestNewConnectorWithClients(t *testing.T) {
+	athenaClient := newMockAthenaClient()
+	s3Client := &s3.S3{}
+	conn, err := NewConnectorWithClients(NewNoOpsConfig(), athenaClient, s3Client).Connect(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, athenaClient, conn.(*Connection).athenaAPI)
+	assert.Equal(t, s3Client, conn.(*Connection).s3API)
+
+	conn, err = NewConnectorWithClient(NewNoOpsConfig(), athenaClient).Connect(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, conn.(*Connection).s3API)
+}
+
+func TestSQLConnector_Connect_NoSharedClient(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetAccessID("id1")
+	_ = testConf.SetSecretAccessKey("key1")
+	conn1, err := NewConnector(testConf).Connect(context.Background())
+	assert.Nil(t, err)
+
+	anotherConf := NewNoOpsConfig()
+	_ = anotherConf.SetAccessID("id2")
+	_ = anotherConf.SetSecretAccessKey("key2")
+	conn2, err := NewConnector(anotherConf).Connect(context.Background())
+	assert.Nil(t, err)
+
+	client1 := conn1.(*Connection).athenaAPI.(*athena.Athena)
+	client2 := conn2.(*Connection).athenaAPI.(*athena.Athena)
+	assert.NotSame(t, client1, client2)
+	v1, _ := client1.Config.Credentials.Get()
+	v2, _ := client2.Config.Credentials.Get()
+	assert.Equal(t, "id1", v1.AccessKeyID)
+	assert.Equal(t, "id2", v2.AccessKeyID)
+}
+
+func TestSQLConnector_Connect_FIPSDualStackEndpoint(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetRegion("us-gov-west-1")
+	_ = testConf.SetAccessID("id")
+	_ = testConf.SetSecretAccessKey("key")
+	testConf.SetFIPSEndpoint(true)
+	conn, err := NewConnector(testConf).Connect(context.Background())
+	assert.Nil(t, err)
+	client := conn.(*Connection).athenaAPI.(*athena.Athena)
+	assert.Equal(t, "https://athena-fips.us-gov-west-1.amazonaws.com", client.Endpoint)
+
+	testConf = NewNoOpsConfig()
+	_ = testConf.SetRegion("us-east-1")
+	_ = testConf.SetAccessID("id")
+	_ = testConf.SetSecretAccessKey("key")
+	testConf.SetDualStackEndpoint(true)
+	conn, err = NewConnector(testConf).Connect(context.Background())
+	assert.Nil(t, err)
+	client = conn.(*Connection).athenaAPI.(*athena.Athena)
+	assert.Equal(t, "https://athena.us-east-1.api.aws", client.Endpoint)
+}
+
+func TestSQLConnector_Connect_Endpoint(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetAccessID("id")
+	_ = testConf.SetSecretAccessKey("key")
+	_ = testConf.SetEndpoint("https://vpce-123-abc.athena.us-east-1.vpce.amazonaws.com")
+	testConf.SetFIPSEndpoint(true)
+	conn, err := NewConnector(testConf).Connect(context.Background())
+	assert.Nil(t, err)
+	client := conn.(*Connection).athenaAPI.(*athena.Athena)
+	assert.Equal(t, "https://vpce-123-abc.athena.us-east-1.vpce.amazonaws.com", client.Endpoint)
+}
+
+func TestSQLConnector_getMFATokenProvider(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	connector := NewConnector(testConf)
+	assert.Nil(t, connector.getMFATokenProvider(context.Background()))
+
+	testConf.SetMFATokenProvider(func() (string, error) { return "config", nil })
+	token, _ := connector.getMFATokenProvider(context.Background())()
+	assert.Equal(t, "config", token)
+
+	ctx := context.WithValue(context.Background(), MFATokenProviderKey,
+		MFATokenProvider(func() (string, error) { return "context", nil }))
+	token, _ = connector.getMFATokenProvider(ctx)()
+	assert.Equal(t, "context", token)
+}
+
+func TestSQLConnector_Connect_FallbackRegions(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetAccessID("id")
+	_ = testConf.SetSecretAccessKey("key")
+	testConf.SetFallbackRegions([]string{"us-west-2"})
+	conn, err := NewConnector(testConf).Connect(context.Background())
+	assert.Nil(t, err)
+	fallbacks := conn.(*Connection).fallbacks
+	assert.Len(t, fallbacks, 1)
+	assert.Equal(t, "us-west-2", fallbacks[0].region)
+	assert.Equal(t, "us-west-2", *fallbacks[0].athenaAPI.(*athena.Athena).Config.Region)
+}
@@ -30,6 +30,9 @@ const (
 	// DefaultBytesScannedCutoffPerQuery is 1G for every user.
 	DefaultBytesScannedCutoffPerQuery = 1024 * 1024 * 1024
 
+	// MinBytesScannedCutoffPerQuery is the lowest BytesScannedCutoffPerQuery Athena accepts, 10MB.
+	MinBytesScannedCutoffPerQuery = 10000000
+
 	// DefaultDBName is the default database name in Athena.
 	DefaultDBName = "default"
 
@@ -42,6 +45,9 @@ const (
 	// DefaultDataSource is the default data source in Athena.
 	DefaultDataSource = "AwsDataCatalog"
 
+	// DefaultRoleSessionName is the session name used for STS AssumeRole if not set in Config.
+	DefaultRoleSessionName = "athenadriver"
+
 	// TimestampUniXFormat is from https://docs.aws.amazon.com/athena/latest/ug/data-types.html.
 	// https://stackoverflow.com/questions/20530327/origin-of-mon-jan-2-150405-mst-2006-in-golang
 	// RFC3339 is not supported by AWS Athena. It uses session timezone!.
@@ -59,6 +65,64 @@ const (
 	// LoggerKey is the key for Logger in context
 	LoggerKey = TContextKey("LoggerKey")
 
+	// CredentialsProviderKey is the key for credentials.Provider in context
+	CredentialsProviderKey = TContextKey("CredentialsProviderKey")
+
+	// MFATokenProviderKey is the key for MFATokenProvider in context
+	MFATokenProviderKey = TContextKey("MFATokenProviderKey")
+
+	// CatalogKey is the key for the data catalog of a query in context, overriding the catalog in Config
+	CatalogKey = TContextKey("CatalogKey")
+
+	// DatabaseKey is the key for the database of a query in context, overriding the database in Config
+	DatabaseKey = TContextKey("DatabaseKey")
+
+	// WorkgroupKey is the key for the workgroup name of a query in context, overriding the workgroup in Config
+	WorkgroupKey = TContextKey("WorkgroupKey")
+
+	// OutputLocationKey is the key for the S3 output location of a query in context,
+	// overriding the output bucket in Config
+	OutputLocationKey = TContextKey("OutputLocationKey")
+
+	// ResultReuseKey is the key for the ResultReuse of a query in context, overriding the result reuse in Config
+	ResultReuseKey = TContextKey("ResultReuseKey")
+
+	// ResultReusedKey is the key for a *bool in context, which is set to whether the query result was reused
+	ResultReusedKey = TContextKey("ResultReusedKey")
+
+	// QueryTimeoutKey is the key for the time.Duration a query can run in context, overriding the query timeout in Config
+	QueryTimeoutKey = TContextKey("QueryTimeoutKey")
+
+	// StatsKey is the key for a *StatsCollector in context, which gets the QueryStats of each query complete
+	StatsKey = TContextKey("StatsKey")
+
+	// CostTagKey is the key for the caller tag of a query in context, to report the cost of the queries by caller
+	CostTagKey = TContextKey("CostTagKey")
+
+	// QueryLabelsKey is the key for the labels of the query annotations in context
+	QueryLabelsKey = TContextKey("QueryLabelsKey")
+
+	// LogLevelKey is the key for the zapcore.Level the queries with a context are logged from
+	LogLevelKey = TContextKey("LogLevelKey")
+
+	// PriorityKey is the key for the Priority of a query in context, in the queue of the concurrent queries
+	PriorityKey = TContextKey("PriorityKey")
+
+	// PartitionProgressKey is the key for the PartitionProgress of Connection.AddPartitions in context
+	PartitionProgressKey = TContextKey("PartitionProgressKey")
+
+	// TimeTravelKey is the key for the snapshots of the Iceberg tables read by the queries with a context
+	TimeTravelKey = TContextKey("TimeTravelKey")
+
+	// ResultModeKey is the key for the ResultMode of a query in context, overriding the result mode in Config
+	ResultModeKey = TContextKey("ResultModeKey")
+
+	// PartitionGuardKey is the key for the PartitionGuardMode of a query in context, overriding the one in Config
+	PartitionGuardKey = TContextKey("PartitionGuardKey")
+
+	// ResultCacheKey is the key for the opt-out of the queries with a context from the result cache of Config
+	ResultCacheKey = TContextKey("ResultCacheKey")
+
 	// DummyRegion is used when AWS CLI Config is used, ie AWS_SDK_LOAD_CONFIG is set
 	DummyRegion = "dummy"
 
@@ -80,10 +144,50 @@ const (
 	// PoolInterval is the interval between two status checks(unit second).
 	PoolInterval = 3
 
+	// DefaultPriorityAging is the default wait for a queued query to go up one priority(unit second).
+	DefaultPriorityAging = 30
+
+	// DefaultQueryRetryBackoff is the default wait before the first retry of a query(unit second).
+	DefaultQueryRetryBackoff = 1
+
+	// StopQueryTimeout is the time to stop a query and confirm it is stopped, once its context is done(unit second).
+	StopQueryTimeout = 10
+
+	// DefaultPollInitialInterval is the first interval between two status checks in PollModeBackoff(unit millisecond).
+	DefaultPollInitialInterval = 250
+
+	// DefaultPollMaxInterval is the maximum interval between two status checks in PollModeBackoff(unit second).
+	DefaultPollMaxInterval = 10
+
+	// DefaultFederatedPollInitialInterval is the first interval between two status checks of the queries in
+	// federated data catalogs, whose connectors take seconds to start cold(unit second).
+	DefaultFederatedPollInitialInterval = 2
+
 	// The maximum allowed query string length is 262144 bytes,
 	// where the strings are encoded in UTF-8.
 	// This is not an adjustable quota. (unit bytes)
 	MAXQueryStringLength = 262144
+
+	// DefaultResultReuseMaxAge is the default max age of reused query results(unit minute).
+	DefaultResultReuseMaxAge = 60
+
+	// DefaultDownloadPartSize is the default size of the parts of result objects downloaded in parallel(unit byte).
+	DefaultDownloadPartSize = 8 << 20
+
+	// DefaultResultCacheTTL is the default time the rows of queries are kept in the result cache(unit second).
+	DefaultResultCacheTTL = 300
+
+	// DefaultResultCacheMaxRows is the default max number of rows of the queries kept in the result cache.
+	DefaultResultCacheMaxRows = 10000
+
+	// DefaultTxTimeout is the default time to commit or end an emulated transaction(unit second).
+	DefaultTxTimeout = 1800
+
+	// DefaultQueryDeduplicationWindow is the default time window of the deduplicated queries(unit second).
+	DefaultQueryDeduplicationWindow = 900
+
+	// MaxResultReuseMaxAge is the maximum allowed max age of reused query results, 7 days(unit minute).
+	MaxResultReuseMaxAge = 7 * 24 * 60
 )
 
 const digits01 = "0123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789"
@@ -94,7 +198,7 @@ var AthenaColumnTypes = [...]string{"tinyint", "smallint", "integer", "bigint",
 	"json", "char", "varchar", "varbinary", "row", "string", "binary",
 	"struct", "interval year to month", "interval day to second", "decimal",
 	"ipaddress", "array", "map", "unknown", "boolean", "date", "time", "time with time zone",
-	"timestamp with time zone", "timestamp", "weird_type"}
+	"timestamp with time zone", "timestamp", "geometry", "weird_type"}
 
 // pseudo commands all start with `PC_`
 
@@ -107,8 +211,27 @@ const PCGetQIDStatus = "get_query_id_status"
 // PCStopQID is the pseudo command to stop a query execution id
 const PCStopQID = "stop_query_id"
 
+// PCAttachQID is the pseudo command to wait for a query execution id to complete and get its result
+const PCAttachQID = "attach"
+
 // PCGetDriverVersion is the pseudo command to get the version of athenadriver
 const PCGetDriverVersion = "get_driver_version"
 
+// PCGetQueryExecution is the pseudo command to get the details of a query execution id, like its state,
+// statement type and scanned bytes
+const PCGetQueryExecution = "get_query_execution"
+
+// PCStop is the pseudo command to stop a query execution id like PCStopQID, and get its details once stopped
+const PCStop = "stop"
+
+// PCListExecutions is the pseudo command to get the details of the latest n query executions in the workgroup
+const PCListExecutions = "list_executions"
+
+// DefaultListExecutions is the number of query executions listed by PCListExecutions without n.
+const DefaultListExecutions = 50
+
+// MaxListExecutions is the max number of query executions listed by PCListExecutions.
+const MaxListExecutions = 1000
+
 // DriverVersion is athenadriver's version
 const DriverVersion = "1.1.14"
@@ -0,0 +1,257 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"go.uber.org/zap/zapcore"
+)
+
+// WithCatalog is to run the queries with ctx in the data catalog, instead of the one in Config. The queries in
+// federated data catalogs, like the Lambda connectors and Hive metastores registered in Athena, are polled with
+// the federated poll strategy of Config, as their connectors start slower.
+func WithCatalog(ctx context.Context, catalog string) context.Context {
+	return context.WithValue(ctx, CatalogKey, catalog)
+}
+
+// WithDatabase is to run the queries with ctx in the database, instead of the one in Config.
+func WithDatabase(ctx context.Context, db string) context.Context {
+	return context.WithValue(ctx, DatabaseKey, db)
+}
+
+// WithWorkgroup is to run the queries with ctx in the workgroup, instead of the one in Config.
+// The workgroup config and tags in Config are used if the workgroup is created remotely, and the results are
+// written to the output bucket of the workgroup set with Config.SetWGOutputBuckets, if any.
+func WithWorkgroup(ctx context.Context, wgName string) context.Context {
+	return context.WithValue(ctx, WorkgroupKey, wgName)
+}
+
+// WithOutputLocation is to write the results of the queries with ctx to the S3 location, like s3://bucket/path,
+// instead of the output bucket in Config. It doesn't apply to fallback regions, which have their own buckets.
+func WithOutputLocation(ctx context.Context, outputLocation string) context.Context {
+	return context.WithValue(ctx, OutputLocationKey, outputLocation)
+}
+
+// ResultReuse is the result reuse of a query, see Config.SetResultReuse.
+type ResultReuse struct {
+	Enabled       bool
+	MaxAgeMinutes int
+}
+
+// WithResultReuse is to set if the queries with ctx can reuse previous results at most maxAgeMinutes old,
+// instead of the result reuse in Config.
+func WithResultReuse(ctx context.Context, enabled bool, maxAgeMinutes int) context.Context {
+	return context.WithValue(ctx, ResultReuseKey, ResultReuse{Enabled: enabled, MaxAgeMinutes: maxAgeMinutes})
+}
+
+// WithQueryTimeout is to stop the queries with ctx running longer than timeout, instead of the query timeout in Config.
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, QueryTimeoutKey, timeout)
+}
+
+// WithPriority is to set the priority of the queries with ctx, when they wait for their turn because the
+// concurrent queries are limited with config.SetMaxConcurrentQueries(n).
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, PriorityKey, priority)
+}
+
+// WithStats is to collect the QueryStats of the queries with ctx in stats, after each query is complete.
+func WithStats(ctx context.Context, stats *StatsCollector) context.Context {
+	return context.WithValue(ctx, StatsKey, stats)
+}
+
+// WithQueryLabels is to set the labels of the annotations of the queries with ctx, like their request ID,
+// over the query labels of Config.
+func WithQueryLabels(ctx context.Context, labels map[string]string) context.Context {
+	return context.WithValue(ctx, QueryLabelsKey, labels)
+}
+
+// WithLogLevel is to log the queries with ctx from level, like DebugLevel to get the timeline of their polling
+// and results, whatever the level of the logger. The logging must still be enabled with SetLogging(true).
+func WithLogLevel(ctx context.Context, level zapcore.Level) context.Context {
+	return context.WithValue(ctx, LogLevelKey, level)
+}
+
+// WithCostTag is to report the cost of the queries with ctx under tag, like a team name, in CostReport and
+// in the cost metrics. The other metrics of the queries are tagged with it as their caller.
+func WithCostTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, CostTagKey, tag)
+}
+
+// WithPartitionProgress is to get the progress of Connection.AddPartitions with ctx, after each statement.
+func WithPartitionProgress(ctx context.Context, progress PartitionProgress) context.Context {
+	return context.WithValue(ctx, PartitionProgressKey, progress)
+}
+
+// WithResultMode is to fetch the rows of the queries with ctx in mode, instead of the result mode in Config.
+func WithResultMode(ctx context.Context, mode ResultMode) context.Context {
+	return context.WithValue(ctx, ResultModeKey, mode)
+}
+
+// WithPartitionGuardMode is to check the partition filters of the queries with ctx in mode, instead of the
+// partition guard mode in Config, like PartitionGuardOff for a query which reads whole tables on purpose.
+func WithPartitionGuardMode(ctx context.Context, mode PartitionGuardMode) context.Context {
+	return context.WithValue(ctx, PartitionGuardKey, mode)
+}
+
+// WithoutResultCache is to run the queries with ctx on Athena, their rows neither served from nor kept in the
+// result cache of Config, like the reads of a table just written.
+func WithoutResultCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ResultCacheKey, false)
+}
+
+// WithSnapshotID is to read the Iceberg table, like db.events or events in the database of the query, at the
+// snapshot snapshotID in the queries with ctx. The queries get FOR VERSION AS OF snapshotID after the table in
+// their FROM and JOIN clauses. It takes precedence over WithAsOfTimestamp for the table.
+func WithSnapshotID(ctx context.Context, table string, snapshotID int64) context.Context {
+	tt := getTimeTravel(ctx)
+	snapshotIDs := make(map[string]int64, len(tt.snapshotIDs)+1)
+	for k, v := range tt.snapshotIDs {
+		snapshotIDs[k] = v
+	}
+	snapshotIDs[table] = snapshotID
+	tt.snapshotIDs = snapshotIDs
+	return context.WithValue(ctx, TimeTravelKey, tt)
+}
+
+// WithAsOfTimestamp is to read the Iceberg tables as of t in the queries with ctx, to get the same results
+// later. The queries get FOR TIMESTAMP AS OF after the tables in their FROM and JOIN clauses, all of them
+// unless tables are set. Only SELECT and WITH queries are rewritten, and quoted table names are left out.
+func WithAsOfTimestamp(ctx context.Context, t time.Time, tables ...string) context.Context {
+	tt := getTimeTravel(ctx)
+	tt.asOf = t
+	tt.asOfTables = tables
+	return context.WithValue(ctx, TimeTravelKey, tt)
+}
+
+func getCatalog(ctx context.Context, config *Config) string {
+	if catalog, ok := ctx.Value(CatalogKey).(string); ok && catalog != "" {
+		return catalog
+	}
+	return config.GetCatalog()
+}
+
+// isFederatedCatalog is to check if the queries in catalog are run by a federated data source, like a Lambda
+// connector or a Hive metastore. All the data catalogs but AwsDataCatalog are assumed to be.
+func isFederatedCatalog(catalog string) bool {
+	return catalog != "" && catalog != DefaultDataSource
+}
+
+func getDatabase(ctx context.Context, config *Config) string {
+	if db, ok := ctx.Value(DatabaseKey).(string); ok && db != "" {
+		return db
+	}
+	return config.GetDB()
+}
+
+func getWorkgroup(ctx context.Context, config *Config) Workgroup {
+	wg := config.GetWorkgroup()
+	if wgName, ok := ctx.Value(WorkgroupKey).(string); ok && wgName != "" {
+		wg.Name = wgName
+	}
+	if wg.Config != nil && wg.Config.ResultConfiguration != nil {
+		// a copy, so the workgroup created remotely has its own output bucket
+		wgConfig := *wg.Config
+		resultConfig := *wg.Config.ResultConfiguration
+		resultConfig.OutputLocation = aws.String(config.GetWGOutputBucket(wg.Name))
+		wgConfig.ResultConfiguration = &resultConfig
+		wg.Config = &wgConfig
+	}
+	return wg
+}
+
+func getOutputLocation(ctx context.Context, config *Config) string {
+	if outputLocation, ok := ctx.Value(OutputLocationKey).(string); ok && outputLocation != "" {
+		return outputLocation
+	}
+	return config.GetWGOutputBucket(getWorkgroup(ctx, config).Name)
+}
+
+func getResultReuse(ctx context.Context, config *Config) ResultReuse {
+	if reuse, ok := ctx.Value(ResultReuseKey).(ResultReuse); ok {
+		if reuse.MaxAgeMinutes <= 0 {
+			reuse.MaxAgeMinutes = DefaultResultReuseMaxAge
+		}
+		return reuse
+	}
+	return ResultReuse{Enabled: config.IsResultReuse(), MaxAgeMinutes: config.GetResultReuseMaxAge()}
+}
+
+func getQueryTimeout(ctx context.Context, config *Config) time.Duration {
+	if timeout, ok := ctx.Value(QueryTimeoutKey).(time.Duration); ok && timeout > 0 {
+		return timeout
+	}
+	return config.GetQueryTimeout()
+}
+
+func getPriority(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(PriorityKey).(Priority); ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+func getCostTag(ctx context.Context) string {
+	tag, _ := ctx.Value(CostTagKey).(string)
+	return tag
+}
+
+func getQueryLabels(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(QueryLabelsKey).(map[string]string)
+	return labels
+}
+
+func getLogLevel(ctx context.Context) (zapcore.Level, bool) {
+	level, ok := ctx.Value(LogLevelKey).(zapcore.Level)
+	return level, ok
+}
+
+func getPartitionProgress(ctx context.Context) PartitionProgress {
+	progress, _ := ctx.Value(PartitionProgressKey).(PartitionProgress)
+	return progress
+}
+
+func getResultMode(ctx context.Context, config *Config) ResultMode {
+	if mode, ok := ctx.Value(ResultModeKey).(ResultMode); ok && mode != "" {
+		return mode
+	}
+	return config.GetResultMode()
+}
+
+func getPartitionGuardMode(ctx context.Context, config *Config) PartitionGuardMode {
+	if mode, ok := ctx.Value(PartitionGuardKey).(PartitionGuardMode); ok {
+		return mode
+	}
+	return config.GetPartitionGuardMode()
+}
+
+func isResultCacheEnabled(ctx context.Context) bool {
+	enabled, ok := ctx.Value(ResultCacheKey).(bool)
+	return !ok || enabled
+}
+
+func getTimeTravel(ctx context.Context) timeTravel {
+	tt, _ := ctx.Value(TimeTravelKey).(timeTravel)
+	return tt
+}
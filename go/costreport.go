@@ -0,0 +1,148 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// CostTotals are the totals of the queries run, succeeded or canceled, as Athena doesn't charge failed queries.
+type CostTotals struct {
+	Queries            int64
+	DataScannedInBytes int64
+	// CostUSD is estimated with the Athena price per TB, and the 10MB minimum per query.
+	CostUSD float64
+}
+
+func (t *CostTotals) add(dataScannedInBytes int64) {
+	t.Queries++
+	t.DataScannedInBytes += dataScannedInBytes
+	t.CostUSD += getCost(dataScannedInBytes)
+}
+
+func (t *CostTotals) merge(o CostTotals) {
+	t.Queries += o.Queries
+	t.DataScannedInBytes += o.DataScannedInBytes
+	t.CostUSD += o.CostUSD
+}
+
+// CostReport is the cost of the queries of a connector, in total, by workgroup, and by the caller tag set in
+// context with WithCostTag. Queries without a caller tag are only in Total and ByWorkgroup.
+type CostReport struct {
+	Total       CostTotals
+	ByWorkgroup map[string]CostTotals
+	ByTag       map[string]CostTotals
+}
+
+// costAccountant adds up the cost of the queries of all connections of a connector.
+type costAccountant struct {
+	mu     sync.Mutex
+	report CostReport
+}
+
+func (a *costAccountant) add(wgName string, tag string, dataScannedInBytes int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.report.ByWorkgroup == nil {
+		a.report.ByWorkgroup = make(map[string]CostTotals)
+		a.report.ByTag = make(map[string]CostTotals)
+	}
+	a.report.Total.add(dataScannedInBytes)
+	wgTotals := a.report.ByWorkgroup[wgName]
+	wgTotals.add(dataScannedInBytes)
+	a.report.ByWorkgroup[wgName] = wgTotals
+	if tag != "" {
+		tagTotals := a.report.ByTag[tag]
+		tagTotals.add(dataScannedInBytes)
+		a.report.ByTag[tag] = tagTotals
+	}
+}
+
+// get is to get a copy of the report, and start the totals over if reset is true.
+func (a *costAccountant) get(reset bool) CostReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	report := CostReport{
+		Total:       a.report.Total,
+		ByWorkgroup: make(map[string]CostTotals, len(a.report.ByWorkgroup)),
+		ByTag:       make(map[string]CostTotals, len(a.report.ByTag)),
+	}
+	for k, v := range a.report.ByWorkgroup {
+		report.ByWorkgroup[k] = v
+	}
+	for k, v := range a.report.ByTag {
+		report.ByTag[k] = v
+	}
+	if reset {
+		a.report = CostReport{}
+	}
+	return report
+}
+
+// CostReport is to get the cost of the queries run by all connections of the connector.
+func (c *SQLConnector) CostReport() CostReport {
+	return c.costs.get(false)
+}
+
+// ResetCostReport is to get the cost of the queries run by all connections of the connector, and start
+// the totals over, like at the end of a billing period.
+func (c *SQLConnector) ResetCostReport() CostReport {
+	return c.costs.get(true)
+}
+
+// Cost is to get the cost of the queries run by the connection. It is reached from database/sql with
+// sql.Conn.Raw, like CostReport, which is the cost of all connections of the connector.
+func (c *Connection) Cost() CostTotals {
+	return c.cost
+}
+
+// CostReport is to get the cost of the queries run by all connections of the connector of the connection.
+func (c *Connection) CostReport() CostReport {
+	return c.connector.CostReport()
+}
+
+// recordCost is to add the cost of a query execution which is complete to the totals and the metrics,
+// and print it in moneywise mode.
+func (c *Connection) recordCost(ctx context.Context, wgName string, o *athena.GetQueryExecutionOutput) {
+	if c.connector.config.IsMoneyWise() {
+		printCost(o)
+	}
+	if o == nil || o.QueryExecution == nil || o.QueryExecution.Statistics == nil {
+		return
+	}
+	scanned := aws.Int64Value(o.QueryExecution.Statistics.DataScannedInBytes)
+	tag := getCostTag(ctx)
+	c.cost.add(scanned)
+	c.connector.costs.add(wgName, tag, scanned)
+
+	// the tags are the same for all queries, as Prometheus needs the same labels for each metric
+	scope := c.connector.tracer.Scope().Tagged(map[string]string{"workgroup": wgName, "caller": tag})
+	scope.Counter(DriverName + ".cost.queries").Inc(1)
+	scope.Counter(DriverName + ".cost.scannedbytes").Inc(scanned)
+	scope.Histogram(DriverName+".query.scannedbytes", ScannedBytesBuckets).RecordValue(float64(scanned))
+	// counters are integers, so the cost is in micro dollars
+	scope.Counter(DriverName + ".cost.microusd").Inc(int64(math.Round(getCost(scanned) * 1e6)))
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+)
+
+func scannedExecution(scanned int64) *athena.GetQueryExecutionOutput {
+	return &athena.GetQueryExecutionOutput{QueryExecution: &athena.QueryExecution{
+		QueryExecutionId: aws.String("qid"),
+		Statistics:       &athena.QueryExecutionStatistics{DataScannedInBytes: aws.Int64(scanned)},
+	}}
+}
+
+func TestConnection_RecordCost(t *testing.T) {
+	connector := NoopsSQLConnector()
+	connector.config.SetMetrics(true)
+	scope := tally.NewTestScope("", nil)
+	connector.tracer.SetScope(scope)
+	c1 := &Connection{connector: connector}
+	c2 := &Connection{connector: connector}
+
+	c1.recordCost(WithCostTag(context.Background(), "finance"), "primary", scannedExecution(1<<30))
+	c1.recordCost(context.Background(), "batch", scannedExecution(0))
+	c2.recordCost(WithCostTag(context.Background(), "finance"), "primary", scannedExecution(1<<20))
+	c2.recordCost(context.Background(), "primary", &athena.GetQueryExecutionOutput{})
+
+	assert.Equal(t, CostTotals{Queries: 2, DataScannedInBytes: 1 << 30, CostUSD: getCost(1 << 30)}, c1.Cost())
+	assert.Equal(t, int64(1), c2.Cost().Queries)
+	report := c1.CostReport()
+	assert.Equal(t, int64(3), report.Total.Queries)
+	assert.Equal(t, int64(1<<30+1<<20), report.Total.DataScannedInBytes)
+	assert.InDelta(t, getCost(1<<30)+getPrice10MB(), report.Total.CostUSD, 1e-12)
+	assert.Equal(t, int64(2), report.ByWorkgroup["primary"].Queries)
+	assert.Equal(t, int64(1), report.ByWorkgroup["batch"].Queries)
+	assert.Equal(t, report.ByWorkgroup["primary"], report.ByTag["finance"])
+	assert.Len(t, report.ByTag, 1)
+
+	counters := scope.Snapshot().Counters()
+	assert.Equal(t, int64(2), counters[DriverName+".cost.queries+caller=finance,workgroup=primary"].Value())
+	assert.Equal(t, int64(1<<30+1<<20),
+		counters[DriverName+".cost.scannedbytes+caller=finance,workgroup=primary"].Value())
+	assert.Equal(t, int64(1), counters[DriverName+".cost.queries+caller=,workgroup=batch"].Value())
+
+	// the report is a copy
+	report.ByTag["finance"] = CostTotals{}
+	assert.Equal(t, int64(2), connector.CostReport().ByTag["finance"].Queries)
+
+	assert.Equal(t, int64(3), connector.ResetCostReport().Total.Queries)
+	assert.Equal(t, CostReport{ByWorkgroup: map[string]CostTotals{}, ByTag: map[string]CostTotals{}},
+		connector.CostReport())
+}
+
+func TestConnection_QueryContext_CostOfStoppedQuery(t *testing.T) {
+	athenaClient := &scanningAthenaClient{runningAthenaClient: runningAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetPollInterval(time.Millisecond)
+	c.connector.config.SetMaxScannedBytes(250)
+
+	_, err := c.QueryContext(WithCostTag(context.Background(), "team"), "SELECT 1", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(400), c.Cost().DataScannedInBytes)
+	assert.Equal(t, int64(400), c.CostReport().ByTag["team"].DataScannedInBytes)
+	assert.Equal(t, int64(400), c.CostReport().ByWorkgroup[DefaultWGName].DataScannedInBytes)
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sso"
+)
+
+// CredentialsMode is to select how SQLConnector resolves AWS credentials.
+type CredentialsMode string
+
+const (
+	// CredentialsModeDefault resolves credentials in the order documented in SQLConnector.Connect.
+	CredentialsModeDefault CredentialsMode = ""
+
+	// CredentialsModeSSO resolves credentials of an AWS SSO (IAM Identity Center) profile
+	// configured with sso_start_url/sso_account_id or sso_session in ~/.aws/config.
+	CredentialsModeSSO CredentialsMode = "sso"
+
+	// CredentialsModeWebIdentity resolves credentials by exchanging the web identity token in
+	// ${AWS_WEB_IDENTITY_TOKEN_FILE} for the role in ${AWS_ROLE_ARN}, like IAM Roles for Service Accounts in EKS.
+	CredentialsModeWebIdentity CredentialsMode = "webIdentity"
+
+	// CredentialsModeSharedConfig loads the profile in Config from ~/.aws/config and ~/.aws/credentials,
+	// including region and credential_process, as if AWS_SDK_LOAD_CONFIG were true.
+	CredentialsModeSharedConfig CredentialsMode = "sharedConfig"
+)
+
+// MFATokenProvider is to get the current MFA token code when STS requires MFA to assume a role,
+// like stscreds.StdinTokenProvider which prompts for it on stdin.
+type MFATokenProvider func() (string, error)
+
+// newAssumeRoleCredentials is to create credentials of the role in Config, assumed with the session's credentials.
+// The returned credentials are refreshed with STS automatically before they expire.
+// If an MFA device is set in Config, tokenProvider is invoked for the token code on every refresh.
+func newAssumeRoleCredentials(sess *session.Session, config *Config, tokenProvider MFATokenProvider) *credentials.Credentials {
+	return stscreds.NewCredentials(newSTSSession(sess, config), config.GetRoleARN(), func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = config.GetRoleSessionName()
+		if externalID := config.GetExternalID(); externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+		if sourceIdentity := config.GetSourceIdentity(); sourceIdentity != "" {
+			p.SourceIdentity = aws.String(sourceIdentity)
+		}
+		if serial := config.GetMFASerial(); serial != "" {
+			p.SerialNumber = aws.String(serial)
+			p.TokenProvider = tokenProvider
+		}
+	})
+}
+
+// newResultS3Credentials is to create credentials of the result S3 role in Config, assumed with the session's
+// credentials, which are the credentials of the Athena client.
+func newResultS3Credentials(sess *session.Session, config *Config) *credentials.Credentials {
+	roleARN, externalID := config.GetResultS3Role()
+	return stscreds.NewCredentials(newSTSSession(sess, config), roleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = config.GetRoleSessionName()
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+	})
+}
+
+// newSSOSession is to create a session with the credentials of the AWS SSO profile in Config.
+// Profiles using an sso_session section get their cached token refreshed with SSO OIDC automatically,
+// legacy profiles need `aws sso login` again once the cached token is expired.
+// Credentials are retrieved eagerly, so an expired login fails Connect with ErrSSOTokenExpired
+// instead of the first query.
+func newSSOSession(ctx context.Context, config *Config, httpClient *http.Client) (*session.Session, error) {
+	profile := config.GetAWSProfile()
+	sess, err := newAWSSessionWithOptions(config, session.Options{
+		Config: aws.Config{
+			Region:     aws.String(config.GetRegion()),
+			HTTPClient: httpClient,
+		},
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = sess.Config.Credentials.GetWithContext(ctx); err != nil {
+		if aerr, ok := err.(awserr.Error); ok &&
+			(aerr.Code() == ssocreds.ErrCodeSSOProviderInvalidToken || aerr.Code() == sso.ErrCodeUnauthorizedException) {
+			return nil, fmt.Errorf("%w, run `aws sso login --profile %s`: %s", ErrSSOTokenExpired, profile, aerr.Message())
+		}
+		return nil, err
+	}
+	return sess, nil
+}
+
+// newSharedConfigSession is to create a session from the shared config files, regardless of AWS_SDK_LOAD_CONFIG.
+// Region set in Config takes precedence over the region of the profile, which takes precedence over the default
+// one of Config. tokenProvider is used for profiles assuming a role with mfa_serial.
+func newSharedConfigSession(config *Config, tokenProvider MFATokenProvider,
+	httpClient *http.Client) (*session.Session, error) {
+	opts := session.Options{
+		Config: aws.Config{
+			HTTPClient: httpClient,
+		},
+		Profile:                 config.GetAWSProfile(),
+		SharedConfigState:       session.SharedConfigEnable,
+		AssumeRoleTokenProvider: tokenProvider,
+	}
+	if config.isRegionSet() {
+		opts.Config.Region = aws.String(config.GetRegion())
+	}
+	return newAWSSessionWithOptions(config, opts)
+}
+
+// newWebIdentitySession is to create a session with web identity credentials, regardless of AWS_SDK_LOAD_CONFIG.
+// The session name is from ${AWS_ROLE_SESSION_NAME}, or the role session name in Config.
+func newWebIdentitySession(config *Config, httpClient *http.Client) (*session.Session, error) {
+	roleARN := GetFromEnvVal(roleARNEnvKey)
+	tokenFile := GetFromEnvVal(webIdentityTokenFileEnvKey)
+	if roleARN == "" || tokenFile == "" {
+		return nil, ErrWebIdentityNotConfigured
+	}
+	sessionName := GetFromEnvVal(roleSessionNameEnvKey)
+	if sessionName == "" {
+		sessionName = config.GetRoleSessionName()
+	}
+	sess, err := newAWSSession(config, &aws.Config{
+		Region:     aws.String(config.GetRegion()),
+		HTTPClient: httpClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sess.Copy(&aws.Config{
+		Credentials: stscreds.NewWebIdentityCredentials(newSTSSession(sess, config), roleARN, sessionName, tokenFile),
+	}), nil
+}
+
+// newSTSSession is to get the session of STS clients, which uses regional STS endpoints if set in Config.
+func newSTSSession(sess *session.Session, config *Config) *session.Session {
+	if config.IsSTSRegionalEndpoint() {
+		return sess.Copy(aws.NewConfig().WithSTSRegionalEndpoint(endpoints.RegionalSTSEndpoint))
+	}
+	return sess
+}
+
+// newAWSSession is session.NewSession with EC2 instance metadata disabled if set in Config.
+func newAWSSession(config *Config, cfgs ...*aws.Config) (*session.Session, error) {
+	opts := session.Options{}
+	opts.Config.MergeIn(cfgs...)
+	return newAWSSessionWithOptions(config, opts)
+}
+
+// newAWSSessionWithOptions is session.NewSessionWithOptions with EC2 instance metadata disabled if set in Config.
+// Requests to the metadata endpoint fail immediately then, so the default credential chain doesn't wait
+// for the endpoint outside EC2.
+func newAWSSessionWithOptions(config *Config, opts session.Options) (*session.Session, error) {
+	if config.IsEC2MetadataDisabled() {
+		opts.Handlers = defaults.Handlers()
+		opts.Handlers.Build.PushFrontNamed(request.NamedHandler{
+			Name: "athenadriver.DisableEC2MetadataHandler",
+			Fn: func(r *request.Request) {
+				if r.ClientInfo.ServiceName == ec2metadata.ServiceName {
+					r.Error = ErrEC2MetadataDisabled
+				}
+			},
+		})
+	}
+	return session.NewSessionWithOptions(opts)
+}
+
+// isCredentialsError is to check if err means AWS rejected the credentials of the request,
+// like an expired session token or revoked access keys.
+func isCredentialsError(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "ExpiredToken", "ExpiredTokenException", "InvalidClientTokenId",
+			"UnrecognizedClientException", "InvalidSignatureException":
+			return true
+		}
+	}
+	return false
+}
+
+// refreshingProvider wraps credentials and retrieves them again once they are within
+// the refresh window of their expiration, instead of waiting for requests to fail.
+type refreshingProvider struct {
+	creds     *credentials.Credentials
+	window    time.Duration
+	mu        sync.Mutex
+	refreshAt time.Time
+}
+
+// newRefreshingCredentials is to create credentials which are refreshed proactively
+// `window` before the wrapped credentials expire.
+// Credentials without expiration, like static ones, are passed through as they are.
+func newRefreshingCredentials(creds *credentials.Credentials, window time.Duration) *credentials.Credentials {
+	return credentials.NewCredentials(&refreshingProvider{
+		creds:  creds,
+		window: window,
+	})
+}
+
+// Retrieve is to implement credentials.Provider.
+func (p *refreshingProvider) Retrieve() (credentials.Value, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.refreshAt.IsZero() {
+		p.creds.Expire()
+	}
+	v, err := p.creds.Get()
+	if err != nil {
+		return v, err
+	}
+	p.refreshAt = time.Time{}
+	if expiresAt, err := p.creds.ExpiresAt(); err == nil {
+		p.refreshAt = expiresAt.Add(-p.window)
+		// credentials handed out already within the window are used until they expire,
+		// otherwise every request would retrieve them again.
+		if !p.refreshAt.After(time.Now()) {
+			p.refreshAt = expiresAt
+		}
+	}
+	return v, nil
+}
+
+// IsExpired is to implement credentials.Provider.
+func (p *refreshingProvider) IsExpired() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.refreshAt.IsZero() && !time.Now().Before(p.refreshAt) {
+		return true
+	}
+	return p.creds.IsExpired()
+}
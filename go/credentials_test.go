@@ -0,0 +1,370 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+type expiringTestProvider struct {
+	retrieved int
+	lifetime  time.Duration
+	expiresAt time.Time
+}
+
+func (p *expiringTestProvider) Retrieve() (credentials.Value, error) {
+	p.retrieved++
+	p.expiresAt = time.Now().Add(p.lifetime)
+	return credentials.Value{AccessKeyID: "id", SecretAccessKey: "key", ProviderName: "expiringTestProvider"}, nil
+}
+
+func (p *expiringTestProvider) IsExpired() bool {
+	return !time.Now().Before(p.expiresAt)
+}
+
+func (p *expiringTestProvider) ExpiresAt() time.Time {
+	return p.expiresAt
+}
+
+func TestRefreshingCredentials_RefreshWithinWindow(t *testing.T) {
+	window := 5 * time.Minute
+	p := &expiringTestProvider{lifetime: window + 50*time.Millisecond}
+	creds := newRefreshingCredentials(credentials.NewCredentials(p), window)
+	_, err := creds.Get()
+	assert.Nil(t, err)
+	_, err = creds.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, p.retrieved)
+
+	// the wrapped credentials are still valid, but within the refresh window now
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, p.IsExpired())
+	assert.True(t, creds.IsExpired())
+	_, err = creds.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, p.retrieved)
+}
+
+func TestRefreshingCredentials_ShortLivedCredentials(t *testing.T) {
+	// credentials living shorter than the window must not be retrieved on every call
+	p := &expiringTestProvider{lifetime: time.Minute}
+	creds := newRefreshingCredentials(credentials.NewCredentials(p), 5*time.Minute)
+	for i := 0; i < 3; i++ {
+		_, err := creds.Get()
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1, p.retrieved)
+}
+
+func TestRefreshingCredentials_Static(t *testing.T) {
+	creds := newRefreshingCredentials(credentials.NewStaticCredentials("id", "key", ""), time.Minute)
+	v, err := creds.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "id", v.AccessKeyID)
+	assert.False(t, creds.IsExpired())
+}
+
+func TestNewSSOSession_ExpiredToken(t *testing.T) {
+	home := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(home, ".aws", "sso", "cache"), 0700))
+	startURL := "https://my-sso-portal.awsapps.com/start"
+	awsConfig := "[profile sso-dev]\n" +
+		"sso_start_url = " + startURL + "\n" +
+		"sso_region = us-east-1\n" +
+		"sso_account_id = 123456789012\n" +
+		"sso_role_name = AthenaReader\n"
+	configFile := filepath.Join(home, ".aws", "config")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte(awsConfig), 0600))
+	cacheKey := sha1.Sum([]byte(startURL))
+	cachedToken := `{"accessToken":"token","expiresAt":"2020-01-01T00:00:00Z","region":"us-east-1","startUrl":"` +
+		startURL + `"}`
+	cacheFile := filepath.Join(home, ".aws", "sso", "cache", hex.EncodeToString(cacheKey[:])+".json")
+	assert.Nil(t, ioutil.WriteFile(cacheFile, []byte(cachedToken), 0600))
+
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	os.Setenv("AWS_CONFIG_FILE", configFile)
+	defer func() {
+		os.Setenv("HOME", oldHome)
+		os.Unsetenv("AWS_CONFIG_FILE")
+	}()
+
+	testConf := NewNoOpsConfig()
+	testConf.SetSSOProfile("sso-dev")
+	assert.Equal(t, CredentialsModeSSO, testConf.GetCredentialsMode())
+	assert.Equal(t, "sso-dev", testConf.GetAWSProfile())
+	connector := &SQLConnector{
+		config: testConf,
+		tracer: NewDefaultObservability(testConf),
+	}
+	conn, err := connector.Connect(context.Background())
+	assert.Nil(t, conn)
+	assert.True(t, errors.Is(err, ErrSSOTokenExpired))
+	assert.Contains(t, err.Error(), "aws sso login --profile sso-dev")
+}
+
+func TestNewSSOSession_MissingProfile(t *testing.T) {
+	os.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+	testConf := NewNoOpsConfig()
+	testConf.SetSSOProfile("does-not-exist")
+	_, err := newSSOSession(context.Background(), testConf, nil)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrSSOTokenExpired))
+}
+
+func TestNewWebIdentitySession(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetCredentialsMode(CredentialsModeWebIdentity)
+	os.Unsetenv("AWS_ROLE_ARN")
+	os.Unsetenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	connector := &SQLConnector{
+		config: testConf,
+		tracer: NewDefaultObservability(testConf),
+	}
+	conn, err := connector.Connect(context.Background())
+	assert.Nil(t, conn)
+	assert.Equal(t, ErrWebIdentityNotConfigured, err)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("web-identity-token"), 0600))
+	os.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/eks-athena")
+	os.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	defer func() {
+		os.Unsetenv("AWS_ROLE_ARN")
+		os.Unsetenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}()
+	sess, err := newWebIdentitySession(testConf, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, testConf.GetRegion(), *sess.Config.Region)
+	conn, err = connector.Connect(context.Background())
+	assert.Nil(t, err)
+	assert.NotNil(t, conn)
+}
+
+func TestNewSharedConfigSession_CredentialProcess(t *testing.T) {
+	os.Unsetenv("AWS_SDK_LOAD_CONFIG")
+	dir := t.TempDir()
+	process := filepath.Join(dir, "credential_process.sh")
+	script := "#!/bin/sh\necho '{\"Version\": 1, \"AccessKeyId\": \"procid\", \"SecretAccessKey\": \"prockey\"}'\n"
+	assert.Nil(t, ioutil.WriteFile(process, []byte(script), 0700))
+	awsConfig := "[profile proc]\n" +
+		"region = eu-central-1\n" +
+		"credential_process = " + process + "\n"
+	configFile := filepath.Join(dir, "config")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte(awsConfig), 0600))
+	os.Setenv("AWS_CONFIG_FILE", configFile)
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	defer func() {
+		os.Unsetenv("AWS_CONFIG_FILE")
+		os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+	}()
+
+	os.Unsetenv("AWS_REGION")
+	os.Unsetenv("AWS_DEFAULT_REGION")
+
+	testConf := NewNoOpsConfig()
+	testConf.SetAWSProfile("proc")
+	testConf.SetCredentialsMode(CredentialsModeSharedConfig)
+	sess, err := newSharedConfigSession(testConf, nil, nil)
+	assert.Nil(t, err)
+	v, err := sess.Config.Credentials.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "procid", v.AccessKeyID)
+	assert.Equal(t, "prockey", v.SecretAccessKey)
+	// the region of the profile is used instead of the default one
+	assert.Equal(t, "eu-central-1", *sess.Config.Region)
+
+	// the region set in Config is used instead of the one of the profile
+	assert.Nil(t, testConf.SetRegion(DefaultRegion))
+	sess, err = newSharedConfigSession(testConf, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultRegion, *sess.Config.Region)
+}
+
+func TestNewAssumeRoleCredentials_MFA(t *testing.T) {
+	var form map[string]string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		_, _ = w.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>mfaid</AccessKeyId><SecretAccessKey>mfakey</SecretAccessKey><SessionToken>mfatoken</SessionToken>
+<Expiration>2100-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+	}))
+	defer sts.Close()
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(sts.URL),
+		Credentials: credentials.NewStaticCredentials("id", "key", ""),
+	})
+	assert.Nil(t, err)
+
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetAssumeRole("arn:aws:iam::123456789012:role/admin", "", "")
+	testConf.SetMFASerial("arn:aws:iam::123456789012:mfa/alice")
+	assert.Equal(t, "arn:aws:iam::123456789012:mfa/alice", testConf.GetMFASerial())
+	invoked := 0
+	testConf.SetMFATokenProvider(func() (string, error) {
+		invoked++
+		return "123456", nil
+	})
+	v, err := newAssumeRoleCredentials(sess, testConf, testConf.GetMFATokenProvider()).Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "mfaid", v.AccessKeyID)
+	assert.Equal(t, 1, invoked)
+	assert.Equal(t, "arn:aws:iam::123456789012:mfa/alice", form["SerialNumber"])
+	assert.Equal(t, "123456", form["TokenCode"])
+
+	testConf.SetMFASerial("")
+	assert.Equal(t, "", testConf.GetMFASerial())
+	_, err = newAssumeRoleCredentials(sess, testConf, testConf.GetMFATokenProvider()).Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, invoked)
+	_, ok := form["TokenCode"]
+	assert.False(t, ok)
+}
+
+func TestIsCredentialsError(t *testing.T) {
+	assert.False(t, isCredentialsError(nil))
+	assert.False(t, isCredentialsError(errors.New("ExpiredToken")))
+	assert.False(t, isCredentialsError(awserr.New("InvalidRequestException", "bad query", nil)))
+	assert.True(t, isCredentialsError(awserr.New("ExpiredTokenException", "expired", nil)))
+	assert.True(t, isCredentialsError(awserr.NewRequestFailure(
+		awserr.New("UnrecognizedClientException", "invalid token", nil), 400, "req")))
+}
+
+func TestNewAssumeRoleCredentials_SourceIdentity(t *testing.T) {
+	var form map[string]string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		_, _ = w.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>roleid</AccessKeyId><SecretAccessKey>rolekey</SecretAccessKey><SessionToken>roletoken</SessionToken>
+<Expiration>2100-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+	}))
+	defer sts.Close()
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(sts.URL),
+		Credentials: credentials.NewStaticCredentials("id", "key", ""),
+	})
+	assert.Nil(t, err)
+
+	testConf := NewNoOpsConfig()
+	_ = testConf.SetAssumeRole("arn:aws:iam::123456789012:role/athena-reader", "", "")
+	testConf.SetSourceIdentity("alice@example.com")
+	assert.Equal(t, "alice@example.com", testConf.GetSourceIdentity())
+	v, err := newAssumeRoleCredentials(sess, testConf, nil).Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "roleid", v.AccessKeyID)
+	assert.Equal(t, "alice@example.com", form["SourceIdentity"])
+
+	testConf.SetSourceIdentity("")
+	assert.Equal(t, "", testConf.GetSourceIdentity())
+}
+
+func TestNewSTSSession(t *testing.T) {
+	os.Unsetenv("AWS_STS_REGIONAL_ENDPOINTS")
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "key", ""),
+	})
+	assert.Nil(t, err)
+	testConf := NewNoOpsConfig()
+	assert.False(t, testConf.IsSTSRegionalEndpoint())
+	assert.Equal(t, "https://sts.amazonaws.com", sts.New(newSTSSession(sess, testConf)).Endpoint)
+
+	testConf.SetSTSRegionalEndpoint(true)
+	assert.True(t, testConf.IsSTSRegionalEndpoint())
+	assert.Equal(t, "https://sts.us-east-1.amazonaws.com", sts.New(newSTSSession(sess, testConf)).Endpoint)
+
+	testConf.SetSTSRegionalEndpoint(false)
+	os.Setenv("AWS_STS_REGIONAL_ENDPOINTS", "regional")
+	defer os.Unsetenv("AWS_STS_REGIONAL_ENDPOINTS")
+	assert.False(t, testConf.IsSTSRegionalEndpoint())
+	assert.True(t, NewNoOpsConfig().IsSTSRegionalEndpoint())
+}
+
+func TestNewAWSSession_EC2MetadataDisabled(t *testing.T) {
+	os.Unsetenv("AWS_EC2_METADATA_DISABLED")
+	testConf := NewNoOpsConfig()
+	assert.False(t, testConf.IsEC2MetadataDisabled())
+	testConf.SetEC2MetadataDisabled(true)
+	assert.True(t, testConf.IsEC2MetadataDisabled())
+	sess, err := newAWSSession(testConf, &aws.Config{Region: aws.String("us-east-1")})
+	assert.Nil(t, err)
+	_, err = ec2metadata.New(sess).GetMetadata("instance-id")
+	assert.Equal(t, ErrEC2MetadataDisabled, err)
+
+	testConf.SetEC2MetadataDisabled(false)
+	assert.False(t, testConf.IsEC2MetadataDisabled())
+	os.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	defer os.Unsetenv("AWS_EC2_METADATA_DISABLED")
+	assert.True(t, NewNoOpsConfig().IsEC2MetadataDisabled())
+}
+
+func TestSQLConnector_newSession_EC2MetadataDisabled(t *testing.T) {
+	dir := t.TempDir()
+	for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY",
+		"AWS_SDK_LOAD_CONFIG", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE"} {
+		os.Unsetenv(key)
+	}
+	os.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	os.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", "http://10.255.255.1")
+	defer func() {
+		os.Unsetenv("AWS_CONFIG_FILE")
+		os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+		os.Unsetenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	}()
+	testConf := NewNoOpsConfig()
+	testConf.SetEC2MetadataDisabled(true)
+	sess, err := NewConnector(testConf).newSession(context.Background())
+	assert.Nil(t, err)
+	now := time.Now()
+	_, err = sess.Config.Credentials.Get()
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(now) < time.Second)
+}
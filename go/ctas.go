@@ -0,0 +1,175 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.uber.org/zap"
+)
+
+// CTASFormats are the storage formats of the tables Athena can create with CREATE TABLE AS SELECT.
+var CTASFormats = []string{"PARQUET", "ORC", "AVRO", "JSON", "TEXTFILE"}
+
+// identifierPattern is for the table name, optionally qualified by its database, and the partition columns of CTAS.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)?$`)
+
+// CTASResult is the outcome of Connection.CreateTableAs.
+type CTASResult struct {
+	// Location is the S3 location of the data of the new table.
+	Location string
+	// RowCount is the number of rows written to the new table.
+	RowCount int64
+}
+
+// newCTASLocation is to get a new empty S3 location for the data of table, under the output location.
+func newCTASLocation(ctx context.Context, config *Config, table string) string {
+	return strings.TrimSuffix(getOutputLocation(ctx, config), "/") + "/tables/" +
+		strings.Replace(table, ".", "_", -1) + "_" + randString(8) + "/"
+}
+
+// ctasQuery is to build the CREATE TABLE AS SELECT statement of table with the result of query.
+func ctasQuery(table, format string, partitionedBy []string, location, query string) (string, error) {
+	if !identifierPattern.MatchString(table) {
+		return "", fmt.Errorf("%w: invalid table name %q", ErrInvalidQuery, table)
+	}
+	format = strings.ToUpper(format)
+	if !isCTASFormat(format) {
+		return "", fmt.Errorf("%w: unsupported CTAS format %q", ErrInvalidQuery, format)
+	}
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	if !isUnloadable(query) {
+		return "", fmt.Errorf("%w: CTAS needs a SELECT query", ErrInvalidQuery)
+	}
+	properties := []string{
+		fmt.Sprintf("format = '%s'", format),
+		fmt.Sprintf("external_location = '%s'", location),
+	}
+	if len(partitionedBy) > 0 {
+		columns := make([]string, len(partitionedBy))
+		for i, column := range partitionedBy {
+			if !identifierPattern.MatchString(column) || strings.Contains(column, ".") {
+				return "", fmt.Errorf("%w: invalid partition column %q", ErrInvalidQuery, column)
+			}
+			columns[i] = "'" + column + "'"
+		}
+		properties = append(properties, "partitioned_by = ARRAY["+strings.Join(columns, ", ")+"]")
+	}
+	// Athena requires the partition columns to be the last ones of the query, which is left to the caller.
+	return fmt.Sprintf("CREATE TABLE %s WITH (%s) AS %s", table, strings.Join(properties, ", "), query), nil
+}
+
+func isCTASFormat(format string) bool {
+	for _, f := range CTASFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTableAs is to create table in format, partitioned by the given columns, with the result of query.
+// The data is written to a new location under the output location, and the call waits for the query to
+// complete. If it fails, the table and the data written so far are removed, in the best effort, unless it
+// failed because the table already exists, which is left as it is.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) CreateTableAs(ctx context.Context, table, format string, partitionedBy []string,
+	query string) (CTASResult, error) {
+	location := newCTASLocation(ctx, c.connector.config, table)
+	ctas, err := ctasQuery(table, format, partitionedBy, location, query)
+	if err != nil {
+		return CTASResult{}, err
+	}
+	result, err := c.ExecContext(ctx, ctas, nil)
+	if err != nil {
+		// the existing table isn't the one of the CTAS, and the CTAS wrote nothing
+		if !errors.Is(err, ErrAlreadyExists) {
+			c.cleanupCTAS(table, location)
+		}
+		return CTASResult{}, err
+	}
+	rowCount, _ := result.RowsAffected()
+	c.connector.tracer.Scope().Counter(DriverName + ".ctas").Inc(1)
+	return CTASResult{Location: location, RowCount: rowCount}, nil
+}
+
+// cleanupCTAS is to drop table and delete its data at location after a failed CTAS.
+// The context of the query may be done, so the cleanup runs in a new one.
+func (c *Connection) cleanupCTAS(table, location string) {
+	var obs = c.connector.tracer
+	ctx := context.Background()
+	if _, err := c.ExecContext(ctx, "DROP TABLE IF EXISTS "+table, nil); err != nil {
+		obs.Log(WarnLevel, "CTAS cleanup failed to drop table",
+			zap.String("table", table),
+			zap.String("error", err.Error()))
+	}
+	if c.s3API == nil {
+		return
+	}
+	if err := c.deleteS3Prefix(ctx, location); err != nil {
+		obs.Log(WarnLevel, "CTAS cleanup failed to delete data",
+			zap.String("location", location),
+			zap.String("error", err.Error()))
+		obs.Scope().Counter(DriverName + ".failure.ctas.cleanup").Inc(1)
+	}
+}
+
+// deleteS3Prefix is to delete all objects under the S3 location.
+func (c *Connection) deleteS3Prefix(ctx context.Context, location string) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	bucket, prefix := u.Host, strings.TrimPrefix(u.Path, "/")
+	var deleteErr error
+	err = c.s3API.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		if len(page.Contents) == 0 {
+			return true
+		}
+		objects := make([]*s3.ObjectIdentifier, len(page.Contents))
+		for i, object := range page.Contents {
+			objects[i] = &s3.ObjectIdentifier{Key: object.Key}
+		}
+		var out *s3.DeleteObjectsOutput
+		out, deleteErr = c.s3API.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if deleteErr == nil {
+			deleteErr = deleteObjectsError(out)
+		}
+		return deleteErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return deleteErr
+}
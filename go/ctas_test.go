@@ -0,0 +1,161 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// ctasAthenaClient fails the CTAS queries if failing, as if the table existed if exists, and returns the row
+// count of the others.
+type ctasAthenaClient struct {
+	queryContextAthenaClient
+	failing bool
+	exists  bool
+}
+
+func (m *ctasAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	out, err := m.queryContextAthenaClient.StartQueryExecutionWithContext(ctx, s, opts...)
+	if m.failing && strings.HasPrefix(*s.QueryString, "CREATE TABLE") {
+		out.QueryExecutionId = aws.String("QueryExecutionStateFailed_QID")
+		if m.exists {
+			out.QueryExecutionId = aws.String("CTAS_EXISTS_QID")
+		}
+	}
+	return out, err
+}
+
+func (m *ctasAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	if *input.QueryExecutionId != "CTAS_EXISTS_QID" {
+		return m.queryContextAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+	}
+	return &athena.GetQueryExecutionOutput{QueryExecution: &athena.QueryExecution{
+		QueryExecutionId: input.QueryExecutionId,
+		Status: &athena.QueryExecutionStatus{
+			State:             aws.String(athena.QueryExecutionStateFailed),
+			StateChangeReason: aws.String("AlreadyExistsException: Table db.t already exists"),
+		},
+	}}, nil
+}
+
+func (m *ctasAthenaClient) GetQueryResultsWithContext(ctx aws.Context, input *athena.GetQueryResultsInput,
+	opts ...request.Option) (*athena.GetQueryResultsOutput, error) {
+	return &athena.GetQueryResultsOutput{
+		UpdateCount: aws.Int64(42),
+		ResultSet: &athena.ResultSet{
+			ResultSetMetadata: &athena.ResultSetMetadata{
+				ColumnInfo: []*athena.ColumnInfo{{Name: aws.String("rows"), Type: aws.String("bigint")}},
+			},
+		},
+	}, nil
+}
+
+// ctasS3Client lists one object under any prefix and records the deleted ones.
+type ctasS3Client struct {
+	s3iface.S3API
+	deleted []string
+}
+
+func (m *ctasS3Client) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input,
+	fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	fn(&s3.ListObjectsV2Output{Contents: []*s3.Object{{Key: aws.String(*input.Prefix + "part-0")}}}, true)
+	return nil
+}
+
+func (m *ctasS3Client) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput,
+	opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	for _, object := range input.Delete.Objects {
+		m.deleted = append(m.deleted, *input.Bucket+"/"+*object.Key)
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestCTASQuery(t *testing.T) {
+	q, err := ctasQuery("db.t", "parquet", []string{"dt", "region"}, "s3://b/tables/t/", "SELECT a, dt, region FROM s;")
+	assert.Nil(t, err)
+	assert.Equal(t, "CREATE TABLE db.t WITH (format = 'PARQUET', external_location = 's3://b/tables/t/', "+
+		"partitioned_by = ARRAY['dt', 'region']) AS SELECT a, dt, region FROM s", q)
+
+	q, err = ctasQuery("t", "ORC", nil, "s3://b/tables/t/", "WITH x AS (SELECT 1) SELECT * FROM x")
+	assert.Nil(t, err)
+	assert.Equal(t, "CREATE TABLE t WITH (format = 'ORC', external_location = 's3://b/tables/t/') "+
+		"AS WITH x AS (SELECT 1) SELECT * FROM x", q)
+
+	for _, c := range []struct{ table, format, partition, query string }{
+		{"t; DROP TABLE x", "PARQUET", "dt", "SELECT 1"},
+		{"t", "CSV", "dt", "SELECT 1"},
+		{"t", "PARQUET", "a.dt", "SELECT 1"},
+		{"t", "PARQUET", "dt", "DROP TABLE x"},
+	} {
+		_, err = ctasQuery(c.table, c.format, []string{c.partition}, "s3://b/", c.query)
+		assert.True(t, errors.Is(err, ErrInvalidQuery))
+	}
+}
+
+func TestConnection_CreateTableAs(t *testing.T) {
+	athenaClient := &ctasAthenaClient{queryContextAthenaClient: queryContextAthenaClient{
+		mockAthenaClient: newMockAthenaClient()}}
+	s3Client := &ctasS3Client{}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API:     s3Client,
+		connector: NoopsSQLConnector(),
+	}
+	result, err := c.CreateTableAs(context.Background(), "db.t", "PARQUET", []string{"dt"}, "SELECT a, dt FROM s")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), result.RowCount)
+	assert.True(t, strings.HasPrefix(result.Location, c.connector.config.GetOutputBucket()+"tables/db_t_"))
+	assert.Len(t, athenaClient.inputs, 1)
+	assert.Equal(t, "CREATE TABLE db.t WITH (format = 'PARQUET', external_location = '"+result.Location+
+		"', partitioned_by = ARRAY['dt']) AS SELECT a, dt FROM s", *athenaClient.inputs[0].QueryString)
+	assert.Empty(t, s3Client.deleted)
+
+	// a failed CTAS is cleaned up
+	athenaClient.failing = true
+	_, err = c.CreateTableAs(context.Background(), "db.t", "PARQUET", nil, "SELECT a FROM s")
+	assert.Equal(t, ErrTestMockFailedByAthena, err)
+	assert.Len(t, athenaClient.inputs, 3)
+	assert.Equal(t, "DROP TABLE IF EXISTS db.t", *athenaClient.inputs[2].QueryString)
+	assert.Len(t, s3Client.deleted, 1)
+	assert.True(t, strings.Contains(s3Client.deleted[0], "/tables/db_t_"))
+	assert.True(t, strings.HasSuffix(s3Client.deleted[0], "/part-0"))
+
+	// the table which already exists isn't dropped
+	athenaClient.exists = true
+	athenaClient.inputs = nil
+	s3Client.deleted = nil
+	_, err = c.CreateTableAs(context.Background(), "db.t", "PARQUET", nil, "SELECT a FROM s")
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+	assert.Len(t, athenaClient.inputs, 1)
+	assert.Empty(t, s3Client.deleted)
+}
@@ -22,6 +22,8 @@ package athenadriver
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -35,25 +37,38 @@ type AthenaTime struct {
 	Valid bool
 }
 
+// timeLayouts have no fractional seconds, as time.Parse accepts any number of them after the seconds field.
 var timeLayouts = []string{
 	"2006-01-02",
-	"15:04:05.000",
-	"2006-01-02 15:04:05.000",
+	"15:04:05",
+	"2006-01-02 15:04:05",
 }
 
+// zoneOffsetPattern is the offset zone of time with time zone values, like 01:02:03.456+08:00.
+var zoneOffsetPattern = regexp.MustCompile(`^(.*:\d{2}(?:\.\d+)?) ?([+-]\d{2}:?\d{2})$`)
+
 func scanTime(vv string) (AthenaTime, error) {
+	return scanTimeInLocation(vv, time.Local)
+}
+
+// scanTimeInLocation is to parse Athena date, time and timestamp values, with or without time zone.
+// Values without time zone are in loc.
+func scanTimeInLocation(vv string, loc *time.Location) (AthenaTime, error) {
+	if m := zoneOffsetPattern.FindStringSubmatch(vv); m != nil {
+		return parseAthenaTimeWithOffset(m[1], m[2])
+	}
 	parts := strings.Split(vv, " ")
 	if len(parts) > 1 && !unicode.IsDigit(rune(parts[len(parts)-1][0])) {
 		return parseAthenaTimeWithLocation(vv)
 	}
-	return parseAthenaTime(vv)
+	return parseAthenaTimeInLocation(vv, loc)
 }
 
-func parseAthenaTime(v string) (AthenaTime, error) {
+func parseAthenaTimeInLocation(v string, loc *time.Location) (AthenaTime, error) {
 	var t time.Time
 	var err error
 	for _, layout := range timeLayouts {
-		t, err = time.ParseInLocation(layout, v, time.Local)
+		t, err = time.ParseInLocation(layout, v, loc)
 		if err == nil {
 			return AthenaTime{Valid: true, Time: t}, nil
 		}
@@ -71,12 +86,23 @@ func parseAthenaTimeWithLocation(v string) (AthenaTime, error) {
 	if err != nil {
 		return AthenaTime{}, fmt.Errorf("cannot load timezone %q: %v", location, err)
 	}
-	var t time.Time
-	for _, layout := range timeLayouts {
-		t, err = time.ParseInLocation(layout, stamp, loc)
-		if err == nil {
-			return AthenaTime{Valid: true, Time: t}, nil
-		}
+	return parseAthenaTimeInLocation(stamp, loc)
+}
+
+// parseAthenaTimeWithOffset is to parse a value with an offset zone like +08:00 or -0530.
+func parseAthenaTimeWithOffset(stamp, offset string) (AthenaTime, error) {
+	digits := strings.Replace(offset[1:], ":", "", 1)
+	hours, err := strconv.Atoi(digits[:2])
+	if err != nil {
+		return AthenaTime{}, err
 	}
-	return AthenaTime{}, err
+	minutes, err := strconv.Atoi(digits[2:])
+	if err != nil {
+		return AthenaTime{}, err
+	}
+	seconds := hours*60*60 + minutes*60
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+	return parseAthenaTimeInLocation(stamp, time.FixedZone(offset, seconds))
 }
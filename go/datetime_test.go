@@ -22,6 +22,7 @@ package athenadriver
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -86,3 +87,46 @@ func TestDateTime_ParseAthenaTimeWithLocation(t *testing.T) {
 	assert.False(t, r.Valid)
 	assert.Equal(t, r.Time.String(), ZeroDateTimeString)
 }
+
+func TestDateTime_ScanTimeWithOffset(t *testing.T) {
+	for _, v := range []string{"2001-08-22 03:04:05.321 +08:00", "2001-08-22 03:04:05.321+08:00",
+		"2001-08-22 03:04:05.321 +0800"} {
+		r, e := scanTime(v)
+		assert.Nil(t, e, v)
+		assert.True(t, r.Valid)
+		_, offset := r.Time.Zone()
+		assert.Equal(t, 8*60*60, offset)
+		assert.Equal(t, "2001-08-21 19:04:05.321", r.Time.UTC().Format(TimestampUniXFormat))
+	}
+
+	r, e := scanTime("01:02:03.456-05:30")
+	assert.Nil(t, e)
+	_, offset := r.Time.Zone()
+	assert.Equal(t, -(5*60*60 + 30*60), offset)
+	assert.Equal(t, 3, r.Time.Second())
+}
+
+func TestDateTime_ScanTimeWithLocation(t *testing.T) {
+	r, e := scanTime("2001-08-22 03:04:05.321 America/Los_Angeles")
+	assert.Nil(t, e)
+	assert.Equal(t, "America/Los_Angeles", r.Time.Location().String())
+	assert.Equal(t, "2001-08-22 10:04:05.321", r.Time.UTC().Format(TimestampUniXFormat))
+}
+
+func TestDateTime_ScanTimeInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	assert.Nil(t, err)
+	r, e := scanTimeInLocation("2001-08-22 03:04:05.123456", loc)
+	assert.Nil(t, e)
+	assert.Equal(t, loc, r.Time.Location())
+	assert.Equal(t, 123456000, r.Time.Nanosecond())
+
+	r, e = scanTimeInLocation("2001-08-22", loc)
+	assert.Nil(t, e)
+	assert.Equal(t, loc, r.Time.Location())
+
+	// the zone of values with time zone is kept
+	r, e = scanTimeInLocation("2001-08-22 03:04:05 UTC", loc)
+	assert.Nil(t, e)
+	assert.Equal(t, time.UTC, r.Time.Location())
+}
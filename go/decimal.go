@@ -0,0 +1,70 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+// DecimalMode is the Go representation of the values of DECIMAL columns.
+type DecimalMode string
+
+const (
+	// DecimalModeString returns DECIMAL values as their exact text, like "12.30".
+	// It is the default mode, and can be scanned into decimal types implementing sql.Scanner.
+	DecimalModeString DecimalMode = "string"
+
+	// DecimalModeBigRat returns DECIMAL values as *big.Rat.
+	DecimalModeBigRat DecimalMode = "bigRat"
+)
+
+// DecimalParser is to convert the text of a DECIMAL value into a decimal type,
+// like decimal.NewFromString of github.com/shopspring/decimal.
+type DecimalParser func(s string) (driver.Value, error)
+
+// convertDecimal is to convert the text of a DECIMAL value by the decimal parser or mode in Config.
+func convertDecimal(val string, config *Config) (driver.Value, error) {
+	if parser := config.GetDecimalParser(); parser != nil {
+		return parser(val)
+	}
+	if config.GetDecimalMode() == DecimalModeBigRat {
+		rat, ok := new(big.Rat).SetString(val)
+		if !ok {
+			return nil, fmt.Errorf("invalid decimal value `%s`", val)
+		}
+		return rat, nil
+	}
+	return val, nil
+}
+
+// decimalScanType is to get the Go type of the values convertDecimal returns.
+func decimalScanType(config *Config) reflect.Type {
+	if config.GetDecimalParser() != nil {
+		return reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	if config.GetDecimalMode() == DecimalModeBigRat {
+		return reflect.TypeOf((*big.Rat)(nil))
+	}
+	return reflect.TypeOf("")
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"database/sql/driver"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// testDecimal is a decimal type returned by a DecimalParser.
+type testDecimal struct {
+	unscaled string
+}
+
+func TestConvertDecimal(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	v, err := convertDecimal("12345678901234567890.123456789", testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, "12345678901234567890.123456789", v)
+	assert.Equal(t, reflect.TypeOf(""), decimalScanType(testConf))
+
+	testConf.SetDecimalMode(DecimalModeBigRat)
+	v, err = convertDecimal("12345678901234567890.123456789", testConf)
+	assert.Nil(t, err)
+	expected, _ := new(big.Rat).SetString("12345678901234567890123456789/1000000000")
+	assert.Equal(t, 0, expected.Cmp(v.(*big.Rat)))
+	assert.Equal(t, reflect.TypeOf(&big.Rat{}), decimalScanType(testConf))
+	_, err = convertDecimal("abc", testConf)
+	assert.NotNil(t, err)
+
+	testConf.SetDecimalParser(func(s string) (driver.Value, error) {
+		if s == "" {
+			return nil, errors.New("empty")
+		}
+		return testDecimal{unscaled: s}, nil
+	})
+	v, err = convertDecimal("1.5", testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, testDecimal{unscaled: "1.5"}, v)
+	_, err = convertDecimal("", testConf)
+	assert.NotNil(t, err)
+	assert.Equal(t, reflect.TypeOf((*interface{})(nil)).Elem(), decimalScanType(testConf))
+}
+
+func TestRows_AthenaTypeToGoType_Decimal(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetDecimalMode(DecimalModeBigRat)
+	r := &Rows{config: testConf, tracer: NewDefaultObservability(testConf)}
+	v, err := r.athenaTypeToGoType(newColumnInfo("n", "decimal"), aws.String("0.10"), testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, "1/10", v.(*big.Rat).String())
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"go.uber.org/zap"
+)
+
+// The engine versions of Athena workgroups, for Config.SetWGEngineVersion.
+const (
+	AthenaEngineVersionAuto = "AUTO"
+	AthenaEngineVersion2    = "Athena engine version 2"
+	AthenaEngineVersion3    = "Athena engine version 3"
+)
+
+// The driver features which need a recent Athena engine version.
+const (
+	// EngineFeatureResultReuse is the reuse of query results, set with Config.SetResultReuse or WithResultReuse.
+	EngineFeatureResultReuse = "result reuse"
+)
+
+// engineFeatureVersions are the major engine versions the features need. Only the features driven by the
+// Config are gated. The UNLOAD of ResultModeUnload is in Parquet with GZIP, which engine version 2 supports,
+// and the UNLOAD options and the types of engine version 3 in a query, like ZSTD compression levels or
+// timestamp(6), are the caller's SQL, which Athena rejects with its own error on engine version 2. The types of
+// the results are read as Athena reports them, whatever the engine version.
+var engineFeatureVersions = map[string]int{
+	EngineFeatureResultReuse: 3,
+}
+
+// parseEngineVersion is to get the major version of an Athena engine version, like 3 for
+// "Athena engine version 3". It is 0 if unknown.
+func parseEngineVersion(version string) int {
+	v, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(version, "Athena engine version")))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// detectEngineVersion is to get the major effective engine version of the workgroup of Config, so the
+// features it doesn't support fail with an EngineVersionError. The connection still works if the workgroup
+// can't be got, without checking the features.
+func (c *Connection) detectEngineVersion(ctx context.Context) {
+	obs := c.connector.tracer
+	wgName := c.connector.config.GetWorkgroup().Name
+	if wgName == "" {
+		wgName = DefaultWGName
+	}
+	wg, err := getWG(ctx, c.athenaAPI, wgName)
+	if err != nil || wg == nil || wg.Configuration == nil || wg.Configuration.EngineVersion == nil {
+		obs.Scope().Counter(DriverName + ".failure.sqlconnector.engineversion").Inc(1)
+		fields := []zap.Field{zap.String("workgroup", wgName)}
+		if err != nil {
+			fields = append(fields, zap.String("error", err.Error()))
+		}
+		obs.Log(WarnLevel, "engine version of workgroup is unknown", fields...)
+		return
+	}
+	version := aws.StringValue(wg.Configuration.EngineVersion.EffectiveEngineVersion)
+	c.engineVersion = parseEngineVersion(version)
+	c.engineVersionWG = wgName
+	obs.Log(DebugLevel, "engine version of workgroup is detected",
+		zap.String("workgroup", wgName),
+		zap.String("engineVersion", version))
+}
+
+// EngineVersion is the major effective engine version of the workgroup of Config, like 3, detected at
+// Connect if Config.SetEngineVersionCheck is enabled. It is 0 if unknown.
+func (c *Connection) EngineVersion() int {
+	return c.engineVersion
+}
+
+// checkEngineFeature is to check if the engine version of the query in workgroup wgName supports the
+// feature. Only the workgroup of Config is checked, as the engine version of the others is unknown.
+func (c *Connection) checkEngineFeature(wgName string, feature string) error {
+	if c.engineVersion == 0 || wgName != c.engineVersionWG {
+		return nil
+	}
+	if required := engineFeatureVersions[feature]; c.engineVersion < required {
+		return &EngineVersionError{
+			Feature:         feature,
+			Workgroup:       wgName,
+			EngineVersion:   c.engineVersion,
+			RequiredVersion: required,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// engineVersionAthenaClient has workgroups of an effective engine version.
+type engineVersionAthenaClient struct {
+	queryContextAthenaClient
+	engineVersion string
+}
+
+func (m *engineVersionAthenaClient) GetWorkGroupWithContext(ctx aws.Context, input *athena.GetWorkGroupInput,
+	opts ...request.Option) (*athena.GetWorkGroupOutput, error) {
+	return &athena.GetWorkGroupOutput{WorkGroup: &athena.WorkGroup{
+		Name:  input.WorkGroup,
+		State: aws.String(athena.WorkGroupStateEnabled),
+		Configuration: &athena.WorkGroupConfiguration{
+			EngineVersion: &athena.EngineVersion{
+				SelectedEngineVersion:  aws.String(AthenaEngineVersionAuto),
+				EffectiveEngineVersion: aws.String(m.engineVersion),
+			},
+		},
+	}}, nil
+}
+
+func TestParseEngineVersion(t *testing.T) {
+	assert.Equal(t, 2, parseEngineVersion(AthenaEngineVersion2))
+	assert.Equal(t, 3, parseEngineVersion(AthenaEngineVersion3))
+	assert.Equal(t, 0, parseEngineVersion(AthenaEngineVersionAuto))
+	assert.Equal(t, 0, parseEngineVersion(""))
+}
+
+func TestSQLConnector_Connect_EngineVersionCheck(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	athenaClient := &engineVersionAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		engineVersion:            AthenaEngineVersion2,
+	}
+	athenaClient.GetWGStatus = true
+	conn, err := NewConnectorWithClient(testConf, athenaClient).Connect(context.Background())
+	assert.Nil(t, err)
+	// the engine version isn't checked by default
+	assert.Equal(t, 0, conn.(*Connection).EngineVersion())
+
+	testConf.SetEngineVersionCheck(true)
+	conn, err = NewConnectorWithClient(testConf, athenaClient).Connect(context.Background())
+	assert.Nil(t, err)
+	c := conn.(*Connection)
+	assert.Equal(t, 2, c.EngineVersion())
+
+	ctx := WithResultReuse(context.Background(), true, 60)
+	_, err = c.QueryContext(ctx, "SELECT 1", nil)
+	var versionErr *EngineVersionError
+	assert.True(t, errors.As(err, &versionErr))
+	assert.True(t, errors.Is(err, ErrEngineVersionUnsupported))
+	assert.Equal(t, EngineFeatureResultReuse, versionErr.Feature)
+	assert.Equal(t, 3, versionErr.RequiredVersion)
+	assert.Empty(t, athenaClient.inputs)
+
+	// the engine version of other workgroups is unknown
+	_, err = c.QueryContext(WithWorkgroup(ctx, "analytics"), "SELECT 1", nil)
+	assert.Nil(t, err)
+
+	athenaClient.engineVersion = AthenaEngineVersion3
+	conn, err = NewConnectorWithClient(testConf, athenaClient).Connect(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, conn.(*Connection).EngineVersion())
+	_, err = conn.(*Connection).QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+}
+
+func TestSQLConnector_Connect_EngineVersionUnknown(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetEngineVersionCheck(true)
+	conn, err := NewConnectorWithClient(testConf, newMockAthenaClient()).Connect(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, conn.(*Connection).EngineVersion())
+	assert.Nil(t, conn.(*Connection).checkEngineFeature(DefaultWGName, EngineFeatureResultReuse))
+}
@@ -23,6 +23,8 @@ package athenadriver
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // Various errors the driver might return. Can change between driver versions.
@@ -34,13 +36,194 @@ var (
 	ErrConfigWGPointer              = errors.New("workgroup pointer is nil")
 	ErrConfigAccessIDRequired       = errors.New("AWS access ID is required")
 	ErrConfigAccessKeyRequired      = errors.New("AWS access Key is required")
+	ErrConfigRoleARNRequired        = errors.New("AWS IAM role ARN is required")
+	ErrConfigEndpoint               = errors.New("endpoint must be an absolute http or https URL")
+	ErrConfigHTTPProxy              = errors.New("HTTP proxy must be an absolute URL")
+	ErrConfigResultReuseMaxAge      = errors.New("result reuse max age must be between 0 and 10080 minutes")
+	ErrConfigQueryAnnotation        = errors.New("query annotation must be a valid text/template")
+	ErrConfigWGEncryption           = errors.New("workgroup encryption must be SSE_S3, or SSE_KMS or CSE_KMS with a KMS key")
+	ErrConfigResultEncryption       = errors.New("result encryption must be SSE_S3, or SSE_KMS or CSE_KMS with a KMS key")
+	ErrConfigResultBucketOwner      = errors.New("result bucket owner must be a 12-digit AWS account ID")
+	ErrConfigResultACL              = errors.New("result ACL must be BUCKET_OWNER_FULL_CONTROL")
+	ErrConfigWGBytesScannedCutoff   = errors.New("workgroup bytes scanned cutoff must be at least 10MB")
+	ErrSSOTokenExpired              = errors.New("AWS SSO token is expired or invalid")
+	ErrEC2MetadataDisabled          = errors.New("EC2 instance metadata is disabled in driver config")
+	ErrWebIdentityNotConfigured     = errors.New("AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE are required for web identity credentials")
 	ErrQueryUnknownType             = errors.New("query parameter type is unknown")
 	ErrQueryBufferOF                = errors.New("query buffer overflow")
+	ErrQueryMixedArgs               = errors.New("query args must be either all named or all positional")
+	ErrQueryNamedArgMissing         = errors.New("query named arg is missing")
 	ErrQueryTimeout                 = errors.New("query timeout")
+	ErrQueryTooLong                 = fmt.Errorf("%w: query is longer than Athena allows", ErrInvalidQuery)
+	ErrQueryRunning                 = errors.New("query execution is still queued or running")
+	ErrBudgetExceeded               = errors.New("query scanned more bytes than allowed")
+	ErrPartitionFilterMissing       = errors.New("query reads a partitioned table without a partition filter")
+	ErrWGDrift                      = errors.New("workgroup configuration drifted from driver config")
+	ErrWGTagInvalid                 = errors.New("workgroup tag is invalid")
+	ErrEngineVersionUnsupported     = errors.New("Athena engine version of the workgroup doesn't support the feature")
+	ErrCapacityReservationDPUs      = fmt.Errorf("capacity reservation must have at least %d DPUs", MinCapacityReservationDPUs)
+	ErrCapacityRequired             = errors.New("workgroup isn't assigned to an active capacity reservation")
 	ErrAthenaTransactionUnsupported = errors.New("Athena doesn't support transaction statements")
 	ErrAthenaNilDatum               = errors.New("*athena.Datum must not be nil")
+	ErrArrowUnsupported             = errors.New("rows of the query can't be read as Arrow records")
 	ErrAthenaNilAPI                 = errors.New("athenaAPI must not be nil")
+	ErrS3NilAPI                     = errors.New("s3API must not be nil")
+	ErrLakeFormationNilAPI          = errors.New("lakeFormationAPI must not be nil")
+	ErrSTSNilAPI                    = errors.New("stsAPI must not be nil")
 	ErrTestMockGeneric              = errors.New("some_mock_error_for_test")
 	ErrTestMockFailedByAthena       = errors.New("the reason why Athena failed the query")
 	ErrServiceLimitOverride         = fmt.Errorf("service limit override must be greater than %d", PoolInterval)
 )
+
+// QueryTimeoutError is returned when a query runs longer than its query timeout, and is stopped.
+// It is ErrQueryTimeout for errors.Is. StopErr is the error of StopQueryExecution if the query couldn't be
+// stopped, and may still be running.
+type QueryTimeoutError struct {
+	QueryID string
+	Timeout time.Duration
+	StopErr error
+}
+
+func (e *QueryTimeoutError) Error() string {
+	if e.StopErr != nil {
+		return fmt.Sprintf("query %s timed out after %s, and failed to stop: %s", e.QueryID, e.Timeout, e.StopErr)
+	}
+	return fmt.Sprintf("query %s timed out after %s", e.QueryID, e.Timeout)
+}
+
+// Is is to match ErrQueryTimeout.
+func (e *QueryTimeoutError) Is(target error) bool {
+	return target == ErrQueryTimeout
+}
+
+// Unwrap is to get the error of StopQueryExecution.
+func (e *QueryTimeoutError) Unwrap() error {
+	return e.StopErr
+}
+
+// QueryTooLongError is returned before a query is started when it's longer than MAXQueryStringLength, which
+// Athena would reject. It is ErrQueryTooLong, and ErrInvalidQuery, for errors.Is.
+type QueryTooLongError struct {
+	Length int
+}
+
+func (e *QueryTooLongError) Error() string {
+	return fmt.Sprintf("query is %d bytes, Athena allows less than %d bytes", e.Length, MAXQueryStringLength)
+}
+
+// Is is to match ErrQueryTooLong and ErrInvalidQuery.
+func (e *QueryTooLongError) Is(target error) bool {
+	return target == ErrQueryTooLong || target == ErrInvalidQuery
+}
+
+// BudgetExceededError is returned when a query scans more bytes than the max scanned bytes in Config,
+// and is stopped. It is ErrBudgetExceeded for errors.Is.
+type BudgetExceededError struct {
+	QueryID            string
+	DataScannedInBytes int64
+	MaxScannedBytes    int64
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("query %s scanned %d bytes, more than the max of %d bytes",
+		e.QueryID, e.DataScannedInBytes, e.MaxScannedBytes)
+}
+
+// Is is to match ErrBudgetExceeded.
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// PartitionFilterError is returned in PartitionGuardStrict mode when a SELECT reads a partitioned table
+// without filtering on any of its partition keys. It is ErrPartitionFilterMissing for errors.Is.
+type PartitionFilterError struct {
+	Database      string
+	Table         string
+	PartitionKeys []string
+}
+
+func (e *PartitionFilterError) Error() string {
+	return fmt.Sprintf("query reads table %s.%s without a filter on its partition keys %s",
+		e.Database, e.Table, strings.Join(e.PartitionKeys, ", "))
+}
+
+// Is is to match ErrPartitionFilterMissing.
+func (e *PartitionFilterError) Is(target error) bool {
+	return target == ErrPartitionFilterMissing
+}
+
+// WGDriftError is returned in WGReconcileStrict mode when the configuration of an existing workgroup differs
+// from the one in Config. It is ErrWGDrift for errors.Is.
+type WGDriftError struct {
+	Workgroup string
+	// Settings are the names of the settings which differ, like BytesScannedCutoffPerQuery.
+	Settings []string
+}
+
+func (e *WGDriftError) Error() string {
+	return fmt.Sprintf("workgroup %q drifted from driver config: %s", e.Workgroup, strings.Join(e.Settings, ", "))
+}
+
+// Is is to match ErrWGDrift.
+func (e *WGDriftError) Is(target error) bool {
+	return target == ErrWGDrift
+}
+
+// EngineVersionError is returned when a query uses a feature the engine version of its workgroup doesn't
+// support, like result reuse on Athena engine version 2. It is ErrEngineVersionUnsupported for errors.Is.
+type EngineVersionError struct {
+	Feature         string
+	Workgroup       string
+	EngineVersion   int
+	RequiredVersion int
+}
+
+func (e *EngineVersionError) Error() string {
+	return fmt.Sprintf("%s needs Athena engine version %d, but workgroup %q runs version %d",
+		e.Feature, e.RequiredVersion, e.Workgroup, e.EngineVersion)
+}
+
+// Is is to match ErrEngineVersionUnsupported.
+func (e *EngineVersionError) Is(target error) bool {
+	return target == ErrEngineVersionUnsupported
+}
+
+// LakeFormationDeniedError is returned when Lake Formation denies the access of a query to a table or a column.
+// The database, the table and the column are empty when the reason doesn't tell. It is ErrLakeFormationDenied
+// and ErrAccessDenied for errors.Is.
+type LakeFormationDeniedError struct {
+	Database string
+	Table    string
+	Column   string
+	// Err is the failure reason of Athena.
+	Err error
+}
+
+func (e *LakeFormationDeniedError) Error() string {
+	resource := "the resources of the query"
+	if e.Table != "" {
+		resource = "table " + e.Table
+		if e.Database != "" {
+			resource = "table " + e.Database + "." + e.Table
+		}
+		if e.Column != "" {
+			resource = "column " + e.Column + " of " + resource
+		}
+	} else if e.Column != "" {
+		resource = "column " + e.Column
+	}
+	if e.Err == nil {
+		return "Lake Formation denied access to " + resource
+	}
+	return fmt.Sprintf("Lake Formation denied access to %s: %s", resource, e.Err)
+}
+
+// Unwrap is to get the failure reason of Athena.
+func (e *LakeFormationDeniedError) Unwrap() error {
+	return e.Err
+}
+
+// Is is to match ErrLakeFormationDenied and ErrAccessDenied.
+func (e *LakeFormationDeniedError) Is(target error) bool {
+	return target == ErrLakeFormationDenied || target == ErrAccessDenied
+}
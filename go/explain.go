@@ -0,0 +1,364 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExplainFormat is the format Athena returns the plan of Connection.Explain in, which is parsed into a QueryPlan.
+type ExplainFormat string
+
+const (
+	// ExplainFormatText is the indented text of EXPLAIN, the default format of Athena.
+	ExplainFormatText ExplainFormat = "TEXT"
+
+	// ExplainFormatJSON is the JSON of EXPLAIN (FORMAT JSON), which has the estimates of the nodes as numbers.
+	ExplainFormatJSON ExplainFormat = "JSON"
+)
+
+// QueryPlan is the plan of a query from Connection.Explain or Connection.ExplainLogical. A logical plan has a
+// single fragment, without an ID.
+type QueryPlan struct {
+	Fragments []*PlanFragment
+	// Text is the plan as Athena returned it.
+	Text string
+}
+
+// PlanFragment is a fragment of a distributed plan, which runs in a stage of the query.
+type PlanFragment struct {
+	ID string
+	// Partitioning is how the fragment is distributed, like SINGLE, HASH or SOURCE, empty in ExplainFormatJSON.
+	Partitioning string
+	// Details are the lines of the fragment before its root node, like its output layout, in ExplainFormatText.
+	Details []string
+	Root    *PlanNode
+}
+
+// PlanNode is a node of a plan, like TableScan, ScanFilterProject, Aggregate or Output.
+type PlanNode struct {
+	// ID is the ID of the node in ExplainFormatJSON, empty in ExplainFormatText.
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Descriptor are the arguments of the node, like table and filterPredicate of ScanFilter.
+	Descriptor map[string]string `json:"descriptor"`
+	Outputs    []PlanSymbol      `json:"outputs"`
+	// Details are the lines under the node, like the columns a TableScan reads and their partition constraints.
+	Details []string `json:"details"`
+	// Estimates of the node, in ExplainFormatJSON only. Unknown estimates are NaN.
+	Estimates []PlanEstimate `json:"estimates"`
+	Children  []*PlanNode    `json:"children"`
+}
+
+// PlanSymbol is an output column of a plan node.
+type PlanSymbol struct {
+	Symbol string `json:"symbol"`
+	Type   string `json:"type"`
+}
+
+// PlanEstimate is the cost estimate of a plan node.
+type PlanEstimate struct {
+	OutputRowCount    float64
+	OutputSizeInBytes float64
+	CPUCost           float64
+	MemoryCost        float64
+	NetworkCost       float64
+}
+
+// UnmarshalJSON is to read the estimates, which Athena writes as strings like "NaN" when they are unknown.
+func (e *PlanEstimate) UnmarshalJSON(data []byte) error {
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	for key, dest := range map[string]*float64{
+		"outputRowCount":    &e.OutputRowCount,
+		"outputSizeInBytes": &e.OutputSizeInBytes,
+		"cpuCost":           &e.CPUCost,
+		"memoryCost":        &e.MemoryCost,
+		"networkCost":       &e.NetworkCost,
+	} {
+		switch v := values[key].(type) {
+		case float64:
+			*dest = v
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("invalid plan estimate %s %q", key, v)
+			}
+			*dest = f
+		}
+	}
+	return nil
+}
+
+// Table is the table the node reads, like awsdatacatalog:db:t, empty if it's not a scan.
+func (n *PlanNode) Table() string {
+	return n.Descriptor["table"]
+}
+
+// Walk is to call fn on the nodes of the plan, parents before their children, until fn returns false.
+func (p *QueryPlan) Walk(fn func(n *PlanNode) bool) {
+	var walk func(n *PlanNode) bool
+	walk = func(n *PlanNode) bool {
+		if n == nil {
+			return true
+		}
+		if !fn(n) {
+			return false
+		}
+		for _, child := range n.Children {
+			if !walk(child) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, f := range p.Fragments {
+		if !walk(f.Root) {
+			return
+		}
+	}
+}
+
+// TableScans are the nodes of the plan which read tables, to check them for full scans or partition
+// predicates.
+func (p *QueryPlan) TableScans() []*PlanNode {
+	var scans []*PlanNode
+	p.Walk(func(n *PlanNode) bool {
+		if n.Table() != "" {
+			scans = append(scans, n)
+		}
+		return true
+	})
+	return scans
+}
+
+// Explain is to get the distributed plan of the query in format, without running it, with
+// EXPLAIN (TYPE DISTRIBUTED). It is for tools to lint queries before they are run.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) Explain(ctx context.Context, query string, format ExplainFormat) (*QueryPlan, error) {
+	return c.explain(ctx, query, "DISTRIBUTED", format)
+}
+
+// ExplainLogical is to get the logical plan of the query in format, without running it, with
+// EXPLAIN (TYPE LOGICAL). It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) ExplainLogical(ctx context.Context, query string, format ExplainFormat) (*QueryPlan, error) {
+	return c.explain(ctx, query, "LOGICAL", format)
+}
+
+// explain is to run EXPLAIN of planType on the query, and parse the plan of its rows.
+func (c *Connection) explain(ctx context.Context, query string, planType string, format ExplainFormat) (
+	*QueryPlan, error) {
+	if format == "" {
+		format = ExplainFormatText
+	}
+	if format != ExplainFormatText && format != ExplainFormatJSON {
+		return nil, fmt.Errorf("%w: invalid explain format %q", ErrInvalidQuery, format)
+	}
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	if query == "" {
+		return nil, ErrInvalidQuery
+	}
+	// the plan is a text column, fetched with GetQueryResults in any result mode
+	rows, err := c.QueryContext(WithResultMode(ctx, ResultModeAPI),
+		fmt.Sprintf("EXPLAIN (TYPE %s, FORMAT %s) %s", planType, format, query), nil)
+	if err != nil {
+		c.connector.tracer.Scope().Counter(DriverName + ".failure.explain").Inc(1)
+		return nil, err
+	}
+	defer rows.Close()
+	var lines []string
+	dest := make([]driver.Value, len(rows.Columns()))
+	for {
+		if err = rows.Next(dest); err == io.EOF {
+			break
+		} else if err != nil {
+			c.connector.tracer.Scope().Counter(DriverName + ".failure.explain").Inc(1)
+			return nil, err
+		}
+		if len(dest) > 0 && dest[0] != nil {
+			lines = append(lines, fmt.Sprint(dest[0]))
+		}
+	}
+	text := strings.Join(lines, "\n")
+	if format == ExplainFormatJSON {
+		return parseJSONPlan(text)
+	}
+	return parseTextPlan(text), nil
+}
+
+// parseJSONPlan is to parse the plan of EXPLAIN (FORMAT JSON), which is the root node of a logical plan, or the
+// root nodes of the fragments of a distributed plan by their IDs.
+func parseJSONPlan(text string) (*QueryPlan, error) {
+	var fragments map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &fragments); err != nil {
+		return nil, fmt.Errorf("invalid JSON query plan: %w", err)
+	}
+	plan := &QueryPlan{Text: text}
+	if _, ok := fragments["name"]; ok {
+		fragments = map[string]json.RawMessage{"": json.RawMessage(text)}
+	}
+	for id, raw := range fragments {
+		var root PlanNode
+		if err := json.Unmarshal(raw, &root); err != nil {
+			return nil, fmt.Errorf("invalid JSON query plan of fragment %q: %w", id, err)
+		}
+		plan.Fragments = append(plan.Fragments, &PlanFragment{ID: id, Root: &root})
+	}
+	sort.Slice(plan.Fragments, func(i, j int) bool {
+		a, _ := strconv.Atoi(plan.Fragments[i].ID)
+		b, _ := strconv.Atoi(plan.Fragments[j].ID)
+		return a < b
+	})
+	return plan, nil
+}
+
+var (
+	// planFragmentPattern matches the first line of a fragment of a text plan, like Fragment 1 [SOURCE].
+	planFragmentPattern = regexp.MustCompile(`^Fragment (\d+) \[([^\]]*)\]`)
+	// planNodePattern matches a node of a text plan, like TableScan[table = awsdatacatalog:db:t], with the
+	// output layout after => of Athena engine version 2.
+	planNodePattern = regexp.MustCompile(`^([A-Z][A-Za-z]*)(?:\[(.*?)\])?(?:\s+=>.*)?$`)
+)
+
+// parseTextPlan is to parse the indented text plan of EXPLAIN. The children of a node are indented under it,
+// after └─, ├─ or - on Athena engine version 2, and the other lines indented under the node are its details.
+func parseTextPlan(text string) *QueryPlan {
+	plan := &QueryPlan{Text: text}
+	type level struct {
+		column int
+		node   *PlanNode
+	}
+	var fragment *PlanFragment
+	var stack []level
+	for _, line := range strings.Split(text, "\n") {
+		if m := planFragmentPattern.FindStringSubmatch(line); m != nil {
+			fragment = &PlanFragment{ID: m[1], Partitioning: m[2]}
+			plan.Fragments = append(plan.Fragments, fragment)
+			stack = nil
+			continue
+		}
+		content := strings.TrimLeft(line, " │")
+		if content == "" {
+			continue
+		}
+		marked := false
+		for _, marker := range []string{"└─ ", "├─ ", "- "} {
+			if strings.HasPrefix(content, marker) {
+				content, marked = content[len(marker):], true
+				break
+			}
+		}
+		column := len([]rune(line)) - len([]rune(content))
+		if fragment == nil {
+			fragment = &PlanFragment{}
+			plan.Fragments = append(plan.Fragments, fragment)
+		}
+		m := planNodePattern.FindStringSubmatch(content)
+		if m == nil || (!marked && fragment.Root != nil) {
+			if len(stack) == 0 {
+				fragment.Details = append(fragment.Details, content)
+			} else {
+				node := stack[len(stack)-1].node
+				node.Details = append(node.Details, content)
+				if strings.HasPrefix(content, "Layout: ") {
+					node.Outputs = parsePlanLayout(strings.TrimPrefix(content, "Layout: "))
+				}
+			}
+			continue
+		}
+		node := &PlanNode{Name: m[1], Descriptor: parsePlanDescriptor(m[2])}
+		for len(stack) > 0 && stack[len(stack)-1].column >= column {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			fragment.Root = node
+		} else {
+			parent := stack[len(stack)-1].node
+			parent.Children = append(parent.Children, node)
+		}
+		stack = append(stack, level{column, node})
+	}
+	return plan
+}
+
+// parsePlanDescriptor is to parse the arguments of a node of a text plan, like table = awsdatacatalog:db:t,
+// filterPredicate = (x > 1). The arguments without a name are joined under the empty name.
+func parsePlanDescriptor(s string) map[string]string {
+	descriptor := map[string]string{}
+	for _, argument := range splitPlanList(s) {
+		if i := strings.Index(argument, " = "); i > 0 && !strings.ContainsAny(argument[:i], "([{") {
+			descriptor[argument[:i]] = argument[i+3:]
+		} else if previous, ok := descriptor[""]; ok {
+			descriptor[""] = previous + ", " + argument
+		} else {
+			descriptor[""] = argument
+		}
+	}
+	return descriptor
+}
+
+// parsePlanLayout is to parse the output layout of a node of a text plan, like [id:integer, price:decimal(10,2)].
+func parsePlanLayout(s string) []PlanSymbol {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	var outputs []PlanSymbol
+	for _, column := range splitPlanList(s) {
+		symbol := PlanSymbol{Symbol: column}
+		if i := strings.IndexByte(column, ':'); i > 0 {
+			symbol = PlanSymbol{Symbol: column[:i], Type: column[i+1:]}
+		}
+		outputs = append(outputs, symbol)
+	}
+	return outputs
+}
+
+// splitPlanList is to split a list of a text plan by its commas outside of brackets and strings.
+func splitPlanList(s string) []string {
+	var items []string
+	depth, start, quoted := 0, 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if item := strings.TrimSpace(s[start:]); item != "" {
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTextPlan = `Fragment 0 [SINGLE]
+    Output layout: [dt, count]
+    Output partitioning: SINGLE []
+    Output[columnNames = [dt, _col1]]
+    │   Layout: [dt:varchar, count:bigint]
+    │   Estimates: {rows: ? (?), cpu: ?, memory: 0B, network: ?}
+    │   _col1 := count
+    └─ RemoteSource[sourceFragmentIds = [1]]
+           Layout: [dt:varchar, count:bigint]
+
+Fragment 1 [SOURCE]
+    Output layout: [dt, count]
+    Output partitioning: SINGLE []
+    Aggregate[type = FINAL, keys = [dt]]
+    │   Layout: [dt:varchar, count:bigint]
+    ├─ ScanFilter[table = awsdatacatalog:db:events, filterPredicate = (price > DECIMAL '1.50')]
+    │      Layout: [dt:varchar, price:decimal(10,2)]
+    │      dt := dt:varchar:PARTITION_KEY
+    │          :: [[2022-05-01]]
+    └─ TableScan[table = awsdatacatalog:db:users]
+           Layout: [id:integer]`
+
+const testJSONPlan = `{
+  "0": {"id": "9", "name": "Output", "descriptor": {"columnNames": "[id]"},
+    "outputs": [{"symbol": "id", "type": "integer"}], "details": [],
+    "estimates": [{"outputRowCount": "NaN", "outputSizeInBytes": 10.5, "cpuCost": 0, "memoryCost": 0,
+      "networkCost": "NaN"}],
+    "children": [{"id": "1", "name": "RemoteSource", "descriptor": {"sourceFragmentIds": "[1]"}, "children": []}]},
+  "1": {"id": "0", "name": "TableScan", "descriptor": {"table": "awsdatacatalog:db:t"}, "children": []}
+}`
+
+// explainAthenaClient returns the plan for the EXPLAIN queries, one line a row.
+type explainAthenaClient struct {
+	queryContextAthenaClient
+	plan string
+}
+
+func (m *explainAthenaClient) GetQueryResultsWithContext(ctx aws.Context, input *athena.GetQueryResultsInput,
+	o ...request.Option) (*athena.GetQueryResultsOutput, error) {
+	var rows [][]*string
+	for _, line := range strings.Split(m.plan, "\n") {
+		rows = append(rows, []*string{aws.String(line)})
+	}
+	return newHeaderResultPage([]*string{aws.String("Query Plan")}, []string{"varchar"}, rows), nil
+}
+
+func TestParseTextPlan(t *testing.T) {
+	plan := parseTextPlan(testTextPlan)
+	assert.Equal(t, testTextPlan, plan.Text)
+	if !assert.Len(t, plan.Fragments, 2) {
+		return
+	}
+	f := plan.Fragments[0]
+	assert.Equal(t, "0", f.ID)
+	assert.Equal(t, "SINGLE", f.Partitioning)
+	assert.Equal(t, []string{"Output layout: [dt, count]", "Output partitioning: SINGLE []"}, f.Details)
+	assert.Equal(t, "Output", f.Root.Name)
+	assert.Equal(t, map[string]string{"columnNames": "[dt, _col1]"}, f.Root.Descriptor)
+	assert.Equal(t, []PlanSymbol{{"dt", "varchar"}, {"count", "bigint"}}, f.Root.Outputs)
+	assert.Len(t, f.Root.Details, 3)
+	if assert.Len(t, f.Root.Children, 1) {
+		assert.Equal(t, "RemoteSource", f.Root.Children[0].Name)
+	}
+
+	root := plan.Fragments[1].Root
+	assert.Equal(t, "Aggregate", root.Name)
+	assert.Equal(t, map[string]string{"type": "FINAL", "keys": "[dt]"}, root.Descriptor)
+	if assert.Len(t, root.Children, 2) {
+		scan := root.Children[0]
+		assert.Equal(t, "ScanFilter", scan.Name)
+		assert.Equal(t, "(price > DECIMAL '1.50')", scan.Descriptor["filterPredicate"])
+		assert.Equal(t, []PlanSymbol{{"dt", "varchar"}, {"price", "decimal(10,2)"}}, scan.Outputs)
+		assert.Equal(t, ":: [[2022-05-01]]", scan.Details[2])
+		assert.Empty(t, scan.Children)
+		assert.Equal(t, "TableScan", root.Children[1].Name)
+	}
+
+	var tables []string
+	for _, scan := range plan.TableScans() {
+		tables = append(tables, scan.Table())
+	}
+	assert.Equal(t, []string{"awsdatacatalog:db:events", "awsdatacatalog:db:users"}, tables)
+}
+
+func TestParseTextPlan_Logical(t *testing.T) {
+	// the logical plan of Athena engine version 2, without fragments
+	plan := parseTextPlan("- Output[id] => [[id]]\n    - TableScan[awsdatacatalog:HiveTableHandle{schemaName=db, " +
+		"tableName=t}, grouped = false] => [[id]]\n            id := id:int:0:REGULAR")
+	if !assert.Len(t, plan.Fragments, 1) {
+		return
+	}
+	root := plan.Fragments[0].Root
+	assert.Equal(t, "", plan.Fragments[0].ID)
+	assert.Equal(t, map[string]string{"": "id"}, root.Descriptor)
+	if assert.Len(t, root.Children, 1) {
+		scan := root.Children[0]
+		assert.Equal(t, map[string]string{"": "awsdatacatalog:HiveTableHandle{schemaName=db, tableName=t}",
+			"grouped": "false"}, scan.Descriptor)
+		assert.Equal(t, []string{"id := id:int:0:REGULAR"}, scan.Details)
+	}
+}
+
+func TestParseJSONPlan(t *testing.T) {
+	plan, err := parseJSONPlan(testJSONPlan)
+	assert.Nil(t, err)
+	if !assert.Len(t, plan.Fragments, 2) {
+		return
+	}
+	root := plan.Fragments[0].Root
+	assert.Equal(t, "0", plan.Fragments[0].ID)
+	assert.Equal(t, "9", root.ID)
+	assert.Equal(t, []PlanSymbol{{"id", "integer"}}, root.Outputs)
+	if assert.Len(t, root.Estimates, 1) {
+		assert.True(t, math.IsNaN(root.Estimates[0].OutputRowCount))
+		assert.Equal(t, 10.5, root.Estimates[0].OutputSizeInBytes)
+	}
+	assert.Equal(t, "RemoteSource", root.Children[0].Name)
+	if scans := plan.TableScans(); assert.Len(t, scans, 1) {
+		assert.Equal(t, "awsdatacatalog:db:t", scans[0].Table())
+	}
+
+	// a logical plan is a single node
+	plan, err = parseJSONPlan(`{"id": "0", "name": "Output", "children": [{"id": "1", "name": "Values"}]}`)
+	assert.Nil(t, err)
+	if assert.Len(t, plan.Fragments, 1) {
+		assert.Equal(t, "Values", plan.Fragments[0].Root.Children[0].Name)
+	}
+
+	_, err = parseJSONPlan("Output[]")
+	assert.NotNil(t, err)
+	_, err = parseJSONPlan(`{"0": {"estimates": [{"cpuCost": "x"}]}}`)
+	assert.NotNil(t, err)
+}
+
+func TestConnection_Explain(t *testing.T) {
+	athenaClient := &explainAthenaClient{queryContextAthenaClient: queryContextAthenaClient{
+		mockAthenaClient: newMockAthenaClient()}, plan: testTextPlan}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeUnload)
+	ctx := context.Background()
+
+	plan, err := c.Explain(ctx, "SELECT dt, count(*) FROM events GROUP BY dt;", "")
+	assert.Nil(t, err)
+	assert.Equal(t, testTextPlan, plan.Text)
+	assert.Len(t, plan.TableScans(), 2)
+
+	athenaClient.plan = testJSONPlan
+	plan, err = c.ExplainLogical(ctx, "SELECT id FROM t", ExplainFormatJSON)
+	assert.Nil(t, err)
+	assert.Len(t, plan.Fragments, 2)
+	assert.Equal(t, []string{
+		"EXPLAIN (TYPE DISTRIBUTED, FORMAT TEXT) SELECT dt, count(*) FROM events GROUP BY dt",
+		"EXPLAIN (TYPE LOGICAL, FORMAT JSON) SELECT id FROM t",
+	}, queryStrings(&athenaClient.queryContextAthenaClient))
+
+	_, err = c.Explain(ctx, "SELECT 1", "GRAPHVIZ")
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	_, err = c.Explain(ctx, " ; ", ExplainFormatText)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportOptions is how Connection.ExportCSV writes the rows of a query.
+type ExportOptions struct {
+	// Delimiter is the field delimiter, ',' by default.
+	Delimiter rune
+	// Header is to write the column names in the first line.
+	Header bool
+	// Null is the encoding of NULL, like `\N`, it is an empty field by default.
+	Null string
+}
+
+// exportColumns is the column names and types of the rows of ExportCSV and ExportJSON.
+type exportColumns struct {
+	names  []string
+	types  []string
+	scales []int64
+}
+
+// ExportCSV is to run query and write its rows to w as CSV, like COPY TO, for CLI tools and reports built on the
+// driver. The rows are streamed: they are written as they are read, and w is not buffered more than csv.Writer
+// does. The results are downloaded from S3 if the result mode in Config or ctx is ResultModeAPI, as in
+// ResultModeDL, which is faster for large results. Timestamps are written like Athena does in
+// TimestampUniXFormat, dates in DateUniXFormat, binary values in hex and complex values in JSON.
+// It gets the number of rows written, and is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) ExportCSV(ctx context.Context, query string, w io.Writer, opts ExportOptions,
+	args ...driver.NamedValue) (int64, error) {
+	cw := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		cw.Comma = opts.Delimiter
+	}
+	var record []string
+	n, err := c.export(ctx, query, args, func(columns *exportColumns) error {
+		record = make([]string, len(columns.names))
+		if !opts.Header {
+			return nil
+		}
+		return cw.Write(columns.names)
+	}, func(columns *exportColumns, dest []driver.Value) error {
+		for i, v := range dest {
+			if v == nil {
+				record[i] = opts.Null
+				continue
+			}
+			s, err := columns.format(i, v)
+			if err != nil {
+				return err
+			}
+			record[i] = s
+		}
+		return cw.Write(record)
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return n, err
+}
+
+// ExportJSON is to run query and write its rows to w as JSON lines, an object of the column names and values
+// of a row in each line, like ExportCSV. NULL values are null, numbers and booleans are JSON numbers and
+// booleans, and complex values are JSON arrays and objects. The other values are strings formatted like in
+// ExportCSV, and so are NaN and infinite numbers. The options of CSV are not used.
+func (c *Connection) ExportJSON(ctx context.Context, query string, w io.Writer, opts ExportOptions,
+	args ...driver.NamedValue) (int64, error) {
+	var keys [][]byte
+	var line []byte
+	return c.export(ctx, query, args, func(columns *exportColumns) error {
+		keys = make([][]byte, len(columns.names))
+		for i, name := range columns.names {
+			key, err := jcf.Marshal(name)
+			if err != nil {
+				return err
+			}
+			keys[i] = append(key, ':')
+		}
+		return nil
+	}, func(columns *exportColumns, dest []driver.Value) error {
+		line = append(line[:0], '{')
+		for i, v := range dest {
+			if i > 0 {
+				line = append(line, ',')
+			}
+			line = append(line, keys[i]...)
+			b, err := columns.encodeJSON(i, v)
+			if err != nil {
+				return err
+			}
+			line = append(line, b...)
+		}
+		line = append(line, '}', '\n')
+		_, err := w.Write(line)
+		return err
+	})
+}
+
+// export is to run query and call write with every row, after start is called with the columns of the rows.
+func (c *Connection) export(ctx context.Context, query string, args []driver.NamedValue,
+	start func(columns *exportColumns) error,
+	write func(columns *exportColumns, dest []driver.Value) error) (int64, error) {
+	if getResultMode(ctx, c.connector.config) == ResultModeAPI {
+		ctx = WithResultMode(ctx, ResultModeDL)
+	}
+	rows, err := c.QueryContext(ctx, query, args)
+	if err != nil {
+		return 0, err
+	}
+	n, err := exportRows(rows, start, write)
+	if closeErr := rows.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// exportRows is to call write with every row of rows, after start is called with their columns.
+func exportRows(rows driver.Rows, start func(columns *exportColumns) error,
+	write func(columns *exportColumns, dest []driver.Value) error) (int64, error) {
+	columns := &exportColumns{names: rows.Columns()}
+	columns.types = make([]string, len(columns.names))
+	columns.scales = make([]int64, len(columns.names))
+	for i := range columns.names {
+		if r, ok := rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+			columns.types[i] = strings.ToLower(r.ColumnTypeDatabaseTypeName(i))
+		}
+		if r, ok := rows.(driver.RowsColumnTypePrecisionScale); ok {
+			_, columns.scales[i], _ = r.ColumnTypePrecisionScale(i)
+		}
+	}
+	if err := start(columns); err != nil {
+		return 0, err
+	}
+	var n int64
+	dest := make([]driver.Value, len(columns.names))
+	for {
+		err := rows.Next(dest)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err = write(columns, dest); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// format is to format the value v of the column index, which isn't nil, in ExportCSV.
+func (c *exportColumns) format(index int, v driver.Value) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.RawMessage:
+		return string(v), nil
+	case []byte:
+		return hex.EncodeToString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int8, int16, int32, int64:
+		return fmt.Sprint(v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case time.Time:
+		if c.types[index] == "date" {
+			return v.Format(DateUniXFormat), nil
+		}
+		return v.Format(TimestampUniXFormat), nil
+	case *big.Rat:
+		return v.FloatString(int(c.scales[index])), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	return jcf.MarshalToString(v)
+}
+
+// encodeJSON is to encode the value v of the column index in ExportJSON.
+func (c *exportColumns) encodeJSON(index int, v driver.Value) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return []byte("null"), nil
+	case json.RawMessage:
+		return x, nil
+	case float32:
+		if f := float64(x); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return jcf.Marshal(x)
+		}
+	case float64:
+		if !math.IsNaN(x) && !math.IsInf(x, 0) {
+			return jcf.Marshal(x)
+		}
+	case bool, int8, int16, int32, int64:
+		return jcf.Marshal(x)
+	case string, []byte, time.Time, *big.Rat, fmt.Stringer:
+	default:
+		return jcf.Marshal(x)
+	}
+	s, err := c.format(index, v)
+	if err != nil {
+		return nil, err
+	}
+	return jcf.Marshal(s)
+}
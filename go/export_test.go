@@ -0,0 +1,102 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestExportConnection() *Connection {
+	athenaClient := &downloadAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		statementType:            athena.StatementTypeDml,
+	}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API: &downloadS3Client{objects: map[string]string{
+			"results/athena/PING_OK_QID.csv": "\"id\",\"name\"\n\"1\",\"a,b\"\n\"2\",\n",
+		}},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetMissingAsNil(true)
+	return c
+}
+
+func TestConnection_ExportCSV(t *testing.T) {
+	c := newTestExportConnection()
+	var buf bytes.Buffer
+	// the results are downloaded in ResultModeAPI
+	n, err := c.ExportCSV(context.Background(), "SELECT 1", &buf, ExportOptions{Header: true, Null: `\N`})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, "id,name\n1,\"a,b\"\n2,\\N\n", buf.String())
+
+	buf.Reset()
+	n, err = c.ExportCSV(context.Background(), "SELECT 1", &buf, ExportOptions{Delimiter: '\t'})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, "1\ta,b\n2\t\n", buf.String())
+
+	_, err = c.ExportCSV(context.Background(), "", &buf, ExportOptions{})
+	assert.Equal(t, ErrInvalidQuery, err)
+}
+
+func TestConnection_ExportJSON(t *testing.T) {
+	c := newTestExportConnection()
+	var buf bytes.Buffer
+	n, err := c.ExportJSON(context.Background(), "SELECT 1", &buf, ExportOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, "{\"id\":1,\"name\":\"a,b\"}\n{\"id\":2,\"name\":null}\n", buf.String())
+}
+
+func TestExportRows_Values(t *testing.T) {
+	rows := newTestArrowRows([]string{"date", "timestamp", "double", "varbinary", "array", "boolean"},
+		[][]*string{{aws.String("2020-01-02"), aws.String("2020-01-02 03:04:05.678"), aws.String("NaN"),
+			aws.String("68 69"), aws.String("[1, 2]"), aws.String("true")}})
+	var formatted, encoded []string
+	n, err := exportRows(rows, func(columns *exportColumns) error {
+		assert.Equal(t, "date", columns.types[0])
+		return nil
+	}, func(columns *exportColumns, dest []driver.Value) error {
+		for i, v := range dest {
+			s, err := columns.format(i, v)
+			assert.Nil(t, err)
+			formatted = append(formatted, s)
+			b, err := columns.encodeJSON(i, v)
+			assert.Nil(t, err)
+			encoded = append(encoded, string(b))
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, []string{"2020-01-02", "2020-01-02 03:04:05.678", "NaN", "6869", "[1,2]", "true"}, formatted)
+	assert.Equal(t, []string{`"2020-01-02"`, `"2020-01-02 03:04:05.678"`, `"NaN"`, `"6869"`, "[1,2]", "true"},
+		encoded)
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Athena returns geometry values in WKT, like `POINT (1 2)`. In geometryWKB mode, they are converted to WKB,
+// which Go geometry libraries read, like github.com/paulmach/orb/encoding/wkb and
+// github.com/twpayne/go-geom/encoding/wkb.
+
+// WKB geometry types, https://www.ogc.org/standards/sfa.
+var wkbTypes = map[string]uint32{
+	"POINT":              1,
+	"LINESTRING":         2,
+	"POLYGON":            3,
+	"MULTIPOINT":         4,
+	"MULTILINESTRING":    5,
+	"MULTIPOLYGON":       6,
+	"GEOMETRYCOLLECTION": 7,
+}
+
+// Geometry is a geometry value in WKB. It can be scanned from geometry columns whether they are returned
+// in WKT or WKB.
+type Geometry []byte
+
+// Scan is to implement sql.Scanner.
+func (g *Geometry) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*g = nil
+	case []byte:
+		*g = append(Geometry(nil), v...)
+	case string:
+		b, err := WKTToWKB(v)
+		if err != nil {
+			return err
+		}
+		*g = b
+	default:
+		return fmt.Errorf("cannot scan %T into Geometry", src)
+	}
+	return nil
+}
+
+// Value is to implement driver.Valuer.
+func (g Geometry) Value() (driver.Value, error) {
+	if g == nil {
+		return nil, nil
+	}
+	return []byte(g), nil
+}
+
+// WKTToWKB is to convert a 2D geometry in WKT into little-endian WKB.
+func WKTToWKB(wkt string) ([]byte, error) {
+	p := &wktParser{s: wkt}
+	b, err := p.geometry()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos != len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return b, nil
+}
+
+// wktParser is to parse WKT into WKB.
+type wktParser struct {
+	s   string
+	pos int
+}
+
+func (p *wktParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid WKT at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *wktParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *wktParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && (p.s[p.pos] >= 'A' && p.s[p.pos] <= 'Z' || p.s[p.pos] >= 'a' && p.s[p.pos] <= 'z') {
+		p.pos++
+	}
+	return strings.ToUpper(p.s[start:p.pos])
+}
+
+func (p *wktParser) peek(c byte) bool {
+	p.skipSpace()
+	return p.pos < len(p.s) && p.s[p.pos] == c
+}
+
+func (p *wktParser) expect(c byte) error {
+	if !p.peek(c) {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// empty is to check if the geometry is `EMPTY`.
+func (p *wktParser) empty() bool {
+	pos := p.pos
+	if p.word() == "EMPTY" {
+		return true
+	}
+	p.pos = pos
+	return false
+}
+
+func (p *wktParser) number() (float64, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte("+-.eE0123456789", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	f, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+	if err != nil {
+		return 0, p.errorf("invalid number %q", p.s[start:p.pos])
+	}
+	return f, nil
+}
+
+// list is to parse `(item, item, ...)`, and return the number of items.
+func (p *wktParser) list(item func() error) (uint32, error) {
+	if err := p.expect('('); err != nil {
+		return 0, err
+	}
+	var n uint32
+	for {
+		if err := item(); err != nil {
+			return 0, err
+		}
+		n++
+		if !p.peek(',') {
+			break
+		}
+		p.pos++
+	}
+	return n, p.expect(')')
+}
+
+func (p *wktParser) geometry() ([]byte, error) {
+	name := p.word()
+	wkbType, ok := wkbTypes[name]
+	if !ok {
+		return nil, p.errorf("unsupported geometry %q", name)
+	}
+	b := appendUint32([]byte{1}, wkbType)
+	if p.empty() {
+		if wkbType == 1 {
+			// an empty point has NaN coordinates in WKB
+			return appendFloat64(appendFloat64(b, math.NaN()), math.NaN()), nil
+		}
+		return appendUint32(b, 0), nil
+	}
+	body, err := p.body(wkbType)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, body...), nil
+}
+
+// body is to parse the coordinates of a geometry type, like `(1 2, 3 4)` of a LINESTRING.
+func (p *wktParser) body(wkbType uint32) ([]byte, error) {
+	var items []byte
+	var n uint32
+	var err error
+	switch wkbType {
+	case 1:
+		if err = p.expect('('); err != nil {
+			return nil, err
+		}
+		if items, err = p.coord(nil); err != nil {
+			return nil, err
+		}
+		return items, p.expect(')')
+	case 2:
+		n, err = p.list(func() (err error) {
+			items, err = p.coord(items)
+			return err
+		})
+	case 3:
+		n, err = p.list(func() error {
+			return p.child(&items, 2, false)
+		})
+	case 4:
+		n, err = p.list(func() error {
+			items = appendUint32(append(items, 1), 1)
+			// MULTIPOINT (1 2, 3 4) and MULTIPOINT ((1 2), (3 4)) are both valid
+			if p.peek('(') {
+				p.pos++
+				if items, err = p.coord(items); err != nil {
+					return err
+				}
+				return p.expect(')')
+			}
+			items, err = p.coord(items)
+			return err
+		})
+	case 5:
+		n, err = p.list(func() error {
+			return p.child(&items, 2, true)
+		})
+	case 6:
+		n, err = p.list(func() error {
+			return p.child(&items, 3, true)
+		})
+	case 7:
+		n, err = p.list(func() error {
+			g, err := p.geometry()
+			items = append(items, g...)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(appendUint32(nil, n), items...), nil
+}
+
+// child is to parse the body of a geometry of wkbType inside another one, with its WKB header if header is set.
+func (p *wktParser) child(items *[]byte, wkbType uint32, header bool) error {
+	body, err := p.body(wkbType)
+	if err != nil {
+		return err
+	}
+	if header {
+		*items = appendUint32(append(*items, 1), wkbType)
+	}
+	*items = append(*items, body...)
+	return nil
+}
+
+func (p *wktParser) coord(b []byte) ([]byte, error) {
+	x, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	y, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	return appendFloat64(appendFloat64(b, x), y), nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendFloat64(b []byte, v float64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWKTToWKB(t *testing.T) {
+	tests := []struct {
+		wkt string
+		wkb string
+	}{
+		{"POINT (1 2)", "0101000000000000000000f03f0000000000000040"},
+		{"point(1 2)", "0101000000000000000000f03f0000000000000040"},
+		{"LINESTRING (0 0, 1 -1)", "010200000002000000" +
+			"00000000000000000000000000000000" + "000000000000f03f000000000000f0bf"},
+		{"POLYGON ((0 0, 1 0, 0 0))", "01030000000100000003000000" +
+			"00000000000000000000000000000000" + "000000000000f03f0000000000000000" +
+			"00000000000000000000000000000000"},
+		{"MULTIPOINT ((1 2), (1 2))", "010400000002000000" +
+			"0101000000000000000000f03f0000000000000040" + "0101000000000000000000f03f0000000000000040"},
+		{"MULTIPOINT (1 2, 1 2)", "010400000002000000" +
+			"0101000000000000000000f03f0000000000000040" + "0101000000000000000000f03f0000000000000040"},
+		{"MULTILINESTRING ((0 0, 1 -1))", "010500000001000000" + "010200000002000000" +
+			"00000000000000000000000000000000" + "000000000000f03f000000000000f0bf"},
+		{"MULTIPOLYGON (((0 0, 1 0, 0 0)))", "010600000001000000" + "01030000000100000003000000" +
+			"00000000000000000000000000000000" + "000000000000f03f0000000000000000" +
+			"00000000000000000000000000000000"},
+		{"GEOMETRYCOLLECTION (POINT (1 2), LINESTRING EMPTY)", "010700000002000000" +
+			"0101000000000000000000f03f0000000000000040" + "010200000000000000"},
+	}
+	for _, test := range tests {
+		b, err := WKTToWKB(test.wkt)
+		assert.Nil(t, err, test.wkt)
+		assert.Equal(t, test.wkb, hex.EncodeToString(b), test.wkt)
+	}
+
+	b, err := WKTToWKB("POINT EMPTY")
+	assert.Nil(t, err)
+	assert.Len(t, b, 21)
+	assert.True(t, math.IsNaN(math.Float64frombits(binary.LittleEndian.Uint64(b[5:13]))))
+
+	for _, wkt := range []string{"", "CIRCLE (1 2)", "POINT (1)", "POINT (1 2", "POINT (1 2) x", "LINESTRING (a b)"} {
+		_, err = WKTToWKB(wkt)
+		assert.NotNil(t, err, wkt)
+	}
+}
+
+func TestGeometry_Scan(t *testing.T) {
+	var g Geometry
+	assert.Nil(t, g.Scan("POINT (1 2)"))
+	assert.Equal(t, "0101000000000000000000f03f0000000000000040", hex.EncodeToString(g))
+	wkb := []byte(g)
+	assert.Nil(t, g.Scan(wkb))
+	assert.Equal(t, Geometry(wkb), g)
+	v, err := g.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, wkb, v)
+
+	assert.Nil(t, g.Scan(nil))
+	assert.Nil(t, g)
+	assert.NotNil(t, g.Scan(1))
+	assert.NotNil(t, g.Scan("POINT"))
+}
+
+func TestRows_AthenaTypeToGoType_Geometry(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	r := &Rows{config: testConf, tracer: NewDefaultObservability(testConf)}
+	c := newColumnInfo("g", "geometry")
+	val := "POINT (1 2)"
+	g, err := r.athenaTypeToGoType(c, &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, val, g)
+
+	testConf.SetGeometryWKB(true)
+	g, err = r.athenaTypeToGoType(c, &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, "0101000000000000000000f03f0000000000000040", hex.EncodeToString(g.([]byte)))
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority is the class of a query in the queue of the concurrent queries, set in context with WithPriority.
+type Priority int
+
+const (
+	// PriorityLow is for batch queries, like backfills, which can wait for the others.
+	PriorityLow Priority = -1
+	// PriorityNormal is the default priority.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for interactive queries, like dashboards, which run before the others.
+	PriorityHigh Priority = 1
+)
+
+// String is the name of the priority in metrics.
+func (p Priority) String() string {
+	switch {
+	case p < PriorityNormal:
+		return "low"
+	case p > PriorityNormal:
+		return "high"
+	}
+	return "normal"
+}
+
+// queryWaiter is a query waiting in the queue of a governor.
+type queryWaiter struct {
+	ready    chan struct{} // closed when the query may run
+	priority Priority
+	queued   time.Time
+}
+
+// queryGovernor limits how many queries run at the same time. Queries over the limit wait for their turn by
+// priority, then in FIFO order. A queued query goes up one priority for each aging interval it waits, so low
+// priority queries are not starved by a steady flow of high priority ones.
+type queryGovernor struct {
+	mu      sync.Mutex
+	limit   int
+	aging   time.Duration
+	running int
+	waiters list.List // of *queryWaiter
+}
+
+// queryGovernors are the governors of the process, by workgroup if the limit is per workgroup.
+// They are shared by all connectors, as the Athena limits are for all the queries of an account.
+var queryGovernors = struct {
+	sync.Mutex
+	m map[string]*queryGovernor
+}{m: make(map[string]*queryGovernor)}
+
+// getQueryGovernor is to get the governor of key, creating it at first use.
+func getQueryGovernor(key string) *queryGovernor {
+	queryGovernors.Lock()
+	defer queryGovernors.Unlock()
+	g, ok := queryGovernors.m[key]
+	if !ok {
+		g = &queryGovernor{}
+		queryGovernors.m[key] = g
+	}
+	return g
+}
+
+// acquire is to wait until less than limit queries are running and no query of the same or a higher priority
+// is queued before, or until ctx is done.
+func (g *queryGovernor) acquire(ctx context.Context, limit int, priority Priority, aging time.Duration) error {
+	g.mu.Lock()
+	g.limit, g.aging = limit, aging
+	// a raised limit lets the queued queries run first
+	g.grant()
+	if g.running < g.limit && g.waiters.Len() == 0 {
+		g.running++
+		g.mu.Unlock()
+		return nil
+	}
+	w := &queryWaiter{ready: make(chan struct{}), priority: priority, queued: time.Now()}
+	e := g.waiters.PushBack(w)
+	g.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		select {
+		case <-w.ready:
+			// the query got to run while ctx was done, its turn goes to the next one
+			g.running--
+			g.grant()
+		default:
+			g.waiters.Remove(e)
+		}
+		return ctx.Err()
+	}
+}
+
+// release is to end a query got by acquire, letting queued queries run.
+func (g *queryGovernor) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running--
+	g.grant()
+}
+
+// grant is to let the queued queries of the highest priority run, as long as they are under the limit.
+func (g *queryGovernor) grant() {
+	now := time.Now()
+	for g.running < g.limit && g.waiters.Len() > 0 {
+		next := g.waiters.Front()
+		for e := next.Next(); e != nil; e = e.Next() {
+			if g.effectivePriority(e.Value.(*queryWaiter), now) > g.effectivePriority(next.Value.(*queryWaiter), now) {
+				next = e
+			}
+		}
+		g.waiters.Remove(next)
+		g.running++
+		close(next.Value.(*queryWaiter).ready)
+	}
+}
+
+// effectivePriority is the priority of w aged by its wait.
+func (g *queryGovernor) effectivePriority(w *queryWaiter, now time.Time) Priority {
+	if g.aging <= 0 {
+		return w.priority
+	}
+	return w.priority + Priority(now.Sub(w.queued)/g.aging)
+}
+
+// queued is the number of queries waiting to run.
+func (g *queryGovernor) queued() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.waiters.Len()
+}
+
+// acquireQuerySlot is to wait until a query in workgroup wgName may run, if the number of concurrent
+// queries is limited in Config. The returned func must be called when the query execution is complete.
+func (c *Connection) acquireQuerySlot(ctx context.Context, wgName string) (func(), error) {
+	limit := c.connector.config.GetMaxConcurrentQueries()
+	if limit <= 0 {
+		return func() {}, nil
+	}
+	key := ""
+	if c.connector.config.IsMaxConcurrentQueriesPerWorkgroup() {
+		key = wgName
+	}
+	priority := getPriority(ctx)
+	scope := c.connector.tracer.Scope()
+	g := getQueryGovernor(key)
+	start := time.Now()
+	err := g.acquire(ctx, limit, priority, c.connector.config.GetPriorityAging())
+	scope.Gauge(DriverName + ".query.governor.queued").Update(float64(g.queued()))
+	if err != nil {
+		scope.Counter(DriverName + ".failure.query.governor.canceled").Inc(1)
+		return nil, err
+	}
+	scope.Tagged(map[string]string{"priority": priority.String()}).
+		Timer(DriverName + ".query.governor.wait").Record(time.Since(start))
+	var once sync.Once
+	return func() { once.Do(g.release) }, nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryGovernor_FIFO(t *testing.T) {
+	g := &queryGovernor{}
+	assert.Nil(t, g.acquire(context.Background(), 1, PriorityNormal, 0))
+
+	order := make(chan int, 3)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, g.acquire(context.Background(), 1, PriorityNormal, 0))
+			order <- i
+			g.release()
+		}(i)
+		// queue the goroutines in order
+		for g.queued() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	g.release()
+	assert.Equal(t, 0, <-order)
+	assert.Equal(t, 1, <-order)
+	assert.Equal(t, 2, <-order)
+	wg.Wait()
+	g.mu.Lock()
+	assert.Equal(t, 0, g.running)
+	g.mu.Unlock()
+}
+
+// queueQueries is to queue a query of each priority on g in order, which reports its priority once it runs.
+func queueQueries(t *testing.T, g *queryGovernor, aging time.Duration, priorities ...Priority) (chan Priority,
+	*sync.WaitGroup) {
+	order := make(chan Priority, len(priorities))
+	var wg sync.WaitGroup
+	queued := g.queued()
+	for i, p := range priorities {
+		wg.Add(1)
+		go func(p Priority) {
+			defer wg.Done()
+			assert.Nil(t, g.acquire(context.Background(), 1, p, aging))
+			order <- p
+			g.release()
+		}(p)
+		for g.queued() != queued+i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return order, &wg
+}
+
+func TestQueryGovernor_Priority(t *testing.T) {
+	g := &queryGovernor{}
+	assert.Nil(t, g.acquire(context.Background(), 1, PriorityNormal, 0))
+	order, wg := queueQueries(t, g, time.Hour, PriorityLow, PriorityNormal, PriorityHigh, PriorityNormal)
+	g.release()
+	wg.Wait()
+	assert.Equal(t, PriorityHigh, <-order)
+	assert.Equal(t, PriorityNormal, <-order)
+	assert.Equal(t, PriorityNormal, <-order)
+	assert.Equal(t, PriorityLow, <-order)
+}
+
+func TestQueryGovernor_PriorityAging(t *testing.T) {
+	g := &queryGovernor{}
+	assert.Nil(t, g.acquire(context.Background(), 1, PriorityNormal, 0))
+	order, wg := queueQueries(t, g, 5*time.Millisecond, PriorityLow)
+	time.Sleep(20 * time.Millisecond)
+	// the low priority query waited long enough to go before a high priority one queued now
+	order2, wg2 := queueQueries(t, g, time.Hour, PriorityHigh)
+	g.release()
+	wg.Wait()
+	wg2.Wait()
+	assert.Equal(t, PriorityLow, <-order)
+	assert.Equal(t, PriorityHigh, <-order2)
+}
+
+func TestQueryGovernor_RaisedLimit(t *testing.T) {
+	g := &queryGovernor{}
+	assert.Nil(t, g.acquire(context.Background(), 1, PriorityNormal, 0))
+	order, _ := queueQueries(t, g, 0, PriorityLow)
+	// the queued query runs with the limit raised, and there is a slot left
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !assert.Nil(t, g.acquire(ctx, 3, PriorityNormal, 0)) {
+		return
+	}
+	assert.Equal(t, PriorityLow, <-order)
+	assert.Equal(t, 0, g.queued())
+}
+
+func TestWithPriority(t *testing.T) {
+	assert.Equal(t, PriorityNormal, getPriority(context.Background()))
+	assert.Equal(t, PriorityHigh, getPriority(WithPriority(context.Background(), PriorityHigh)))
+	assert.Equal(t, "low", PriorityLow.String())
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, DefaultPriorityAging*time.Second, testConf.GetPriorityAging())
+	testConf.SetPriorityAging(time.Minute)
+	assert.Equal(t, time.Minute, testConf.GetPriorityAging())
+}
+
+func TestQueryGovernor_ContextDone(t *testing.T) {
+	g := &queryGovernor{}
+	assert.Nil(t, g.acquire(context.Background(), 1, PriorityNormal, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, g.acquire(ctx, 1, PriorityNormal, 0))
+	assert.Equal(t, 0, g.queued())
+
+	g.release()
+	assert.Nil(t, g.acquire(context.Background(), 1, PriorityNormal, 0))
+	assert.Equal(t, 1, g.running)
+}
+
+func TestConnection_QueryContext_MaxConcurrentQueries(t *testing.T) {
+	athenaClient := &runningAthenaClient{queryContextAthenaClient: queryContextAthenaClient{
+		mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetMaxConcurrentQueries(1)
+	c.connector.config.SetMaxConcurrentQueriesPerWorkgroup(true)
+	c.connector.config.SetPollInterval(time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := c.QueryContext(ctx, "SELECT 1", nil)
+		done <- err
+	}()
+	// wait for the first query to run
+	g := getQueryGovernor(DefaultWGName)
+	for {
+		g.mu.Lock()
+		running := g.running
+		g.mu.Unlock()
+		if running == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer timeoutCancel()
+	_, err := c.QueryContext(timeoutCtx, "SELECT 2", nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Len(t, athenaClient.inputs, 1)
+	assert.Nil(t, g.acquire(context.Background(), 1, PriorityNormal, 0))
+	g.release()
+}
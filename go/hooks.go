@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"time"
+)
+
+// QueryEvent describes a query execution to the Hooks.
+type QueryEvent struct {
+	// Query is the query text, with the arguments interpolated, redacted with the QueryRedactor of Config
+	// if there is one.
+	Query     string
+	Workgroup string
+	// QueryExecutionID is empty if the query didn't start.
+	QueryExecutionID string
+	// Attempt is the attempt of the query, from 1, which is more than 1 if the query is retried.
+	Attempt int
+	// Duration is the time since the attempt started, which is the time to start the query in OnQueryStart.
+	Duration time.Duration
+	// Stats are the statistics of the query execution, nil if the query isn't complete or didn't start.
+	Stats *QueryStats
+	// Err is the error of the query, nil in OnQueryStart and OnQueryEnd.
+	Err error
+}
+
+// Hooks are called by the driver around the queries of QueryContext and ExecContext, like to send them to an
+// audit pipeline. They are called synchronously in the goroutine of the query, so they should be fast.
+// BaseHooks can be embedded to implement only some of them.
+type Hooks interface {
+	// OnQueryStart is called once Athena started the query execution of an attempt.
+	OnQueryStart(ctx context.Context, event QueryEvent)
+	// OnQueryEnd is called once the query execution succeeded.
+	OnQueryEnd(ctx context.Context, event QueryEvent)
+	// OnError is called when the query failed, and won't be retried.
+	OnError(ctx context.Context, event QueryEvent)
+	// OnRetry is called when an attempt of the query failed transiently, before the query is retried.
+	OnRetry(ctx context.Context, event QueryEvent)
+}
+
+// BaseHooks is a Hooks which does nothing.
+type BaseHooks struct{}
+
+// OnQueryStart is to implement Hooks.
+func (BaseHooks) OnQueryStart(ctx context.Context, event QueryEvent) {}
+
+// OnQueryEnd is to implement Hooks.
+func (BaseHooks) OnQueryEnd(ctx context.Context, event QueryEvent) {}
+
+// OnError is to implement Hooks.
+func (BaseHooks) OnError(ctx context.Context, event QueryEvent) {}
+
+// OnRetry is to implement Hooks.
+func (BaseHooks) OnRetry(ctx context.Context, event QueryEvent) {}
+
+// queryEvent is to get the event of the current attempt of query, with the stats of the query execution
+// if it is complete.
+func (c *Connection) queryEvent(query string, wgName string, queryID string, attempt int, start time.Time,
+	err error) QueryEvent {
+	return QueryEvent{
+		Query:            c.connector.config.redactQuery(query),
+		Workgroup:        wgName,
+		QueryExecutionID: queryID,
+		Attempt:          attempt,
+		Duration:         time.Since(start),
+		Stats:            c.lastStats,
+		Err:              err,
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingHooks records the events of the hooks, by the name of the hook.
+type recordingHooks struct {
+	BaseHooks
+	events []string
+	last   map[string]QueryEvent
+}
+
+func (h *recordingHooks) record(name string, event QueryEvent) {
+	if h.last == nil {
+		h.last = map[string]QueryEvent{}
+	}
+	h.events = append(h.events, name)
+	h.last[name] = event
+}
+
+func (h *recordingHooks) OnQueryStart(ctx context.Context, event QueryEvent) {
+	h.record("start", event)
+}
+
+func (h *recordingHooks) OnQueryEnd(ctx context.Context, event QueryEvent) {
+	h.record("end", event)
+}
+
+func (h *recordingHooks) OnError(ctx context.Context, event QueryEvent) {
+	h.record("error", event)
+}
+
+func (h *recordingHooks) OnRetry(ctx context.Context, event QueryEvent) {
+	h.record("retry", event)
+}
+
+func TestConnection_QueryContext_Hooks(t *testing.T) {
+	athenaClient := &flakyAthenaClient{queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	hooks := &recordingHooks{}
+	c.connector.config.SetHooks(hooks)
+	c.connector.config.SetQueryRedactor(strings.ToUpper)
+	c.connector.config.SetQueryRetryAttempts(2)
+	c.connector.config.SetQueryRetryBackoff(time.Millisecond)
+
+	_, err := c.QueryContext(context.Background(), "select 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"start", "retry", "start", "end"}, hooks.events)
+	retry := hooks.last["retry"]
+	assert.Equal(t, "SELECT 1", retry.Query)
+	assert.Equal(t, DefaultWGName, retry.Workgroup)
+	assert.Equal(t, "FLAKY_QID", retry.QueryExecutionID)
+	assert.Equal(t, 1, retry.Attempt)
+	assert.NotNil(t, retry.Err)
+	if assert.NotNil(t, retry.Stats) {
+		assert.Equal(t, "FAILED", retry.Stats.State)
+	}
+	end := hooks.last["end"]
+	assert.Equal(t, "PING_OK_QID", end.QueryExecutionID)
+	assert.Equal(t, 2, end.Attempt)
+	assert.Nil(t, end.Err)
+	if assert.NotNil(t, end.Stats) {
+		assert.Equal(t, "SUCCEEDED", end.Stats.State)
+	}
+	assert.Nil(t, hooks.last["start"].Stats)
+
+	// statements writing data are not retried
+	athenaClient.inputs, hooks.events = nil, nil
+	_, err = c.QueryContext(context.Background(), "INSERT INTO t VALUES (1)", nil)
+	var queryErr *QueryError
+	assert.True(t, errors.As(err, &queryErr))
+	assert.Equal(t, []string{"start", "error"}, hooks.events)
+	assert.Equal(t, err, hooks.last["error"].Err)
+	assert.Equal(t, "INSERT INTO T VALUES (1)", hooks.last["error"].Query)
+}
+
+func TestConfig_SetHooks(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Nil(t, testConf.GetHooks())
+	assert.Nil(t, testConf.GetQueryRedactor())
+	testConf.SetHooks(BaseHooks{})
+	assert.Equal(t, BaseHooks{}, testConf.GetHooks())
+}
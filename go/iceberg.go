@@ -0,0 +1,124 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// IcebergMaintenanceResult is the outcome of the maintenance of an Iceberg table by
+// Connection.MaintainIcebergTables, with the stats of its OPTIMIZE and VACUUM statements.
+type IcebergMaintenanceResult struct {
+	Table    string
+	Optimize QueryStats
+	Vacuum   QueryStats
+	// Err is the failure of the first statement which failed, nil if both succeeded.
+	Err error
+}
+
+// execMaintenance is to run the maintenance statement of an Iceberg table, and get its stats.
+func (c *Connection) execMaintenance(ctx context.Context, operation string, table string, query string) (
+	QueryStats, error) {
+	var obs = c.connector.tracer
+	if _, err := c.ExecContext(ctx, query, nil); err != nil {
+		obs.Scope().Counter(DriverName + ".failure.iceberg." + operation).Inc(1)
+		obs.Log(WarnLevel, "Iceberg table maintenance failed",
+			zap.String("operation", operation),
+			zap.String("table", table),
+			zap.String("error", err.Error()))
+		return QueryStats{}, err
+	}
+	obs.Scope().Counter(DriverName + ".iceberg." + operation).Inc(1)
+	if c.lastStats == nil {
+		return QueryStats{}, nil
+	}
+	return *c.lastStats, nil
+}
+
+// OptimizeTable is to compact the small data files of the Iceberg table, and remove its deleted rows, with
+// OPTIMIZE REWRITE DATA USING BIN_PACK. It waits for the statement to complete, which can take long for large
+// tables, and gets its stats. The optional where predicate, like dt >= '2022-05-01', limits the rewritten data.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) OptimizeTable(ctx context.Context, table string, where string) (QueryStats, error) {
+	if !identifierPattern.MatchString(table) {
+		return QueryStats{}, fmt.Errorf("%w: invalid table name %q", ErrInvalidQuery, table)
+	}
+	query := "OPTIMIZE " + table + " REWRITE DATA USING BIN_PACK"
+	if where != "" {
+		query += " WHERE " + where
+	}
+	return c.execMaintenance(ctx, "optimize", table, query)
+}
+
+// VacuumTable is to expire the snapshots of the Iceberg table older than its vacuum_max_snapshot_age_seconds
+// property, 5 days by default, and remove the files no snapshot refers to, with VACUUM. It waits for the
+// statement to complete, and gets its stats.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) VacuumTable(ctx context.Context, table string) (QueryStats, error) {
+	if !identifierPattern.MatchString(table) {
+		return QueryStats{}, fmt.Errorf("%w: invalid table name %q", ErrInvalidQuery, table)
+	}
+	return c.execMaintenance(ctx, "vacuum", table, "VACUUM "+table)
+}
+
+// ExpireSnapshots is to expire the snapshots of the Iceberg table older than maxAge, of at least a second.
+// It sets the vacuum_max_snapshot_age_seconds property of the table to maxAge, which later VACUUM statements
+// use as well, and runs VacuumTable.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) ExpireSnapshots(ctx context.Context, table string, maxAge time.Duration) (QueryStats, error) {
+	if !identifierPattern.MatchString(table) {
+		return QueryStats{}, fmt.Errorf("%w: invalid table name %q", ErrInvalidQuery, table)
+	}
+	if maxAge < time.Second {
+		return QueryStats{}, fmt.Errorf("%w: snapshot max age %s is less than a second", ErrInvalidQuery, maxAge)
+	}
+	query := fmt.Sprintf("ALTER TABLE %s SET TBLPROPERTIES ('vacuum_max_snapshot_age_seconds' = '%d')",
+		table, int64(maxAge/time.Second))
+	if _, err := c.execMaintenance(ctx, "expiresnapshots", table, query); err != nil {
+		return QueryStats{}, err
+	}
+	return c.VacuumTable(ctx, table)
+}
+
+// MaintainIcebergTables is to run OptimizeTable on the whole table and then VacuumTable on each of the Iceberg
+// tables, one after the other, like in a scheduled job. A table which fails doesn't stop the others, and its
+// result has the failure. Once ctx is done, the tables left are not maintained, with the error of ctx.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) MaintainIcebergTables(ctx context.Context, tables []string) []IcebergMaintenanceResult {
+	results := make([]IcebergMaintenanceResult, len(tables))
+	for i, table := range tables {
+		results[i].Table = table
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Optimize, results[i].Err = c.OptimizeTable(ctx, table, "")
+		if results[i].Err != nil {
+			continue
+		}
+		results[i].Vacuum, results[i].Err = c.VacuumTable(ctx, table)
+	}
+	return results
+}
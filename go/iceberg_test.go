@@ -0,0 +1,151 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// icebergAthenaClient fails the statements on the failing tables, and returns the stats of the others.
+type icebergAthenaClient struct {
+	ctasAthenaClient
+	failing map[string]bool
+}
+
+func (m *icebergAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	out, err := m.queryContextAthenaClient.StartQueryExecutionWithContext(ctx, s, opts...)
+	for table := range m.failing {
+		if strings.Contains(*s.QueryString, " "+table) {
+			out.QueryExecutionId = aws.String("QueryExecutionStateFailed_QID")
+		}
+	}
+	return out, err
+}
+
+func (m *icebergAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	if *input.QueryExecutionId == "QueryExecutionStateFailed_QID" {
+		return m.queryContextAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+	}
+	return &athena.GetQueryExecutionOutput{QueryExecution: &athena.QueryExecution{
+		QueryExecutionId: input.QueryExecutionId,
+		StatementType:    aws.String(athena.StatementTypeUtility),
+		Status:           &athena.QueryExecutionStatus{State: aws.String(athena.QueryExecutionStateSucceeded)},
+		Statistics: &athena.QueryExecutionStatistics{
+			DataScannedInBytes:          aws.Int64(int64(len(m.inputs)) * 1024),
+			EngineExecutionTimeInMillis: aws.Int64(2000),
+		},
+	}}, nil
+}
+
+func newIcebergConnection(failing ...string) (*Connection, *icebergAthenaClient) {
+	athenaClient := &icebergAthenaClient{
+		ctasAthenaClient: ctasAthenaClient{queryContextAthenaClient: newQueryContextAthenaClient()},
+		failing:          map[string]bool{},
+	}
+	for _, table := range failing {
+		athenaClient.failing[table] = true
+	}
+	return newMockConnection(athenaClient), athenaClient
+}
+
+func TestConnection_OptimizeTable(t *testing.T) {
+	c, athenaClient := newIcebergConnection()
+	stats, err := c.OptimizeTable(context.Background(), "db.events", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "OPTIMIZE db.events REWRITE DATA USING BIN_PACK", *athenaClient.inputs[0].QueryString)
+	assert.Equal(t, int64(1024), stats.DataScannedInBytes)
+	assert.Equal(t, int64(2000), stats.EngineExecutionTimeMillis)
+
+	_, err = c.OptimizeTable(context.Background(), "db.events", "dt >= '2022-05-01'")
+	assert.Nil(t, err)
+	assert.Equal(t, "OPTIMIZE db.events REWRITE DATA USING BIN_PACK WHERE dt >= '2022-05-01'",
+		*athenaClient.inputs[1].QueryString)
+
+	_, err = c.OptimizeTable(context.Background(), "db.events; DROP TABLE x", "")
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	assert.Len(t, athenaClient.inputs, 2)
+}
+
+func TestConnection_VacuumTable(t *testing.T) {
+	c, athenaClient := newIcebergConnection("events")
+	_, err := c.VacuumTable(context.Background(), "events")
+	assert.NotNil(t, err)
+	assert.Equal(t, "VACUUM events", *athenaClient.inputs[0].QueryString)
+
+	_, err = c.VacuumTable(context.Background(), "db-events")
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
+
+func TestConnection_ExpireSnapshots(t *testing.T) {
+	c, athenaClient := newIcebergConnection()
+	stats, err := c.ExpireSnapshots(context.Background(), "db.events", 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 2)
+	assert.Equal(t, "ALTER TABLE db.events SET TBLPROPERTIES ('vacuum_max_snapshot_age_seconds' = '86400')",
+		*athenaClient.inputs[0].QueryString)
+	assert.Equal(t, "VACUUM db.events", *athenaClient.inputs[1].QueryString)
+	assert.Equal(t, int64(2048), stats.DataScannedInBytes)
+
+	_, err = c.ExpireSnapshots(context.Background(), "db.events", time.Millisecond)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	assert.Len(t, athenaClient.inputs, 2)
+}
+
+func TestConnection_MaintainIcebergTables(t *testing.T) {
+	c, athenaClient := newIcebergConnection("db.broken")
+	results := c.MaintainIcebergTables(context.Background(), []string{"db.events", "db.broken", "db.users"})
+	assert.Len(t, results, 3)
+	assert.Equal(t, "db.events", results[0].Table)
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, int64(1024), results[0].Optimize.DataScannedInBytes)
+	assert.Equal(t, int64(2048), results[0].Vacuum.DataScannedInBytes)
+	assert.NotNil(t, results[1].Err)
+	assert.Equal(t, QueryStats{}, results[1].Vacuum)
+	assert.Nil(t, results[2].Err)
+	var queries []string
+	for _, input := range athenaClient.inputs {
+		queries = append(queries, *input.QueryString)
+	}
+	assert.Equal(t, []string{
+		"OPTIMIZE db.events REWRITE DATA USING BIN_PACK",
+		"VACUUM db.events",
+		"OPTIMIZE db.broken REWRITE DATA USING BIN_PACK",
+		"OPTIMIZE db.users REWRITE DATA USING BIN_PACK",
+		"VACUUM db.users",
+	}, queries)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = c.MaintainIcebergTables(ctx, []string{"db.events"})
+	assert.Equal(t, context.Canceled, results[0].Err)
+	assert.Len(t, athenaClient.inputs, 5)
+}
@@ -0,0 +1,332 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SQLLiteral is a value written as it is in the statements of Connection.InsertRows, like DATE '2022-05-01',
+// for the types which have no Go value.
+type SQLLiteral string
+
+// insertQuery is an INSERT INTO statement, and the number of rows it inserts.
+type insertQuery struct {
+	query string
+	rows  int
+}
+
+// insertQueries is to build the INSERT INTO ... VALUES statements of rows in table, each within
+// MAXQueryStringLength with reserved bytes left for the comments prepended to it. columns are the columns of the
+// values of the rows, or all of them in their order if it's empty.
+func insertQueries(table string, columns []string, rows [][]interface{}, reserved int) ([]insertQuery, error) {
+	if !identifierPattern.MatchString(table) {
+		return nil, fmt.Errorf("%w: invalid table name %q", ErrInvalidQuery, table)
+	}
+	prefix := "INSERT INTO " + table
+	if len(columns) > 0 {
+		for _, column := range columns {
+			if !identifierPattern.MatchString(column) || strings.Contains(column, ".") {
+				return nil, fmt.Errorf("%w: invalid column name %q", ErrInvalidQuery, column)
+			}
+		}
+		prefix += " (" + strings.Join(columns, ", ") + ")"
+	}
+	prefix += " VALUES "
+	maxLength := MAXQueryStringLength - reserved
+	var queries []insertQuery
+	var b strings.Builder
+	count := 0
+	for i, row := range rows {
+		if len(row) == 0 || (len(columns) > 0 && len(row) != len(columns)) || len(row) != len(rows[0]) {
+			return nil, fmt.Errorf("%w: row %d has %d values", ErrInvalidQuery, i, len(row))
+		}
+		tuple, err := insertTuple(row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		if len(prefix)+len(tuple) >= maxLength {
+			return nil, fmt.Errorf("%w: row %d is too long for a query", ErrInvalidQuery, i)
+		}
+		if count > 0 && b.Len()+len(", ")+len(tuple) >= maxLength {
+			queries = append(queries, insertQuery{b.String(), count})
+			b.Reset()
+			count = 0
+		}
+		if count == 0 {
+			b.WriteString(prefix)
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(tuple)
+		count++
+	}
+	if count > 0 {
+		queries = append(queries, insertQuery{b.String(), count})
+	}
+	return queries, nil
+}
+
+// insertTuple is to get the VALUES tuple of row, like (1, 'a').
+func insertTuple(row []interface{}) (string, error) {
+	values := make([]string, len(row))
+	for i, v := range row {
+		literal, err := sqlLiteral(v)
+		if err != nil {
+			return "", err
+		}
+		values[i] = literal
+	}
+	return "(" + strings.Join(values, ", ") + ")", nil
+}
+
+// sqlLiteral is to get the SQL literal of v, typed like the column it's inserted in: TIMESTAMP for time.Time,
+// in UTC, DECIMAL for *big.Rat, *big.Int and *big.Float, DOUBLE and REAL for floats, X” for []byte, JSON for
+// json.RawMessage, ARRAY for []interface{} and MAP for map[string]interface{}. The values of driver.Valuer
+// are the literals of their Value.
+func sqlLiteral(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case SQLLiteral:
+		return string(v), nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	case float32:
+		return "REAL '" + floatLiteral(float64(v), 32) + "'", nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "DOUBLE '" + floatLiteral(v, 64) + "'", nil
+		}
+		// the exponent makes it a DOUBLE, not a DECIMAL
+		return strconv.FormatFloat(v, 'E', -1, 64), nil
+	case time.Time:
+		return "TIMESTAMP '" + v.In(time.UTC).Format(TimestampUniXFormat) + "'", nil
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case json.RawMessage:
+		return "JSON '" + strings.ReplaceAll(string(v), "'", "''") + "'", nil
+	case *big.Int:
+		return "DECIMAL '" + v.String() + "'", nil
+	case *big.Float:
+		return "DECIMAL '" + v.Text('f', -1) + "'", nil
+	case *big.Rat:
+		scale, ok := decimalScale(v)
+		if !ok {
+			return "", fmt.Errorf("%w: %s is not a decimal", ErrQueryUnknownType, v.String())
+		}
+		return "DECIMAL '" + v.FloatString(scale) + "'", nil
+	case []interface{}:
+		elements := make([]string, len(v))
+		for i, e := range v {
+			literal, err := sqlLiteral(e)
+			if err != nil {
+				return "", err
+			}
+			elements[i] = literal
+		}
+		return "ARRAY[" + strings.Join(elements, ", ") + "]", nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]interface{}, len(keys))
+		keyValues := make([]interface{}, len(keys))
+		for i, key := range keys {
+			keyValues[i], values[i] = key, v[key]
+		}
+		keyArray, _ := sqlLiteral(keyValues)
+		valueArray, err := sqlLiteral(values)
+		if err != nil {
+			return "", err
+		}
+		return "MAP(" + keyArray + ", " + valueArray + ")", nil
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return "", err
+		}
+		return sqlLiteral(value)
+	}
+	return "", fmt.Errorf("%w: %T", ErrQueryUnknownType, v)
+}
+
+// floatLiteral is to format f for a DOUBLE or REAL literal, with the names Athena parses for NaN and infinities.
+func floatLiteral(f float64, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bitSize)
+}
+
+// decimalScale is to get the number of digits after the decimal point of r, if it has finitely many
+// and at most 38, the max precision of Athena decimals.
+func decimalScale(r *big.Rat) (int, bool) {
+	denom := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	for denom.Cmp(big.NewInt(1)) != 0 {
+		if mod.Mod(denom, two).Sign() == 0 {
+			denom.Quo(denom, two)
+			twos++
+		} else if mod.Mod(denom, five).Sign() == 0 {
+			denom.Quo(denom, five)
+			fives++
+		} else {
+			return 0, false
+		}
+	}
+	scale := twos
+	if fives > scale {
+		scale = fives
+	}
+	return scale, scale <= 38
+}
+
+// InsertRows is to insert rows into table with INSERT INTO ... VALUES statements, as many as needed to keep
+// them within MAXQueryStringLength, instead of building the VALUES by hand. columns are the columns of the
+// values of the rows, or all of them in their order if it's empty. The values are written as the SQL literals
+// of their type, see SQLLiteral for the types which have no Go value.
+// The statements are run one after another, or up to parallelism at once. They are separate, so if one fails
+// the rows of the others stay inserted, and InsertRows gets the number of rows inserted with the error.
+// In an emulated transaction, the statements are staged like the other ones, and can't run in parallel.
+// It is reached from database/sql with the *Connection passed to the function of sql.Conn.Raw.
+func (c *Connection) InsertRows(ctx context.Context, table string, columns []string, rows [][]interface{},
+	parallelism int) (int64, error) {
+	queries, err := insertQueries(table, columns, rows, c.queryCommentsLength(ctx))
+	if err != nil {
+		return 0, err
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	if parallelism > 1 && c.tx != nil {
+		return 0, fmt.Errorf("%w: rows can't be inserted in parallel in a transaction",
+			ErrAthenaTransactionUnsupported)
+	}
+	if parallelism > len(queries) {
+		parallelism = len(queries)
+	}
+	var obs = c.connector.tracer
+	var mu sync.Mutex
+	var inserted int64
+	var firstErr error
+	work := make(chan insertQuery)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		// a Connection is not used concurrently, so the statements run in parallel have their own
+		conn := c
+		if parallelism > 1 {
+			conn = c.worker()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range work {
+				_, err := conn.ExecContext(ctx, q.query, nil)
+				mu.Lock()
+				if err == nil {
+					inserted += int64(q.rows)
+				} else if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+			if conn != c {
+				mu.Lock()
+				c.cost.merge(conn.cost)
+				mu.Unlock()
+			}
+		}()
+	}
+	// the statements running when one fails are not stopped, but no other one is started
+dispatch:
+	for _, q := range queries {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		select {
+		case work <- q:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+	if firstErr == nil && inserted < int64(len(rows)) {
+		firstErr = ctx.Err()
+	}
+	obs.Log(DebugLevel, "rows inserted",
+		zap.String("table", table),
+		zap.Int64("inserted", inserted),
+		zap.Int("total", len(rows)))
+	obs.Scope().Counter(DriverName + ".insertrows").Inc(inserted)
+	if firstErr != nil {
+		obs.Scope().Counter(DriverName + ".failure.insertrows").Inc(1)
+		return inserted, firstErr
+	}
+	return inserted, nil
+}
+
+// worker is to get a Connection with the clients of c, to run queries concurrently with c.
+func (c *Connection) worker() *Connection {
+	return &Connection{
+		athenaAPI:        c.athenaAPI,
+		s3API:            c.s3API,
+		fallbacks:        c.fallbacks,
+		connector:        c.connector,
+		engineVersion:    c.engineVersion,
+		engineVersionWG:  c.engineVersionWG,
+		lakeFormationAPI: c.lakeFormationAPI,
+		stsAPI:           c.stsAPI,
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// insertAthenaClient records the queries, which can be started concurrently, and fails the ones with "fail".
+type insertAthenaClient struct {
+	queryContextAthenaClient
+	mu sync.Mutex
+}
+
+func (m *insertAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out, err := m.queryContextAthenaClient.StartQueryExecutionWithContext(ctx, s, opts...)
+	if strings.Contains(*s.QueryString, "'fail'") {
+		out.QueryExecutionId = aws.String("QueryExecutionStateFailed_QID")
+	}
+	return out, err
+}
+
+func TestSQLLiteral(t *testing.T) {
+	for _, c := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "NULL"},
+		{"it's", "'it''s'"},
+		{true, "TRUE"},
+		{int8(-3), "-3"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{1.5, "1.5E+00"},
+		{math.Inf(-1), "DOUBLE '-Infinity'"},
+		{float32(0.25), "REAL '0.25'"},
+		{time.Date(2022, 5, 1, 3, 4, 5, 6000000, time.FixedZone("", 3600)), "TIMESTAMP '2022-05-01 02:04:05.006'"},
+		{[]byte("hi"), "X'6869'"},
+		{json.RawMessage(`{"a":"b'c"}`), `JSON '{"a":"b''c"}'`},
+		{big.NewRat(1250, 1000), "DECIMAL '1.25'"},
+		{big.NewInt(7), "DECIMAL '7'"},
+		{SQLLiteral("DATE '2022-05-01'"), "DATE '2022-05-01'"},
+		{[]interface{}{int64(1), nil}, "ARRAY[1, NULL]"},
+		{map[string]interface{}{"b": "x", "a": int64(1)}, "MAP(ARRAY['a', 'b'], ARRAY[1, 'x'])"},
+	} {
+		literal, err := sqlLiteral(c.value)
+		assert.Nil(t, err, c.value)
+		assert.Equal(t, c.expected, literal, c.value)
+	}
+
+	_, err := sqlLiteral(big.NewRat(1, 3))
+	assert.True(t, errors.Is(err, ErrQueryUnknownType))
+	_, err = sqlLiteral(struct{}{})
+	assert.True(t, errors.Is(err, ErrQueryUnknownType))
+}
+
+func TestInsertQueries(t *testing.T) {
+	queries, err := insertQueries("db.t", []string{"id", "name"}, [][]interface{}{{1, "a"}, {2, nil}}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []insertQuery{{"INSERT INTO db.t (id, name) VALUES (1, 'a'), (2, NULL)", 2}}, queries)
+
+	// the statements are within the max query length
+	long := strings.Repeat("x", MAXQueryStringLength/3)
+	queries, err = insertQueries("t", nil, [][]interface{}{{long}, {long}, {long}, {1}}, 0)
+	assert.Nil(t, err)
+	if assert.Len(t, queries, 2) {
+		assert.Equal(t, 2, queries[0].rows)
+		assert.True(t, len(queries[0].query) < MAXQueryStringLength)
+		assert.True(t, strings.HasPrefix(queries[1].query, "INSERT INTO t VALUES ('x"))
+		assert.True(t, strings.HasSuffix(queries[1].query, "'), (1)"))
+	}
+	// and leave room for the comments
+	reserved := len(queries[0].query) - len("INSERT INTO t VALUES ('"+long+"')")
+	queries, err = insertQueries("t", nil, [][]interface{}{{long}, {long}, {long}, {1}}, reserved)
+	assert.Nil(t, err)
+	if assert.Len(t, queries, 3) {
+		assert.True(t, len(queries[0].query)+reserved < MAXQueryStringLength)
+	}
+
+	for _, c := range []struct {
+		table   string
+		columns []string
+		rows    [][]interface{}
+	}{
+		{"t; DROP TABLE x", nil, [][]interface{}{{1}}},
+		{"t", []string{"a.b"}, [][]interface{}{{1}}},
+		{"t", []string{"a", "b"}, [][]interface{}{{1}}},
+		{"t", nil, [][]interface{}{{1}, {1, 2}}},
+		{"t", nil, [][]interface{}{{strings.Repeat("x", MAXQueryStringLength)}}},
+	} {
+		_, err = insertQueries(c.table, c.columns, c.rows, 0)
+		assert.True(t, errors.Is(err, ErrInvalidQuery), c.table)
+	}
+}
+
+func TestConnection_InsertRows(t *testing.T) {
+	long := strings.Repeat("x", MAXQueryStringLength/3)
+	rows := [][]interface{}{{long}, {long}, {long}, {long}, {long}}
+	for _, parallelism := range []int{0, 3} {
+		athenaClient := &insertAthenaClient{queryContextAthenaClient: queryContextAthenaClient{
+			mockAthenaClient: newMockAthenaClient()}}
+		c := &Connection{
+			athenaAPI: athenaClient,
+			connector: NoopsSQLConnector(),
+		}
+		inserted, err := c.InsertRows(context.Background(), "t", nil, rows, parallelism)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(5), inserted)
+		assert.Len(t, athenaClient.inputs, 3)
+	}
+
+	athenaClient := &insertAthenaClient{queryContextAthenaClient: queryContextAthenaClient{
+		mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	rows[3] = []interface{}{"fail"}
+	inserted, err := c.InsertRows(context.Background(), "t", nil, rows, 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(2), inserted)
+	// the statements after the failed one are not run
+	assert.Len(t, athenaClient.inputs, 2)
+
+	// the statements leave room for the query annotation
+	athenaClient = &insertAthenaClient{queryContextAthenaClient: newQueryContextAthenaClient()}
+	c = newMockConnection(athenaClient)
+	assert.Nil(t, c.connector.config.SetQueryAnnotation("service={{.Labels.service}}"))
+	ctx := WithQueryLabels(context.Background(), map[string]string{"service": strings.Repeat("s", 1000)})
+	rows = [][]interface{}{{long[:len(long)-400]}, {long[:len(long)-400]}, {long}}
+	inserted, err = c.InsertRows(ctx, "t", nil, rows, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), inserted)
+	if assert.Len(t, athenaClient.inputs, 2) {
+		assert.True(t, strings.HasPrefix(*athenaClient.inputs[0].QueryString, "/* service=sss"))
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// YearMonthInterval is a value of Athena's interval year to month type.
+// Years and Months have the sign of the interval, like -1 and -2 for `-1-2`.
+type YearMonthInterval struct {
+	Years  int
+	Months int
+}
+
+// TotalMonths is to get the length of the interval in months.
+func (i YearMonthInterval) TotalMonths() int {
+	return i.Years*12 + i.Months
+}
+
+// String is to format the interval like Athena, as `years-months`.
+func (i YearMonthInterval) String() string {
+	if i.Years < 0 || i.Months < 0 {
+		return fmt.Sprintf("-%d-%d", -i.Years, -i.Months)
+	}
+	return fmt.Sprintf("%d-%d", i.Years, i.Months)
+}
+
+// parseYearMonthInterval is to parse an interval year to month value, like `1-2` or `-0-3`.
+func parseYearMonthInterval(val string) (YearMonthInterval, error) {
+	s, negative := trimSign(val)
+	idx := strings.IndexByte(s, '-')
+	if idx <= 0 {
+		return YearMonthInterval{}, fmt.Errorf("invalid interval year to month `%s`", val)
+	}
+	years, err := strconv.Atoi(s[:idx])
+	if err != nil {
+		return YearMonthInterval{}, fmt.Errorf("invalid interval year to month `%s`", val)
+	}
+	months, err := strconv.Atoi(s[idx+1:])
+	if err != nil || months < 0 || months > 11 {
+		return YearMonthInterval{}, fmt.Errorf("invalid interval year to month `%s`", val)
+	}
+	if negative {
+		years, months = -years, -months
+	}
+	return YearMonthInterval{Years: years, Months: months}, nil
+}
+
+// parseDaySecondInterval is to parse an interval day to second value, like `2 03:04:05.678` or `-0 01:00:00.000`.
+func parseDaySecondInterval(val string) (time.Duration, error) {
+	s, negative := trimSign(val)
+	invalid := fmt.Errorf("invalid interval day to second `%s`", val)
+	idx := strings.IndexByte(s, ' ')
+	if idx <= 0 {
+		return 0, invalid
+	}
+	days, err := strconv.ParseInt(s[:idx], 10, 64)
+	if err != nil {
+		return 0, invalid
+	}
+	clock := strings.Split(s[idx+1:], ":")
+	if len(clock) != 3 {
+		return 0, invalid
+	}
+	hours, err := strconv.ParseInt(clock[0], 10, 64)
+	if err != nil || hours < 0 || hours > 23 {
+		return 0, invalid
+	}
+	minutes, err := strconv.ParseInt(clock[1], 10, 64)
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, invalid
+	}
+	seconds, err := time.ParseDuration(clock[2] + "s")
+	if err != nil || seconds < 0 || seconds >= time.Minute || strings.ContainsAny(clock[2], "+-") {
+		return 0, invalid
+	}
+	const maxDays = int64(time.Duration(1<<63-1) / (24 * time.Hour))
+	if days > maxDays {
+		return 0, fmt.Errorf("interval day to second `%s` overflows time.Duration", val)
+	}
+	d := time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+	if d > time.Duration(1<<63-1)-seconds {
+		return 0, fmt.Errorf("interval day to second `%s` overflows time.Duration", val)
+	}
+	d += seconds
+	if negative {
+		d = -d
+	}
+	return d, nil
+}
+
+// trimSign is to trim the leading - of negative intervals.
+func trimSign(val string) (string, bool) {
+	if strings.HasPrefix(val, "-") {
+		return val[1:], true
+	}
+	return val, false
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseYearMonthInterval(t *testing.T) {
+	tests := []struct {
+		val      string
+		expected YearMonthInterval
+	}{
+		{"0-0", YearMonthInterval{}},
+		{"1-2", YearMonthInterval{Years: 1, Months: 2}},
+		{"0-11", YearMonthInterval{Months: 11}},
+		{"-1-2", YearMonthInterval{Years: -1, Months: -2}},
+		{"-0-3", YearMonthInterval{Months: -3}},
+		{"178956970-7", YearMonthInterval{Years: 178956970, Months: 7}},
+	}
+	for _, test := range tests {
+		i, err := parseYearMonthInterval(test.val)
+		assert.Nil(t, err, test.val)
+		assert.Equal(t, test.expected, i, test.val)
+		assert.Equal(t, test.val, i.String())
+	}
+	i, _ := parseYearMonthInterval("-1-2")
+	assert.Equal(t, -14, i.TotalMonths())
+
+	for _, val := range []string{"", "1", "-1", "1-12", "1--2", "a-1", "1-b", "012"} {
+		_, err := parseYearMonthInterval(val)
+		assert.NotNil(t, err, val)
+	}
+}
+
+func TestParseDaySecondInterval(t *testing.T) {
+	tests := []struct {
+		val      string
+		expected time.Duration
+	}{
+		{"0 00:00:00.000", 0},
+		{"2 03:04:05.678", 2*24*time.Hour + 3*time.Hour + 4*time.Minute + 5678*time.Millisecond},
+		{"0 23:59:59.999", 24*time.Hour - time.Millisecond},
+		{"-0 01:00:00.000", -time.Hour},
+		{"-1 00:00:00.001", -(24*time.Hour + time.Millisecond)},
+		{"0 00:00:01", time.Second},
+		{"106751 23:47:16.854", 106751*24*time.Hour + 23*time.Hour + 47*time.Minute + 16854*time.Millisecond},
+	}
+	for _, test := range tests {
+		d, err := parseDaySecondInterval(test.val)
+		assert.Nil(t, err, test.val)
+		assert.Equal(t, test.expected, d, test.val)
+	}
+
+	for _, val := range []string{"", "1", "1 00:00", "1 24:00:00.000", "1 00:60:00.000", "1 00:00:60.000",
+		"1 00:00:-1.000", "x 00:00:00.000", "106752 00:00:00.000", "106751 23:47:16.855", "012"} {
+		_, err := parseDaySecondInterval(val)
+		assert.NotNil(t, err, val)
+	}
+}
+
+func TestRows_AthenaTypeToGoType_Interval(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	r := &Rows{config: testConf, tracer: NewDefaultObservability(testConf)}
+	val := "1-2"
+	g, err := r.athenaTypeToGoType(newColumnInfo("i", "interval year to month"), &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, YearMonthInterval{Years: 1, Months: 2}, g)
+	val = "1 00:00:00.000"
+	g, err = r.athenaTypeToGoType(newColumnInfo("i", "interval day to second"), &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, 24*time.Hour, g)
+	assert.Equal(t, reflect.TypeOf(time.Duration(0)), r.scanTypeOfColumnType("interval day to second"))
+	assert.Equal(t, reflect.TypeOf(YearMonthInterval{}), r.scanTypeOfColumnType("interval year to month"))
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/lakeformation"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"go.uber.org/zap"
+)
+
+// LakeFormationAllPrincipals is the Lake Formation principal of the tables whose access is controlled by IAM only.
+const LakeFormationAllPrincipals = "IAM_ALLOWED_PRINCIPALS"
+
+// lakeFormationTableRegexp is to find the table in the reason of a Lake Formation denial, like
+// "Insufficient Lake Formation permission(s) on sales.orders".
+var lakeFormationTableRegexp = regexp.MustCompile(
+	"(?i)lake formation permission.*?\\bon\\s+(?:table\\s+)?[\"'`]?([A-Za-z0-9_]+(?:\\.[A-Za-z0-9_]+){0,2})[\"'`]?(?:[\\s,;()]|$)")
+
+// lakeFormationColumnRegexp is to find the column in the reason of a column denial, like
+// "Column 'ssn' cannot be resolved or requester is not authorized to access requested resources".
+var lakeFormationColumnRegexp = regexp.MustCompile(`(?i)column\s+'([^']+)'\s+cannot be resolved or requester is not authorized`)
+
+// newLakeFormationDeniedError is to get the error of a Lake Formation denial with the failure reason err,
+// whose message is reason.
+func newLakeFormationDeniedError(reason string, err error) *LakeFormationDeniedError {
+	e := &LakeFormationDeniedError{Err: err}
+	if m := lakeFormationTableRegexp.FindStringSubmatch(reason); m != nil {
+		// the data catalog of catalog.database.table is left out
+		names := strings.Split(m[1], ".")
+		e.Table = names[len(names)-1]
+		if len(names) > 1 {
+			e.Database = names[len(names)-2]
+		}
+	}
+	if m := lakeFormationColumnRegexp.FindStringSubmatch(reason); m != nil {
+		e.Column = m[1]
+	}
+	return e
+}
+
+// lakeFormationPrincipal is to get the Lake Formation principal of the caller ARN, the IAM role of an assumed
+// role session. The path of the role isn't in the ARN of the session, so roles with a path are not found.
+func lakeFormationPrincipal(callerARN string) string {
+	a, err := arn.Parse(callerARN)
+	if err != nil || a.Service != "sts" {
+		return callerARN
+	}
+	parts := strings.Split(a.Resource, "/")
+	if len(parts) != 3 || parts[0] != "assumed-role" {
+		return callerARN
+	}
+	a.Service = "iam"
+	a.Resource = "role/" + parts[1]
+	return a.String()
+}
+
+// getLakeFormationPrincipal is to get the Lake Formation principal of the credentials of the connection.
+func (c *Connection) getLakeFormationPrincipal(ctx context.Context) (string, error) {
+	if c.lakeFormationPrincipal != "" {
+		return c.lakeFormationPrincipal, nil
+	}
+	if c.stsAPI == nil {
+		return "", ErrSTSNilAPI
+	}
+	identity, err := c.stsAPI.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	c.lakeFormationPrincipal = lakeFormationPrincipal(aws.StringValue(identity.Arn))
+	return c.lakeFormationPrincipal, nil
+}
+
+// isLakeFormationGoverned is to get if Lake Formation controls the access to the tables of the data catalog,
+// which is not the case while new tables grant ALL to LakeFormationAllPrincipals by default.
+func (c *Connection) isLakeFormationGoverned(ctx context.Context) (bool, error) {
+	if c.lakeFormationGoverned != nil {
+		return *c.lakeFormationGoverned, nil
+	}
+	resp, err := c.lakeFormationAPI.GetDataLakeSettingsWithContext(ctx, &lakeformation.GetDataLakeSettingsInput{})
+	if err != nil {
+		return false, err
+	}
+	governed := true
+	if resp.DataLakeSettings != nil {
+		for _, p := range resp.DataLakeSettings.CreateTableDefaultPermissions {
+			if p.Principal != nil && aws.StringValue(p.Principal.DataLakePrincipalIdentifier) == LakeFormationAllPrincipals &&
+				hasLakeFormationPermission(p.Permissions, lakeformation.PermissionAll) {
+				governed = false
+			}
+		}
+	}
+	c.lakeFormationGoverned = &governed
+	return governed, nil
+}
+
+func hasLakeFormationPermission(permissions []*string, permission string) bool {
+	for _, p := range permissions {
+		if aws.StringValue(p) == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(names []*string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(aws.StringValue(n), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// lakeFormationSelects is to get if the permissions grant SELECT on the column of their table, or on any of
+// its columns if column is empty.
+func lakeFormationSelects(p *lakeformation.PrincipalResourcePermissions, column string) bool {
+	if p.Resource == nil || !hasLakeFormationPermission(p.Permissions, lakeformation.PermissionSelect) &&
+		!hasLakeFormationPermission(p.Permissions, lakeformation.PermissionAll) {
+		return false
+	}
+	if p.Resource.Table != nil {
+		return true
+	}
+	columns := p.Resource.TableWithColumns
+	if columns == nil {
+		return false
+	}
+	if column == "" {
+		return true
+	}
+	if columns.ColumnWildcard != nil {
+		return !containsFold(columns.ColumnWildcard.ExcludedColumnNames, column)
+	}
+	return containsFold(columns.ColumnNames, column)
+}
+
+// CheckLakeFormationPermissions is to check if Lake Formation grants the caller SELECT on the table of the
+// database, and on its columns if any. It returns an ErrLakeFormationNoGrant error if no grant of the caller is
+// listed, which isn't a denial, and nil if Lake Formation doesn't control the access to the tables (see
+// Config.SetLakeFormationPreflight), or if the table doesn't exist. Only the permissions the caller is allowed
+// to list are seen.
+func (c *Connection) CheckLakeFormationPermissions(ctx context.Context, database string, table string,
+	columns ...string) error {
+	if c.lakeFormationAPI == nil {
+		return ErrLakeFormationNilAPI
+	}
+	governed, err := c.isLakeFormationGoverned(ctx)
+	if err != nil || !governed {
+		return err
+	}
+	principal, err := c.getLakeFormationPrincipal(ctx)
+	if err != nil {
+		return err
+	}
+	var permissions []*lakeformation.PrincipalResourcePermissions
+	err = c.lakeFormationAPI.ListPermissionsPagesWithContext(ctx, &lakeformation.ListPermissionsInput{
+		IncludeRelated: aws.String("TRUE"),
+		Resource: &lakeformation.Resource{
+			Table: &lakeformation.TableResource{
+				DatabaseName: aws.String(database),
+				Name:         aws.String(table),
+			},
+		},
+	}, func(page *lakeformation.ListPermissionsOutput, lastPage bool) bool {
+		permissions = append(permissions, page.PrincipalResourcePermissions...)
+		return true
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == lakeformation.ErrCodeEntityNotFoundException {
+		// like the name of a CTE, Athena fails the query if the table doesn't exist
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		columns = []string{""}
+	}
+	for _, column := range columns {
+		granted := false
+		for _, p := range permissions {
+			if p.Principal == nil {
+				continue
+			}
+			id := aws.StringValue(p.Principal.DataLakePrincipalIdentifier)
+			if (id == principal || id == LakeFormationAllPrincipals) && lakeFormationSelects(p, column) {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			if column != "" {
+				return fmt.Errorf("%w: SELECT on column %s of table %s.%s", ErrLakeFormationNoGrant, column,
+					database, table)
+			}
+			return fmt.Errorf("%w: SELECT on table %s.%s", ErrLakeFormationNoGrant, database, table)
+		}
+	}
+	return nil
+}
+
+// lakeFormationPreflight is to check the Lake Formation permissions on the tables in the FROM and JOIN clauses
+// of the query, when Config enables the preflight. It is never stricter than Athena: the tables without a grant
+// listed are logged and counted, and failures of the Lake Formation API don't fail the query either. The tables
+// checked are cached by the connection.
+func (c *Connection) lakeFormationPreflight(ctx context.Context, obs *DriverTracer, query string) error {
+	if !c.connector.config.IsLakeFormationPreflight() || c.lakeFormationAPI == nil ||
+		isFederatedCatalog(getCatalog(ctx, c.connector.config)) {
+		return nil
+	}
+	db := getDatabase(ctx, c.connector.config)
+	query = multiLineCommentPattern.ReplaceAllString(query, "")
+	query = oneLineCommentPattern.ReplaceAllString(query, "")
+	for _, m := range getTableNamePattern.FindAllStringSubmatch(query, -1) {
+		database, table := splitTableName(m[1], db)
+		if c.lakeFormationTables[database+"."+table] {
+			continue
+		}
+		err := c.CheckLakeFormationPermissions(ctx, database, table)
+		if errors.Is(err, ErrLakeFormationNoGrant) {
+			// the grants with LF-Tags, to groups or to other accounts may still allow the query
+			obs.Scope().Counter(DriverName + ".querycontext.lakeformationnogrant").Inc(1)
+			obs.Log(WarnLevel, "no Lake Formation grant is listed for the table", zap.String("database", database),
+				zap.String("table", table))
+		} else if err != nil {
+			obs.Scope().Counter(DriverName + ".failure.querycontext.lakeformationpreflight").Inc(1)
+			obs.Log(WarnLevel, "Lake Formation preflight failed", zap.String("error", err.Error()))
+			return nil
+		}
+		if c.lakeFormationTables == nil {
+			c.lakeFormationTables = map[string]bool{}
+		}
+		c.lakeFormationTables[database+"."+table] = true
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/lakeformation"
+	"github.com/aws/aws-sdk-go/service/lakeformation/lakeformationiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+const testLakeFormationRole = "arn:aws:iam::123456789012:role/analyst"
+
+// mockLakeFormationClient grants the permissions of the tables by database.table.
+type mockLakeFormationClient struct {
+	lakeformationiface.LakeFormationAPI
+	defaultPermissions []*lakeformation.PrincipalPermissions
+	permissions        map[string][]*lakeformation.PrincipalResourcePermissions
+	err                error
+	listed             []string
+}
+
+func (m *mockLakeFormationClient) GetDataLakeSettingsWithContext(ctx aws.Context,
+	input *lakeformation.GetDataLakeSettingsInput, opts ...request.Option) (*lakeformation.GetDataLakeSettingsOutput, error) {
+	return &lakeformation.GetDataLakeSettingsOutput{DataLakeSettings: &lakeformation.DataLakeSettings{
+		CreateTableDefaultPermissions: m.defaultPermissions,
+	}}, nil
+}
+
+func (m *mockLakeFormationClient) ListPermissionsPagesWithContext(ctx aws.Context,
+	input *lakeformation.ListPermissionsInput, fn func(*lakeformation.ListPermissionsOutput, bool) bool,
+	opts ...request.Option) error {
+	if m.err != nil {
+		return m.err
+	}
+	name := *input.Resource.Table.DatabaseName + "." + *input.Resource.Table.Name
+	m.listed = append(m.listed, name)
+	permissions, ok := m.permissions[name]
+	if !ok {
+		return awserr.New(lakeformation.ErrCodeEntityNotFoundException, "Entity not found", nil)
+	}
+	for _, p := range permissions {
+		fn(&lakeformation.ListPermissionsOutput{PrincipalResourcePermissions: []*lakeformation.PrincipalResourcePermissions{p}},
+			false)
+	}
+	return nil
+}
+
+type mockSTSClient struct {
+	stsiface.STSAPI
+}
+
+func (m *mockSTSClient) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput,
+	opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Arn: aws.String("arn:aws:sts::123456789012:assumed-role/analyst/session")}, nil
+}
+
+func tablePermissions(principal string, permission string) *lakeformation.PrincipalResourcePermissions {
+	return &lakeformation.PrincipalResourcePermissions{
+		Principal:   &lakeformation.DataLakePrincipal{DataLakePrincipalIdentifier: aws.String(principal)},
+		Permissions: aws.StringSlice([]string{permission}),
+		Resource:    &lakeformation.Resource{Table: &lakeformation.TableResource{}},
+	}
+}
+
+func columnPermissions(principal string, columns []string, excluded []string) *lakeformation.PrincipalResourcePermissions {
+	resource := &lakeformation.TableWithColumnsResource{ColumnNames: aws.StringSlice(columns)}
+	if excluded != nil {
+		resource.ColumnWildcard = &lakeformation.ColumnWildcard{ExcludedColumnNames: aws.StringSlice(excluded)}
+	}
+	return &lakeformation.PrincipalResourcePermissions{
+		Principal:   &lakeformation.DataLakePrincipal{DataLakePrincipalIdentifier: aws.String(principal)},
+		Permissions: aws.StringSlice([]string{lakeformation.PermissionSelect}),
+		Resource:    &lakeformation.Resource{TableWithColumns: resource},
+	}
+}
+
+func newLakeFormationConnection(lakeFormationClient *mockLakeFormationClient) (*Connection,
+	*queryContextAthenaClient) {
+	athenaClient := newQueryContextAthenaClient()
+	c := newMockConnection(&athenaClient)
+	c.lakeFormationAPI = lakeFormationClient
+	c.stsAPI = &mockSTSClient{}
+	return c, &athenaClient
+}
+
+func TestNewLakeFormationDeniedError(t *testing.T) {
+	e := newLakeFormationDeniedError("Insufficient Lake Formation permission(s) on sales.orders "+
+		"(Service: AmazonDataCatalog; Status Code: 400; Error Code: AccessDeniedException)", nil)
+	assert.Equal(t, &LakeFormationDeniedError{Database: "sales", Table: "orders"}, e)
+	assert.Equal(t, "Lake Formation denied access to table sales.orders", e.Error())
+
+	e = newLakeFormationDeniedError("Insufficient Lake Formation permission(s): Required Select on orders", nil)
+	assert.Equal(t, &LakeFormationDeniedError{Table: "orders"}, e)
+
+	e = newLakeFormationDeniedError("Insufficient Lake Formation permission(s) on s3://bucket/orders", nil)
+	assert.Equal(t, &LakeFormationDeniedError{}, e)
+
+	reason := errors.New("COLUMN_NOT_FOUND: line 1:8: Column 'ssn' cannot be resolved or requester is not " +
+		"authorized to access requested resources")
+	e = newLakeFormationDeniedError(reason.Error(), reason)
+	assert.Equal(t, "ssn", e.Column)
+	assert.Equal(t, "Lake Formation denied access to column ssn: "+reason.Error(), e.Error())
+	assert.True(t, errors.Is(e, reason))
+}
+
+func TestNewQueryError_LakeFormationDenied(t *testing.T) {
+	reason := "HIVE_METASTORE_ERROR: Insufficient Lake Formation permission(s) on awsdatacatalog.sales.orders"
+	err := error(newQueryError(&athena.QueryExecution{
+		QueryExecutionId: aws.String("qid"),
+		Status: &athena.QueryExecutionStatus{
+			State:             aws.String(athena.QueryExecutionStateFailed),
+			StateChangeReason: aws.String(reason),
+		},
+	}, errors.New(reason)))
+	assert.True(t, errors.Is(err, ErrLakeFormationDenied))
+	assert.True(t, errors.Is(err, ErrAccessDenied))
+	assert.False(t, errors.Is(err, ErrFederatedSource))
+	var denied *LakeFormationDeniedError
+	assert.True(t, errors.As(err, &denied))
+	assert.Equal(t, "sales", denied.Database)
+	assert.Equal(t, "orders", denied.Table)
+
+	err = classifyError("qid", awserr.New(athena.ErrCodeInvalidRequestException,
+		"Insufficient Lake Formation permission(s) on orders", nil))
+	assert.True(t, errors.As(err, &denied))
+	assert.Equal(t, "orders", denied.Table)
+}
+
+func TestLakeFormationPrincipal(t *testing.T) {
+	assert.Equal(t, testLakeFormationRole,
+		lakeFormationPrincipal("arn:aws:sts::123456789012:assumed-role/analyst/session"))
+	assert.Equal(t, "arn:aws:iam::123456789012:user/jane", lakeFormationPrincipal("arn:aws:iam::123456789012:user/jane"))
+	assert.Equal(t, "not an arn", lakeFormationPrincipal("not an arn"))
+}
+
+func TestConnection_CheckLakeFormationPermissions(t *testing.T) {
+	lakeFormationClient := &mockLakeFormationClient{
+		permissions: map[string][]*lakeformation.PrincipalResourcePermissions{
+			"sales.orders": {tablePermissions(testLakeFormationRole, lakeformation.PermissionSelect)},
+			"sales.customers": {
+				tablePermissions(testLakeFormationRole, lakeformation.PermissionDescribe),
+				columnPermissions(testLakeFormationRole, []string{"id", "name"}, nil),
+			},
+			"sales.payments": {columnPermissions(testLakeFormationRole, nil, []string{"card"})},
+			"sales.regions":  {tablePermissions(LakeFormationAllPrincipals, lakeformation.PermissionAll)},
+			"sales.salaries": {tablePermissions("arn:aws:iam::123456789012:role/hr", lakeformation.PermissionSelect)},
+		},
+	}
+	c, _ := newLakeFormationConnection(lakeFormationClient)
+	ctx := context.Background()
+
+	assert.Nil(t, c.CheckLakeFormationPermissions(ctx, "sales", "orders", "id"))
+	assert.Nil(t, c.CheckLakeFormationPermissions(ctx, "sales", "customers"))
+	assert.Nil(t, c.CheckLakeFormationPermissions(ctx, "sales", "customers", "ID", "name"))
+	err := c.CheckLakeFormationPermissions(ctx, "sales", "customers", "id", "ssn")
+	assert.True(t, errors.Is(err, ErrLakeFormationNoGrant))
+	assert.Equal(t, "no Lake Formation grant of the caller is listed: SELECT on column ssn of table sales.customers",
+		err.Error())
+	assert.Nil(t, c.CheckLakeFormationPermissions(ctx, "sales", "payments", "amount"))
+	assert.True(t, errors.Is(c.CheckLakeFormationPermissions(ctx, "sales", "payments", "card"), ErrLakeFormationNoGrant))
+	assert.Nil(t, c.CheckLakeFormationPermissions(ctx, "sales", "regions"))
+	// no grant listed isn't a denial, the grant may be with LF-Tags or to a group
+	err = c.CheckLakeFormationPermissions(ctx, "sales", "salaries")
+	assert.True(t, errors.Is(err, ErrLakeFormationNoGrant))
+	assert.False(t, errors.Is(err, ErrAccessDenied))
+	assert.Nil(t, c.CheckLakeFormationPermissions(ctx, "sales", "missing"))
+	assert.Equal(t, testLakeFormationRole, c.lakeFormationPrincipal)
+
+	// new tables are controlled by IAM only
+	c, _ = newLakeFormationConnection(&mockLakeFormationClient{
+		defaultPermissions: []*lakeformation.PrincipalPermissions{{
+			Principal:   &lakeformation.DataLakePrincipal{DataLakePrincipalIdentifier: aws.String(LakeFormationAllPrincipals)},
+			Permissions: aws.StringSlice([]string{lakeformation.PermissionAll}),
+		}},
+	})
+	assert.Nil(t, c.CheckLakeFormationPermissions(ctx, "sales", "salaries"))
+
+	c.lakeFormationAPI = nil
+	assert.Equal(t, ErrLakeFormationNilAPI, c.CheckLakeFormationPermissions(ctx, "sales", "orders"))
+}
+
+func TestConnection_QueryContext_LakeFormationPreflight(t *testing.T) {
+	lakeFormationClient := &mockLakeFormationClient{
+		permissions: map[string][]*lakeformation.PrincipalResourcePermissions{
+			"sales.orders":   {tablePermissions(testLakeFormationRole, lakeformation.PermissionSelect)},
+			"sales.salaries": {tablePermissions("arn:aws:iam::123456789012:role/hr", lakeformation.PermissionSelect)},
+		},
+	}
+	c, athenaClient := newLakeFormationConnection(lakeFormationClient)
+	ctx := context.Background()
+
+	// disabled by default
+	_, err := c.QueryContext(ctx, "SELECT * FROM sales.salaries", nil)
+	assert.Nil(t, err)
+	assert.Empty(t, lakeFormationClient.listed)
+
+	// the tables without a grant listed don't fail the query, which only Athena can deny
+	c.connector.config.SetLakeFormationPreflight(true)
+	_, err = c.QueryContext(ctx, "SELECT * FROM sales.orders o JOIN sales.salaries s ON o.id = s.id", nil)
+	assert.Nil(t, err)
+	assert.Len(t, lakeFormationClient.listed, 2)
+	assert.Len(t, athenaClient.inputs, 2)
+
+	// the tables checked are cached, the unqualified ones are in the database of the query
+	lakeFormationClient.listed = nil
+	_, err = c.QueryContext(WithDatabase(ctx, "sales"), "SELECT * FROM orders JOIN salaries ON true", nil)
+	assert.Nil(t, err)
+	assert.Empty(t, lakeFormationClient.listed)
+	assert.Len(t, athenaClient.inputs, 3)
+
+	// federated data catalogs are not checked
+	_, err = c.QueryContext(WithCatalog(ctx, "dynamodb"), "SELECT * FROM sales.salaries", nil)
+	assert.Nil(t, err)
+	assert.Empty(t, lakeFormationClient.listed)
+
+	// Athena denies the query anyway if the preflight fails
+	lakeFormationClient.err = awserr.New(lakeformation.ErrCodeInternalServiceException, "internal error", nil)
+	_, err = c.QueryContext(ctx, "SELECT * FROM sales.payments", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 5)
+}
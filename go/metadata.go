@@ -0,0 +1,166 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// showSchemasRegexp matches SHOW SCHEMAS and SHOW DATABASES, with an optional LIKE pattern.
+var showSchemasRegexp = regexp.MustCompile(`(?i)^\s*SHOW\s+(?:SCHEMAS|DATABASES)(?:\s+LIKE\s+'([^']*)')?\s*;?\s*$`)
+
+// showTablesRegexp matches SHOW TABLES, with an optional database and pattern.
+var showTablesRegexp = regexp.MustCompile(
+	"(?i)^\\s*SHOW\\s+TABLES(?:\\s+(?:IN|FROM)\\s+`?([A-Za-z0-9_]+)`?)?(?:\\s+'([^']*)')?\\s*;?\\s*$")
+
+// ListDatabases is to list the databases in the data catalog of ctx, set with WithCatalog, or of Config.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) ListDatabases(ctx context.Context) ([]*athena.Database, error) {
+	var databases []*athena.Database
+	err := c.athenaAPI.ListDatabasesPagesWithContext(ctx, &athena.ListDatabasesInput{
+		CatalogName: aws.String(getCatalog(ctx, c.connector.config)),
+	}, func(page *athena.ListDatabasesOutput, lastPage bool) bool {
+		databases = append(databases, page.DatabaseList...)
+		return true
+	})
+	if err != nil {
+		c.connector.tracer.Scope().Counter(DriverName + ".failure.listdatabases").Inc(1)
+		return nil, err
+	}
+	return databases, nil
+}
+
+// ListTableMetadata is to list the metadata of the tables in the database of the data catalog of ctx, or of
+// Config. If expression isn't empty, only the tables matching it are listed, like `sales_*|orders`.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) ListTableMetadata(ctx context.Context, database string, expression string) (
+	[]*athena.TableMetadata, error) {
+	input := &athena.ListTableMetadataInput{
+		CatalogName:  aws.String(getCatalog(ctx, c.connector.config)),
+		DatabaseName: aws.String(database),
+	}
+	if expression != "" {
+		input.Expression = aws.String(expression)
+	}
+	var tables []*athena.TableMetadata
+	err := c.athenaAPI.ListTableMetadataPagesWithContext(ctx, input,
+		func(page *athena.ListTableMetadataOutput, lastPage bool) bool {
+			tables = append(tables, page.TableMetadataList...)
+			return true
+		})
+	if err != nil {
+		c.connector.tracer.Scope().Counter(DriverName + ".failure.listtablemetadata").Inc(1)
+		return nil, err
+	}
+	return tables, nil
+}
+
+// GetTableMetadata is to get the metadata of the table in the database of the data catalog of ctx, or of
+// Config, like its columns and partition keys.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) GetTableMetadata(ctx context.Context, database string, table string) (
+	*athena.TableMetadata, error) {
+	out, err := c.athenaAPI.GetTableMetadataWithContext(ctx, &athena.GetTableMetadataInput{
+		CatalogName:  aws.String(getCatalog(ctx, c.connector.config)),
+		DatabaseName: aws.String(database),
+		TableName:    aws.String(table),
+	})
+	if err != nil {
+		c.connector.tracer.Scope().Counter(DriverName + ".failure.gettablemetadata").Inc(1)
+		return nil, err
+	}
+	return out.TableMetadata, nil
+}
+
+// showPatternRegexp is to get the regexp of a pattern of SHOW SCHEMAS, where * matches any characters and
+// | separates alternatives, case-insensitively.
+func showPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '|':
+			b.WriteString("|")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return regexp.Compile("(?i)^(?:" + b.String() + ")$")
+}
+
+// metadataQuery is to run SHOW SCHEMAS and SHOW TABLES with the metadata API, without a query execution,
+// if Config.SetMetadataAPI is enabled. ok is false for the other queries.
+func (c *Connection) metadataQuery(ctx context.Context, query string) (rows driver.Rows, ok bool, err error) {
+	if !c.connector.config.IsMetadataAPI() {
+		return nil, false, nil
+	}
+	var column string
+	var names []string
+	if m := showSchemasRegexp.FindStringSubmatch(query); m != nil {
+		column = "database_name"
+		var pattern *regexp.Regexp
+		if m[1] != "" {
+			if pattern, err = showPatternRegexp(m[1]); err != nil {
+				// left to Athena
+				return nil, false, nil
+			}
+		}
+		databases, err := c.ListDatabases(ctx)
+		if err != nil {
+			return nil, true, err
+		}
+		for _, db := range databases {
+			if name := aws.StringValue(db.Name); pattern == nil || pattern.MatchString(name) {
+				names = append(names, name)
+			}
+		}
+	} else if m := showTablesRegexp.FindStringSubmatch(query); m != nil {
+		column = "tab_name"
+		database := m[1]
+		if database == "" {
+			database = getDatabase(ctx, c.connector.config)
+		}
+		tables, err := c.ListTableMetadata(ctx, database, m[2])
+		if err != nil {
+			return nil, true, err
+		}
+		for _, table := range tables {
+			names = append(names, aws.StringValue(table.Name))
+		}
+	} else {
+		return nil, false, nil
+	}
+	c.connector.tracer.Scope().Counter(DriverName + ".querycontext.metadataapi").Inc(1)
+	r, err := NewNonOpsRows(ctx, c.athenaAPI, "", c.connector.config, c.connector.tracer)
+	data := make([][]*string, len(names))
+	for i := range names {
+		data[i] = []*string{&names[i]}
+	}
+	r.ResultOutput = newHeaderlessResultPage([]*string{&column}, []string{"string"}, data)
+	return r, true, err
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// metadataAthenaClient has the databases and tables of a data catalog, and records the table listings.
+type metadataAthenaClient struct {
+	queryContextAthenaClient
+	databases []string
+	tables    map[string][]string
+	listings  []*athena.ListTableMetadataInput
+}
+
+func (m *metadataAthenaClient) ListDatabasesPagesWithContext(ctx aws.Context, input *athena.ListDatabasesInput,
+	fn func(*athena.ListDatabasesOutput, bool) bool, opts ...request.Option) error {
+	for i, name := range m.databases {
+		fn(&athena.ListDatabasesOutput{DatabaseList: []*athena.Database{{Name: aws.String(name)}}},
+			i == len(m.databases)-1)
+	}
+	return nil
+}
+
+func (m *metadataAthenaClient) ListTableMetadataPagesWithContext(ctx aws.Context,
+	input *athena.ListTableMetadataInput, fn func(*athena.ListTableMetadataOutput, bool) bool,
+	opts ...request.Option) error {
+	m.listings = append(m.listings, input)
+	page := &athena.ListTableMetadataOutput{}
+	for _, name := range m.tables[*input.DatabaseName] {
+		page.TableMetadataList = append(page.TableMetadataList, &athena.TableMetadata{Name: aws.String(name)})
+	}
+	fn(page, true)
+	return nil
+}
+
+func (m *metadataAthenaClient) GetTableMetadataWithContext(ctx aws.Context, input *athena.GetTableMetadataInput,
+	opts ...request.Option) (*athena.GetTableMetadataOutput, error) {
+	for _, name := range m.tables[*input.DatabaseName] {
+		if name == *input.TableName {
+			return &athena.GetTableMetadataOutput{TableMetadata: &athena.TableMetadata{
+				Name:    aws.String(name),
+				Columns: []*athena.Column{{Name: aws.String("id"), Type: aws.String("bigint")}},
+			}}, nil
+		}
+	}
+	return nil, ErrTestMockGeneric
+}
+
+func newMetadataConnection() (*Connection, *metadataAthenaClient) {
+	athenaClient := &metadataAthenaClient{
+		queryContextAthenaClient: newQueryContextAthenaClient(),
+		databases:                []string{"default", "sales", "sales_archive"},
+		tables:                   map[string][]string{"default": {"t"}, "sales": {"orders", "customers"}},
+	}
+	return newMockConnection(athenaClient), athenaClient
+}
+
+func TestConnection_MetadataAPI(t *testing.T) {
+	c, _ := newMetadataConnection()
+	ctx := WithCatalog(context.Background(), "hive_metastore")
+	databases, err := c.ListDatabases(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, databases, 3)
+
+	tables, err := c.ListTableMetadata(ctx, "sales", "")
+	assert.Nil(t, err)
+	assert.Len(t, tables, 2)
+
+	table, err := c.GetTableMetadata(ctx, "sales", "orders")
+	assert.Nil(t, err)
+	assert.Equal(t, "id", *table.Columns[0].Name)
+	_, err = c.GetTableMetadata(ctx, "sales", "returns")
+	assert.Equal(t, ErrTestMockGeneric, err)
+}
+
+func TestConnection_QueryContext_MetadataAPI(t *testing.T) {
+	c, athenaClient := newMetadataConnection()
+	names := func(query string) []driver.Value {
+		rows, err := c.QueryContext(context.Background(), query, nil)
+		assert.Nil(t, err)
+		var got []driver.Value
+		for _, row := range readAllRows(t, rows) {
+			got = append(got, row[0])
+		}
+		return got
+	}
+
+	// the queries are run by Athena by default
+	names("SHOW TABLES")
+	assert.Len(t, athenaClient.inputs, 1)
+	assert.Empty(t, athenaClient.listings)
+
+	c.connector.config.SetMetadataAPI(true)
+	assert.Equal(t, []driver.Value{"default", "sales", "sales_archive"}, names("SHOW SCHEMAS"))
+	assert.Equal(t, []driver.Value{"sales", "sales_archive"}, names("show databases like 'SALES*';"))
+	assert.Equal(t, []driver.Value{"default", "sales"}, names("SHOW SCHEMAS LIKE 'default|sales'"))
+	assert.Equal(t, []driver.Value{"t"}, names("SHOW TABLES"))
+	assert.Equal(t, []driver.Value{"orders", "customers"}, names("SHOW TABLES IN `sales` 'ord*|cust*'"))
+	assert.Len(t, athenaClient.inputs, 1)
+	if assert.Len(t, athenaClient.listings, 2) {
+		assert.Equal(t, c.connector.config.GetDB(), *athenaClient.listings[0].DatabaseName)
+		assert.Nil(t, athenaClient.listings[0].Expression)
+		assert.Equal(t, "ord*|cust*", *athenaClient.listings[1].Expression)
+	}
+
+	rows, err := c.QueryContext(context.Background(), "SHOW TABLES IN sales", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tab_name"}, rows.Columns())
+
+	// the other SHOW statements are still run by Athena
+	names("SHOW COLUMNS IN sales.orders")
+	assert.Len(t, athenaClient.inputs, 2)
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultMigrationsTable is the default name of the Iceberg table of the migration version of
+// Connection.MigrationVersion and Connection.SetMigrationVersion.
+const DefaultMigrationsTable = "schema_migrations"
+
+// NilMigrationVersion is the migration version of a schema without any migration applied, like NilVersion of
+// golang-migrate.
+const NilMigrationVersion = -1
+
+// ddlName is the pattern of the names in the DDL statements, which can be quoted.
+const ddlName = "[A-Za-z0-9_.`\"]+"
+
+// idempotentDDLRewrites make the DDL statements of migrations idempotent, to run them again after a
+// migration failed halfway. CTAS statements, without a column list, are left out, Athena doesn't support
+// IF NOT EXISTS for them.
+var idempotentDDLRewrites = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?is)^(\s*CREATE\s+(?:EXTERNAL\s+)?TABLE)\s+(` + ddlName + `\s*\()`), "$1 IF NOT EXISTS $2"},
+	{regexp.MustCompile(`(?is)^(\s*CREATE\s+(?:DATABASE|SCHEMA))\s+(` + ddlName + `)`), "$1 IF NOT EXISTS $2"},
+	{regexp.MustCompile(`(?is)^(\s*CREATE)\s+(VIEW)\s`), "$1 OR REPLACE $2 "},
+	{regexp.MustCompile(`(?is)^(\s*DROP\s+(?:TABLE|VIEW|DATABASE|SCHEMA))\s+(` + ddlName + `)`), "$1 IF EXISTS $2"},
+	{regexp.MustCompile(`(?is)^(\s*ALTER\s+TABLE\s+` + ddlName + `\s+ADD)\s+(PARTITION)\s`), "$1 IF NOT EXISTS $2 "},
+}
+
+// idempotentDDL is to add IF NOT EXISTS or IF EXISTS to a DDL statement, or OR REPLACE to CREATE VIEW, so it
+// succeeds when it was run before. The other statements and the ones with them already are returned as they are.
+func idempotentDDL(query string) string {
+	for _, r := range idempotentDDLRewrites {
+		if loc := r.pattern.FindStringSubmatchIndex(query); loc != nil {
+			rest := strings.TrimLeft(query[loc[3]:], " \t\r\n")
+			if hasKeyword(rest, "if") || hasKeyword(rest, "or") {
+				return query
+			}
+			return string(r.pattern.ExpandString(nil, r.replacement, query, loc)) + query[loc[1]:]
+		}
+	}
+	return query
+}
+
+// ensureMigrationsTable is to create the Iceberg table of the migration version if it doesn't exist.
+func (c *Connection) ensureMigrationsTable(ctx context.Context, table string) error {
+	if !identifierPattern.MatchString(table) {
+		return fmt.Errorf("%w: invalid table name %q", ErrInvalidQuery, table)
+	}
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version bigint, dirty boolean, applied_at timestamp) "+
+		"LOCATION '%s' TBLPROPERTIES ('table_type' = 'ICEBERG')", table, newCTASLocation(ctx, c.connector.config, table))
+	_, err := c.ExecContext(ctx, query, nil)
+	return err
+}
+
+// MigrationVersion is to get the migration version of the schema, and if the migration to it failed halfway,
+// from the Iceberg table, DefaultMigrationsTable if it's empty, which is created if it doesn't exist. The
+// version is NilMigrationVersion if no migration was applied. It is for migration tools like golang-migrate,
+// and is reached from database/sql with the *Connection passed to the function of sql.Conn.Raw.
+func (c *Connection) MigrationVersion(ctx context.Context, table string) (version int64, dirty bool, err error) {
+	if table == "" {
+		table = DefaultMigrationsTable
+	}
+	if err = c.ensureMigrationsTable(ctx, table); err != nil {
+		return NilMigrationVersion, false, err
+	}
+	// the version set by the last migration, not the one cached before it
+	rows, err := c.QueryContext(WithoutResultCache(ctx),
+		"SELECT version, dirty FROM "+table+" ORDER BY applied_at DESC LIMIT 1", nil)
+	if err != nil {
+		return NilMigrationVersion, false, err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 2)
+	if err = rows.Next(dest); err == io.EOF {
+		return NilMigrationVersion, false, nil
+	} else if err != nil {
+		return NilMigrationVersion, false, err
+	}
+	version, _ = dest[0].(int64)
+	dirty, _ = dest[1].(bool)
+	return version, dirty, nil
+}
+
+// SetMigrationVersion is to set the migration version of the schema, and if the migration to it is in progress
+// or failed halfway, in the Iceberg table, DefaultMigrationsTable if it's empty, which is created if it doesn't
+// exist. The row of the version is inserted before the ones of the versions before are deleted, so the table
+// always has the latest version, even if SetMigrationVersion fails halfway.
+// It is reached from database/sql with the *Connection passed to the function of sql.Conn.Raw.
+func (c *Connection) SetMigrationVersion(ctx context.Context, table string, version int64, dirty bool) error {
+	if table == "" {
+		table = DefaultMigrationsTable
+	}
+	if err := c.ensureMigrationsTable(ctx, table); err != nil {
+		return err
+	}
+	appliedAt, _ := sqlLiteral(time.Now())
+	query := fmt.Sprintf("INSERT INTO %s VALUES (%d, %t, %s)", table, version, dirty, appliedAt)
+	if _, err := c.ExecContext(ctx, query, nil); err != nil {
+		return err
+	}
+	if _, err := c.ExecContext(ctx, "DELETE FROM "+table+" WHERE applied_at < "+appliedAt, nil); err != nil {
+		return err
+	}
+	c.connector.tracer.Log(InfoLevel, "migration version set",
+		zap.String("table", table),
+		zap.Int64("version", version),
+		zap.Bool("dirty", dirty))
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// migrationAthenaClient returns the version rows for the SELECT queries of the migration version.
+type migrationAthenaClient struct {
+	queryContextAthenaClient
+	versions [][]*string
+}
+
+func (m *migrationAthenaClient) GetQueryResultsWithContext(ctx aws.Context, input *athena.GetQueryResultsInput,
+	o ...request.Option) (*athena.GetQueryResultsOutput, error) {
+	last := m.inputs[len(m.inputs)-1]
+	if !strings.HasPrefix(*last.QueryString, "SELECT version, dirty") {
+		return m.queryContextAthenaClient.GetQueryResultsWithContext(ctx, input, o...)
+	}
+	return newHeaderResultPage([]*string{aws.String("version"), aws.String("dirty")},
+		[]string{"bigint", "boolean"}, m.versions), nil
+}
+
+func TestIdempotentDDL(t *testing.T) {
+	for _, c := range []struct {
+		query    string
+		expected string
+	}{
+		{"CREATE TABLE db.t (id int) LOCATION 's3://b/t'", "CREATE TABLE IF NOT EXISTS db.t (id int) LOCATION 's3://b/t'"},
+		{"create external table `t`(id int)", "create external table IF NOT EXISTS `t`(id int)"},
+		{"CREATE DATABASE db", "CREATE DATABASE IF NOT EXISTS db"},
+		{"\nCREATE SCHEMA db COMMENT 'x'", "\nCREATE SCHEMA IF NOT EXISTS db COMMENT 'x'"},
+		{"CREATE VIEW v AS SELECT 1", "CREATE OR REPLACE VIEW v AS SELECT 1"},
+		{"DROP TABLE db.t", "DROP TABLE IF EXISTS db.t"},
+		{"drop view v", "drop view IF EXISTS v"},
+		{"ALTER TABLE t ADD PARTITION (dt = '2022-05-01')", "ALTER TABLE t ADD IF NOT EXISTS PARTITION (dt = '2022-05-01')"},
+		// the statements already idempotent, CTAS and the other statements are left as they are
+		{"CREATE TABLE IF NOT EXISTS t (id int)", "CREATE TABLE IF NOT EXISTS t (id int)"},
+		{"CREATE OR REPLACE VIEW v AS SELECT 1", "CREATE OR REPLACE VIEW v AS SELECT 1"},
+		{"DROP TABLE IF EXISTS t", "DROP TABLE IF EXISTS t"},
+		{"ALTER TABLE t ADD IF NOT EXISTS PARTITION (dt = '1')", "ALTER TABLE t ADD IF NOT EXISTS PARTITION (dt = '1')"},
+		{"CREATE TABLE t WITH (format = 'PARQUET') AS SELECT 1", "CREATE TABLE t WITH (format = 'PARQUET') AS SELECT 1"},
+		{"ALTER TABLE t ADD COLUMNS (c int)", "ALTER TABLE t ADD COLUMNS (c int)"},
+		{"SELECT 'DROP TABLE t'", "SELECT 'DROP TABLE t'"},
+	} {
+		assert.Equal(t, c.expected, idempotentDDL(c.query), c.query)
+	}
+}
+
+func TestConnection_ExecContext_MigrationMode(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetMigrationMode(true)
+	assert.True(t, c.connector.config.IsMultiStatements())
+	assert.True(t, c.connector.config.IsFakeTransactions())
+
+	tx, err := c.Begin()
+	assert.Nil(t, err)
+	script := "CREATE DATABASE db;\nDROP TABLE db.t;\nINSERT INTO db.u VALUES (1);"
+	_, err = c.ExecContext(context.Background(), script, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Commit())
+	assert.Equal(t, []string{"CREATE DATABASE IF NOT EXISTS db", "DROP TABLE IF EXISTS db.t",
+		"INSERT INTO db.u VALUES (1)"}, queryStrings(athenaClient))
+}
+
+func TestConnection_MigrationVersion(t *testing.T) {
+	athenaClient := &migrationAthenaClient{queryContextAthenaClient: queryContextAthenaClient{
+		mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	ctx := context.Background()
+
+	version, dirty, err := c.MigrationVersion(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(NilMigrationVersion), version)
+	assert.False(t, dirty)
+	queries := queryStrings(&athenaClient.queryContextAthenaClient)
+	if assert.Len(t, queries, 2) {
+		assert.True(t, strings.HasPrefix(queries[0], "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint, "+
+			"dirty boolean, applied_at timestamp) LOCATION '"), queries[0])
+		assert.True(t, strings.HasSuffix(queries[0], "' TBLPROPERTIES ('table_type' = 'ICEBERG')"), queries[0])
+		assert.Equal(t, "SELECT version, dirty FROM schema_migrations ORDER BY applied_at DESC LIMIT 1", queries[1])
+	}
+
+	athenaClient.inputs = nil
+	assert.Nil(t, c.SetMigrationVersion(ctx, "db.migrations", 3, true))
+	queries = queryStrings(&athenaClient.queryContextAthenaClient)
+	if assert.Len(t, queries, 3) {
+		assert.True(t, strings.HasPrefix(queries[1], "INSERT INTO db.migrations VALUES (3, true, TIMESTAMP '"), queries[1])
+		appliedAt := strings.TrimSuffix(strings.TrimPrefix(queries[1], "INSERT INTO db.migrations VALUES (3, true, "), ")")
+		assert.Equal(t, "DELETE FROM db.migrations WHERE applied_at < "+appliedAt, queries[2])
+	}
+
+	athenaClient.versions = [][]*string{{aws.String("3"), aws.String("true")}}
+	version, dirty, err = c.MigrationVersion(ctx, "db.migrations")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), version)
+	assert.True(t, dirty)
+
+	assert.NotNil(t, c.SetMigrationVersion(ctx, "t; DROP TABLE x", 1, false))
+}
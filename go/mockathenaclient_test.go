@@ -127,8 +127,8 @@ func (m *mockAthenaClient) CreateWorkGroup(*athena.CreateWorkGroupInput) (
 	return &a, nil
 }
 
-func (m *mockAthenaClient) StartQueryExecution(s *athena.
-	StartQueryExecutionInput) (*athena.StartQueryExecutionOutput, error) {
+func (m *mockAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.
+	StartQueryExecutionInput, opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
 	if strings.ToLower(*s.QueryString) == "select 1" { // Ping
 		qid := "PING_OK_QID"
 		return &athena.StartQueryExecutionOutput{
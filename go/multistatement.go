@@ -0,0 +1,117 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMultiStatementsArgs is returned when execution parameters are passed with multiple statements,
+// as they can't be split between the statements.
+var ErrMultiStatementsArgs = errors.New("execution parameters can't be used with multiple statements")
+
+// StatementError is the error of a statement of a script run by ExecContext with multi statements set in Config.
+// The statements before it were executed, and the ones after it were not.
+type StatementError struct {
+	// Index is the index of the failed statement in the script, from 0.
+	Index int
+	// Statement is the failed statement.
+	Statement string
+	// RowsAffected is the number of rows written by the statements executed before.
+	RowsAffected int64
+	Err          error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %d failed: %s", e.Index+1, e.Err.Error())
+}
+
+// Unwrap is to get the error of the statement.
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// splitStatements is to split a script into its statements separated by semicolons, skipping the semicolons
+// in string literals, quoted identifiers and comments. Empty statements and the ones of comments only are dropped.
+func splitStatements(script string) []string {
+	var statements []string
+	start, hasCode := 0, false
+	add := func(end int) {
+		if hasCode {
+			statements = append(statements, strings.TrimSpace(script[start:end]))
+		}
+		start, hasCode = end+1, false
+	}
+	for i := 0; i < len(script); i++ {
+		switch ch := script[i]; {
+		case ch == '\'' || ch == '"' || ch == '`':
+			hasCode = true
+			// quotes are escaped by doubling them, which closes and opens the quotes again, backslashes are
+			// characters like the others
+			for i++; i < len(script) && script[i] != ch; i++ {
+			}
+		case ch == '-' && strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case ch == '/' && strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(script)
+			}
+		case ch == ';':
+			add(i)
+		case ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r':
+			hasCode = true
+		}
+	}
+	add(len(script))
+	return statements
+}
+
+// execStatements is to execute the statements in order, until one fails.
+// The rows affected by the statements are summed up, and the query execution ID is of the last statement.
+func (c *Connection) execStatements(ctx context.Context, statements []string,
+	namedArgs []driver.NamedValue) (driver.Result, error) {
+	if len(namedArgs) > 0 {
+		return nil, ErrMultiStatementsArgs
+	}
+	var rowsAffected int64
+	var queryID string
+	for i, statement := range statements {
+		result, err := c.ExecContext(ctx, statement, nil)
+		if err != nil {
+			c.connector.tracer.Scope().Counter(DriverName + ".failure.multistatements").Inc(1)
+			return nil, &StatementError{Index: i, Statement: statement, RowsAffected: rowsAffected, Err: err}
+		}
+		n, _ := result.RowsAffected()
+		rowsAffected += n
+		queryID = result.(AthenaResult).QueryExecutionID()
+	}
+	return AthenaResult{lastInsertedID: -1, rowAffected: rowsAffected, queryID: queryID}, nil
+}
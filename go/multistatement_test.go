@@ -0,0 +1,89 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	assert.Equal(t, []string{"SELECT 1"}, splitStatements("SELECT 1;"))
+	assert.Equal(t, []string{
+		"CREATE TABLE t (a string)",
+		"INSERT INTO t VALUES ('a;b'), ('it''s;'), ('C:\\'), (';')",
+		"-- repair\nMSCK REPAIR TABLE \"t;\"",
+		"SELECT /* ; */ 1",
+	}, splitStatements("CREATE TABLE t (a string);\n"+
+		"INSERT INTO t VALUES ('a;b'), ('it''s;'), ('C:\\'), (';');\n"+
+		"-- repair\nMSCK REPAIR TABLE \"t;\";;\n"+
+		"SELECT /* ; */ 1;\n"+
+		"-- the end; done\n"))
+	assert.Empty(t, splitStatements(" ; -- nothing\n"))
+}
+
+func TestConnection_ExecContext_MultiStatements(t *testing.T) {
+	athenaClient := &ctasAthenaClient{queryContextAthenaClient: queryContextAthenaClient{
+		mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	script := "CREATE TABLE t AS SELECT 1 AS a; INSERT INTO t VALUES (2); MSCK REPAIR TABLE t"
+
+	// scripts are run as a single query by default
+	_, err := c.ExecContext(context.Background(), script, nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 1)
+
+	c.connector.config.SetMultiStatements(true)
+	result, err := c.ExecContext(context.Background(), script, nil)
+	assert.Nil(t, err)
+	n, _ := result.RowsAffected()
+	assert.Equal(t, int64(3*42), n)
+	assert.Equal(t, "PING_OK_QID", result.(AthenaResult).QueryExecutionID())
+	var queries []string
+	for _, input := range athenaClient.inputs[1:] {
+		queries = append(queries, *input.QueryString)
+	}
+	assert.Equal(t, []string{"CREATE TABLE t AS SELECT 1 AS a", "INSERT INTO t VALUES (2)", "MSCK REPAIR TABLE t"},
+		queries)
+
+	// the statements after a failed one are not run
+	athenaClient.failing = true
+	_, err = c.ExecContext(context.Background(), "INSERT INTO t VALUES (3); "+script, nil)
+	var statementErr *StatementError
+	assert.True(t, errors.As(err, &statementErr))
+	assert.Equal(t, 1, statementErr.Index)
+	assert.Equal(t, "CREATE TABLE t AS SELECT 1 AS a", statementErr.Statement)
+	assert.Equal(t, int64(42), statementErr.RowsAffected)
+	assert.Equal(t, ErrTestMockFailedByAthena, errors.Unwrap(err))
+	assert.Len(t, athenaClient.inputs, 6)
+
+	c.connector.config.SetExecutionParameters(true)
+	_, err = c.ExecContext(context.Background(), "INSERT INTO t VALUES (?); SELECT 1",
+		[]driver.NamedValue{{Ordinal: 1, Value: int64(1)}})
+	assert.Equal(t, ErrMultiStatementsArgs, err)
+}
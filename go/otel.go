@@ -0,0 +1,63 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the OpenTelemetry spans of the driver.
+const tracerName = "github.com/datasapiens/athenadriver"
+
+// startSpan is to start an OpenTelemetry span with the tracer provider in config. Without a tracer provider,
+// the span is a no-op and ctx is returned as it is.
+func startSpan(ctx context.Context, config *Config, name string,
+	attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if config == nil || config.GetTracerProvider() == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return config.GetTracerProvider().Tracer(tracerName, trace.WithInstrumentationVersion(DriverVersion)).
+		Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan is to end span, with the error status if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceparentComment is to get the W3C trace context of the span in ctx as a query comment, so the query
+// can be correlated with its trace in CloudTrail, or "" if there is no span in ctx.
+func traceparentComment(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("/* traceparent=00-%s-%s-%s */ ", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
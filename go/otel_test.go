@@ -0,0 +1,143 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingSpan records a span, the other methods are the ones of a no-op span.
+type recordingSpan struct {
+	trace.Span
+	name  string
+	sc    trace.SpanContext
+	attrs []attribute.KeyValue
+	err   error
+	ended bool
+}
+
+func (s *recordingSpan) SpanContext() trace.SpanContext { return s.sc }
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) { s.attrs = append(s.attrs, kv...) }
+
+func (s *recordingSpan) RecordError(err error, options ...trace.EventOption) { s.err = err }
+
+func (s *recordingSpan) End(options ...trace.SpanEndOption) { s.ended = true }
+
+func (s *recordingSpan) attr(key string) attribute.Value {
+	for _, kv := range s.attrs {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// recordingTracerProvider records the spans started by its tracers.
+type recordingTracerProvider struct {
+	trace.TracerProvider
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingTracer struct {
+	trace.Tracer
+	provider *recordingTracerProvider
+}
+
+func (p *recordingTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{provider: p}
+}
+
+func (p *recordingTracerProvider) names() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var names []string
+	for _, s := range p.spans {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string,
+	opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+	t.provider.mu.Lock()
+	defer t.provider.mu.Unlock()
+	span := &recordingSpan{
+		Span:  trace.SpanFromContext(context.Background()),
+		name:  name,
+		attrs: config.Attributes(),
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0xab},
+			SpanID:     trace.SpanID{byte(len(t.provider.spans) + 1)},
+			TraceFlags: trace.FlagsSampled,
+		}),
+	}
+	t.provider.spans = append(t.provider.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func TestStartSpan_NoTracerProvider(t *testing.T) {
+	ctx := context.Background()
+	spanCtx, span := startSpan(ctx, NewNoOpsConfig(), "x")
+	assert.Equal(t, ctx, spanCtx)
+	assert.False(t, span.SpanContext().IsValid())
+	endSpan(span, errors.New("ignored"))
+	assert.Equal(t, "", traceparentComment(spanCtx))
+}
+
+func TestConnection_QueryContext_Tracing(t *testing.T) {
+	provider := &recordingTracerProvider{}
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	connector := NewConnectorWithClient(NewNoOpsConfig(), athenaClient)
+	connector.config.SetTracerProvider(provider)
+	conn, err := connector.Connect(context.Background())
+	assert.Nil(t, err)
+
+	rows, err := conn.(*Connection).QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Equal(t, []string{"athenadriver.Connect", "athena.StartQueryExecution", "athena.WaitForQueryExecution",
+		"athena.GetQueryResults"}, provider.names())
+	for _, span := range provider.spans {
+		assert.True(t, span.ended)
+		assert.Nil(t, span.err)
+	}
+	start := provider.spans[1]
+	assert.Equal(t, "PING_OK_QID", start.attr("athena.query_execution_id").AsString())
+	assert.Equal(t, DefaultWGName, start.attr("athena.workgroup").AsString())
+	assert.Equal(t, "/* traceparent=00-ab000000000000000000000000000000-0200000000000000-01 */ SELECT 1",
+		*athenaClient.inputs[0].QueryString)
+
+	// the query text is kept for result reuse
+	assert.Nil(t, connector.config.SetResultReuse(true, 60))
+	_, err = conn.(*Connection).QueryContext(context.Background(), "SELECT 2", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT 2", *athenaClient.inputs[1].QueryString)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// MaxPartitionsPerStatement is the max number of partitions added by each ALTER TABLE ADD PARTITION statement
+// of Connection.AddPartitions, which is the max number of partitions Athena creates in the Glue Data Catalog
+// at once.
+const MaxPartitionsPerStatement = 100
+
+// PartitionProgress gets the number of partitions added so far by Connection.AddPartitions, out of total.
+type PartitionProgress func(added int, total int)
+
+// partitionSpec is to get the PARTITION clause of a partition path, like (dt = '2022-05-01', country = 'us')
+// for dt=2022-05-01/country=us.
+func partitionSpec(path string) (string, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	columns := make([]string, len(parts))
+	for i, part := range parts {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || !identifierPattern.MatchString(kv[0]) || strings.Contains(kv[0], ".") {
+			return "", fmt.Errorf("%w: invalid partition %q", ErrInvalidQuery, path)
+		}
+		columns[i] = fmt.Sprintf("%s = '%s'", kv[0], strings.Replace(kv[1], "'", "''", -1))
+	}
+	return "(" + strings.Join(columns, ", ") + ")", nil
+}
+
+// addPartitionsQuery is an ALTER TABLE ADD PARTITION statement, and the number of partitions it adds.
+type addPartitionsQuery struct {
+	query      string
+	partitions int
+}
+
+// addPartitionsQueries is to build the ALTER TABLE ADD PARTITION statements of table, each adding up to
+// MaxPartitionsPerStatement partitions and within MAXQueryStringLength. The partitions are the paths like
+// dt=2022-05-01/country=us, with their S3 location, or location followed by the path if it's empty.
+func addPartitionsQueries(table string, partitions map[string]string, location string) (
+	[]addPartitionsQuery, error) {
+	if !identifierPattern.MatchString(table) {
+		return nil, fmt.Errorf("%w: invalid table name %q", ErrInvalidQuery, table)
+	}
+	paths := make([]string, 0, len(partitions))
+	for path := range partitions {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	prefix := "ALTER TABLE " + table + " ADD IF NOT EXISTS"
+	var queries []addPartitionsQuery
+	var b strings.Builder
+	count := 0
+	for _, path := range paths {
+		spec, err := partitionSpec(path)
+		if err != nil {
+			return nil, err
+		}
+		partitionLocation := partitions[path]
+		if partitionLocation == "" {
+			partitionLocation = strings.TrimSuffix(location, "/") + "/" + strings.Trim(path, "/") + "/"
+		}
+		if !strings.HasPrefix(partitionLocation, "s3://") {
+			return nil, fmt.Errorf("%w: partition %q location must start with s3://", ErrInvalidQuery, path)
+		}
+		clause := fmt.Sprintf(" PARTITION %s LOCATION '%s'", spec, strings.Replace(partitionLocation, "'", "''", -1))
+		if len(prefix)+len(clause) >= MAXQueryStringLength {
+			return nil, fmt.Errorf("%w: partition %q is too long for a query", ErrInvalidQuery, path)
+		}
+		if count > 0 && (count == MaxPartitionsPerStatement || b.Len()+len(clause) >= MAXQueryStringLength) {
+			queries = append(queries, addPartitionsQuery{b.String(), count})
+			b.Reset()
+			count = 0
+		}
+		if count == 0 {
+			b.WriteString(prefix)
+		}
+		b.WriteString(clause)
+		count++
+	}
+	if count > 0 {
+		queries = append(queries, addPartitionsQuery{b.String(), count})
+	}
+	return queries, nil
+}
+
+// AddPartitions is to add the partitions of table, which are the paths like dt=2022-05-01/country=us with
+// their S3 location, or location followed by the path if it's empty. The partitions which exist already
+// are skipped. They are added in batches of MaxPartitionsPerStatement, and the PartitionProgress in ctx set
+// with WithPartitionProgress gets the progress after each of them. If a batch fails, the partitions of the
+// previous ones stay added.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) AddPartitions(ctx context.Context, table string, partitions map[string]string,
+	location string) error {
+	queries, err := addPartitionsQueries(table, partitions, location)
+	if err != nil {
+		return err
+	}
+	var obs = c.connector.tracer
+	progress := getPartitionProgress(ctx)
+	added := 0
+	for _, q := range queries {
+		if _, err := c.ExecContext(ctx, q.query, nil); err != nil {
+			obs.Scope().Counter(DriverName + ".failure.addpartitions").Inc(1)
+			return err
+		}
+		added += q.partitions
+		obs.Log(DebugLevel, "partitions added",
+			zap.String("table", table),
+			zap.Int("added", added),
+			zap.Int("total", len(partitions)))
+		if progress != nil {
+			progress(added, len(partitions))
+		}
+	}
+	obs.Scope().Counter(DriverName + ".addpartitions").Inc(int64(added))
+	return nil
+}
+
+// RepairTable is to add the partitions of table found in its S3 location, in Hive layout, with
+// MSCK REPAIR TABLE. It can take long for many partitions, which AddPartitions adds faster.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) RepairTable(ctx context.Context, table string) error {
+	if !identifierPattern.MatchString(table) {
+		return fmt.Errorf("%w: invalid table name %q", ErrInvalidQuery, table)
+	}
+	if _, err := c.ExecContext(ctx, "MSCK REPAIR TABLE "+table, nil); err != nil {
+		c.connector.tracer.Scope().Counter(DriverName + ".failure.repairtable").Inc(1)
+		return err
+	}
+	c.connector.tracer.Scope().Counter(DriverName + ".repairtable").Inc(1)
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// partitionAthenaClient fails the query failAt, counting from 1, and returns the row count of the others.
+type partitionAthenaClient struct {
+	ctasAthenaClient
+	failAt int
+}
+
+func (m *partitionAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	out, err := m.queryContextAthenaClient.StartQueryExecutionWithContext(ctx, s, opts...)
+	if len(m.inputs) == m.failAt {
+		out.QueryExecutionId = aws.String("QueryExecutionStateFailed_QID")
+	}
+	return out, err
+}
+
+func TestAddPartitionsQueries(t *testing.T) {
+	queries, err := addPartitionsQueries("db.t", map[string]string{
+		"dt=2022-05-02/country=us":   "",
+		"dt=2022-05-01/country=it's": "s3://other/2022-05-01/",
+	}, "s3://b/t/")
+	assert.Nil(t, err)
+	assert.Equal(t, []addPartitionsQuery{{
+		"ALTER TABLE db.t ADD IF NOT EXISTS" +
+			" PARTITION (dt = '2022-05-01', country = 'it''s') LOCATION 's3://other/2022-05-01/'" +
+			" PARTITION (dt = '2022-05-02', country = 'us') LOCATION 's3://b/t/dt=2022-05-02/country=us/'", 2,
+	}}, queries)
+
+	partitions := map[string]string{}
+	for i := 0; i < 2*MaxPartitionsPerStatement+1; i++ {
+		partitions[fmt.Sprintf("n=%03d", i)] = ""
+	}
+	queries, err = addPartitionsQueries("t", partitions, "s3://b/t")
+	assert.Nil(t, err)
+	if assert.Len(t, queries, 3) {
+		assert.Equal(t, MaxPartitionsPerStatement, queries[0].partitions)
+		assert.Equal(t, MaxPartitionsPerStatement, strings.Count(queries[1].query, " PARTITION ("))
+		assert.Equal(t, 1, queries[2].partitions)
+		assert.Equal(t, "ALTER TABLE t ADD IF NOT EXISTS PARTITION (n = '200') LOCATION 's3://b/t/n=200/'",
+			queries[2].query)
+	}
+
+	// the statements are within the max query length
+	long := strings.Repeat("x", MAXQueryStringLength/3)
+	queries, err = addPartitionsQueries("t", map[string]string{"a=1": "s3://b/" + long, "a=2": "s3://b/" + long,
+		"a=3": "s3://b/" + long}, "")
+	assert.Nil(t, err)
+	assert.Len(t, queries, 2)
+	// a statement of exactly the max query length is too long
+	fill := MAXQueryStringLength - len("ALTER TABLE t ADD IF NOT EXISTS") -
+		len(" PARTITION (a = '1') LOCATION 's3://b/"+long+"'") - len(" PARTITION (a = '2') LOCATION 's3://b/'")
+	queries, err = addPartitionsQueries("t", map[string]string{"a=1": "s3://b/" + long,
+		"a=2": "s3://b/" + strings.Repeat("y", fill)}, "")
+	assert.Nil(t, err)
+	if assert.Len(t, queries, 2) {
+		assert.True(t, len(queries[0].query) < MAXQueryStringLength)
+		assert.True(t, len(queries[1].query) < MAXQueryStringLength)
+	}
+
+	for _, c := range []struct{ table, path, location string }{
+		{"t; DROP TABLE x", "dt=1", ""},
+		{"t", "dt", ""},
+		{"t", "d.t=1", ""},
+		{"t", "dt=1", "hdfs://b/dt=1/"},
+		{"t", "dt=1", "s3://b/" + strings.Repeat("x", MAXQueryStringLength)},
+	} {
+		_, err = addPartitionsQueries(c.table, map[string]string{c.path: c.location}, "s3://b/t/")
+		assert.True(t, errors.Is(err, ErrInvalidQuery), c)
+	}
+}
+
+func TestConnection_AddPartitions(t *testing.T) {
+	athenaClient := &partitionAthenaClient{ctasAthenaClient: ctasAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	partitions := map[string]string{}
+	for i := 0; i < MaxPartitionsPerStatement+10; i++ {
+		partitions[fmt.Sprintf("n=%03d", i)] = ""
+	}
+	var progress [][2]int
+	ctx := WithPartitionProgress(context.Background(), func(added int, total int) {
+		progress = append(progress, [2]int{added, total})
+	})
+	assert.Nil(t, c.AddPartitions(ctx, "db.t", partitions, "s3://b/t/"))
+	assert.Len(t, athenaClient.inputs, 2)
+	assert.Equal(t, [][2]int{{MaxPartitionsPerStatement, 110}, {110, 110}}, progress)
+
+	// the partitions of the batches before the failed one stay added
+	athenaClient.inputs, progress = nil, nil
+	athenaClient.failAt = 2
+	assert.Equal(t, ErrTestMockFailedByAthena, c.AddPartitions(ctx, "db.t", partitions, "s3://b/t/"))
+	assert.Equal(t, [][2]int{{MaxPartitionsPerStatement, 110}}, progress)
+
+	assert.True(t, errors.Is(c.AddPartitions(ctx, "db.t", map[string]string{"dt": ""}, "s3://b/t/"), ErrInvalidQuery))
+}
+
+func TestConnection_RepairTable(t *testing.T) {
+	athenaClient := &partitionAthenaClient{ctasAthenaClient: ctasAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	assert.Nil(t, c.RepairTable(context.Background(), "db.t"))
+	assert.Equal(t, "MSCK REPAIR TABLE db.t", *athenaClient.inputs[0].QueryString)
+	assert.True(t, errors.Is(c.RepairTable(context.Background(), "t; DROP TABLE x"), ErrInvalidQuery))
+	athenaClient.failAt = 2
+	assert.Equal(t, ErrTestMockFailedByAthena, c.RepairTable(context.Background(), "db.t"))
+}
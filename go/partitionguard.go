@@ -0,0 +1,160 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"go.uber.org/zap"
+)
+
+// PartitionGuardMode is what the driver does when a SELECT reads a partitioned table without a partition filter.
+type PartitionGuardMode string
+
+const (
+	// PartitionGuardOff doesn't check the partition filters of the queries. It is the default mode.
+	PartitionGuardOff PartitionGuardMode = ""
+
+	// PartitionGuardWarn logs a warning for the tables read without a partition filter, and runs the query.
+	PartitionGuardWarn PartitionGuardMode = "warn"
+
+	// PartitionGuardStrict fails the queries reading a table without a partition filter with a
+	// *PartitionFilterError, before they are started.
+	PartitionGuardStrict PartitionGuardMode = "strict"
+)
+
+var (
+	// stringLiteralPattern matches the string literals of a query, which can't be partition filters.
+	stringLiteralPattern = regexp.MustCompile(`'(?:[^']|'')*'`)
+	// wherePattern matches the first WHERE of a query, after which the partition filters are.
+	wherePattern = regexp.MustCompile(`(?i)\bwhere\b`)
+)
+
+// getPartitionKeys is to get the partition keys of the table from its Glue metadata, cached by the connection.
+// A table which doesn't exist, like the name of a CTE, has none.
+func (c *Connection) getPartitionKeys(ctx context.Context, database string, table string) ([]string, error) {
+	name := database + "." + table
+	if keys, ok := c.partitionKeys[name]; ok {
+		return keys, nil
+	}
+	// the API, not Connection.GetTableMetadata, which counts the names of CTEs as failures
+	out, err := c.athenaAPI.GetTableMetadataWithContext(ctx, &athena.GetTableMetadataInput{
+		CatalogName:  aws.String(getCatalog(ctx, c.connector.config)),
+		DatabaseName: aws.String(database),
+		TableName:    aws.String(table),
+	})
+	var keys []string
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != athena.ErrCodeMetadataException {
+			return nil, err
+		}
+	} else if out.TableMetadata != nil {
+		for _, key := range out.TableMetadata.PartitionKeys {
+			keys = append(keys, aws.StringValue(key.Name))
+		}
+	}
+	if c.partitionKeys == nil {
+		c.partitionKeys = map[string][]string{}
+	}
+	c.partitionKeys[name] = keys
+	return keys, nil
+}
+
+// LintPartitionFilters is to find the partitioned tables in the FROM and JOIN clauses of the query which it reads
+// without a filter on any of their partition keys, and so scans whole. The partition keys are from the Glue
+// metadata of the tables. It is lenient: a partition key is taken as filtered if it is anywhere after the first
+// WHERE of the query, so only the tables surely read whole are found.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) LintPartitionFilters(ctx context.Context, query string) ([]*PartitionFilterError, error) {
+	db := getDatabase(ctx, c.connector.config)
+	query = multiLineCommentPattern.ReplaceAllString(query, "")
+	query = oneLineCommentPattern.ReplaceAllString(query, "")
+	query = stringLiteralPattern.ReplaceAllString(query, "''")
+	filters := ""
+	if loc := wherePattern.FindStringIndex(query); loc != nil {
+		filters = query[loc[1]:]
+	}
+	var missing []*PartitionFilterError
+	linted := map[string]bool{}
+	for _, m := range getTableNamePattern.FindAllStringSubmatch(query, -1) {
+		database, table := splitTableName(m[1], db)
+		if linted[database+"."+table] {
+			continue
+		}
+		linted[database+"."+table] = true
+		keys, err := c.getPartitionKeys(ctx, database, table)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		filtered := false
+		for _, key := range keys {
+			if containsName(filters, key) {
+				filtered = true
+				break
+			}
+		}
+		if !filtered {
+			missing = append(missing, &PartitionFilterError{Database: database, Table: table, PartitionKeys: keys})
+		}
+	}
+	return missing, nil
+}
+
+// partitionGuard is to check the partition filters of a SELECT in the partition guard mode of ctx or Config.
+// Failures of the metadata API don't fail the query.
+func (c *Connection) partitionGuard(ctx context.Context, obs *DriverTracer, query string) error {
+	mode := getPartitionGuardMode(ctx, c.connector.config)
+	if mode == PartitionGuardOff || isFederatedCatalog(getCatalog(ctx, c.connector.config)) {
+		return nil
+	}
+	i := skipSpaceAndComments(query, 0)
+	if !hasKeyword(query[i:], "select") && !hasKeyword(query[i:], "with") {
+		return nil
+	}
+	missing, err := c.LintPartitionFilters(ctx, query)
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.querycontext.partitionguard").Inc(1)
+		obs.Log(WarnLevel, "partition guard failed", zap.String("error", err.Error()))
+		return nil
+	}
+	for _, e := range missing {
+		obs.Log(WarnLevel, "query reads a partitioned table without a partition filter",
+			zap.String("database", e.Database),
+			zap.String("table", e.Table),
+			zap.Strings("partitionKeys", e.PartitionKeys))
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if mode == PartitionGuardStrict {
+		obs.Scope().Counter(DriverName + ".failure.querycontext.partitionfilter").Inc(1)
+		return missing[0]
+	}
+	obs.Scope().Counter(DriverName + ".querycontext.partitionfilter").Inc(1)
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// partitionGuardAthenaClient has the partition keys of the tables by database.table, fails for the table broken,
+// and counts the table metadata fetched.
+type partitionGuardAthenaClient struct {
+	queryContextAthenaClient
+	partitionKeys map[string][]string
+	fetched       int
+}
+
+func (m *partitionGuardAthenaClient) GetTableMetadataWithContext(ctx aws.Context, input *athena.GetTableMetadataInput,
+	opts ...request.Option) (*athena.GetTableMetadataOutput, error) {
+	m.fetched++
+	if *input.TableName == "broken" {
+		return nil, ErrTestMockGeneric
+	}
+	keys, ok := m.partitionKeys[*input.DatabaseName+"."+*input.TableName]
+	if !ok {
+		return nil, awserr.New(athena.ErrCodeMetadataException, "table not found", nil)
+	}
+	metadata := &athena.TableMetadata{Name: input.TableName}
+	for _, key := range keys {
+		metadata.PartitionKeys = append(metadata.PartitionKeys, &athena.Column{Name: aws.String(key)})
+	}
+	return &athena.GetTableMetadataOutput{TableMetadata: metadata}, nil
+}
+
+func newPartitionGuardConnection() (*Connection, *partitionGuardAthenaClient) {
+	athenaClient := &partitionGuardAthenaClient{
+		queryContextAthenaClient: newQueryContextAthenaClient(),
+		partitionKeys: map[string][]string{
+			"db.events":    {"year", "dt"},
+			"db.users":     nil,
+			"default.logs": {"dt"},
+		},
+	}
+	return newMockConnection(athenaClient), athenaClient
+}
+
+func TestConfig_SetPartitionGuardMode(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, PartitionGuardOff, testConf.GetPartitionGuardMode())
+	testConf.SetPartitionGuardMode(PartitionGuardStrict)
+	assert.Equal(t, PartitionGuardStrict, testConf.GetPartitionGuardMode())
+	testConf.SetPartitionGuardMode("unknown")
+	assert.Equal(t, PartitionGuardOff, testConf.GetPartitionGuardMode())
+	testConf.SetPartitionGuardMode(PartitionGuardOff)
+	assert.Equal(t, PartitionGuardOff, testConf.GetPartitionGuardMode())
+}
+
+func TestConnection_LintPartitionFilters(t *testing.T) {
+	c, athenaClient := newPartitionGuardConnection()
+	ctx := context.Background()
+	for _, q := range []struct {
+		query   string
+		missing []string
+	}{
+		{"SELECT * FROM db.events", []string{"db.events"}},
+		{"SELECT * FROM db.events WHERE DT = '2022-05-01'", nil},
+		{"SELECT * FROM db.events e JOIN db.users u ON e.id = u.id WHERE e.year = 2022", nil},
+		{"SELECT dt FROM db.events WHERE id = 'dt' -- AND dt = '1'", []string{"db.events"}},
+		{"SELECT * FROM logs JOIN db.events ON logs.id = events.id WHERE logs.dt > '1'", nil},
+		{"WITH x AS (SELECT * FROM db.events) SELECT * FROM x JOIN logs ON TRUE", []string{"db.events", "default.logs"}},
+		{"SELECT * FROM db.users", nil},
+	} {
+		missing, err := c.LintPartitionFilters(ctx, q.query)
+		assert.Nil(t, err, q.query)
+		var tables []string
+		for _, e := range missing {
+			tables = append(tables, e.Database+"."+e.Table)
+		}
+		assert.Equal(t, q.missing, tables, q.query)
+	}
+	// the partition keys of db.events, db.users, default.logs and the CTE x are cached
+	assert.Equal(t, 4, athenaClient.fetched)
+
+	missing, err := c.LintPartitionFilters(ctx, "SELECT * FROM db.events")
+	assert.Nil(t, err)
+	if assert.Len(t, missing, 1) {
+		assert.Equal(t, []string{"year", "dt"}, missing[0].PartitionKeys)
+		assert.True(t, errors.Is(missing[0], ErrPartitionFilterMissing))
+		assert.Equal(t, "query reads table db.events without a filter on its partition keys year, dt",
+			missing[0].Error())
+	}
+	_, err = c.LintPartitionFilters(ctx, "SELECT * FROM db.broken")
+	assert.Equal(t, ErrTestMockGeneric, err)
+}
+
+func TestConnection_QueryContext_PartitionGuard(t *testing.T) {
+	c, athenaClient := newPartitionGuardConnection()
+	ctx := context.Background()
+	c.connector.config.SetPartitionGuardMode(PartitionGuardStrict)
+
+	_, err := c.QueryContext(ctx, "SELECT * FROM db.events", nil)
+	assert.True(t, errors.Is(err, ErrPartitionFilterMissing))
+	var filterErr *PartitionFilterError
+	if assert.True(t, errors.As(err, &filterErr)) {
+		assert.Equal(t, "events", filterErr.Table)
+	}
+	assert.Empty(t, athenaClient.inputs)
+
+	for _, query := range []string{
+		"SELECT * FROM db.events WHERE dt = '2022-05-01'",
+		"INSERT INTO db.users SELECT * FROM db.events",
+		// the failures of the metadata API don't fail the queries
+		"SELECT * FROM db.broken",
+	} {
+		_, err = c.QueryContext(ctx, query, nil)
+		assert.Nil(t, err, query)
+	}
+	_, err = c.QueryContext(WithPartitionGuardMode(ctx, PartitionGuardOff), "SELECT * FROM db.events", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 4)
+
+	c.connector.config.SetPartitionGuardMode(PartitionGuardWarn)
+	_, err = c.QueryContext(ctx, "/* full scan */ SELECT * FROM db.events", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 5)
+}
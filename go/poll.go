@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// PollStrategy is to decide how long to wait between two status checks of a running query.
+type PollStrategy interface {
+	// Interval is the wait after the status check n of a query, counting from 0.
+	Interval(n int) time.Duration
+}
+
+// PollMode is the built-in poll strategy set in DSN.
+type PollMode string
+
+const (
+	// PollModeBackoff waits twice as long after each status check, from the poll interval up to the max
+	// poll interval, with a jitter of 20%. It is the default mode, so short queries complete quickly
+	// and long ones are not polled too often.
+	PollModeBackoff PollMode = "backoff"
+
+	// PollModeFixed waits the poll interval after each status check.
+	PollModeFixed PollMode = "fixed"
+)
+
+// FixedPoll is the PollStrategy waiting the same interval after each status check.
+type FixedPoll time.Duration
+
+// Interval is to implement PollStrategy.
+func (p FixedPoll) Interval(n int) time.Duration {
+	return time.Duration(p)
+}
+
+// BackoffPoll is the PollStrategy waiting exponentially longer after each status check.
+type BackoffPoll struct {
+	// Initial is the wait after the first status check.
+	Initial time.Duration
+	// Max caps the wait, DefaultPollMaxInterval seconds if it is not above 0.
+	Max time.Duration
+	// Multiplier is the growth of the wait after each status check, 2 if it is not above 1.
+	Multiplier float64
+	// Jitter is the fraction the wait is randomly changed by, so concurrent queries don't poll together.
+	Jitter float64
+}
+
+// Interval is to implement PollStrategy.
+func (p BackoffPoll) Interval(n int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	maxWait := float64(p.Max)
+	if maxWait <= 0 {
+		maxWait = float64(DefaultPollMaxInterval * time.Second)
+	}
+	// the wait is capped before the conversion, math.Pow overflows the durations after a few hundred checks
+	d := math.Min(float64(p.Initial)*math.Pow(multiplier, float64(n)), maxWait)
+	if p.Jitter > 0 {
+		d = math.Min(d*(1+p.Jitter*(2*rand.Float64()-1)), maxWait)
+	}
+	return time.Duration(d)
+}
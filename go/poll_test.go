@@ -0,0 +1,74 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffPoll_Interval(t *testing.T) {
+	p := BackoffPoll{Initial: 100 * time.Millisecond, Max: time.Second}
+	assert.Equal(t, 100*time.Millisecond, p.Interval(0))
+	assert.Equal(t, 200*time.Millisecond, p.Interval(1))
+	assert.Equal(t, 800*time.Millisecond, p.Interval(3))
+	assert.Equal(t, time.Second, p.Interval(4))
+	assert.Equal(t, time.Second, p.Interval(1000))
+
+	// without a max, the wait is capped by the default one
+	p.Max = 0
+	assert.Equal(t, DefaultPollMaxInterval*time.Second, p.Interval(100))
+	assert.Equal(t, DefaultPollMaxInterval*time.Second, p.Interval(math.MaxInt32))
+	p.Jitter = 0.2
+	assert.True(t, p.Interval(math.MaxInt32) > 0)
+	p.Max, p.Jitter = time.Second, 0
+
+	p.Multiplier, p.Jitter = 3, 0.2
+	for i := 0; i < 100; i++ {
+		d := p.Interval(1)
+		assert.True(t, d >= 240*time.Millisecond && d <= 360*time.Millisecond, d)
+		assert.True(t, p.Interval(10) <= time.Second)
+	}
+}
+
+func TestConfig_GetPollStrategy(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, PollModeBackoff, testConf.GetPollMode())
+	assert.Equal(t, BackoffPoll{Initial: DefaultPollInitialInterval * time.Millisecond,
+		Max: DefaultPollMaxInterval * time.Second, Multiplier: 2, Jitter: 0.2}, testConf.GetPollStrategy())
+
+	testConf.SetPollInterval(time.Second)
+	testConf.SetPollMaxInterval(time.Minute)
+	assert.Equal(t, time.Minute, testConf.GetPollMaxInterval())
+	assert.Equal(t, BackoffPoll{Initial: time.Second, Max: time.Minute, Multiplier: 2, Jitter: 0.2},
+		testConf.GetPollStrategy())
+
+	testConf.SetPollMode(PollModeFixed)
+	assert.Equal(t, PollModeFixed, testConf.GetPollMode())
+	assert.Equal(t, FixedPoll(time.Second), testConf.GetPollStrategy())
+
+	testConf.SetPollStrategy(FixedPoll(time.Millisecond))
+	assert.Equal(t, FixedPoll(time.Millisecond), testConf.GetPollStrategy())
+	assert.Equal(t, time.Millisecond, testConf.GetPollStrategy().Interval(5))
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uber-go/tally"
+)
+
+var (
+	// PrometheusLatencyBuckets are the buckets of the histograms of the driver timers in Prometheus, like the
+	// query latency (unit second).
+	PrometheusLatencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+	// ScannedBytesBuckets are the buckets of the histogram of the bytes scanned by queries, from 10MB,
+	// the minimum Athena charges, to 10TB.
+	ScannedBytesBuckets = tally.ValueBuckets{1e7, 1e8, 1e9, 1e10, 1e11, 1e12, 1e13}
+)
+
+// prometheusReportInterval is how often the metrics of a Prometheus scope are reported to its registerer.
+const prometheusReportInterval = time.Second
+
+// prometheusScopes are the tally scopes reporting to Prometheus, by registerer. A registerer accepts each
+// metric once, so all connectors using a registerer share its scope.
+var prometheusScopes = struct {
+	sync.Mutex
+	m map[prometheus.Registerer]tally.Scope
+}{m: make(map[prometheus.Registerer]tally.Scope)}
+
+// getPrometheusScope is to get the scope reporting to registerer, creating it at first use.
+func getPrometheusScope(registerer prometheus.Registerer, obs *DriverTracer) tally.Scope {
+	prometheusScopes.Lock()
+	defer prometheusScopes.Unlock()
+	if scope, ok := prometheusScopes.m[registerer]; ok {
+		return scope
+	}
+	// the scope isn't closed, it reports for the lifetime of the process like the registerer
+	scope, _ := tally.NewRootScope(tally.ScopeOptions{
+		Reporter: newPrometheusReporter(registerer, obs),
+	}, prometheusReportInterval)
+	prometheusScopes.m[registerer] = scope
+	return scope
+}
+
+// prometheusReporter is a tally.StatsReporter registering the driver metrics with a Prometheus registerer.
+// Metric names are sanitized for Prometheus, like awsathena_query_queryexecutionstatesucceeded, and the tags
+// are labels, with prometheusLabelNames. Timers are histograms in seconds with PrometheusLatencyBuckets.
+type prometheusReporter struct {
+	registerer prometheus.Registerer
+	obs        *DriverTracer
+
+	mu         sync.Mutex
+	collectors map[string]prometheus.Collector
+}
+
+func newPrometheusReporter(registerer prometheus.Registerer, obs *DriverTracer) *prometheusReporter {
+	return &prometheusReporter{
+		registerer: registerer,
+		obs:        obs,
+		collectors: make(map[string]prometheus.Collector),
+	}
+}
+
+// prometheusName is to replace the characters Prometheus doesn't allow in names, like '.', with '_'.
+func prometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// prometheusLabelNames are the labels of all driver metrics, the tags of the tagged scopes of the driver, like
+// the one of Connection.queryTracer. A metric is registered once with its labels, and the same metric is
+// reported from scopes with different tags, so the missing tags are labels with an empty value.
+var prometheusLabelNames = []string{"caller", "database", "priority", "resultmode", "workgroup"}
+
+// prometheusLabels is to get the sanitized label names and values of tags, with prometheusLabelNames,
+// sorted by name.
+func prometheusLabels(tags map[string]string) ([]string, prometheus.Labels) {
+	labels := make(prometheus.Labels, len(tags)+len(prometheusLabelNames))
+	for _, name := range prometheusLabelNames {
+		labels[name] = ""
+	}
+	for k, v := range tags {
+		labels[prometheusName(k)] = v
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, labels
+}
+
+// collector is to get the collector of name, registering the one made by newCollector at first use.
+// It is nil if the registration failed, like if the labels of a metric change.
+func (r *prometheusReporter) collector(name string, labelNames []string,
+	newCollector func(name string) prometheus.Collector) prometheus.Collector {
+	name = prometheusName(name)
+	key := name + "+" + strings.Join(labelNames, ",")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.collectors[key]; ok {
+		return c
+	}
+	c := newCollector(name)
+	if err := r.registerer.Register(c); err != nil {
+		r.obs.Log(WarnLevel, "failed to register a Prometheus metric: "+err.Error())
+		c = nil
+	}
+	r.collectors[key] = c
+	return c
+}
+
+// ReportCounter is to add value to a counter, as tally reports counters by their change.
+func (r *prometheusReporter) ReportCounter(name string, tags map[string]string, value int64) {
+	labelNames, labels := prometheusLabels(tags)
+	c := r.collector(name, labelNames, func(name string) prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: name}, labelNames)
+	})
+	if c != nil {
+		c.(*prometheus.CounterVec).With(labels).Add(float64(value))
+	}
+}
+
+// ReportGauge is to set a gauge.
+func (r *prometheusReporter) ReportGauge(name string, tags map[string]string, value float64) {
+	labelNames, labels := prometheusLabels(tags)
+	c := r.collector(name, labelNames, func(name string) prometheus.Collector {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: name}, labelNames)
+	})
+	if c != nil {
+		c.(*prometheus.GaugeVec).With(labels).Set(value)
+	}
+}
+
+// ReportTimer is to observe interval in a histogram with PrometheusLatencyBuckets.
+func (r *prometheusReporter) ReportTimer(name string, tags map[string]string, interval time.Duration) {
+	r.observe(name, tags, PrometheusLatencyBuckets, interval.Seconds(), 1)
+}
+
+// ReportHistogramValueSamples is to observe the samples of a tally histogram bucket in a Prometheus histogram
+// with the same buckets. The samples are observed as the upper bound of their bucket, or the lower bound for
+// the last bucket, which has none.
+func (r *prometheusReporter) ReportHistogramValueSamples(name string, tags map[string]string,
+	buckets tally.Buckets, bucketLowerBound, bucketUpperBound float64, samples int64) {
+	value := bucketUpperBound
+	if bucketUpperBound == math.MaxFloat64 {
+		value = bucketLowerBound
+	}
+	r.observe(name, tags, buckets.AsValues(), value, samples)
+}
+
+// ReportHistogramDurationSamples is like ReportHistogramValueSamples, in seconds.
+func (r *prometheusReporter) ReportHistogramDurationSamples(name string, tags map[string]string,
+	buckets tally.Buckets, bucketLowerBound, bucketUpperBound time.Duration, samples int64) {
+	values := make([]float64, 0, buckets.Len())
+	for _, d := range buckets.AsDurations() {
+		values = append(values, d.Seconds())
+	}
+	value := bucketUpperBound
+	if bucketUpperBound == time.Duration(math.MaxInt64) {
+		value = bucketLowerBound
+	}
+	r.observe(name, tags, values, value.Seconds(), samples)
+}
+
+func (r *prometheusReporter) observe(name string, tags map[string]string, buckets []float64, value float64,
+	samples int64) {
+	labelNames, labels := prometheusLabels(tags)
+	c := r.collector(name, labelNames, func(name string) prometheus.Collector {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: name, Buckets: buckets},
+			labelNames)
+	})
+	if c == nil {
+		return
+	}
+	h := c.(*prometheus.HistogramVec).With(labels)
+	for i := int64(0); i < samples; i++ {
+		h.Observe(value)
+	}
+}
+
+// Capabilities is to implement tally.BaseStatsReporter.
+func (r *prometheusReporter) Capabilities() tally.Capabilities {
+	return r
+}
+
+// Reporting is to implement tally.Capabilities.
+func (r *prometheusReporter) Reporting() bool {
+	return true
+}
+
+// Tagging is to implement tally.Capabilities.
+func (r *prometheusReporter) Tagging() bool {
+	return true
+}
+
+// Flush is to implement tally.BaseStatsReporter, Prometheus collects the metrics when it scrapes them.
+func (r *prometheusReporter) Flush() {}
@@ -0,0 +1,131 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func gatherPrometheus(t *testing.T, registry *prometheus.Registry) map[string]*dto.MetricFamily {
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+	m := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		m[f.GetName()] = f
+	}
+	return m
+}
+
+func prometheusMetricLabels(m *dto.Metric) map[string]string {
+	labels := make(map[string]string)
+	for _, l := range m.Label {
+		labels[l.GetName()] = l.GetValue()
+	}
+	return labels
+}
+
+func TestPrometheusReporter(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	r := newPrometheusReporter(registry, NewNoOpsObservability())
+
+	r.ReportCounter(DriverName+".query.count", map[string]string{"workgroup": "batch"}, 2)
+	r.ReportCounter(DriverName+".query.count", map[string]string{"workgroup": "batch"}, 3)
+	r.ReportGauge(DriverName+".query.governor.queued", nil, 4)
+	r.ReportTimer(DriverName+".query.latency", nil, 3*time.Second)
+	r.ReportHistogramValueSamples(DriverName+".query.scannedbytes", nil, ScannedBytesBuckets, 1e7, 1e8, 2)
+	r.ReportHistogramValueSamples(DriverName+".query.scannedbytes", nil, ScannedBytesBuckets, 1e13,
+		math.MaxFloat64, 1)
+	// the labels of a metric are the same whatever its tags
+	r.ReportCounter(DriverName+".query.count", map[string]string{"caller": "x"}, 1)
+
+	families := gatherPrometheus(t, registry)
+	counter := families["awsathena_query_count"]
+	if assert.NotNil(t, counter) && assert.Len(t, counter.Metric, 2) {
+		assert.Equal(t, map[string]string{"caller": "", "database": "", "priority": "", "resultmode": "",
+			"workgroup": "batch"}, prometheusMetricLabels(counter.Metric[0]))
+		assert.Equal(t, 5.0, counter.Metric[0].GetCounter().GetValue())
+		assert.Equal(t, map[string]string{"caller": "x", "database": "", "priority": "", "resultmode": "",
+			"workgroup": ""}, prometheusMetricLabels(counter.Metric[1]))
+		assert.Equal(t, 1.0, counter.Metric[1].GetCounter().GetValue())
+	}
+	gauge := families["awsathena_query_governor_queued"]
+	if assert.NotNil(t, gauge) {
+		assert.Equal(t, 4.0, gauge.Metric[0].GetGauge().GetValue())
+	}
+	latency := families["awsathena_query_latency"]
+	if assert.NotNil(t, latency) {
+		h := latency.Metric[0].GetHistogram()
+		assert.Equal(t, uint64(1), h.GetSampleCount())
+		assert.Equal(t, 3.0, h.GetSampleSum())
+		assert.Len(t, h.Bucket, len(PrometheusLatencyBuckets))
+	}
+	scanned := families["awsathena_query_scannedbytes"]
+	if assert.NotNil(t, scanned) {
+		h := scanned.Metric[0].GetHistogram()
+		assert.Equal(t, uint64(3), h.GetSampleCount())
+		assert.Equal(t, 2e8+1e13, h.GetSampleSum())
+		assert.Len(t, h.Bucket, len(ScannedBytesBuckets))
+	}
+}
+
+func TestGetPrometheusScope(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	scope := getPrometheusScope(registry, NewNoOpsObservability())
+	assert.Equal(t, scope, getPrometheusScope(registry, NewNoOpsObservability()))
+
+	scope.Counter(DriverName + ".connection").Inc(1)
+	scope.Tagged(map[string]string{"workgroup": "batch"}).Timer(DriverName + ".query").
+		Record(time.Second)
+	assert.Eventually(t, func() bool {
+		families := gatherPrometheus(t, registry)
+		return families["awsathena_connection"] != nil && families["awsathena_query"] != nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestPrometheusReporter_TaggedAndUntaggedScopes(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	r := newPrometheusReporter(registry, NewNoOpsObservability())
+
+	// like the metrics of Connection.queryTracer and of the tracer of the connector
+	r.ReportCounter(DriverName+".query.queryexecutionstatesucceeded", map[string]string{"workgroup": "batch",
+		"database": "default", "resultmode": "", "caller": "etl"}, 2)
+	r.ReportCounter(DriverName+".query.queryexecutionstatesucceeded", nil, 1)
+	r.ReportTimer(DriverName+".query.governor.wait", map[string]string{"priority": "high"}, time.Second)
+	r.ReportTimer(DriverName+".query.governor.wait", nil, time.Second)
+
+	families := gatherPrometheus(t, registry)
+	counter := families["awsathena_query_queryexecutionstatesucceeded"]
+	if assert.NotNil(t, counter) && assert.Len(t, counter.Metric, 2) {
+		assert.Equal(t, 1.0, counter.Metric[0].GetCounter().GetValue())
+		assert.Equal(t, "etl", prometheusMetricLabels(counter.Metric[1])["caller"])
+		assert.Equal(t, 2.0, counter.Metric[1].GetCounter().GetValue())
+	}
+	wait := families["awsathena_query_governor_wait"]
+	if assert.NotNil(t, wait) {
+		assert.Len(t, wait.Metric, 2)
+	}
+}
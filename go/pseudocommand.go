@@ -0,0 +1,210 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"go.uber.org/zap"
+)
+
+// queryExecutionColumns are the columns of the rows of PCGetQueryExecution and PCListExecutions.
+var queryExecutionColumns = []struct {
+	name, athenaType string
+}{
+	{"query_execution_id", "varchar"},
+	{"state", "varchar"},
+	{"state_change_reason", "varchar"},
+	{"workgroup", "varchar"},
+	{"database", "varchar"},
+	{"statement_type", "varchar"},
+	{"submission_time", "timestamp"},
+	{"completion_time", "timestamp"},
+	{"data_scanned_bytes", "bigint"},
+	{"engine_execution_ms", "bigint"},
+	{"output_location", "varchar"},
+	{"query", "varchar"},
+}
+
+// queryExecutionRow is to get the row of a query execution, with its query redacted by config.
+func queryExecutionRow(execution *athena.QueryExecution, config *Config) []*string {
+	row := make([]*string, len(queryExecutionColumns))
+	row[0] = execution.QueryExecutionId
+	row[5] = execution.StatementType
+	if execution.Query != nil {
+		row[11] = aws.String(config.redactQuery(*execution.Query))
+	}
+	if execution.WorkGroup != nil {
+		row[3] = execution.WorkGroup
+	}
+	if ctx := execution.QueryExecutionContext; ctx != nil {
+		row[4] = ctx.Database
+	}
+	if status := execution.Status; status != nil {
+		row[1] = status.State
+		row[2] = status.StateChangeReason
+		row[6] = formatExecutionTime(status.SubmissionDateTime)
+		row[7] = formatExecutionTime(status.CompletionDateTime)
+	}
+	if stats := execution.Statistics; stats != nil {
+		if stats.DataScannedInBytes != nil {
+			row[8] = aws.String(strconv.FormatInt(*stats.DataScannedInBytes, 10))
+		}
+		if stats.EngineExecutionTimeInMillis != nil {
+			row[9] = aws.String(strconv.FormatInt(*stats.EngineExecutionTimeInMillis, 10))
+		}
+	}
+	if rc := execution.ResultConfiguration; rc != nil {
+		row[10] = rc.OutputLocation
+	}
+	return row
+}
+
+// formatExecutionTime is to format t like an Athena timestamp, nil if t is nil.
+func formatExecutionTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	return aws.String(t.UTC().Format(TimestampUniXFormat))
+}
+
+// getQueryExecutionsPage is to get the Rows of the query executions, in the columns queryExecutionColumns.
+func (c *Connection) getQueryExecutionsPage(ctx context.Context, executions []*athena.QueryExecution) (
+	driver.Rows, error) {
+	r, err := NewNonOpsRows(ctx, c.athenaAPI, "", c.connector.config, c.connector.tracer)
+	columnNames := make([]*string, len(queryExecutionColumns))
+	columnTypes := make([]string, len(queryExecutionColumns))
+	for i, column := range queryExecutionColumns {
+		columnNames[i] = aws.String(column.name)
+		columnTypes[i] = column.athenaType
+	}
+	data := make([][]*string, len(executions))
+	for i, execution := range executions {
+		data[i] = queryExecutionRow(execution, c.connector.config)
+	}
+	r.ResultOutput = newHeaderlessResultPage(columnNames, columnTypes, data)
+	return r, err
+}
+
+// getQueryExecution is to run PCGetQueryExecution for the query execution id.
+func (c *Connection) getQueryExecution(ctx context.Context, obs *DriverTracer, queryID string) (driver.Rows, error) {
+	if !IsQID(queryID) {
+		return nil, fmt.Errorf("%w: %q is not a query execution id", ErrInvalidQuery, queryID)
+	}
+	out, err := c.athenaAPI.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
+		QueryExecutionId: aws.String(queryID),
+	})
+	if err != nil {
+		obs.Log(ErrorLevel, "GetQueryExecutionWithContext failed",
+			zap.String("queryID", queryID),
+			zap.String("error", err.Error()))
+		obs.Scope().Counter(DriverName + ".failure.querycontext.getqueryexecutionwithcontext").Inc(1)
+		return nil, err
+	}
+	return c.getQueryExecutionsPage(ctx, []*athena.QueryExecution{out.QueryExecution})
+}
+
+// stopQuery is to run PCStop for the query execution id, and get the query execution once stopped.
+func (c *Connection) stopQuery(ctx context.Context, queryID string) (driver.Rows, error) {
+	if !IsQID(queryID) {
+		return nil, fmt.Errorf("%w: %q is not a query execution id", ErrInvalidQuery, queryID)
+	}
+	statusResp, err := c.stopQueryExecution(c.athenaAPI, queryID)
+	if err != nil {
+		return nil, err
+	}
+	if statusResp == nil {
+		return c.getQueryExecutionsPage(ctx, []*athena.QueryExecution{{QueryExecutionId: aws.String(queryID)}})
+	}
+	return c.getQueryExecutionsPage(ctx, []*athena.QueryExecution{statusResp.QueryExecution})
+}
+
+// listQueryExecutions is to run PCListExecutions, for the latest n query executions in the workgroup of ctx,
+// DefaultListExecutions if arg is empty.
+func (c *Connection) listQueryExecutions(ctx context.Context, obs *DriverTracer, arg string) (driver.Rows, error) {
+	n := DefaultListExecutions
+	if arg != "" {
+		var err error
+		if n, err = strconv.Atoi(arg); err != nil || n < 1 || n > MaxListExecutions {
+			return nil, fmt.Errorf("%w: %s needs a number of query executions from 1 to %d", ErrInvalidQuery,
+				PCListExecutions, MaxListExecutions)
+		}
+	}
+	wgName := getWorkgroup(ctx, c.connector.config).Name
+	if wgName == "" {
+		wgName = DefaultWGName
+	}
+	var queryIDs []*string
+	input := &athena.ListQueryExecutionsInput{WorkGroup: aws.String(wgName)}
+	for len(queryIDs) < n {
+		input.MaxResults = aws.Int64(50)
+		if left := n - len(queryIDs); left < 50 {
+			input.MaxResults = aws.Int64(int64(left))
+		}
+		out, err := c.athenaAPI.ListQueryExecutionsWithContext(ctx, input)
+		if err != nil {
+			obs.Log(ErrorLevel, "ListQueryExecutions failed",
+				zap.String("workgroup", wgName),
+				zap.String("error", err.Error()))
+			obs.Scope().Counter(DriverName + ".failure.querycontext.listqueryexecutions").Inc(1)
+			return nil, err
+		}
+		queryIDs = append(queryIDs, out.QueryExecutionIds...)
+		if out.NextToken == nil {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+	// BatchGetQueryExecution gets up to 50 query executions, in any order
+	byID := make(map[string]*athena.QueryExecution, len(queryIDs))
+	for i := 0; i < len(queryIDs); i += 50 {
+		end := i + 50
+		if end > len(queryIDs) {
+			end = len(queryIDs)
+		}
+		out, err := c.athenaAPI.BatchGetQueryExecutionWithContext(ctx, &athena.BatchGetQueryExecutionInput{
+			QueryExecutionIds: queryIDs[i:end],
+		})
+		if err != nil {
+			obs.Log(ErrorLevel, "BatchGetQueryExecution failed",
+				zap.String("workgroup", wgName),
+				zap.String("error", err.Error()))
+			obs.Scope().Counter(DriverName + ".failure.querycontext.batchgetqueryexecution").Inc(1)
+			return nil, err
+		}
+		for _, execution := range out.QueryExecutions {
+			byID[aws.StringValue(execution.QueryExecutionId)] = execution
+		}
+	}
+	executions := make([]*athena.QueryExecution, 0, len(queryIDs))
+	for _, queryID := range queryIDs {
+		if execution, ok := byID[aws.StringValue(queryID)]; ok {
+			executions = append(executions, execution)
+		}
+	}
+	return c.getQueryExecutionsPage(ctx, executions)
+}
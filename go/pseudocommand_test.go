@@ -0,0 +1,221 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+// executionsAthenaClient has query executions in a workgroup, the latest first, listed in pages of 50.
+type executionsAthenaClient struct {
+	*mockAthenaClient
+	executions []*athena.QueryExecution
+	stopped    []string
+	batches    int
+}
+
+func (m *executionsAthenaClient) find(queryID string) *athena.QueryExecution {
+	for _, execution := range m.executions {
+		if *execution.QueryExecutionId == queryID {
+			return execution
+		}
+	}
+	return nil
+}
+
+func (m *executionsAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	if execution := m.find(*input.QueryExecutionId); execution != nil {
+		return &athena.GetQueryExecutionOutput{QueryExecution: execution}, nil
+	}
+	return nil, ErrTestMockGeneric
+}
+
+func (m *executionsAthenaClient) StopQueryExecutionWithContext(ctx aws.Context, input *athena.StopQueryExecutionInput,
+	opts ...request.Option) (*athena.StopQueryExecutionOutput, error) {
+	execution := m.find(*input.QueryExecutionId)
+	if execution == nil {
+		return nil, ErrTestMockGeneric
+	}
+	m.stopped = append(m.stopped, *input.QueryExecutionId)
+	execution.Status.State = aws.String(athena.QueryExecutionStateCancelled)
+	return &athena.StopQueryExecutionOutput{}, nil
+}
+
+func (m *executionsAthenaClient) ListQueryExecutionsWithContext(ctx aws.Context, input *athena.ListQueryExecutionsInput,
+	opts ...request.Option) (*athena.ListQueryExecutionsOutput, error) {
+	start := 0
+	if input.NextToken != nil {
+		fmt.Sscanf(*input.NextToken, "%d", &start)
+	}
+	out := &athena.ListQueryExecutionsOutput{}
+	end := start + int(*input.MaxResults)
+	if end < len(m.executions) {
+		out.NextToken = aws.String(fmt.Sprint(end))
+	} else {
+		end = len(m.executions)
+	}
+	for _, execution := range m.executions[start:end] {
+		out.QueryExecutionIds = append(out.QueryExecutionIds, execution.QueryExecutionId)
+	}
+	return out, nil
+}
+
+func (m *executionsAthenaClient) BatchGetQueryExecutionWithContext(ctx aws.Context,
+	input *athena.BatchGetQueryExecutionInput, opts ...request.Option) (*athena.BatchGetQueryExecutionOutput, error) {
+	m.batches++
+	out := &athena.BatchGetQueryExecutionOutput{}
+	// in reverse order, as Athena doesn't keep it
+	for i := len(input.QueryExecutionIds) - 1; i >= 0; i-- {
+		out.QueryExecutions = append(out.QueryExecutions, m.find(*input.QueryExecutionIds[i]))
+	}
+	return out, nil
+}
+
+func newExecutionsAthenaClient(n int) *executionsAthenaClient {
+	m := &executionsAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	submitted := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		m.executions = append(m.executions, &athena.QueryExecution{
+			QueryExecutionId: aws.String(fmt.Sprintf("00000000-0000-0000-0000-%012d", i)),
+			Query:            aws.String(fmt.Sprintf("SELECT * FROM t WHERE id = %d", i)),
+			StatementType:    aws.String(athena.StatementTypeDml),
+			WorkGroup:        aws.String(DefaultWGName),
+			QueryExecutionContext: &athena.QueryExecutionContext{
+				Database: aws.String("sales"),
+			},
+			ResultConfiguration: &athena.ResultConfiguration{
+				OutputLocation: aws.String(fmt.Sprintf("s3://results/%d.csv", i)),
+			},
+			Status: &athena.QueryExecutionStatus{
+				State:              aws.String(athena.QueryExecutionStateRunning),
+				SubmissionDateTime: aws.Time(submitted),
+			},
+			Statistics: &athena.QueryExecutionStatistics{
+				DataScannedInBytes:          aws.Int64(int64(i) * 1024),
+				EngineExecutionTimeInMillis: aws.Int64(1500),
+			},
+		})
+	}
+	return m
+}
+
+func readAllRows(t *testing.T, rows driver.Rows) [][]driver.Value {
+	var got [][]driver.Value
+	for {
+		dest := make([]driver.Value, len(rows.Columns()))
+		if err := rows.Next(dest); err != nil {
+			assert.Equal(t, io.EOF, err)
+			return got
+		}
+		got = append(got, dest)
+	}
+}
+
+func TestConnection_QueryContext_PCGetQueryExecution(t *testing.T) {
+	athenaClient := newExecutionsAthenaClient(1)
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetQueryRedaction(true)
+	queryID := *athenaClient.executions[0].QueryExecutionId
+	rows, err := c.QueryContext(context.Background(), "pc:get_query_execution "+queryID, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"query_execution_id", "state", "state_change_reason", "workgroup", "database",
+		"statement_type", "submission_time", "completion_time", "data_scanned_bytes", "engine_execution_ms",
+		"output_location", "query"}, rows.Columns())
+	got := readAllRows(t, rows)
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, []driver.Value{queryID, "RUNNING", "", DefaultWGName, "sales", "DML"}, got[0][:6])
+		assert.True(t, time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC).Equal(got[0][6].(time.Time)))
+		assert.Equal(t, []driver.Value{int64(0), int64(1500), "s3://results/0.csv", "SELECT * FROM t WHERE id = ?"},
+			got[0][8:])
+	}
+
+	_, err = c.QueryContext(context.Background(), "pc:get_query_execution SELECT 1", nil)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	_, err = c.QueryContext(context.Background(), "pc:get_query_execution 00000000-0000-0000-0000-000000000009", nil)
+	assert.Equal(t, ErrTestMockGeneric, err)
+}
+
+func TestConnection_QueryContext_PCStop(t *testing.T) {
+	athenaClient := newExecutionsAthenaClient(2)
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	queryID := *athenaClient.executions[1].QueryExecutionId
+	rows, err := c.QueryContext(context.Background(), "pc:stop "+queryID, nil)
+	assert.Nil(t, err)
+	got := readAllRows(t, rows)
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, []driver.Value{queryID, "CANCELLED"}, got[0][:2])
+	}
+	assert.Equal(t, []string{queryID}, athenaClient.stopped)
+
+	_, err = c.QueryContext(context.Background(), "pc:stop me", nil)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
+
+func TestConnection_QueryContext_PCListExecutions(t *testing.T) {
+	athenaClient := newExecutionsAthenaClient(120)
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	rows, err := c.QueryContext(context.Background(), "pc:list_executions", nil)
+	assert.Nil(t, err)
+	got := readAllRows(t, rows)
+	assert.Len(t, got, DefaultListExecutions)
+	assert.Equal(t, *athenaClient.executions[0].QueryExecutionId, got[0][0])
+	assert.Equal(t, *athenaClient.executions[49].QueryExecutionId, got[49][0])
+
+	athenaClient.batches = 0
+	rows, err = c.QueryContext(context.Background(), "pc:list_executions 75", nil)
+	assert.Nil(t, err)
+	got = readAllRows(t, rows)
+	assert.Len(t, got, 75)
+	assert.Equal(t, 2, athenaClient.batches)
+	for i, row := range got {
+		assert.Equal(t, *athenaClient.executions[i].QueryExecutionId, row[0])
+	}
+
+	rows, err = c.QueryContext(context.Background(), "pc:list_executions 1000", nil)
+	assert.Nil(t, err)
+	assert.Len(t, readAllRows(t, rows), 120)
+
+	for _, query := range []string{"pc:list_executions 0", "pc:list_executions 1001", "pc:list_executions all"} {
+		_, err = c.QueryContext(context.Background(), query, nil)
+		assert.True(t, errors.Is(err, ErrInvalidQuery), query)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// The failure modes of queries, for errors.Is on the errors the driver returns.
+var (
+	ErrQueryCancelled = errors.New("query was cancelled")
+	ErrThrottled      = errors.New("request was throttled")
+	ErrSyntax         = errors.New("query has a syntax error")
+	ErrAccessDenied   = errors.New("access was denied")
+	ErrResultExpired  = errors.New("query result is expired")
+	ErrAlreadyExists  = errors.New("table or database already exists")
+	// ErrLakeFormationDenied is the denial of Lake Formation, a LakeFormationDeniedError for errors.As. It is
+	// ErrAccessDenied as well.
+	ErrLakeFormationDenied = errors.New("access was denied by Lake Formation")
+	// ErrLakeFormationNoGrant is returned by Connection.CheckLakeFormationPermissions when no grant of the caller
+	// is listed. It isn't a denial: the grants with LF-Tags, to groups, to other accounts and to roles with a path
+	// are not listed for the caller.
+	ErrLakeFormationNoGrant = errors.New("no Lake Formation grant of the caller is listed")
+	// ErrFederatedSource is the failure of the connector of a federated data catalog, like its Lambda function
+	ErrFederatedSource = errors.New("federated data source failed")
+)
+
+// errorCodeKinds are the failure modes of AWS error codes.
+var errorCodeKinds = map[string]error{
+	"ThrottlingException":      ErrThrottled,
+	"TooManyRequestsException": ErrThrottled,
+	"SlowDown":                 ErrThrottled,
+	"AccessDeniedException":    ErrAccessDenied,
+	"AccessDenied":             ErrAccessDenied,
+	"UnauthorizedOperation":    ErrAccessDenied,
+	"NoSuchKey":                ErrResultExpired,
+	"AlreadyExistsException":   ErrAlreadyExists,
+}
+
+// errorMessageKinds are the failure modes of error messages and state change reasons, by a part of them in
+// upper case.
+var errorMessageKinds = []struct {
+	part string
+	kind error
+}{
+	// before the syntax errors and the access denied, which the Lake Formation denials look like
+	{"LAKE FORMATION PERMISSION", ErrLakeFormationDenied},
+	{"NOT AUTHORIZED TO ACCESS REQUESTED RESOURCES", ErrLakeFormationDenied},
+	{"SYNTAX_ERROR", ErrSyntax},
+	{"MISMATCHED INPUT", ErrSyntax},
+	{"EXTRANEOUS INPUT", ErrSyntax},
+	{"NO VIABLE ALTERNATIVE", ErrSyntax},
+	{"ACCESS DENIED", ErrAccessDenied},
+	{"PERMISSION_DENIED", ErrAccessDenied},
+	{"NOT AUTHORIZED", ErrAccessDenied},
+	{"RATE EXCEEDED", ErrThrottled},
+	{"SLOW DOWN", ErrThrottled},
+	{"TOO_MANY_REQUESTS", ErrThrottled},
+	{"THROTTL", ErrThrottled},
+	{"NOSUCHKEY", ErrResultExpired},
+	{"KEY DOES NOT EXIST", ErrResultExpired},
+	{"ALREADY EXISTS", ErrAlreadyExists},
+	// after the throttling and the access denied of the federated data sources
+	{"LAMBDAFUNCTION", ErrFederatedSource},
+	{"LAMBDA FUNCTION", ErrFederatedSource},
+	{"AWSLAMBDAEXCEPTION", ErrFederatedSource},
+	{"HIVE_METASTORE_ERROR", ErrFederatedSource},
+	{"FEDERATED", ErrFederatedSource},
+}
+
+// QueryError is the error of a query execution, wrapping the AWS error or the failure reason of Athena.
+// It is the failure mode in Kind for errors.Is, like ErrThrottled, if the failure mode is known.
+type QueryError struct {
+	// QueryID is empty if the query didn't start.
+	QueryID string
+	// State is the state of the query execution, empty if it is not known.
+	State string
+	// Reason is the state change reason of the query execution.
+	Reason string
+	// Catalog is the federated data catalog of the query, empty for AwsDataCatalog.
+	Catalog            string
+	DataScannedInBytes int64
+	// Retryable is whether Athena tells the query may succeed if it runs again.
+	Retryable bool
+	Kind      error
+	Err       error
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap is to get the AWS error, or the failure reason.
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// Is is to match the failure mode of the error.
+func (e *QueryError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// errorKind is to get the failure mode of an AWS error code and message, or nil if it is not known.
+func errorKind(code string, message string) error {
+	if kind, ok := errorCodeKinds[code]; ok {
+		return kind
+	}
+	message = strings.ToUpper(message)
+	for _, k := range errorMessageKinds {
+		if strings.Contains(message, k.part) {
+			return k.kind
+		}
+	}
+	return nil
+}
+
+// newQueryError is to get the error of a query execution which didn't succeed.
+func newQueryError(execution *athena.QueryExecution, err error) *QueryError {
+	e := &QueryError{
+		QueryID: aws.StringValue(execution.QueryExecutionId),
+		Err:     err,
+	}
+	if execution.Status != nil {
+		e.State = aws.StringValue(execution.Status.State)
+		e.Reason = aws.StringValue(execution.Status.StateChangeReason)
+		if execution.Status.AthenaError != nil {
+			e.Retryable = aws.BoolValue(execution.Status.AthenaError.Retryable)
+		}
+	}
+	if execution.Statistics != nil {
+		e.DataScannedInBytes = aws.Int64Value(execution.Statistics.DataScannedInBytes)
+	}
+	if e.State == athena.QueryExecutionStateCancelled {
+		e.Kind = ErrQueryCancelled
+	} else {
+		e.Kind = errorKind("", e.Reason)
+	}
+	if e.Kind == ErrLakeFormationDenied {
+		e.Err = newLakeFormationDeniedError(e.Reason, err)
+	}
+	return e
+}
+
+// classifyError is to wrap an AWS error of the query queryID in a QueryError if its failure mode is known.
+// Other errors are returned as they are.
+func classifyError(queryID string, err error) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+	kind := errorKind(aerr.Code(), aerr.Message())
+	if kind == nil {
+		return err
+	}
+	if kind == ErrLakeFormationDenied {
+		err = newLakeFormationDeniedError(aerr.Message(), err)
+	}
+	return &QueryError{QueryID: queryID, Kind: kind, Err: err}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	throttled := awserr.New("ThrottlingException", "Rate exceeded", nil)
+	err := classifyError("qid", throttled)
+	assert.True(t, errors.Is(err, ErrThrottled))
+	assert.False(t, errors.Is(err, ErrAccessDenied))
+	var queryErr *QueryError
+	assert.True(t, errors.As(err, &queryErr))
+	assert.Equal(t, "qid", queryErr.QueryID)
+	assert.Equal(t, throttled, errors.Unwrap(err))
+	assert.Equal(t, throttled.Error(), err.Error())
+
+	err = classifyError("", awserr.New(athena.ErrCodeInvalidRequestException,
+		"line 1:8: mismatched input 'FORM'", nil))
+	assert.True(t, errors.Is(err, ErrSyntax))
+	err = classifyError("", awserr.New("AccessDeniedException", "not allowed", nil))
+	assert.True(t, errors.Is(err, ErrAccessDenied))
+	err = classifyError("qid", awserr.New("NoSuchKey", "The specified key does not exist.", nil))
+	assert.True(t, errors.Is(err, ErrResultExpired))
+	err = classifyError("qid", awserr.New(athena.ErrCodeInvalidRequestException,
+		"AlreadyExistsException: Table db.t already exists", nil))
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+	err = classifyError("qid", awserr.New(athena.ErrCodeInvalidRequestException,
+		"HIVE_METASTORE_ERROR: Failed to connect to the metastore", nil))
+	assert.True(t, errors.Is(err, ErrFederatedSource))
+	err = classifyError("qid", awserr.New(athena.ErrCodeInvalidRequestException,
+		"Rate exceeded from your LambdaFunction[dynamodb]", nil))
+	assert.True(t, errors.Is(err, ErrThrottled))
+
+	// other errors are returned as they are
+	other := awserr.New(athena.ErrCodeInternalServerException, "oops", nil)
+	assert.Equal(t, other, classifyError("qid", other))
+	assert.Equal(t, ErrTestMockGeneric, classifyError("qid", ErrTestMockGeneric))
+}
+
+func TestNewQueryError(t *testing.T) {
+	execution := &athena.QueryExecution{
+		QueryExecutionId: aws.String("qid"),
+		Status: &athena.QueryExecutionStatus{
+			State:             aws.String(athena.QueryExecutionStateFailed),
+			StateChangeReason: aws.String("SYNTAX_ERROR: line 1:8: Column 'x' cannot be resolved"),
+		},
+		Statistics: &athena.QueryExecutionStatistics{DataScannedInBytes: aws.Int64(42)},
+	}
+	err := newQueryError(execution, errors.New(*execution.Status.StateChangeReason))
+	assert.True(t, errors.Is(err, ErrSyntax))
+	assert.Equal(t, "qid", err.QueryID)
+	assert.Equal(t, athena.QueryExecutionStateFailed, err.State)
+	assert.Equal(t, int64(42), err.DataScannedInBytes)
+	assert.Equal(t, "SYNTAX_ERROR: line 1:8: Column 'x' cannot be resolved", err.Error())
+
+	execution.Status.State = aws.String(athena.QueryExecutionStateCancelled)
+	execution.Status.StateChangeReason = nil
+	err = newQueryError(execution, context.Canceled)
+	assert.True(t, errors.Is(err, ErrQueryCancelled))
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestConnection_QueryContext_QueryError(t *testing.T) {
+	c := &Connection{
+		athenaAPI: newMockAthenaClient(),
+		connector: NoopsSQLConnector(),
+	}
+	_, err := c.QueryContext(context.Background(), "SELECTQueryContext_AWS_FAIL", nil)
+	var queryErr *QueryError
+	assert.True(t, errors.As(err, &queryErr))
+	assert.Equal(t, "SELECTQueryContext_AWS_FAIL_QID", queryErr.QueryID)
+	assert.Equal(t, athena.QueryExecutionStateFailed, queryErr.State)
+
+	_, err = c.QueryContext(context.Background(), "SELECTQueryContext_AWS_CANCEL", nil)
+	assert.True(t, errors.Is(err, ErrQueryCancelled))
+}
+
+// federatedAthenaClient fails the queries in the Lambda connector of a federated data catalog after polls.
+type federatedAthenaClient struct {
+	queryContextAthenaClient
+	polls int
+}
+
+func (m *federatedAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	m.polls++
+	state := athena.QueryExecutionStateRunning
+	if m.polls == 3 {
+		state = athena.QueryExecutionStateFailed
+	}
+	return &athena.GetQueryExecutionOutput{QueryExecution: &athena.QueryExecution{
+		QueryExecutionId: input.QueryExecutionId,
+		StatementType:    aws.String(athena.StatementTypeDml),
+		Status: &athena.QueryExecutionStatus{
+			State: aws.String(state),
+			StateChangeReason: aws.String("GENERIC_USER_ERROR: Encountered an exception" +
+				"[com.amazonaws.services.lambda.model.AWSLambdaException] from your LambdaFunction[dynamodb]"),
+		},
+	}}, nil
+}
+
+// recordingPoll is a FixedPoll recording the status checks it is asked to wait after.
+type recordingPoll struct {
+	polls []int
+}
+
+func (p *recordingPoll) Interval(n int) time.Duration {
+	p.polls = append(p.polls, n)
+	return time.Millisecond
+}
+
+func TestConnection_QueryContext_FederatedCatalog(t *testing.T) {
+	athenaClient := &federatedAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+	}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	poll, federatedPoll := &recordingPoll{}, &recordingPoll{}
+	c.connector.config.SetPollStrategy(poll)
+	c.connector.config.SetFederatedPollStrategy(federatedPoll)
+
+	_, err := c.QueryContext(WithCatalog(context.Background(), "dynamodb"), "SELECT * FROM orders", nil)
+	var queryErr *QueryError
+	assert.True(t, errors.As(err, &queryErr))
+	assert.True(t, errors.Is(err, ErrFederatedSource))
+	assert.Equal(t, "dynamodb", queryErr.Catalog)
+	assert.Equal(t, []int{0, 1}, federatedPoll.polls)
+	assert.Empty(t, poll.polls)
+
+	athenaClient.polls = 0
+	_, err = c.QueryContext(context.Background(), "SELECT * FROM orders", nil)
+	assert.True(t, errors.As(err, &queryErr))
+	assert.Equal(t, "", queryErr.Catalog)
+	assert.Equal(t, []int{0, 1}, poll.polls)
+}
+
+func TestConfig_FederatedPollStrategy(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, DefaultFederatedPollInitialInterval*time.Second, testConf.GetFederatedPollInterval())
+	testConf.SetFederatedPollInterval(5 * time.Second)
+	testConf.SetPollMaxInterval(20 * time.Second)
+	assert.Equal(t, BackoffPoll{Initial: 5 * time.Second, Max: 20 * time.Second, Multiplier: 2, Jitter: 0.2},
+		testConf.GetFederatedPollStrategy())
+	testConf.SetFederatedPollStrategy(FixedPoll(time.Second))
+	assert.Equal(t, FixedPoll(time.Second), testConf.GetFederatedPollStrategy())
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.uber.org/zap"
+)
+
+// maxDoneQueries is how many completed queries a queryEventListener remembers, to delete their late events.
+const maxDoneQueries = 1024
+
+// queryStateChangeEvent is the Athena Query State Change event of EventBridge, delivered to SQS.
+type queryStateChangeEvent struct {
+	DetailType string `json:"detail-type"`
+	Detail     struct {
+		QueryExecutionID string `json:"queryExecutionId"`
+		CurrentState     string `json:"currentState"`
+	} `json:"detail"`
+}
+
+// queryEventListener receives Athena Query State Change events from an SQS queue, and notifies the queries
+// waiting for them. It receives messages only while queries are waiting, in a single goroutine shared by
+// all connections of a connector. Messages of other queries are left in the queue.
+type queryEventListener struct {
+	sqsAPI   sqsiface.SQSAPI
+	queueURL string
+	tracer   *DriverTracer
+
+	mu      sync.Mutex
+	running bool
+	waiters map[string]chan struct{}
+	// done has the last completed queries in order, and doneSet the same queries.
+	done    []string
+	doneSet map[string]bool
+}
+
+func newQueryEventListener(sqsAPI sqsiface.SQSAPI, queueURL string, obs *DriverTracer) *queryEventListener {
+	return &queryEventListener{
+		sqsAPI:   sqsAPI,
+		queueURL: queueURL,
+		tracer:   obs,
+		waiters:  map[string]chan struct{}{},
+		doneSet:  map[string]bool{},
+	}
+}
+
+// subscribe is to get a channel closed when the query queryID reaches a final state,
+// and the function to call once the query doesn't wait any more.
+func (l *queryEventListener) subscribe(queryID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waiters[queryID] = ch
+	if !l.running {
+		l.running = true
+		go l.receive()
+	}
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.waiters, queryID)
+		if !l.doneSet[queryID] {
+			l.doneSet[queryID] = true
+			l.done = append(l.done, queryID)
+			if len(l.done) > maxDoneQueries {
+				delete(l.doneSet, l.done[0])
+				l.done = l.done[1:]
+			}
+		}
+	}
+}
+
+// receive is to receive the messages of the queue until no query waits.
+func (l *queryEventListener) receive() {
+	for {
+		l.mu.Lock()
+		if len(l.waiters) == 0 {
+			l.running = false
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+
+		resp, err := l.sqsAPI.ReceiveMessageWithContext(context.Background(), &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(l.queueURL),
+			MaxNumberOfMessages: aws.Int64(10),
+			WaitTimeSeconds:     aws.Int64(20),
+		})
+		if err != nil {
+			// the waiting queries fall back to polling
+			l.tracer.Log(WarnLevel, "ReceiveMessage of query events failed",
+				zap.String("queue", l.queueURL),
+				zap.String("error", err.Error()))
+			l.tracer.Scope().Counter(DriverName + ".failure.queryevents.receivemessage").Inc(1)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, message := range resp.Messages {
+			if l.handle(aws.StringValue(message.Body)) {
+				l.deleteMessage(message)
+			}
+		}
+	}
+}
+
+// handle is to notify the query of the event in body if it reached a final state.
+// It is true if the event is of a query of the listener, so the message can be deleted.
+func (l *queryEventListener) handle(body string) bool {
+	var event queryStateChangeEvent
+	if err := json.Unmarshal([]byte(body), &event); err != nil || event.DetailType != "Athena Query State Change" {
+		return false
+	}
+	queryID := event.Detail.QueryExecutionID
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch, ok := l.waiters[queryID]
+	if !ok {
+		return l.doneSet[queryID]
+	}
+	switch event.Detail.CurrentState {
+	case athena.QueryExecutionStateSucceeded, athena.QueryExecutionStateFailed, athena.QueryExecutionStateCancelled:
+		close(ch)
+		delete(l.waiters, queryID)
+		l.tracer.Scope().Counter(DriverName + ".queryevents.notified").Inc(1)
+	}
+	return true
+}
+
+func (l *queryEventListener) deleteMessage(message *sqs.Message) {
+	_, err := l.sqsAPI.DeleteMessageWithContext(context.Background(), &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(l.queueURL),
+		ReceiptHandle: message.ReceiptHandle,
+	})
+	if err != nil {
+		l.tracer.Log(WarnLevel, "DeleteMessage of query events failed",
+			zap.String("queue", l.queueURL),
+			zap.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+)
+
+// queryEventsSQSClient delivers the query events in bodies, and records the deleted ones.
+type queryEventsSQSClient struct {
+	sqsiface.SQSAPI
+	mu      sync.Mutex
+	bodies  []string
+	deleted []string
+}
+
+func (m *queryEventsSQSClient) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput,
+	opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	time.Sleep(time.Millisecond)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := &sqs.ReceiveMessageOutput{}
+	for _, body := range m.bodies {
+		out.Messages = append(out.Messages, &sqs.Message{Body: aws.String(body), ReceiptHandle: aws.String(body)})
+	}
+	m.bodies = nil
+	return out, nil
+}
+
+func (m *queryEventsSQSClient) DeleteMessageWithContext(ctx aws.Context, input *sqs.DeleteMessageInput,
+	opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted = append(m.deleted, *input.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func queryStateChangeEventBody(queryID, state string) string {
+	return `{"detail-type":"Athena Query State Change","source":"aws.athena","detail":{"queryExecutionId":"` +
+		queryID + `","currentState":"` + state + `"}}`
+}
+
+func TestConnection_QueryEvents(t *testing.T) {
+	sqsClient := &queryEventsSQSClient{}
+	athenaClient := &attachAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetPollMaxInterval(time.Hour)
+	c.connector.queryEvents = newQueryEventListener(sqsClient, "https://sqs/queue", c.connector.tracer)
+
+	running := queryStateChangeEventBody("00000000-0000-0000-0000-000000000000", "RUNNING")
+	other := queryStateChangeEventBody("11111111-0000-0000-0000-000000000000", "SUCCEEDED")
+	succeeded := queryStateChangeEventBody("00000000-0000-0000-0000-000000000000", "SUCCEEDED")
+	sqsClient.bodies = []string{running, other, "not an event", succeeded}
+
+	done := make(chan error)
+	go func() {
+		_, err := c.AttachQuery(context.Background(), "00000000-0000-0000-0000-000000000000")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the query didn't complete on its event")
+	}
+	assert.Equal(t, 2, athenaClient.polls)
+	sqsClient.mu.Lock()
+	assert.Equal(t, []string{running, succeeded}, sqsClient.deleted)
+	sqsClient.mu.Unlock()
+
+	// late events of completed queries are deleted, the ones of other queries are left
+	assert.True(t, c.connector.queryEvents.handle(succeeded))
+	assert.False(t, c.connector.queryEvents.handle(other))
+}
+
+func TestConfig_SetQueryEventsQueue(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, "", testConf.GetQueryEventsQueue())
+	testConf.SetQueryEventsQueue("https://sqs.us-east-1.amazonaws.com/123456789012/athena-events")
+	assert.Equal(t, "https://sqs.us-east-1.amazonaws.com/123456789012/athena-events", testConf.GetQueryEventsQueue())
+	testConf.SetQueryEventsQueue("")
+	assert.Equal(t, "", testConf.GetQueryEventsQueue())
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+)
+
+const (
+	// rateDecrease is the factor the rate of a limiter is multiplied by when a request is throttled.
+	rateDecrease = 0.5
+	// rateIncrease is the part of the configured rate added back to the rate after each request which isn't
+	// throttled, so the rate recovers in 20 requests after a throttling.
+	rateIncrease = 0.05
+	// minRateFraction is the lowest rate of a limiter, as part of the configured rate.
+	minRateFraction = 0.05
+)
+
+// adaptiveLimiter is a token bucket limiting the rate of an API, which adapts to throttling errors: the rate
+// is halved when a request is throttled, and increased back to the configured rate as requests succeed.
+// A limiter is shared by all connections of a connector, so they back off together.
+type adaptiveLimiter struct {
+	mu     sync.Mutex
+	max    float64 // configured rate, in requests per second
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newAdaptiveLimiter is to create a limiter of rate requests per second, allowing bursts of burst requests.
+func newAdaptiveLimiter(rate float64, burst int) *adaptiveLimiter {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	return &adaptiveLimiter{
+		max:    rate,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait is to take a token, waiting until one is available or ctx is done.
+func (l *adaptiveLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// tokens may go negative, reserving the next ones for the requests already waiting
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Observe is to adapt the rate to the result of a request.
+func (l *adaptiveLimiter) Observe(err error) {
+	throttled := err != nil && errors.Is(classifyError("", err), ErrThrottled)
+	if err != nil && !throttled {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if throttled {
+		l.rate = math.Max(l.rate*rateDecrease, l.max*minRateFraction)
+	} else {
+		l.rate = math.Min(l.rate+l.max*rateIncrease, l.max)
+	}
+}
+
+// Rate is a getter of the current rate, in requests per second.
+func (l *adaptiveLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// rateLimiters are the limiters of the Athena APIs of a region.
+type rateLimiters struct {
+	startQuery      *adaptiveLimiter
+	getQueryResults *adaptiveLimiter
+}
+
+// newRateLimiters is to create the limiters set in Config, nil if none is set.
+func newRateLimiters(config *Config) *rateLimiters {
+	l := &rateLimiters{}
+	if rate, burst := config.GetStartQueryRateLimit(); rate > 0 {
+		l.startQuery = newAdaptiveLimiter(rate, burst)
+	}
+	if rate, burst := config.GetQueryResultsRateLimit(); rate > 0 {
+		l.getQueryResults = newAdaptiveLimiter(rate, burst)
+	}
+	if l.startQuery == nil && l.getQueryResults == nil {
+		return nil
+	}
+	return l
+}
+
+// rateLimitedAthenaAPI is an Athena client waiting on the limiters of its region before calling
+// StartQueryExecutionWithContext and GetQueryResultsWithContext. The driver calls the Athena APIs with the
+// context of the query only, so the waits are canceled with it.
+type rateLimitedAthenaAPI struct {
+	athenaiface.AthenaAPI
+	limiters *rateLimiters
+	tracer   *DriverTracer
+}
+
+// limitAthenaAPI is to wrap athenaAPI with limiters, or return it as it is if limiters is nil.
+func limitAthenaAPI(athenaAPI athenaiface.AthenaAPI, limiters *rateLimiters, tracer *DriverTracer) athenaiface.AthenaAPI {
+	if limiters == nil {
+		return athenaAPI
+	}
+	return &rateLimitedAthenaAPI{AthenaAPI: athenaAPI, limiters: limiters, tracer: tracer}
+}
+
+// wait is to wait on limiter, if it is set, recording how long it took.
+func (a *rateLimitedAthenaAPI) wait(ctx context.Context, limiter *adaptiveLimiter, api string) error {
+	if limiter == nil {
+		return nil
+	}
+	start := time.Now()
+	if err := limiter.Wait(ctx); err != nil {
+		return err
+	}
+	a.tracer.Scope().Timer(DriverName + ".ratelimit." + api + ".wait").Record(time.Since(start))
+	return nil
+}
+
+// observe is to adapt limiter to err, if it is set.
+func (a *rateLimitedAthenaAPI) observe(limiter *adaptiveLimiter, api string, err error) {
+	if limiter == nil {
+		return
+	}
+	limiter.Observe(err)
+	if err != nil && errors.Is(classifyError("", err), ErrThrottled) {
+		a.tracer.Scope().Counter(DriverName + ".ratelimit." + api + ".throttled").Inc(1)
+	}
+}
+
+func (a *rateLimitedAthenaAPI) StartQueryExecutionWithContext(ctx aws.Context,
+	input *athena.StartQueryExecutionInput, opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	limiter := a.limiters.startQuery
+	if err := a.wait(ctx, limiter, "startqueryexecution"); err != nil {
+		return nil, err
+	}
+	out, err := a.AthenaAPI.StartQueryExecutionWithContext(ctx, input, opts...)
+	a.observe(limiter, "startqueryexecution", err)
+	return out, err
+}
+
+func (a *rateLimitedAthenaAPI) GetQueryResultsWithContext(ctx aws.Context, input *athena.GetQueryResultsInput,
+	opts ...request.Option) (*athena.GetQueryResultsOutput, error) {
+	limiter := a.limiters.getQueryResults
+	if err := a.wait(ctx, limiter, "getqueryresults"); err != nil {
+		return nil, err
+	}
+	out, err := a.AthenaAPI.GetQueryResultsWithContext(ctx, input, opts...)
+	a.observe(limiter, "getqueryresults", err)
+	return out, err
+}
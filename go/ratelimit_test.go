@@ -0,0 +1,157 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveLimiter_Wait(t *testing.T) {
+	l := newAdaptiveLimiter(20, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, l.Wait(context.Background()))
+	}
+	// the burst is free, the next 2 tokens take 50ms each
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, l.Wait(ctx))
+}
+
+func TestAdaptiveLimiter_Observe(t *testing.T) {
+	l := newAdaptiveLimiter(10, 0)
+	assert.Equal(t, float64(10), l.burst)
+
+	l.Observe(awserr.New("TooManyRequestsException", "Rate exceeded", nil))
+	assert.Equal(t, float64(5), l.Rate())
+	l.Observe(awserr.New("InvalidRequestException", "bad query", nil))
+	assert.Equal(t, float64(5), l.Rate())
+	for i := 0; i < 10; i++ {
+		l.Observe(awserr.New("ThrottlingException", "Rate exceeded", nil))
+	}
+	assert.Equal(t, 10*minRateFraction, l.Rate())
+	for i := 0; i < 30; i++ {
+		l.Observe(nil)
+	}
+	assert.Equal(t, float64(10), l.Rate())
+}
+
+// throttlingAthenaClient throttles every other StartQueryExecution call.
+type throttlingAthenaClient struct {
+	athenaiface.AthenaAPI
+	calls int
+}
+
+func (m *throttlingAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, input *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	m.calls++
+	if m.calls%2 == 0 {
+		return nil, awserr.New("TooManyRequestsException", "Rate exceeded", nil)
+	}
+	return &athena.StartQueryExecutionOutput{QueryExecutionId: aws.String("qid")}, nil
+}
+
+func (m *throttlingAthenaClient) GetQueryResultsWithContext(ctx aws.Context, input *athena.GetQueryResultsInput,
+	opts ...request.Option) (*athena.GetQueryResultsOutput, error) {
+	m.calls++
+	return &athena.GetQueryResultsOutput{}, nil
+}
+
+func TestRateLimitedAthenaAPI(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Nil(t, limitAthenaAPI(nil, newRateLimiters(testConf), nil))
+
+	testConf.SetStartQueryRateLimit(1000, 1)
+	client := &throttlingAthenaClient{}
+	limiters := newRateLimiters(testConf)
+	assert.Nil(t, limiters.getQueryResults)
+	api := limitAthenaAPI(client, limiters, NewDefaultObservability(testConf))
+
+	_, err := api.StartQueryExecutionWithContext(context.Background(), &athena.StartQueryExecutionInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, float64(1000), limiters.startQuery.Rate())
+	_, err = api.StartQueryExecutionWithContext(context.Background(), &athena.StartQueryExecutionInput{})
+	assert.NotNil(t, err)
+	assert.Equal(t, float64(500), limiters.startQuery.Rate())
+
+	_, err = api.GetQueryResultsWithContext(context.Background(), &athena.GetQueryResultsInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, client.calls)
+
+	// the wait is canceled with the context of the query
+	testConf.SetStartQueryRateLimit(1, 1)
+	client = &throttlingAthenaClient{}
+	api = limitAthenaAPI(client, newRateLimiters(testConf), NewDefaultObservability(testConf))
+	_, err = api.StartQueryExecutionWithContext(context.Background(), &athena.StartQueryExecutionInput{})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = api.StartQueryExecutionWithContext(ctx, &athena.StartQueryExecutionInput{})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, client.calls)
+}
+
+func TestSQLConnector_RateLimiters(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	c := NewConnectorWithClient(testConf, &throttlingAthenaClient{})
+	conn, err := c.Connect(context.Background())
+	assert.Nil(t, err)
+	_, limited := conn.(*Connection).athenaAPI.(*rateLimitedAthenaAPI)
+	assert.False(t, limited)
+
+	testConf.SetQueryResultsRateLimit(50, 10)
+	c = NewConnectorWithClient(testConf, &throttlingAthenaClient{})
+	conn, err = c.Connect(context.Background())
+	assert.Nil(t, err)
+	conn2, err := c.Connect(context.Background())
+	assert.Nil(t, err)
+	api := conn.(*Connection).athenaAPI.(*rateLimitedAthenaAPI)
+	assert.Same(t, api.limiters, conn2.(*Connection).athenaAPI.(*rateLimitedAthenaAPI).limiters)
+}
+
+func TestConfig_SetRateLimit(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	rate, burst := testConf.GetStartQueryRateLimit()
+	assert.Equal(t, float64(0), rate)
+	assert.Equal(t, 0, burst)
+	testConf.SetStartQueryRateLimit(2.5, 5)
+	rate, burst = testConf.GetStartQueryRateLimit()
+	assert.Equal(t, 2.5, rate)
+	assert.Equal(t, 5, burst)
+	testConf.SetQueryResultsRateLimit(100, 0)
+	rate, burst = testConf.GetQueryResultsRateLimit()
+	assert.Equal(t, float64(100), rate)
+	assert.Equal(t, 0, burst)
+	testConf.SetStartQueryRateLimit(0, 5)
+	rate, _ = testConf.GetStartQueryRateLimit()
+	assert.Equal(t, float64(0), rate)
+}
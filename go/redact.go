@@ -0,0 +1,112 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"strings"
+)
+
+// QueryRedactor is to get the text of query which can be logged, like with its literals masked.
+type QueryRedactor func(query string) string
+
+// RedactLiterals is the default QueryRedactor, replacing the string and number literals of query with `?`,
+// as they are where PII usually is, like in `WHERE email = 'a@b.c'`. Identifiers, quoted or not, keywords
+// and comments are kept, so the redacted query still tells what the query does.
+func RedactLiterals(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			// '' is a quote in a string literal
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					j++
+					break
+				}
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+		case ch == '"' || ch == '`':
+			j := strings.IndexByte(query[i+1:], ch)
+			if j < 0 {
+				j = len(query) - i - 2
+			}
+			b.WriteString(query[i : i+j+2])
+			i += j + 2
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			b.WriteString(query[i : i+j])
+			i += j
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				j = len(query) - i - 4
+			}
+			b.WriteString(query[i : i+j+4])
+			i += j + 4
+		case isDigit(ch) || ch == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			if i > 0 && isIdentifierChar(query[i-1]) {
+				// like t1
+				b.WriteByte(ch)
+				i++
+				continue
+			}
+			j := i
+			for j < len(query) && (isIdentifierChar(query[j]) || query[j] == '.' ||
+				(query[j] == '+' || query[j] == '-') && (query[j-1] == 'e' || query[j-1] == 'E')) {
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+		default:
+			b.WriteByte(ch)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentifierChar(ch byte) bool {
+	return isDigit(ch) || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_'
+}
+
+// redactQuery is to get query as it can be logged, with the query redactor of c.
+func (c *Config) redactQuery(query string) string {
+	if redact := c.GetQueryRedactor(); redact != nil {
+		return redact(query)
+	}
+	return query
+}
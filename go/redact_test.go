@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactLiterals(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM t WHERE email = 'a@b.c'", "SELECT * FROM t WHERE email = ?"},
+		{"SELECT * FROM t WHERE name = 'O''Brien' AND age > 42", "SELECT * FROM t WHERE name = ? AND age > ?"},
+		{"SELECT x FROM t1 WHERE y IN (1, 2.5, .5, 1e-3) LIMIT 10", "SELECT x FROM t1 WHERE y IN (?, ?, ?, ?) LIMIT ?"},
+		{`SELECT "col 1", "o'k" FROM "db"."t_2"`, `SELECT "col 1", "o'k" FROM "db"."t_2"`},
+		{"SELECT d FROM t WHERE d = DATE '2020-01-01' -- it's 1", "SELECT d FROM t WHERE d = DATE ? -- it's 1"},
+		{"/* traceparent=00-1 */ SELECT -1", "/* traceparent=00-1 */ SELECT -?"},
+		{"SELECT 'unterminated", "SELECT ?"},
+		{`SELECT "unterminated`, `SELECT "unterminated`},
+		{"SELECT 1 /* unterminated", "SELECT ? /* unterminated"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, RedactLiterals(test.query), test.query)
+	}
+}
+
+func TestConfig_SetQueryRedaction(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.False(t, testConf.IsQueryRedaction())
+	assert.Nil(t, testConf.GetQueryRedactor())
+	assert.Equal(t, "SELECT 1", testConf.redactQuery("SELECT 1"))
+
+	testConf.SetQueryRedaction(true)
+	assert.True(t, testConf.IsQueryRedaction())
+	assert.Equal(t, "SELECT ?", testConf.redactQuery("SELECT 1"))
+
+	// a custom redactor takes precedence
+	testConf.SetQueryRedactor(func(string) string { return "redacted" })
+	assert.Equal(t, "redacted", testConf.redactQuery("SELECT 1"))
+
+	testConf.SetQueryRedactor(nil)
+	testConf.SetQueryRedaction(false)
+	assert.Nil(t, testConf.GetQueryRedactor())
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// redisKeyPrefix is the prefix of the keys of the result cache in Redis.
+const redisKeyPrefix = DriverName + ":result:"
+
+// redisIdleConns is the max number of idle connections kept by a RedisResultCache.
+const redisIdleConns = 8
+
+// RedisResultCache is a ResultCache in Redis, so the rows are shared by the processes using the same Redis
+// server, and expired by Redis. It speaks the Redis protocol itself, so it needs no Redis client. Values
+// larger than the proto-max-bulk-len of the server, 512 MB by default, are not cached.
+type RedisResultCache struct {
+	address  string
+	password string
+	db       int
+	dialer   net.Dialer
+	idle     chan *redisConn
+}
+
+// NewRedisResultCache is to create a ResultCache in the Redis server at address, like localhost:6379, in database
+// db. The connections are authenticated with password if it isn't empty.
+func NewRedisResultCache(address string, password string, db int) *RedisResultCache {
+	return &RedisResultCache{
+		address:  address,
+		password: password,
+		db:       db,
+		idle:     make(chan *redisConn, redisIdleConns),
+	}
+}
+
+// Get is to implement ResultCache.
+func (r *RedisResultCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := r.do(ctx, "GET", redisKeyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected Redis reply %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set is to implement ResultCache.
+func (r *RedisResultCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	_, err := r.do(ctx, "SET", redisKeyPrefix+key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// Close is to close the idle connections.
+func (r *RedisResultCache) Close() error {
+	for {
+		select {
+		case conn := <-r.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do is to send a command on an idle connection, or a new one, and read its reply. The connection is kept
+// unless the command failed with a network error.
+func (r *RedisResultCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	var conn *redisConn
+	select {
+	case conn = <-r.idle:
+	default:
+		var err error
+		if conn, err = r.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := conn.do(ctx, args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case r.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+func (r *RedisResultCache) dial(ctx context.Context) (*redisConn, error) {
+	netConn, err := r.dialer.DialContext(ctx, "tcp", r.address)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+	if r.password != "" {
+		if _, err = conn.do(ctx, "AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err = conn.do(ctx, "SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply of Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn is a connection to Redis.
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// do is to send a command and read its reply, which is nil, a string, an int64 or []byte.
+func (c *redisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed Redis reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			// $-1 is a missing value
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, fmt.Errorf("unexpected Redis reply %q", line)
+}
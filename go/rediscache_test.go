@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis is a Redis server serving GET and SET, ignoring the expiration.
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	r := &fakeRedis{listener: listener, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, _ = reader.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			data := make([]byte, size+2)
+			io.ReadFull(reader, data)
+			args[i] = string(data[:size])
+		}
+		r.mu.Lock()
+		r.commands = append(r.commands, args[0])
+		reply := "+OK\r\n"
+		switch args[0] {
+		case "GET":
+			if value, ok := r.values[args[1]]; ok {
+				reply = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			r.values[args[1]] = args[2]
+		case "AUTH":
+			if args[1] != "secret" {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		}
+		r.mu.Unlock()
+		conn.Write([]byte(reply))
+	}
+}
+
+func TestRedisResultCache(t *testing.T) {
+	server := newFakeRedis(t)
+	cache := NewRedisResultCache(server.listener.Addr().String(), "secret", 2)
+	defer cache.Close()
+	ctx := context.Background()
+
+	_, found, err := cache.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.False(t, found)
+	assert.Nil(t, cache.Set(ctx, "k", []byte("v\r\n1"), time.Minute))
+	value, found, err := cache.Get(ctx, "k")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("v\r\n1"), value)
+	assert.Equal(t, "v\r\n1", server.values[redisKeyPrefix+"k"])
+	// the connection is reused
+	assert.Equal(t, []string{"AUTH", "SELECT", "GET", "SET", "GET"}, server.commands)
+
+	cache = NewRedisResultCache(server.listener.Addr().String(), "wrong", 0)
+	_, _, err = cache.Get(ctx, "k")
+	assert.Equal(t, redisError("WRONGPASS invalid password"), err)
+}
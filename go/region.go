@@ -0,0 +1,64 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+)
+
+// regionalAthenaAPI is an Athena client of a fallback region.
+type regionalAthenaAPI struct {
+	region    string
+	athenaAPI athenaiface.AthenaAPI
+}
+
+// regionOutageFailures is the number of server errors in a row after which Athena of a region is taken as
+// unavailable. A single server error is retried in the same region, as Athena returns them now and then.
+const regionOutageFailures = 2
+
+// isServerError is to check if err is a server error of Athena, which may be transient.
+func isServerError(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		switch reqErr.StatusCode() {
+		case http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+// isRegionOutageError is to check if err, after failures errors in a row in the region, means the Athena
+// service of the region is unavailable, rather than the query or the request being wrong. Connection-level
+// errors mean an outage at once, the server errors only when they are repeated.
+func isRegionOutageError(err error, failures int) bool {
+	if _, ok := err.(awserr.RequestFailure); ok {
+		return isServerError(err) && failures >= regionOutageFailures
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == request.ErrCodeRequestError
+	}
+	return false
+}
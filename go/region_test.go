@@ -0,0 +1,45 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRegionOutageError(t *testing.T) {
+	assert.False(t, isRegionOutageError(nil, 1))
+	assert.False(t, isRegionOutageError(errors.New("boom"), regionOutageFailures))
+	assert.False(t, isRegionOutageError(awserr.NewRequestFailure(
+		awserr.New("InvalidRequestException", "bad query", nil), 400, "req"), regionOutageFailures))
+	assert.False(t, isRegionOutageError(awserr.NewRequestFailure(
+		awserr.New("InternalServerException", "oops", nil), 500, "req"), 1))
+	assert.True(t, isRegionOutageError(awserr.NewRequestFailure(
+		awserr.New("InternalServerException", "oops", nil), 500, "req"), regionOutageFailures))
+	assert.True(t, isRegionOutageError(awserr.NewRequestFailure(
+		awserr.New("ServiceUnavailable", "down", nil), 503, "req"), regionOutageFailures))
+	assert.True(t, isRegionOutageError(awserr.New(request.ErrCodeRequestError, "send request failed", nil), 1))
+	assert.False(t, isRegionOutageError(awserr.New(request.CanceledErrorCode, "canceled", nil), 1))
+}
@@ -24,6 +24,7 @@ package athenadriver
 type AthenaResult struct {
 	lastInsertedID int64
 	rowAffected    int64
+	queryID        string
 }
 
 // LastInsertId returns the database's auto-generated ID
@@ -37,3 +38,11 @@ func (a AthenaResult) LastInsertId() (int64, error) {
 func (a AthenaResult) RowsAffected() (int64, error) {
 	return a.rowAffected, nil
 }
+
+// QueryExecutionID returns the ID of the Athena query execution, to find it in the Athena console.
+// For a script of multiple statements, it is the ID of the last statement. database/sql wraps the driver.Result
+// of sql.DB.ExecContext, so it is reached by calling Connection.ExecContext in the function of sql.Conn.Raw, or
+// the IDs are collected with WithStats.
+func (a AthenaResult) QueryExecutionID() string {
+	return a.queryID
+}
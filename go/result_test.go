@@ -21,6 +21,7 @@
 package athenadriver
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -39,3 +40,17 @@ func TestAthenaResult_RowsAffected(t *testing.T) {
 	assert.Equal(t, r, int64(0))
 	assert.Nil(t, e)
 }
+
+func TestConnection_ExecContext_QueryExecutionID(t *testing.T) {
+	c := &Connection{
+		athenaAPI: &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		connector: NoopsSQLConnector(),
+	}
+	result, err := c.ExecContext(context.Background(), "INSERT INTO t VALUES (1)", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "PING_OK_QID", result.(AthenaResult).QueryExecutionID())
+
+	rows, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "PING_OK_QID", rows.(*Rows).QueryExecutionID())
+}
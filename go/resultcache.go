@@ -0,0 +1,323 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"go.uber.org/zap"
+)
+
+// ResultCache is where the rows of SELECT queries are kept, to serve the same queries again without running them,
+// set with Config.SetResultCache. Keys are hex strings made from the normalized query, its workgroup, catalog,
+// database and execution parameters, and the region and credentials of the Config, values are the encoded raw
+// rows, which are converted to Go values with the column masks of the Config reading them.
+type ResultCache interface {
+	// Get is to get the value of key, found is false if it isn't cached or it is expired.
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	// Set is to cache value under key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// cachedResult is the encoding of the rows of a query in a ResultCache.
+type cachedResult struct {
+	QueryID string               `json:"queryID"`
+	Columns []*athena.ColumnInfo `json:"columns"`
+	Rows    [][]*string          `json:"rows"`
+}
+
+// memoryResultCache is a ResultCache in memory, evicting the least recently used values once their total size is
+// over maxBytes.
+type memoryResultCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	lru      *list.List // of *memoryEntry, most recently used first
+	entries  map[string]*list.Element
+	now      func() time.Time
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryResultCache is to create a ResultCache in memory, holding at most maxBytes of encoded rows. It is
+// shared by the connections of the connectors it is set in, but not by processes, see NewRedisResultCache
+// for that.
+func NewMemoryResultCache(maxBytes int) ResultCache {
+	return &memoryResultCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		now:      time.Now,
+	}
+}
+
+// Get is to implement ResultCache.
+func (m *memoryResultCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := e.Value.(*memoryEntry)
+	if !m.now().Before(entry.expires) {
+		m.remove(e)
+		return nil, false, nil
+	}
+	m.lru.MoveToFront(e)
+	return entry.value, true, nil
+}
+
+// Set is to implement ResultCache. Values larger than the cache are not cached.
+func (m *memoryResultCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok {
+		m.remove(e)
+	}
+	if len(value) > m.maxBytes {
+		return nil
+	}
+	m.entries[key] = m.lru.PushFront(&memoryEntry{key: key, value: value, expires: m.now().Add(ttl)})
+	m.size += len(value)
+	for m.size > m.maxBytes {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+func (m *memoryResultCache) remove(e *list.Element) {
+	entry := m.lru.Remove(e).(*memoryEntry)
+	delete(m.entries, entry.key)
+	m.size -= len(entry.value)
+}
+
+// normalizeQuery is to normalize query for the result cache keys, so queries only differing in the case of
+// keywords and identifiers, whitespace, comments or the final semicolon are the same. String literals and
+// quoted identifiers are kept as they are.
+func normalizeQuery(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	space := false
+	for i := 0; i < len(query); {
+		ch := query[i]
+		j := i + 1
+		switch {
+		case ch == '\'':
+			// '' is a quote in a string literal
+			for j < len(query) {
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					j++
+					break
+				}
+				j++
+			}
+		case ch == '"' || ch == '`':
+			if k := strings.IndexByte(query[j:], ch); k >= 0 {
+				j += k + 1
+			} else {
+				j = len(query)
+			}
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			if k := strings.IndexByte(query[i:], '\n'); k >= 0 {
+				j = i + k
+			} else {
+				j = len(query)
+			}
+			space, i = true, j
+			continue
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			if k := strings.Index(query[i+2:], "*/"); k >= 0 {
+				j = i + k + 4
+			} else {
+				j = len(query)
+			}
+			space, i = true, j
+			continue
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			space, i = true, j
+			continue
+		case 'A' <= ch && ch <= 'Z':
+			ch += 'a' - 'A'
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		if j == i+1 {
+			b.WriteByte(ch)
+		} else {
+			b.WriteString(query[i:j])
+		}
+		i = j
+	}
+	return strings.TrimRight(b.String(), "; ")
+}
+
+// resultCacheKey is the key of the rows of query in the result cache, empty if they aren't cached: without
+// a result cache, for the queries which aren't SELECT queries and for `pc:get_query_id`, which doesn't
+// return the rows. The caller is in the key, so the rows aren't served to a principal which can't read them.
+func (c *Connection) resultCacheKey(ctx context.Context, query string, params []*string, pseudoCommand string) string {
+	config := c.connector.config
+	if config.GetResultCache() == nil || !isResultCacheEnabled(ctx) || pseudoCommand != "" || !isUnloadable(query) {
+		return ""
+	}
+	h := sha256.New()
+	for _, s := range []string{config.GetRegion(), string(config.GetCredentialsMode()), config.GetAccessID(),
+		config.GetAWSProfile(), config.GetRoleARN(), config.GetExternalID(),
+		getWorkgroup(ctx, config).Name, getCatalog(ctx, config), getDatabase(ctx, config), normalizeQuery(query)} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	for _, p := range params {
+		h.Write([]byte(aws.StringValue(p)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// getCachedRows is to get the Rows of key from the result cache, nil if they aren't cached.
+func (c *Connection) getCachedRows(ctx context.Context, obs *DriverTracer, key string) *Rows {
+	config := c.connector.config
+	value, found, err := config.GetResultCache().Get(ctx, key)
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.resultcache.get").Inc(1)
+		obs.Log(WarnLevel, "result cache get failed", zap.String("error", err.Error()))
+		return nil
+	}
+	var result cachedResult
+	if found {
+		if err = jcf.Unmarshal(value, &result); err != nil {
+			obs.Scope().Counter(DriverName + ".failure.resultcache.decode").Inc(1)
+			obs.Log(WarnLevel, "result cache decode failed", zap.String("error", err.Error()))
+			found = false
+		}
+	}
+	if !found {
+		obs.Scope().Counter(DriverName + ".resultcache.miss").Inc(1)
+		return nil
+	}
+	obs.Scope().Counter(DriverName + ".resultcache.hit").Inc(1)
+	obs.Log(DebugLevel, "rows served from result cache", zap.String("queryID", result.QueryID),
+		zap.Int("rows", len(result.Rows)))
+	rows := make([]*athena.Row, len(result.Rows))
+	for i, data := range result.Rows {
+		rows[i] = genRow(data)
+	}
+	r := &Rows{
+		ctx:     ctx,
+		queryID: result.QueryID,
+		config:  config,
+		tracer:  obs,
+		ResultOutput: &athena.GetQueryResultsOutput{
+			ResultSet: &athena.ResultSet{
+				ResultSetMetadata: &athena.ResultSetMetadata{ColumnInfo: result.Columns},
+				Rows:              rows,
+			},
+		},
+		reachedLastPage: len(rows) == 0,
+	}
+	r.initColumnTypes()
+	return r
+}
+
+// resultRecorder collects the raw rows read from Rows, to cache them once they are all read.
+type resultRecorder struct {
+	cache   ResultCache
+	key     string
+	ttl     time.Duration
+	maxRows int
+	rows    [][]*string
+}
+
+// withResultCache is to cache the rows of key once they are all read, if they are at most the max rows of the
+// result cache. The rows of UNLOAD queries are not cached, as they are not read as strings.
+func (c *Connection) withResultCache(rows *Rows, key string) {
+	if key == "" || rows.unload != nil {
+		return
+	}
+	config := c.connector.config
+	rows.recorder = &resultRecorder{
+		cache:   config.GetResultCache(),
+		key:     key,
+		ttl:     config.GetResultCacheTTL(),
+		maxRows: config.GetResultCacheMaxRows(),
+	}
+}
+
+// recordRow is to record the raw row data, giving up once the rows are over the max rows of the result cache.
+func (r *Rows) recordRow(data []*athena.Datum) {
+	if r.recorder == nil {
+		return
+	}
+	if len(r.recorder.rows) >= r.recorder.maxRows {
+		r.tracer.Scope().Counter(DriverName + ".resultcache.toolarge").Inc(1)
+		r.recorder = nil
+		return
+	}
+	row := make([]*string, len(data))
+	for i, d := range data {
+		if d != nil {
+			row[i] = d.VarCharValue
+		}
+	}
+	r.recorder.rows = append(r.recorder.rows, row)
+}
+
+// storeResult is to cache the recorded rows once Next is done with err, if it is io.EOF.
+func (r *Rows) storeResult(err error) {
+	recorder := r.recorder
+	r.recorder = nil
+	if err != io.EOF {
+		return
+	}
+	value, err := jcf.Marshal(cachedResult{
+		QueryID: r.queryID,
+		Columns: r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo,
+		Rows:    recorder.rows,
+	})
+	if err == nil {
+		err = recorder.cache.Set(r.ctx, recorder.key, value, recorder.ttl)
+	}
+	if err != nil {
+		r.tracer.Scope().Counter(DriverName + ".failure.resultcache.set").Inc(1)
+		r.tracer.Log(WarnLevel, "result cache set failed", zap.String("error", err.Error()))
+		return
+	}
+	r.tracer.Scope().Counter(DriverName + ".resultcache.store").Inc(1)
+}
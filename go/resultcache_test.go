@@ -0,0 +1,174 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "select 1"},
+		{"  select\n\t1 ;", "select 1"},
+		{"SELECT a FROM T WHERE b = 'Mixed  Case'", "select a from t where b = 'Mixed  Case'"},
+		{"SELECT 'it''s  A'", "select 'it''s  A'"},
+		{`SELECT "Col  1" FROM "DB"."T"`, `select "Col  1" from "DB"."T"`},
+		{"SELECT 1 -- Comment\nFROM t", "select 1 from t"},
+		{"/* traceparent=00-1 */ SELECT 1", "select 1"},
+		{"SELECT 1/*x*/+2", "select 1 +2"},
+		{"SELECT 'unterminated", "select 'unterminated"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, normalizeQuery(test.query), test.query)
+	}
+}
+
+func TestMemoryResultCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryResultCache(10).(*memoryResultCache)
+	now := time.Unix(0, 0)
+	cache.now = func() time.Time { return now }
+
+	assert.Nil(t, cache.Set(ctx, "a", []byte("1234"), time.Minute))
+	assert.Nil(t, cache.Set(ctx, "b", []byte("5678"), time.Second))
+	value, found, err := cache.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("1234"), value)
+
+	// b is the least recently used
+	assert.Nil(t, cache.Set(ctx, "c", []byte("90"), time.Minute))
+	assert.Nil(t, cache.Set(ctx, "d", []byte("12"), time.Minute))
+	_, found, _ = cache.Get(ctx, "b")
+	assert.False(t, found)
+	_, found, _ = cache.Get(ctx, "a")
+	assert.True(t, found)
+	assert.Equal(t, 8, cache.size)
+
+	// values larger than the cache are not cached
+	assert.Nil(t, cache.Set(ctx, "a", make([]byte, 11), time.Minute))
+	_, found, _ = cache.Get(ctx, "a")
+	assert.False(t, found)
+
+	now = now.Add(time.Minute)
+	_, found, _ = cache.Get(ctx, "c")
+	assert.False(t, found)
+	assert.Equal(t, 2, cache.size)
+}
+
+func readAll(t *testing.T, rows driver.Rows) [][]driver.Value {
+	var got [][]driver.Value
+	for {
+		dest := make([]driver.Value, len(rows.Columns()))
+		if err := rows.Next(dest); err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+		got = append(got, dest)
+	}
+	assert.Nil(t, rows.Close())
+	return got
+}
+
+func TestConnection_QueryContext_ResultCache(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultCache(NewMemoryResultCache(1 << 20))
+	ctx := context.Background()
+
+	rows, err := c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	want := readAll(t, rows)
+	assert.NotEmpty(t, want)
+	assert.Len(t, athenaClient.inputs, 1)
+
+	rows, err = c.QueryContext(ctx, "select 1; -- again", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 1)
+	assert.Equal(t, "PING_OK_QID", rows.(*Rows).QueryExecutionID())
+	assert.Equal(t, want, readAll(t, rows))
+
+	// another database is another query
+	rows, err = c.QueryContext(WithDatabase(ctx, "other"), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 2)
+
+	// the rows cached for one principal aren't served to another one
+	other := &Connection{athenaAPI: athenaClient, connector: NoopsSQLConnector()}
+	other.connector.config.SetResultCache(c.connector.config.GetResultCache())
+	assert.Nil(t, other.connector.config.SetAssumeRole("arn:aws:iam::123456789012:role/other", "", ""))
+	_, err = other.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 3)
+
+	// rows not read to the end are not cached
+	assert.Nil(t, rows.Close())
+	_, err = c.QueryContext(WithDatabase(ctx, "other"), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 4)
+
+	// only SELECT queries are cached
+	for i := 0; i < 2; i++ {
+		rows, err = c.QueryContext(ctx, "SHOW TABLES", nil)
+		assert.Nil(t, err)
+		readAll(t, rows)
+	}
+	assert.Len(t, athenaClient.inputs, 6)
+
+	// the queries with the opt-out are neither served from the cache nor kept in it
+	rows, err = c.QueryContext(WithoutResultCache(ctx), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 7)
+	readAll(t, rows)
+	rows, err = c.QueryContext(WithoutResultCache(WithDatabase(ctx, "opt-out")), "SELECT 1", nil)
+	assert.Nil(t, err)
+	readAll(t, rows)
+	_, err = c.QueryContext(WithDatabase(ctx, "opt-out"), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.inputs, 9)
+
+	// nor the pings
+	c.connector.config.SetPingProbe(PingProbeQuery)
+	assert.Nil(t, c.Ping(ctx))
+	assert.Len(t, athenaClient.inputs, 10)
+}
+
+func TestRows_RecordRow_MaxRows(t *testing.T) {
+	r := &Rows{tracer: NewNoOpsObservability(), recorder: &resultRecorder{maxRows: 1}}
+	r.recordRow(genRow([]*string{aws.String("a"), nil}).Data)
+	assert.Equal(t, [][]*string{{aws.String("a"), nil}}, r.recorder.rows)
+	// results over the max rows are not cached
+	r.recordRow(genRow([]*string{aws.String("b"), nil}).Data)
+	assert.Nil(t, r.recorder)
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"go.uber.org/zap"
+)
+
+// MaxResultReapInterval is the max interval between the deletions of the result objects older than the
+// result TTL of Config.
+const MaxResultReapInterval = time.Hour
+
+// MinResultReapInterval is the min interval between the deletions of the result objects, so a short result
+// TTL doesn't list the output locations all the time.
+const MinResultReapInterval = time.Minute
+
+// resultObjectPattern is to match the names of the result objects of Athena, like <query id>.csv and
+// <query id>.csv.metadata. The data of CTAS and UNLOAD queries, and the results saved by the console, are
+// in other prefixes.
+var resultObjectPattern = regexp.MustCompile(`^[0-9a-f-]{36}(?:\.csv|\.txt)?(?:\.metadata)?$`)
+
+// withResultCleanup is to delete the result object of the query execution and its metadata when the rows are
+// closed, if Config sets the result cleanup and the query can't reuse its result later.
+func (c *Connection) withResultCleanup(ctx context.Context, rows *Rows, execution *athena.QueryExecution) {
+	if !c.connector.config.IsResultCleanup() || c.s3API == nil || execution == nil ||
+		execution.ResultConfiguration == nil || getResultReuse(ctx, c.connector.config).Enabled {
+		return
+	}
+	rows.s3API = c.s3API
+	rows.resultLocation = aws.StringValue(execution.ResultConfiguration.OutputLocation)
+}
+
+// deleteResult is to delete the result object of the rows and its metadata. It uses a new context, as the
+// context of the query is often done once the rows are closed.
+func (r *Rows) deleteResult() {
+	u, err := url.Parse(r.resultLocation)
+	if err == nil {
+		key := strings.TrimPrefix(u.Path, "/")
+		var out *s3.DeleteObjectsOutput
+		out, err = r.s3API.DeleteObjectsWithContext(context.Background(), &s3.DeleteObjectsInput{
+			Bucket:              aws.String(u.Host),
+			ExpectedBucketOwner: r.config.expectedBucketOwner(),
+			RequestPayer:        r.config.requestPayer(),
+			Delete: &s3.Delete{
+				Objects: []*s3.ObjectIdentifier{{Key: aws.String(key)}, {Key: aws.String(key + ".metadata")}},
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err == nil {
+			err = deleteObjectsError(out)
+		}
+	}
+	if err != nil {
+		r.tracer.Scope().Counter(DriverName + ".failure.resultcleanup").Inc(1)
+		r.tracer.Log(WarnLevel, "result cleanup failed",
+			zap.String("queryID", r.queryID),
+			zap.String("location", r.resultLocation),
+			zap.String("error", err.Error()))
+		return
+	}
+	r.tracer.Scope().Counter(DriverName + ".resultcleanup").Inc(1)
+}
+
+// deleteObjectsError is to get the error of the objects DeleteObjects failed to delete, which it reports in its
+// output rather than in its error, nil if they are all deleted.
+func deleteObjectsError(out *s3.DeleteObjectsOutput) error {
+	if out == nil || len(out.Errors) == 0 {
+		return nil
+	}
+	e := out.Errors[0]
+	return fmt.Errorf("%d objects not deleted, like %s: %s: %s", len(out.Errors), aws.StringValue(e.Key),
+		aws.StringValue(e.Code), aws.StringValue(e.Message))
+}
+
+// resultReaper deletes the result objects older than the result TTL of Config from its output locations.
+type resultReaper struct {
+	s3API    s3iface.S3API
+	config   *Config
+	tracer   *DriverTracer
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newResultReaper(s3API s3iface.S3API, config *Config, obs *DriverTracer) *resultReaper {
+	return &resultReaper{
+		s3API:  s3API,
+		config: config,
+		tracer: obs,
+		stop:   make(chan struct{}),
+	}
+}
+
+// ttl is to get how long the result objects are kept: the result TTL of Config, or the max age of reused
+// results if result reuse is enabled in Config and it's longer, so the results Athena can still reuse are kept.
+func (r *resultReaper) ttl() time.Duration {
+	ttl := r.config.GetResultTTL()
+	if !r.config.IsResultReuse() {
+		return ttl
+	}
+	if maxAge := time.Duration(r.config.GetResultReuseMaxAge()) * time.Minute; maxAge > ttl {
+		return maxAge
+	}
+	return ttl
+}
+
+// run is to delete the expired result objects every result TTL, within MinResultReapInterval and
+// MaxResultReapInterval, until close.
+func (r *resultReaper) run() {
+	interval := r.ttl()
+	if interval > MaxResultReapInterval {
+		interval = MaxResultReapInterval
+	}
+	if interval < MinResultReapInterval {
+		interval = MinResultReapInterval
+	}
+	for {
+		r.reap(context.Background(), time.Now())
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (r *resultReaper) close() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+// reap is to delete the result objects last modified more than the ttl before now, in the output
+// locations of Config.
+func (r *resultReaper) reap(ctx context.Context, now time.Time) {
+	locations := map[string]bool{r.config.GetOutputBucket(): true}
+	for _, location := range r.config.GetWGOutputBuckets() {
+		locations[location] = true
+	}
+	expiry := now.Add(-r.ttl())
+	for location := range locations {
+		n, err := r.reapLocation(ctx, location, expiry)
+		if n > 0 {
+			r.tracer.Scope().Counter(DriverName + ".resultreaper.deleted").Inc(int64(n))
+			r.tracer.Log(DebugLevel, "expired results deleted", zap.String("location", location), zap.Int("objects", n))
+		}
+		if err != nil {
+			r.tracer.Scope().Counter(DriverName + ".failure.resultreaper").Inc(1)
+			r.tracer.Log(WarnLevel, "expired results deletion failed",
+				zap.String("location", location),
+				zap.String("error", err.Error()))
+		}
+	}
+}
+
+// reapLocation is to delete the result objects right under the S3 location last modified before expiry,
+// and get how many are deleted.
+func (r *resultReaper) reapLocation(ctx context.Context, location string, expiry time.Time) (int, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return 0, err
+	}
+	bucket, prefix := u.Host, strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	deleted := 0
+	var deleteErr error
+	err = r.s3API.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:              aws.String(bucket),
+		Prefix:              aws.String(prefix),
+		Delimiter:           aws.String("/"),
+		ExpectedBucketOwner: r.config.expectedBucketOwner(),
+		RequestPayer:        r.config.requestPayer(),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		var objects []*s3.ObjectIdentifier
+		for _, object := range page.Contents {
+			if resultObjectPattern.MatchString(strings.TrimPrefix(aws.StringValue(object.Key), prefix)) &&
+				aws.TimeValue(object.LastModified).Before(expiry) {
+				objects = append(objects, &s3.ObjectIdentifier{Key: object.Key})
+			}
+		}
+		if len(objects) == 0 {
+			return true
+		}
+		var out *s3.DeleteObjectsOutput
+		out, deleteErr = r.s3API.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket:              aws.String(bucket),
+			Delete:              &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+			ExpectedBucketOwner: r.config.expectedBucketOwner(),
+			RequestPayer:        r.config.requestPayer(),
+		})
+		if deleteErr == nil {
+			// the objects not deleted are in the output only
+			deleted += len(objects) - len(out.Errors)
+			deleteErr = deleteObjectsError(out)
+		}
+		return deleteErr == nil
+	})
+	if err != nil {
+		return deleted, err
+	}
+	return deleted, deleteErr
+}
+
+// Close is to stop deleting the expired result objects in the background, and is called by sql.DB.Close.
+func (c *SQLConnector) Close() error {
+	if c.resultReaper != nil {
+		c.resultReaper.close()
+	}
+	return nil
+}
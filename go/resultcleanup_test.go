@@ -0,0 +1,196 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+)
+
+// cleanupAthenaClient writes the results of the queries to s3://bucket/results/.
+type cleanupAthenaClient struct {
+	queryContextAthenaClient
+}
+
+func (m *cleanupAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	out, err := m.queryContextAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+	if err == nil {
+		out.QueryExecution.ResultConfiguration = &athena.ResultConfiguration{
+			OutputLocation: aws.String("s3://bucket/results/" + *input.QueryExecutionId + ".csv"),
+		}
+	}
+	return out, err
+}
+
+// cleanupS3Client lists the objects by bucket, and records the deleted ones. The failing ones are not deleted.
+type cleanupS3Client struct {
+	s3iface.S3API
+	objects map[string][]*s3.Object
+	failing map[string]bool
+	deleted []string
+}
+
+func (m *cleanupS3Client) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input,
+	fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	fn(&s3.ListObjectsV2Output{Contents: m.objects[*input.Bucket+"/"+*input.Prefix]}, true)
+	return nil
+}
+
+func (m *cleanupS3Client) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput,
+	opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	out := &s3.DeleteObjectsOutput{}
+	for _, object := range input.Delete.Objects {
+		if m.failing[*input.Bucket+"/"+*object.Key] {
+			out.Errors = append(out.Errors, &s3.Error{Key: object.Key, Code: aws.String("AccessDenied"),
+				Message: aws.String("Access Denied")})
+			continue
+		}
+		m.deleted = append(m.deleted, *input.Bucket+"/"+*object.Key)
+	}
+	return out, nil
+}
+
+func TestConnection_QueryContext_ResultCleanup(t *testing.T) {
+	s3Client := &cleanupS3Client{}
+	c := &Connection{
+		athenaAPI: &cleanupAthenaClient{
+			queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		},
+		s3API:     s3Client,
+		connector: NoopsSQLConnector(),
+	}
+	rows, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Empty(t, s3Client.deleted)
+
+	c.connector.config.SetResultCleanup(true)
+	rows, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Equal(t, []string{"bucket/results/PING_OK_QID.csv", "bucket/results/PING_OK_QID.csv.metadata"},
+		s3Client.deleted)
+	assert.Nil(t, rows.Close())
+	assert.Len(t, s3Client.deleted, 2)
+
+	// the results which can be reused are kept
+	rows, err = c.QueryContext(WithResultReuse(context.Background(), true, 60), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Len(t, s3Client.deleted, 2)
+
+	// the objects DeleteObjects fails to delete are failures
+	c.connector.config.SetMetrics(true)
+	scope := tally.NewTestScope("", nil)
+	c.connector.tracer.SetScope(scope)
+	s3Client.failing = map[string]bool{"bucket/results/PING_OK_QID.csv": true}
+	rows, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	assert.Len(t, s3Client.deleted, 3)
+	tags := "+caller=,database=default,resultmode=API,workgroup=primary"
+	counters := scope.Snapshot().Counters()
+	if assert.NotNil(t, counters[DriverName+".failure.resultcleanup"+tags]) {
+		assert.Equal(t, int64(1), counters[DriverName+".failure.resultcleanup"+tags].Value())
+	}
+	assert.Nil(t, counters[DriverName+".resultcleanup"+tags])
+}
+
+func TestResultReaper_Reap(t *testing.T) {
+	now := time.Now()
+	expired, fresh := aws.Time(now.Add(-25*time.Hour)), aws.Time(now.Add(-time.Hour))
+	s3Client := &cleanupS3Client{objects: map[string][]*s3.Object{
+		"bucket/results/": {
+			{Key: aws.String("results/c0a8e7a1-9f2b-4c3d-8e5f-1a2b3c4d5e6f.csv"), LastModified: expired},
+			{Key: aws.String("results/c0a8e7a1-9f2b-4c3d-8e5f-1a2b3c4d5e6f.csv.metadata"), LastModified: expired},
+			{Key: aws.String("results/d1b9f8b2-0a3c-4d4e-9f6a-2b3c4d5e6f7a.txt"), LastModified: fresh},
+			{Key: aws.String("results/report.csv"), LastModified: expired},
+		},
+		"etl/": {
+			{Key: aws.String("e2c0a9c3-1b4d-4e5f-8a7b-3c4d5e6f7a8b.csv"), LastModified: expired},
+		},
+	}}
+	config := NewNoOpsConfig()
+	assert.Nil(t, config.SetOutputBucket("s3://bucket/results"))
+	assert.Nil(t, config.SetWGOutputBuckets(map[string]string{"etl": "s3://etl/"}))
+	config.SetResultTTL(24 * time.Hour)
+	r := newResultReaper(s3Client, config, NewDefaultObservability(config))
+	r.reap(context.Background(), now)
+	assert.ElementsMatch(t, []string{
+		"bucket/results/c0a8e7a1-9f2b-4c3d-8e5f-1a2b3c4d5e6f.csv",
+		"bucket/results/c0a8e7a1-9f2b-4c3d-8e5f-1a2b3c4d5e6f.csv.metadata",
+		"etl/e2c0a9c3-1b4d-4e5f-8a7b-3c4d5e6f7a8b.csv",
+	}, s3Client.deleted)
+
+	// the objects DeleteObjects fails to delete are not counted
+	s3Client.deleted = nil
+	s3Client.failing = map[string]bool{"etl/e2c0a9c3-1b4d-4e5f-8a7b-3c4d5e6f7a8b.csv": true}
+	n, err := r.reapLocation(context.Background(), "s3://etl/", now.Add(-24*time.Hour))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, "1 objects not deleted, like e2c0a9c3-1b4d-4e5f-8a7b-3c4d5e6f7a8b.csv: AccessDenied: Access Denied",
+		err.Error())
+	assert.Empty(t, s3Client.deleted)
+}
+
+func TestResultReaper_TTL_ResultReuse(t *testing.T) {
+	now := time.Now()
+	s3Client := &cleanupS3Client{objects: map[string][]*s3.Object{
+		"bucket/": {
+			{Key: aws.String("c0a8e7a1-9f2b-4c3d-8e5f-1a2b3c4d5e6f.csv"), LastModified: aws.Time(now.Add(-time.Hour))},
+		},
+	}}
+	config := NewNoOpsConfig()
+	assert.Nil(t, config.SetOutputBucket("s3://bucket/"))
+	config.SetResultTTL(30 * time.Minute)
+	assert.Nil(t, config.SetResultReuse(true, 120))
+	r := newResultReaper(s3Client, config, NewDefaultObservability(config))
+	// the results are kept as long as they can be reused
+	assert.Equal(t, 2*time.Hour, r.ttl())
+	r.reap(context.Background(), now)
+	assert.Nil(t, s3Client.deleted)
+
+	assert.Nil(t, config.SetResultReuse(false, 0))
+	assert.Equal(t, 30*time.Minute, r.ttl())
+	r.reap(context.Background(), now)
+	assert.Len(t, s3Client.deleted, 1)
+}
+
+func TestSQLConnector_Close_ResultReaper(t *testing.T) {
+	config := NewNoOpsConfig()
+	config.SetResultTTL(time.Millisecond)
+	c := NewConnectorWithClients(config, newMockAthenaClient(), &cleanupS3Client{})
+	_, err := c.Connect(context.Background())
+	assert.Nil(t, err)
+	assert.NotNil(t, c.resultReaper)
+	assert.Nil(t, c.Close())
+	assert.Nil(t, c.Close())
+	assert.Nil(t, NoopsSQLConnector().Close())
+}
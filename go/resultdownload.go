@@ -0,0 +1,306 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"go.uber.org/zap"
+)
+
+// ResultMode is how the rows of query results are fetched.
+type ResultMode string
+
+const (
+	// ResultModeAPI pages the results with GetQueryResults, 1000 rows at a time. It is the default mode.
+	ResultModeAPI ResultMode = "API"
+
+	// ResultModeDL downloads the CSV result object of SELECT queries from the S3 output location and
+	// streams the rows from it, which is much faster for large results.
+	// It needs s3:GetObject on the output location. Other statements are paged with GetQueryResults.
+	ResultModeDL ResultMode = "DL"
+
+	// ResultModeUnload wraps SELECT queries in UNLOAD to Parquet files under the output location, and
+	// reads the rows from them with Apache Arrow. Values keep their types instead of being parsed from text.
+	// The files are read one after the other, so the rows of queries with ORDER BY are only in order within
+	// each file, use ResultModeAPI or ResultModeDL for them.
+	// It needs s3:ListBucket and s3:GetObject on the output location. Other statements are paged with
+	// GetQueryResults.
+	ResultModeUnload ResultMode = "UNLOAD"
+)
+
+// isCSVResult is to check if the query wrote its result as CSV, which is the case for SELECT queries.
+// DDL statements write text results. The results encrypted client-side with CSE_KMS are only read with
+// GetQueryResults.
+func isCSVResult(execution *athena.QueryExecution) bool {
+	if execution == nil || aws.StringValue(execution.StatementType) != athena.StatementTypeDml ||
+		execution.ResultConfiguration == nil {
+		return false
+	}
+	if e := execution.ResultConfiguration.EncryptionConfiguration; e != nil &&
+		aws.StringValue(e.EncryptionOption) == athena.EncryptionOptionCseKms {
+		return false
+	}
+	return strings.HasSuffix(aws.StringValue(execution.ResultConfiguration.OutputLocation), ".csv")
+}
+
+// NewDownloadRows is to create Rows streaming the CSV result object of the query from S3.
+// The column metadata is still got with GetQueryResults.
+func NewDownloadRows(ctx context.Context, athenaAPI athenaiface.AthenaAPI, s3API s3iface.S3API,
+	execution *athena.QueryExecution, driverConfig *Config, obs *DriverTracer) (*Rows, error) {
+	queryID := aws.StringValue(execution.QueryExecutionId)
+	metadata, err := athenaAPI.GetQueryResultsWithContext(ctx, &athena.GetQueryResultsInput{
+		QueryExecutionId: aws.String(queryID),
+		MaxResults:       aws.Int64(1),
+	})
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.download.getqueryresults").Inc(1)
+		return nil, err
+	}
+	metadata.ResultSet.Rows = nil
+	metadata.NextToken = nil
+
+	location, err := url.Parse(aws.StringValue(execution.ResultConfiguration.OutputLocation))
+	if err != nil {
+		return nil, err
+	}
+	object, err := openObject(ctx, s3API, location.Host, strings.TrimPrefix(location.Path, "/"), driverConfig)
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.download.getobject").Inc(1)
+		obs.Log(ErrorLevel, "GetObject failed", zap.String("queryID", queryID), zap.String("error", err.Error()))
+		return nil, classifyError(queryID, err)
+	}
+	downloaded := &byteCounter{ReadCloser: object}
+	body, err := decompressedBody(downloaded)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	obs.Log(DebugLevel, "downloading query result",
+		zap.String("queryID", queryID),
+		zap.String("location", location.String()))
+	r := &Rows{
+		athena:       athenaAPI,
+		ctx:          ctx,
+		queryID:      queryID,
+		ResultOutput: metadata,
+		config:       driverConfig,
+		tracer:       obs,
+		download:     newCSVResultReader(body),
+		downloaded:   downloaded,
+	}
+	// skip the header
+	if _, err = r.download.Read(); err != nil && err != io.EOF {
+		r.download.Close()
+		return nil, err
+	}
+	r.initColumnTypes()
+	obs.Scope().Counter(DriverName + ".download").Inc(1)
+	return r, nil
+}
+
+// nextDownloaded is to read the data of the next row from the downloaded result.
+func (r *Rows) nextDownloaded() ([]*athena.Datum, error) {
+	columns := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo
+	for {
+		record, err := r.download.Read()
+		if err != nil {
+			r.reachedLastPage = true
+			if err != io.EOF {
+				r.tracer.Scope().Counter(DriverName + ".failure.download.read").Inc(1)
+				r.tracer.Log(ErrorLevel, "reading result failed", zap.String("error", err.Error()))
+			}
+			return nil, err
+		}
+		if len(record) != len(columns) {
+			r.tracer.Scope().Counter(DriverName + ".download.raggedrow").Inc(1)
+			r.tracer.Log(WarnLevel, "ragged result row",
+				zap.String("queryID", r.queryID),
+				zap.Int("fields", len(record)),
+				zap.Int("columns", len(columns)))
+			switch policy := r.config.GetRaggedRowPolicy(); {
+			case policy == RaggedRowSkip:
+				continue
+			case policy == RaggedRowPad && len(record) < len(columns):
+				record = append(record, make([]*string, len(columns)-len(record))...)
+			default:
+				return nil, csv.ErrFieldCount
+			}
+		}
+		data := make([]*athena.Datum, len(record))
+		for i, field := range record {
+			data[i] = &athena.Datum{VarCharValue: field}
+		}
+		return data, nil
+	}
+}
+
+// RaggedRowPolicy is what is done with the rows of CSV results in ResultModeDL, which don't have a field
+// for every column.
+type RaggedRowPolicy string
+
+const (
+	// RaggedRowError fails the result with csv.ErrFieldCount. It is the default policy.
+	RaggedRowError RaggedRowPolicy = "error"
+
+	// RaggedRowPad reads the missing trailing fields of short rows as NULL. Long rows still fail.
+	RaggedRowPad RaggedRowPolicy = "pad"
+
+	// RaggedRowSkip skips ragged rows.
+	RaggedRowSkip RaggedRowPolicy = "skip"
+)
+
+// gzipMagic is the first bytes of gzip streams.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// byteCounter is a reader counting the bytes read.
+type byteCounter struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *byteCounter) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// readCloser is a reader with the Close of another one.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// decompressedBody is to decompress the body of a result object if it is gzip compressed, like the results
+// of CTAS or UNLOAD with compression = 'GZIP'. Objects are checked by content, whatever their key or metadata.
+func decompressedBody(body io.ReadCloser) (io.ReadCloser, error) {
+	r := bufio.NewReader(body)
+	if magic, _ := r.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return readCloser{Reader: r, Closer: body}, nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{Reader: gz, Closer: body}, nil
+}
+
+// csvResultReader is an incremental reader of the CSV results of Athena.
+// Unlike csv.Reader, it tells unquoted empty fields, which are NULL, from quoted empty strings.
+type csvResultReader struct {
+	body io.ReadCloser
+	r    *bufio.Reader
+}
+
+func newCSVResultReader(body io.ReadCloser) *csvResultReader {
+	return &csvResultReader{
+		body: body,
+		r:    bufio.NewReaderSize(body, 1<<16),
+	}
+}
+
+// Read is to read the next record. NULL fields are nil.
+func (c *csvResultReader) Read() ([]*string, error) {
+	var record []*string
+	for {
+		field, last, err := c.readField()
+		if err == io.EOF && record == nil && field == nil {
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		record = append(record, field)
+		if last || err == io.EOF {
+			return record, nil
+		}
+	}
+}
+
+// readField is to read the next field, last is true if the field ends the record.
+func (c *csvResultReader) readField() (field *string, last bool, err error) {
+	b, err := c.r.ReadByte()
+	if err != nil {
+		return nil, true, err
+	}
+	if b != '"' {
+		var buf []byte
+		for ; b != ',' && b != '\n'; b, err = c.r.ReadByte() {
+			if err != nil {
+				break
+			}
+			buf = append(buf, b)
+		}
+		if len(buf) > 0 && buf[len(buf)-1] == '\r' && b == '\n' {
+			buf = buf[:len(buf)-1]
+		}
+		if len(buf) > 0 {
+			s := string(buf)
+			field = &s
+		}
+		return field, b != ',' || err != nil, err
+	}
+	var buf []byte
+	for {
+		if b, err = c.r.ReadByte(); err != nil {
+			return nil, true, io.ErrUnexpectedEOF
+		}
+		if b != '"' {
+			buf = append(buf, b)
+			continue
+		}
+		b, err = c.r.ReadByte()
+		switch {
+		case err == io.EOF, err == nil && b == '\n':
+			last = true
+		case err != nil:
+			return nil, true, err
+		case b == '"':
+			buf = append(buf, '"')
+			continue
+		case b == '\r':
+			if b, err = c.r.ReadByte(); err != nil || b != '\n' {
+				return nil, true, csv.ErrQuote
+			}
+			last = true
+		case b != ',':
+			return nil, true, csv.ErrQuote
+		}
+		s := string(buf)
+		return &s, last, nil
+	}
+}
+
+// Close is to close the result object.
+func (c *csvResultReader) Close() error {
+	return c.body.Close()
+}
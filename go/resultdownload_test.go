@@ -0,0 +1,263 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql/driver"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+func readCSVResult(t *testing.T, body io.ReadCloser) ([][]*string, error) {
+	reader := newCSVResultReader(body)
+	defer reader.Close()
+	var records [][]*string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func csvBody(data string) io.ReadCloser {
+	return ioutil.NopCloser(strings.NewReader(data))
+}
+
+func TestCSVResultReader(t *testing.T) {
+	records, err := readCSVResult(t, csvBody("\"id\",\"name\",\"note\"\n\"1\",\"a \"\"b\"\", c\",\"\"\n\"2\",,\"line\nbreak\"\r\n\"3\",\"x\","))
+	assert.Nil(t, err)
+	assert.Len(t, records, 4)
+	assert.Equal(t, []string{"id", "name", "note"}, aws.StringValueSlice(records[0]))
+	assert.Equal(t, []string{"1", `a "b", c`, ""}, aws.StringValueSlice(records[1]))
+	assert.NotNil(t, records[1][2])
+	assert.Nil(t, records[2][1])
+	assert.Equal(t, "line\nbreak", *records[2][2])
+	assert.Equal(t, "3", *records[3][0])
+	assert.Nil(t, records[3][2])
+
+	records, err = readCSVResult(t, csvBody(""))
+	assert.Nil(t, err)
+	assert.Empty(t, records)
+
+	_, err = readCSVResult(t, csvBody("\"1\",\"unterminated\n"))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = readCSVResult(t, csvBody("\"1\"x,\"2\"\n"))
+	assert.Equal(t, csv.ErrQuote, err)
+}
+
+type downloadS3Client struct {
+	s3iface.S3API
+	objects map[string]string
+}
+
+func (m *downloadS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput,
+	opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(strings.NewReader(m.objects[*input.Bucket+"/"+*input.Key])),
+	}, nil
+}
+
+type downloadAthenaClient struct {
+	queryContextAthenaClient
+	statementType string
+}
+
+func (m *downloadAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	ext := ".csv"
+	if m.statementType != athena.StatementTypeDml {
+		ext = ".txt"
+	}
+	return &athena.GetQueryExecutionOutput{
+		QueryExecution: &athena.QueryExecution{
+			QueryExecutionId: input.QueryExecutionId,
+			StatementType:    aws.String(m.statementType),
+			Status:           &athena.QueryExecutionStatus{State: aws.String(athena.QueryExecutionStateSucceeded)},
+			ResultConfiguration: &athena.ResultConfiguration{
+				OutputLocation: aws.String("s3://results/athena/" + *input.QueryExecutionId + ext),
+			},
+		},
+	}, nil
+}
+
+func (m *downloadAthenaClient) GetQueryResultsWithContext(ctx aws.Context, input *athena.GetQueryResultsInput,
+	opts ...request.Option) (*athena.GetQueryResultsOutput, error) {
+	return &athena.GetQueryResultsOutput{
+		ResultSet: &athena.ResultSet{
+			ResultSetMetadata: &athena.ResultSetMetadata{
+				ColumnInfo: []*athena.ColumnInfo{
+					newColumnInfo("id", "integer"),
+					newColumnInfo("name", "varchar"),
+				},
+			},
+			Rows: []*athena.Row{
+				newRow(2, []string{"id", "name"}),
+				newRow(2, []string{"1", "paged"}),
+			},
+		},
+	}, nil
+}
+
+func TestConnection_QueryContext_ResultModeDL(t *testing.T) {
+	athenaClient := &downloadAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		statementType:            athena.StatementTypeDml,
+	}
+	s3Client := &downloadS3Client{objects: map[string]string{
+		"results/athena/PING_OK_QID.csv": "\"id\",\"name\"\n\"1\",\"downloaded\"\n\"2\",\n",
+	}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API:     s3Client,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeDL)
+	c.connector.config.SetMissingAsEmptyString(false)
+
+	rows, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "name"}, rows.Columns())
+	dest := make([]driver.Value, 2)
+	assert.Nil(t, rows.Next(dest))
+	assert.Equal(t, []driver.Value{int32(1), "downloaded"}, dest)
+	// NULL is missing data
+	assert.NotNil(t, rows.Next(dest))
+	assert.Nil(t, rows.Close())
+
+	c.connector.config.SetMissingAsEmptyString(true)
+	rows, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Next(dest))
+	assert.Nil(t, rows.Next(dest))
+	assert.Equal(t, []driver.Value{int32(2), ""}, dest)
+	assert.Equal(t, io.EOF, rows.Next(dest))
+	assert.Nil(t, rows.Close())
+
+	// DDL results are paged with GetQueryResults
+	athenaClient.statementType = athena.StatementTypeDdl
+	rows, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Next(dest))
+	assert.Equal(t, []driver.Value{int32(1), "paged"}, dest)
+}
+
+func TestIsCSVResult(t *testing.T) {
+	execution := &athena.QueryExecution{
+		StatementType: aws.String(athena.StatementTypeDml),
+		ResultConfiguration: &athena.ResultConfiguration{
+			OutputLocation: aws.String("s3://results/qid.csv"),
+			EncryptionConfiguration: &athena.EncryptionConfiguration{
+				EncryptionOption: aws.String(athena.EncryptionOptionSseKms),
+			},
+		},
+	}
+	assert.True(t, isCSVResult(execution))
+	// client-side encrypted results are decrypted by GetQueryResults
+	execution.ResultConfiguration.EncryptionConfiguration.EncryptionOption = aws.String(athena.EncryptionOptionCseKms)
+	assert.False(t, isCSVResult(execution))
+	assert.False(t, isCSVResult(nil))
+}
+
+func TestDecompressedBody(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte("\"id\"\n\"1\"\n"))
+	assert.Nil(t, gz.Close())
+
+	for _, data := range []string{buf.String(), "\"id\"\n\"1\"\n"} {
+		body, err := decompressedBody(ioutil.NopCloser(strings.NewReader(data)))
+		assert.Nil(t, err)
+		records, err := readCSVResult(t, body)
+		assert.Nil(t, err)
+		assert.Len(t, records, 2)
+		assert.Equal(t, "1", *records[1][0])
+	}
+
+	// a truncated gzip header
+	_, err := decompressedBody(ioutil.NopCloser(bytes.NewReader(buf.Bytes()[:4])))
+	assert.NotNil(t, err)
+}
+
+func TestConnection_QueryContext_ResultModeDL_RaggedRows(t *testing.T) {
+	athenaClient := &downloadAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		statementType:            athena.StatementTypeDml,
+	}
+	s3Client := &downloadS3Client{objects: map[string]string{
+		"results/athena/PING_OK_QID.csv": "\"id\",\"name\"\n\"1\"\n\"2\",\"b\",\"c\"\n\"3\",\"c\"\n",
+	}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API:     s3Client,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeDL)
+	c.connector.config.SetMissingAsNil(true)
+
+	readAll := func() ([][]driver.Value, error) {
+		rows, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+		assert.Nil(t, err)
+		defer rows.Close()
+		var got [][]driver.Value
+		for {
+			dest := make([]driver.Value, 2)
+			if err := rows.Next(dest); err != nil {
+				if err == io.EOF {
+					return got, nil
+				}
+				return got, err
+			}
+			got = append(got, dest)
+		}
+	}
+
+	got, err := readAll()
+	assert.Equal(t, csv.ErrFieldCount, err)
+	assert.Empty(t, got)
+
+	c.connector.config.SetRaggedRowPolicy(RaggedRowPad)
+	got, err = readAll()
+	assert.Equal(t, csv.ErrFieldCount, err)
+	assert.Equal(t, [][]driver.Value{{int32(1), nil}}, got)
+
+	c.connector.config.SetRaggedRowPolicy(RaggedRowSkip)
+	got, err = readAll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]driver.Value{{int32(3), "c"}}, got)
+}
@@ -0,0 +1,509 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet/file"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"go.uber.org/zap"
+)
+
+// unloadLocationPattern matches the UNLOAD queries, after their leading comments, and captures their location.
+var unloadLocationPattern = regexp.MustCompile(`(?is)^(?:\s|/\*.*?\*/|--[^\n]*\n)*UNLOAD\s*\(.*\)\s*TO\s*'([^']+)'`)
+
+// unloadLocation is to get the S3 location of an UNLOAD query, empty if query isn't an UNLOAD query.
+func unloadLocation(query string) string {
+	if m := unloadLocationPattern.FindStringSubmatch(query); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// isUnloadable is to check if the query can be wrapped in UNLOAD.
+func isUnloadable(query string) bool {
+	nQuery := strings.TrimSpace(strings.ToLower(query))
+	return strings.HasPrefix(nQuery, "select") || strings.HasPrefix(nQuery, "with")
+}
+
+// newUnloadLocation is to get a new empty S3 location for the UNLOAD of a query, under the output location.
+func newUnloadLocation(ctx context.Context, config *Config) string {
+	return strings.TrimSuffix(getOutputLocation(ctx, config), "/") + "/unload/" + randString(16) + "/"
+}
+
+// unloadQuery is to wrap the query in UNLOAD to Parquet files in location, gzip compressed if set in Config.
+func unloadQuery(query string, location string, config *Config) string {
+	compression := ""
+	if config.IsResultCompression() {
+		compression = "GZIP"
+	}
+	return formatUnloadQuery(query, location, "PARQUET", compression)
+}
+
+// formatUnloadQuery is to wrap the query in UNLOAD to files in format to location, compressed if compression is set.
+func formatUnloadQuery(query string, location string, format string, compression string) string {
+	properties := fmt.Sprintf("format = '%s'", format)
+	if compression != "" {
+		properties += fmt.Sprintf(", compression = '%s'", compression)
+	}
+	return fmt.Sprintf("UNLOAD (%s) TO '%s' WITH (%s)", strings.TrimRight(query, "; \t\n"), location, properties)
+}
+
+// NewUnloadRows is to create Rows reading the Parquet files a query unloaded to location. The files are read in
+// the order of their keys, which isn't the order of the rows Athena wrote in parallel, so ORDER BY is kept within
+// each file only. The columns of an empty result, which has no file, are the ones of the query execution.
+func NewUnloadRows(ctx context.Context, athenaAPI athenaiface.AthenaAPI, s3API s3iface.S3API, queryID string,
+	location string, driverConfig *Config, obs *DriverTracer) (*Rows, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	reader := &parquetResultReader{
+		ctx:    ctx,
+		s3API:  s3API,
+		bucket: u.Host,
+		owner:  driverConfig.expectedBucketOwner(),
+		payer:  driverConfig.requestPayer(),
+	}
+	err = s3API.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:              aws.String(u.Host),
+		Prefix:              aws.String(strings.TrimPrefix(u.Path, "/")),
+		ExpectedBucketOwner: reader.owner,
+		RequestPayer:        reader.payer,
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			if aws.Int64Value(object.Size) > 0 {
+				reader.objects = append(reader.objects, object)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.unload.listobjects").Inc(1)
+		obs.Log(ErrorLevel, "ListObjectsV2 failed", zap.String("queryID", queryID), zap.String("error", err.Error()))
+		return nil, err
+	}
+	r := &Rows{
+		ctx:     ctx,
+		queryID: queryID,
+		ResultOutput: &athena.GetQueryResultsOutput{
+			ResultSet: &athena.ResultSet{ResultSetMetadata: &athena.ResultSetMetadata{}},
+		},
+		config: driverConfig,
+		tracer: obs,
+		unload: reader,
+	}
+	// no file is written for empty results
+	if len(reader.objects) == 0 {
+		r.reachedLastPage = true
+		out, err := athenaAPI.GetQueryResultsWithContext(ctx, &athena.GetQueryResultsInput{
+			QueryExecutionId: aws.String(queryID),
+			MaxResults:       aws.Int64(1),
+		})
+		if err != nil {
+			obs.Scope().Counter(DriverName + ".failure.unload.getqueryresults").Inc(1)
+			return nil, err
+		}
+		if out.ResultSet != nil && out.ResultSet.ResultSetMetadata != nil {
+			r.ResultOutput.ResultSet.ResultSetMetadata = out.ResultSet.ResultSetMetadata
+		}
+		r.initColumnTypes()
+		return r, nil
+	}
+	if err = reader.openNextFile(); err != nil {
+		return nil, err
+	}
+	for _, field := range reader.schema.Fields() {
+		r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo = append(
+			r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo, unloadColumnInfo(field))
+		if id := field.Type.ID(); id == arrow.DECIMAL128 || id == arrow.DECIMAL256 {
+			r.columnType = append(r.columnType, decimalScanType(driverConfig))
+		} else {
+			r.columnType = append(r.columnType, scanTypeOf(field.Type))
+		}
+	}
+	obs.Scope().Counter(DriverName + ".unload").Inc(1)
+	return r, nil
+}
+
+// nextUnloaded is to read the next row from the unloaded Parquet files.
+func (r *Rows) nextUnloaded(dest []driver.Value) error {
+	record, row, err := r.unload.next()
+	if err != nil {
+		r.reachedLastPage = true
+		if err != io.EOF {
+			r.tracer.Scope().Counter(DriverName + ".failure.unload.read").Inc(1)
+			r.tracer.Log(ErrorLevel, "reading unloaded result failed", zap.String("error", err.Error()))
+		}
+		return err
+	}
+	columns := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo
+	for i, column := range record.Columns() {
+		if maskedValue, masked := r.config.CheckColumnMasked(*columns[i].Name); masked {
+			dest[i] = maskedValue
+			continue
+		}
+		if column.IsNull(row) {
+			// like NULL in ResultModeAPI, by the missing value options in Config
+			if dest[i], err = r.athenaTypeToGoType(columns[i], nil, r.config); err != nil {
+				return err
+			}
+			continue
+		}
+		if *columns[i].Type == "decimal" {
+			if dest[i], err = convertDecimal(arrowValue(column, row).(string), r.config); err != nil {
+				return err
+			}
+			continue
+		}
+		dest[i] = arrowValue(column, row)
+	}
+	return nil
+}
+
+// parquetResultReader reads the records of Parquet files in S3 one after another.
+type parquetResultReader struct {
+	ctx    context.Context
+	s3API  s3iface.S3API
+	bucket string
+	// owner is the expected owner of the bucket, nil if it isn't checked.
+	owner *string
+	// payer is the RequestPayer of the requests, nil if the bucket owner pays.
+	payer   *string
+	objects []*s3.Object
+
+	schema  *arrow.Schema
+	records pqarrow.RecordReader
+	record  arrow.Record
+	row     int
+}
+
+// openNextFile is to open the next Parquet file. It returns io.EOF after the last file.
+func (p *parquetResultReader) openNextFile() error {
+	p.release()
+	if len(p.objects) == 0 {
+		return io.EOF
+	}
+	object := p.objects[0]
+	p.objects = p.objects[1:]
+	parquetReader, err := file.NewParquetReader(&s3ObjectReader{
+		ctx:    p.ctx,
+		s3API:  p.s3API,
+		bucket: p.bucket,
+		owner:  p.owner,
+		payer:  p.payer,
+		key:    aws.StringValue(object.Key),
+		size:   aws.Int64Value(object.Size),
+	})
+	if err != nil {
+		return err
+	}
+	fileReader, err := pqarrow.NewFileReader(parquetReader, pqarrow.ArrowReadProperties{BatchSize: 1024},
+		memory.DefaultAllocator)
+	if err != nil {
+		return err
+	}
+	if p.schema, err = fileReader.Schema(); err != nil {
+		return err
+	}
+	p.records, err = fileReader.GetRecordReader(p.ctx, nil, nil)
+	return err
+}
+
+// next is to get the record and the index of the next row.
+func (p *parquetResultReader) next() (arrow.Record, int, error) {
+	p.row++
+	for p.record == nil || p.row >= int(p.record.NumRows()) {
+		if p.records != nil && p.records.Next() {
+			p.record = p.records.Record()
+			p.row = 0
+			continue
+		}
+		if p.records != nil && p.records.Err() != nil && p.records.Err() != io.EOF {
+			return nil, 0, p.records.Err()
+		}
+		if err := p.openNextFile(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return p.record, p.row, nil
+}
+
+// nextRecord is to get the next record of the Parquet files, which is released by the reader. It returns io.EOF
+// after the last record.
+func (p *parquetResultReader) nextRecord() (arrow.Record, error) {
+	for {
+		if p.records != nil && p.records.Next() {
+			p.record = p.records.Record()
+			p.row = int(p.record.NumRows())
+			return p.record, nil
+		}
+		if p.records != nil && p.records.Err() != nil && p.records.Err() != io.EOF {
+			return nil, p.records.Err()
+		}
+		if err := p.openNextFile(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parquetResultReader) release() {
+	if p.records != nil {
+		p.records.Release()
+	}
+	p.records = nil
+	p.record = nil
+}
+
+// Close is to release the records read.
+func (p *parquetResultReader) Close() error {
+	p.release()
+	p.objects = nil
+	return nil
+}
+
+// s3ObjectReader is to read an S3 object at random offsets with range requests, like the footer and
+// the column chunks of a Parquet file, so the file is not downloaded as a whole.
+type s3ObjectReader struct {
+	ctx    context.Context
+	s3API  s3iface.S3API
+	bucket string
+	owner  *string
+	payer  *string
+	key    string
+	size   int64
+	offset int64
+}
+
+// ReadAt is to implement io.ReaderAt.
+func (o *s3ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > o.size {
+		end = o.size
+	}
+	object, err := o.s3API.GetObjectWithContext(o.ctx, &s3.GetObjectInput{
+		Bucket:              aws.String(o.bucket),
+		Key:                 aws.String(o.key),
+		Range:               aws.String(fmt.Sprintf("bytes=%d-%d", off, end-1)),
+		ExpectedBucketOwner: o.owner,
+		RequestPayer:        o.payer,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer object.Body.Close()
+	n, err := io.ReadFull(object.Body, p[:end-off])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Seek is to implement io.Seeker.
+func (o *s3ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+// unloadColumnInfo is to get the ColumnInfo of a field of the unloaded Parquet schema.
+func unloadColumnInfo(field arrow.Field) *athena.ColumnInfo {
+	info := newColumnInfo(field.Name, athenaTypeOf(field.Type))
+	nullable := athena.ColumnNullableNotNull
+	if field.Nullable {
+		nullable = athena.ColumnNullableNullable
+	}
+	info.Nullable = aws.String(nullable)
+	switch t := field.Type.(type) {
+	case *arrow.Decimal128Type:
+		info.Precision, info.Scale = aws.Int64(int64(t.Precision)), aws.Int64(int64(t.Scale))
+	case *arrow.Decimal256Type:
+		info.Precision, info.Scale = aws.Int64(int64(t.Precision)), aws.Int64(int64(t.Scale))
+	case *arrow.FixedSizeBinaryType:
+		info.Precision = aws.Int64(int64(t.ByteWidth))
+	default:
+		// Parquet doesn't keep the length of varchar(n)
+		info.Precision, info.Scale = aws.Int64(0), aws.Int64(0)
+	}
+	return info
+}
+
+// athenaTypeOf is to get the Athena type name of an Arrow type.
+func athenaTypeOf(t arrow.DataType) string {
+	switch t.ID() {
+	case arrow.INT8:
+		return "tinyint"
+	case arrow.INT16:
+		return "smallint"
+	case arrow.INT32:
+		return "integer"
+	case arrow.INT64:
+		return "bigint"
+	case arrow.FLOAT32:
+		return "real"
+	case arrow.FLOAT64:
+		return "double"
+	case arrow.BOOL:
+		return "boolean"
+	case arrow.STRING, arrow.LARGE_STRING:
+		return "varchar"
+	case arrow.BINARY, arrow.LARGE_BINARY, arrow.FIXED_SIZE_BINARY:
+		return "varbinary"
+	case arrow.DATE32, arrow.DATE64:
+		return "date"
+	case arrow.TIMESTAMP:
+		return "timestamp"
+	case arrow.DECIMAL128, arrow.DECIMAL256:
+		return "decimal"
+	case arrow.LIST, arrow.LARGE_LIST, arrow.FIXED_SIZE_LIST:
+		return "array"
+	case arrow.MAP:
+		return "map"
+	case arrow.STRUCT:
+		return "row"
+	default:
+		return "unknown"
+	}
+}
+
+// scanTypeOf is to get the Go type of the values arrowValue returns for an Arrow type.
+func scanTypeOf(t arrow.DataType) reflect.Type {
+	switch t.ID() {
+	case arrow.INT8:
+		return reflect.TypeOf(int8(0))
+	case arrow.INT16:
+		return reflect.TypeOf(int16(0))
+	case arrow.INT32:
+		return reflect.TypeOf(int32(0))
+	case arrow.INT64:
+		return reflect.TypeOf(int64(0))
+	case arrow.FLOAT32:
+		return reflect.TypeOf(float32(0))
+	case arrow.FLOAT64:
+		return reflect.TypeOf(float64(0))
+	case arrow.BOOL:
+		return reflect.TypeOf(false)
+	case arrow.BINARY, arrow.LARGE_BINARY, arrow.FIXED_SIZE_BINARY:
+		return reflect.TypeOf([]byte(nil))
+	case arrow.DATE32, arrow.DATE64, arrow.TIMESTAMP:
+		return reflect.TypeOf(time.Time{})
+	case arrow.LIST, arrow.LARGE_LIST, arrow.FIXED_SIZE_LIST:
+		return reflect.TypeOf([]interface{}{})
+	default:
+		return reflect.TypeOf("")
+	}
+}
+
+// arrowValue is to get the Go value at index i of an Arrow array, which is not NULL.
+func arrowValue(arr arrow.Array, i int) interface{} {
+	switch a := arr.(type) {
+	case *array.Int8:
+		return a.Value(i)
+	case *array.Int16:
+		return a.Value(i)
+	case *array.Int32:
+		return a.Value(i)
+	case *array.Int64:
+		return a.Value(i)
+	case *array.Float32:
+		return a.Value(i)
+	case *array.Float64:
+		return a.Value(i)
+	case *array.Boolean:
+		return a.Value(i)
+	case *array.String:
+		return a.Value(i)
+	case *array.LargeString:
+		return a.Value(i)
+	case *array.Binary:
+		return append([]byte(nil), a.Value(i)...)
+	case *array.LargeBinary:
+		return append([]byte(nil), a.Value(i)...)
+	case *array.FixedSizeBinary:
+		return append([]byte(nil), a.Value(i)...)
+	case *array.Date32:
+		return a.Value(i).ToTime()
+	case *array.Date64:
+		return a.Value(i).ToTime()
+	case *array.Timestamp:
+		return a.Value(i).ToTime(a.DataType().(*arrow.TimestampType).Unit)
+	case *array.Decimal128:
+		return a.Value(i).ToString(a.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		return a.Value(i).ToString(a.DataType().(*arrow.Decimal256Type).Scale)
+	case *array.List:
+		start, end := a.ValueOffsets(i)
+		return arrowListValue(a.ListValues(), int(start), int(end))
+	case *array.LargeList:
+		start, end := a.ValueOffsets(i)
+		return arrowListValue(a.ListValues(), int(start), int(end))
+	case *array.FixedSizeList:
+		n := int(a.DataType().(*arrow.FixedSizeListType).Len())
+		start := (a.Data().Offset() + i) * n
+		return arrowListValue(a.ListValues(), start, start+n)
+	default:
+		return arr.ValueStr(i)
+	}
+}
+
+// arrowListValue is to get the Go values from start to end of the values of an Arrow list.
+func arrowListValue(arr arrow.Array, start int, end int) []interface{} {
+	values := make([]interface{}, 0, end-start)
+	for j := start; j < end; j++ {
+		if arr.IsNull(j) {
+			values = append(values, nil)
+		} else {
+			values = append(values, arrowValue(arr, j))
+		}
+	}
+	return values
+}
@@ -0,0 +1,351 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/decimal128"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/compress"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// unloadS3Client serves the Parquet files of the UNLOAD in the last query.
+type unloadS3Client struct {
+	s3iface.S3API
+	athenaClient *queryContextAthenaClient
+	files        [][]byte
+	rangeReads   int
+}
+
+func (m *unloadS3Client) prefix() (string, string) {
+	query := *m.athenaClient.inputs[len(m.athenaClient.inputs)-1].QueryString
+	location := query[strings.Index(query, "TO '")+4:]
+	location = strings.TrimPrefix(location[:strings.Index(location, "'")], "s3://")
+	i := strings.Index(location, "/")
+	return location[:i], location[i+1:]
+}
+
+func (m *unloadS3Client) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input,
+	fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	bucket, prefix := m.prefix()
+	if *input.Bucket != bucket || *input.Prefix != prefix {
+		return fmt.Errorf("unexpected prefix s3://%s/%s", *input.Bucket, *input.Prefix)
+	}
+	page := &s3.ListObjectsV2Output{}
+	for i, f := range m.files {
+		page.Contents = append(page.Contents, &s3.Object{
+			Key:  aws.String(fmt.Sprintf("%s%d.parquet", prefix, i)),
+			Size: aws.Int64(int64(len(f))),
+		})
+	}
+	fn(page, true)
+	return nil
+}
+
+func (m *unloadS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput,
+	opts ...request.Option) (*s3.GetObjectOutput, error) {
+	_, prefix := m.prefix()
+	var i, start, end int
+	if _, err := fmt.Sscanf(strings.TrimPrefix(*input.Key, prefix), "%d.parquet", &i); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end); err != nil {
+		return nil, err
+	}
+	m.rangeReads++
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(bytes.NewReader(m.files[i][start : end+1])),
+	}, nil
+}
+
+func newParquetFile(t *testing.T, ids []int32, names []string, valid []bool, opts ...parquet.WriterProperty) []byte {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Millisecond}},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String)},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for i, id := range ids {
+		b.Field(0).(*array.Int32Builder).Append(id)
+		b.Field(1).(*array.StringBuilder).AppendValues([]string{names[i]}, []bool{valid[i]})
+		b.Field(2).(*array.TimestampBuilder).Append(arrow.Timestamp(int64(id) * 1000))
+		tags := b.Field(3).(*array.ListBuilder)
+		tags.Append(true)
+		tags.ValueBuilder().(*array.StringBuilder).AppendValues([]string{"a", names[i]}, nil)
+	}
+	record := b.NewRecord()
+	defer record.Release()
+	table := array.NewTableFromRecords(schema, []arrow.Record{record})
+	defer table.Release()
+	var buf bytes.Buffer
+	assert.Nil(t, pqarrow.WriteTable(table, &buf, 1024, parquet.NewWriterProperties(opts...), pqarrow.DefaultWriterProps()))
+	return buf.Bytes()
+}
+
+func TestConnection_QueryContext_ResultModeUnload(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	s3Client := &unloadS3Client{
+		athenaClient: athenaClient,
+		files: [][]byte{
+			newParquetFile(t, []int32{1, 2}, []string{"x", ""}, []bool{true, false}),
+			newParquetFile(t, []int32{3}, []string{"z"}, []bool{true}),
+		},
+	}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API:     s3Client,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeUnload)
+	c.connector.config.SetMissingAsNil(true)
+
+	rows, err := c.QueryContext(context.Background(), "SELECT id, name, ts, tags FROM t;", nil)
+	assert.Nil(t, err)
+	bucket, prefix := s3Client.prefix()
+	assert.Equal(t, fmt.Sprintf("UNLOAD (SELECT id, name, ts, tags FROM t) TO 's3://%s/%s' WITH (format = 'PARQUET')",
+		bucket, prefix), *athenaClient.inputs[0].QueryString)
+	assert.True(t, strings.HasPrefix("s3://"+bucket+"/"+prefix, c.connector.config.GetOutputBucket()+"unload/"))
+
+	assert.Equal(t, []string{"id", "name", "ts", "tags"}, rows.Columns())
+	typed := rows.(driver.RowsColumnTypeDatabaseTypeName)
+	assert.Equal(t, "integer", typed.ColumnTypeDatabaseTypeName(0))
+	assert.Equal(t, "timestamp", typed.ColumnTypeDatabaseTypeName(2))
+	assert.Equal(t, "array", typed.ColumnTypeDatabaseTypeName(3))
+
+	var got [][]driver.Value
+	for {
+		dest := make([]driver.Value, 4)
+		if err := rows.Next(dest); err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+		got = append(got, dest)
+	}
+	assert.Nil(t, rows.Close())
+	assert.Equal(t, [][]driver.Value{
+		{int32(1), "x", time.Unix(1, 0).UTC(), []interface{}{"a", "x"}},
+		{int32(2), nil, time.Unix(2, 0).UTC(), []interface{}{"a", ""}},
+		{int32(3), "z", time.Unix(3, 0).UTC(), []interface{}{"a", "z"}},
+	}, got)
+	assert.True(t, s3Client.rangeReads > 0)
+
+	// only SELECT queries are unloaded
+	_, err = c.QueryContext(context.Background(), "SHOW TABLES", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "SHOW TABLES", *athenaClient.inputs[1].QueryString)
+}
+
+func TestNewUnloadRows_Empty(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API:     &unloadS3Client{athenaClient: athenaClient},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeUnload)
+	rows, err := c.QueryContext(context.Background(), "SELECT 1 WHERE false", nil)
+	assert.Nil(t, err)
+	// the columns are the ones of the query execution
+	assert.Equal(t, []string{"_col0"}, rows.Columns())
+	assert.Equal(t, io.EOF, rows.Next(make([]driver.Value, 1)))
+
+	reader, err := c.QueryArrow(context.Background(), "SELECT 1 WHERE false")
+	assert.Nil(t, err)
+	defer reader.Release()
+	assert.Equal(t, []string{"_col0"}, []string{reader.Schema().Field(0).Name})
+	assert.False(t, reader.Next())
+	assert.Nil(t, reader.Err())
+}
+
+func TestConnection_QueryContext_ResultModeUnload_Null(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API: &unloadS3Client{
+			athenaClient: athenaClient,
+			files:        [][]byte{newParquetFile(t, []int32{1}, []string{""}, []bool{false})},
+		},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeUnload)
+	for _, missing := range []struct {
+		set      func(conf *Config)
+		expected driver.Value
+	}{
+		{func(conf *Config) { conf.SetMissingAsEmptyString(true) }, ""},
+		{func(conf *Config) { conf.SetMissingAsEmptyString(false); conf.SetMissingAsDefault(true) }, ""},
+		{func(conf *Config) { conf.SetMissingAsNil(true) }, nil},
+	} {
+		missing.set(c.connector.config)
+		rows, err := c.QueryContext(context.Background(), "SELECT id, name, ts, tags FROM t", nil)
+		assert.Nil(t, err)
+		dest := make([]driver.Value, 4)
+		assert.Nil(t, rows.Next(dest))
+		assert.Equal(t, missing.expected, dest[1])
+		assert.Nil(t, rows.Close())
+	}
+
+	// NULL fails like in ResultModeAPI without a missing value option
+	c.connector.config.SetMissingAsNil(false)
+	c.connector.config.SetMissingAsDefault(false)
+	rows, err := c.QueryContext(context.Background(), "SELECT id, name, ts, tags FROM t", nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, rows.Next(make([]driver.Value, 4)))
+	assert.Nil(t, rows.Close())
+}
+
+func TestConnection_QueryContext_ResultModeUnload_Masked(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API: &unloadS3Client{
+			athenaClient: athenaClient,
+			files:        [][]byte{newParquetFile(t, []int32{1, 2}, []string{"x", ""}, []bool{true, false})},
+		},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeUnload)
+	c.connector.config.SetMaskedColumnValue("name", "xxx")
+
+	rows, err := c.QueryContext(context.Background(), "SELECT id, name, ts, tags FROM t", nil)
+	assert.Nil(t, err)
+	dest := make([]driver.Value, 4)
+	for _, id := range []int32{1, 2} {
+		assert.Nil(t, rows.Next(dest))
+		assert.Equal(t, []driver.Value{id, "xxx"}, dest[:2])
+	}
+	assert.Equal(t, io.EOF, rows.Next(dest))
+}
+
+func TestConnection_QueryContext_ResultModeUnload_Compression(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	s3Client := &unloadS3Client{
+		athenaClient: athenaClient,
+		files: [][]byte{
+			newParquetFile(t, []int32{1}, []string{"x"}, []bool{true}, parquet.WithCompression(compress.Codecs.Gzip)),
+		},
+	}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API:     s3Client,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetResultMode(ResultModeUnload)
+	c.connector.config.SetResultCompression(true)
+
+	rows, err := c.QueryContext(context.Background(), "SELECT id, name, ts, tags FROM t", nil)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(*athenaClient.inputs[0].QueryString,
+		"WITH (format = 'PARQUET', compression = 'GZIP')"))
+	dest := make([]driver.Value, 4)
+	assert.Nil(t, rows.Next(dest))
+	assert.Equal(t, []driver.Value{int32(1), "x"}, dest[:2])
+	assert.Equal(t, io.EOF, rows.Next(dest))
+}
+
+func TestUnloadColumnInfo(t *testing.T) {
+	info := unloadColumnInfo(arrow.Field{Name: "n", Type: &arrow.Decimal128Type{Precision: 10, Scale: 2}, Nullable: true})
+	assert.Equal(t, "decimal", *info.Type)
+	assert.Equal(t, athena.ColumnNullableNullable, *info.Nullable)
+	assert.Equal(t, int64(10), *info.Precision)
+	assert.Equal(t, int64(2), *info.Scale)
+
+	info = unloadColumnInfo(arrow.Field{Name: "v", Type: arrow.BinaryTypes.String})
+	assert.Equal(t, "varchar", *info.Type)
+	assert.Equal(t, athena.ColumnNullableNotNull, *info.Nullable)
+	assert.Equal(t, int64(0), *info.Precision)
+}
+
+func TestArrowValue_Decimal(t *testing.T) {
+	b := array.NewDecimal128Builder(memory.DefaultAllocator, &arrow.Decimal128Type{Precision: 38, Scale: 4})
+	defer b.Release()
+	b.Append(decimal128.FromI64(-1234567890123456789))
+	arr := b.NewArray()
+	defer arr.Release()
+	assert.Equal(t, "-123456789012345.6789", arrowValue(arr, 0))
+}
+
+func TestArrowValue_ScanType(t *testing.T) {
+	mem := memory.DefaultAllocator
+	var arrays []arrow.Array
+	largeString := array.NewLargeStringBuilder(mem)
+	largeString.Append("a")
+	largeBinary := array.NewBinaryBuilder(mem, arrow.BinaryTypes.LargeBinary)
+	largeBinary.Append([]byte{1})
+	fixedBinary := array.NewFixedSizeBinaryBuilder(mem, &arrow.FixedSizeBinaryType{ByteWidth: 2})
+	fixedBinary.Append([]byte{1, 2})
+	largeList := array.NewLargeListBuilder(mem, arrow.PrimitiveTypes.Int32)
+	largeList.Append(true)
+	largeList.ValueBuilder().(*array.Int32Builder).Append(1)
+	fixedList := array.NewFixedSizeListBuilder(mem, 2, arrow.PrimitiveTypes.Int32)
+	fixedList.Append(true)
+	fixedList.ValueBuilder().(*array.Int32Builder).AppendValues([]int32{1, 2}, nil)
+	fixedList.Append(true)
+	fixedList.ValueBuilder().(*array.Int32Builder).AppendValues([]int32{3, 4}, []bool{true, false})
+	for _, b := range []array.Builder{largeString, largeBinary, fixedBinary, largeList, fixedList} {
+		arrays = append(arrays, b.NewArray())
+		b.Release()
+	}
+	defer func() {
+		for _, arr := range arrays {
+			arr.Release()
+		}
+	}()
+	assert.Equal(t, "a", arrowValue(arrays[0], 0))
+	assert.Equal(t, []byte{1}, arrowValue(arrays[1], 0))
+	assert.Equal(t, []byte{1, 2}, arrowValue(arrays[2], 0))
+	assert.Equal(t, []interface{}{int32(1)}, arrowValue(arrays[3], 0))
+	assert.Equal(t, []interface{}{int32(3), nil}, arrowValue(arrays[4], 1))
+	// the values are of the scan types of their columns
+	for _, arr := range arrays {
+		assert.Equal(t, scanTypeOf(arr.DataType()), reflect.TypeOf(arrowValue(arr, 0)), arr.DataType().Name())
+	}
+}
+
+func TestUnloadLocation(t *testing.T) {
+	assert.Equal(t, "s3://bucket/unload/abc/", unloadLocation(
+		"UNLOAD (SELECT 'a' FROM t) TO 's3://bucket/unload/abc/' WITH (format = 'PARQUET')"))
+	assert.Equal(t, "s3://bucket/p/", unloadLocation("/* app=etl */\n-- daily\nunload (\nSELECT 1\n) to 's3://bucket/p/'"))
+	assert.Equal(t, "", unloadLocation("SELECT 'UNLOAD (x) TO ''s3://b/'''"))
+	assert.Equal(t, "", unloadLocation("SELECT 1"))
+}
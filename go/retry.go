@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// transientReasons are the transient failures of query executions, by a part of their state change reason
+// in upper case, with the reason in the retry metric. An empty reason is for a failure which is not transient.
+var transientReasons = []struct {
+	part   string
+	reason string
+}{
+	// unlike the internal errors of Athena, a GENERIC_INTERNAL_ERROR is usually a bad schema or data
+	{"GENERIC_INTERNAL_ERROR", ""},
+	{"HIVE_CURSOR_ERROR", "hivecursorerror"},
+	{"SLOW DOWN", "slowdown"},
+	{"SLOWDOWN", "slowdown"},
+	{"INTERNAL_ERROR", "internalerror"},
+	{"INTERNAL ERROR", "internalerror"},
+}
+
+// transientErrorCodes are the AWS error codes of transient failures to start or check a query.
+var transientErrorCodes = map[string]bool{
+	athena.ErrCodeInternalServerException: true,
+	"InternalFailure":                     true,
+	"ServiceUnavailable":                  true,
+}
+
+// retryReason is to get the reason to run a query again after err, or "" if the failure is not transient.
+// If the query started, only its failed execution is retried, and if executionRetryable only, as it may
+// have written data. If it didn't, throttling and internal errors of Athena are retried.
+func retryReason(err error, started bool, executionRetryable bool) string {
+	var queryErr *QueryError
+	isQueryErr := errors.As(err, &queryErr)
+	if started {
+		if !isQueryErr || queryErr.State != athena.QueryExecutionStateFailed || !executionRetryable {
+			return ""
+		}
+		reason := strings.ToUpper(queryErr.Reason)
+		for _, r := range transientReasons {
+			if strings.Contains(reason, r.part) {
+				return r.reason
+			}
+		}
+		if queryErr.Retryable {
+			return "retryable"
+		}
+		return ""
+	}
+	if isQueryErr && queryErr.Kind == ErrThrottled {
+		return "throttled"
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && transientErrorCodes[aerr.Code()] {
+		return "internalerror"
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"github.com/stretchr/testify/assert"
+)
+
+func failedQueryError(reason string, retryable bool) error {
+	return newQueryError(&athena.QueryExecution{
+		QueryExecutionId: aws.String("qid"),
+		Status: &athena.QueryExecutionStatus{
+			State:             aws.String(athena.QueryExecutionStateFailed),
+			StateChangeReason: aws.String(reason),
+			AthenaError:       &athena.AthenaError{Retryable: aws.Bool(retryable)},
+		},
+	}, errors.New(reason))
+}
+
+func TestRetryReason(t *testing.T) {
+	hiveCursor := failedQueryError("HIVE_CURSOR_ERROR: Please reduce your request rate.", false)
+	assert.Equal(t, "hivecursorerror", retryReason(hiveCursor, true, true))
+	assert.Equal(t, "", retryReason(hiveCursor, true, false))
+	assert.Equal(t, "slowdown", retryReason(failedQueryError("Slow Down (Service: Amazon S3)", false), true, true))
+	assert.Equal(t, "internalerror", retryReason(failedQueryError("INTERNAL_ERROR_QUERY_ENGINE", false), true, true))
+	assert.Equal(t, "", retryReason(failedQueryError("GENERIC_INTERNAL_ERROR: bad schema", true), true, true))
+	assert.Equal(t, "retryable", retryReason(failedQueryError("something else", true), true, true))
+	assert.Equal(t, "", retryReason(failedQueryError("SYNTAX_ERROR: line 1:8", false), true, true))
+
+	throttled := classifyError("", awserr.New("ThrottlingException", "Rate exceeded", nil))
+	assert.Equal(t, "throttled", retryReason(throttled, false, false))
+	internal := awserr.New(athena.ErrCodeInternalServerException, "oops", nil)
+	assert.Equal(t, "internalerror", retryReason(internal, false, false))
+	// the status checks of started queries are not retried by running them again
+	assert.Equal(t, "", retryReason(internal, true, true))
+	assert.Equal(t, "", retryReason(ErrTestMockGeneric, false, true))
+}
+
+// flakyAthenaClient fails the first query execution with a HIVE_CURSOR_ERROR.
+type flakyAthenaClient struct {
+	queryContextAthenaClient
+}
+
+func (m *flakyAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	out, err := m.queryContextAthenaClient.StartQueryExecutionWithContext(ctx, s, opts...)
+	if len(m.inputs) == 1 {
+		out.QueryExecutionId = aws.String("FLAKY_QID")
+	}
+	return out, err
+}
+
+func (m *flakyAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	if *input.QueryExecutionId != "FLAKY_QID" {
+		return m.mockAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+	}
+	return &athena.GetQueryExecutionOutput{
+		QueryExecution: &athena.QueryExecution{
+			QueryExecutionId: input.QueryExecutionId,
+			Status: &athena.QueryExecutionStatus{
+				State:             aws.String(athena.QueryExecutionStateFailed),
+				StateChangeReason: aws.String("HIVE_CURSOR_ERROR: Unexpected end of input stream"),
+			},
+		},
+	}, nil
+}
+
+func TestConnection_QueryContext_Retry(t *testing.T) {
+	athenaClient := &flakyAthenaClient{queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	// queries are not retried by default
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	var queryErr *QueryError
+	assert.True(t, errors.As(err, &queryErr))
+	assert.Equal(t, "FLAKY_QID", queryErr.QueryID)
+
+	athenaClient.inputs = nil
+	c.connector.config.SetQueryRetryAttempts(3)
+	c.connector.config.SetQueryRetryBackoff(time.Millisecond)
+	rows, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, rows)
+	assert.Len(t, athenaClient.inputs, 2)
+
+	// failed executions of statements writing data are not retried
+	athenaClient.inputs = nil
+	_, err = c.QueryContext(context.Background(), "INSERT INTO t VALUES (1)", nil)
+	assert.True(t, errors.As(err, &queryErr))
+	assert.Len(t, athenaClient.inputs, 1)
+}
+
+// throttledAthenaClient throttles the first StartQueryExecution.
+type throttledAthenaClient struct {
+	queryContextAthenaClient
+}
+
+func (m *throttledAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	out, err := m.queryContextAthenaClient.StartQueryExecutionWithContext(ctx, s, opts...)
+	if len(m.inputs) == 1 {
+		return nil, awserr.New("ThrottlingException", "Rate exceeded", nil)
+	}
+	return out, err
+}
+
+func TestConnection_QueryContext_Retry_QueryDeduplication(t *testing.T) {
+	tokens := func(athenaAPI athenaiface.AthenaAPI, client *queryContextAthenaClient) []string {
+		c := &Connection{
+			athenaAPI: athenaAPI,
+			connector: NoopsSQLConnector(),
+		}
+		c.connector.config.SetQueryDeduplication(true)
+		c.connector.config.SetQueryRetryAttempts(3)
+		c.connector.config.SetQueryRetryBackoff(time.Millisecond)
+		_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+		assert.Nil(t, err)
+		var tokens []string
+		for _, input := range client.inputs {
+			tokens = append(tokens, *input.ClientRequestToken)
+		}
+		return tokens
+	}
+
+	// a new execution after a failed one gets a new token
+	flaky := &flakyAthenaClient{queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}
+	if flakyTokens := tokens(flaky, &flaky.queryContextAthenaClient); assert.Len(t, flakyTokens, 2) {
+		assert.NotEqual(t, flakyTokens[0], flakyTokens[1])
+	}
+	// the execution may have been created by a StartQueryExecution which failed, so its token is kept
+	throttled := &throttledAthenaClient{queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}
+	if throttledTokens := tokens(throttled, &throttled.queryContextAthenaClient); assert.Len(t, throttledTokens, 2) {
+		assert.Equal(t, throttledTokens[0], throttledTokens[1])
+	}
+}
+
+func TestConfig_SetQueryRetry(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, 1, testConf.GetQueryRetryAttempts())
+	assert.Equal(t, DefaultQueryRetryBackoff*time.Second, testConf.GetQueryRetryBackoff())
+	testConf.SetQueryRetryAttempts(3)
+	testConf.SetQueryRetryBackoff(500 * time.Millisecond)
+	assert.Equal(t, 3, testConf.GetQueryRetryAttempts())
+	assert.Equal(t, 500*time.Millisecond, testConf.GetQueryRetryBackoff())
+	testConf.SetQueryRetryAttempts(0)
+	assert.Equal(t, 1, testConf.GetQueryRetryAttempts())
+}
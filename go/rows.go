@@ -23,16 +23,21 @@ package athenadriver
 import (
 	"context"
 	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	jsoniter "github.com/json-iterator/go"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -52,6 +57,30 @@ type Rows struct {
 	tracer          *DriverTracer
 	pageCount       int64
 	columnType      []reflect.Type
+	// download is set in ResultModeDL, rows are read from the result object in S3 then.
+	download *csvResultReader
+	// downloaded counts the bytes of the result object downloaded in ResultModeDL.
+	downloaded *byteCounter
+	// unload is set in ResultModeUnload, rows are read from the Parquet files unloaded to S3 then.
+	unload *parquetResultReader
+	// prefetched has the next pages fetched in the background, if result prefetch is set in Config.
+	prefetched     chan resultPage
+	cancelPrefetch context.CancelFunc
+	// limit is the `LIMIT n` of the query, no page is fetched after n rows are returned if it is set.
+	limit    int
+	returned int
+	// resultLocation is the result object deleted with s3API when the rows are closed, if result cleanup
+	// is set in Config.
+	s3API          s3iface.S3API
+	resultLocation string
+	// recorder collects the rows to cache them once they are all read, if the result cache is set in Config.
+	recorder *resultRecorder
+}
+
+// resultPage is a page of query results fetched in the background.
+type resultPage struct {
+	output *athena.GetQueryResultsOutput
+	err    error
 }
 
 // NewNonOpsRows is to create a new Rows.
@@ -71,6 +100,12 @@ func NewNonOpsRows(ctx context.Context, athenaAPI athenaiface.AthenaAPI, queryID
 // NewRows is to create a new Rows.
 func NewRows(ctx context.Context, athenaAPI athenaiface.AthenaAPI, queryID string, driverConfig *Config,
 	obs *DriverTracer) (*Rows, error) {
+	return newRows(ctx, athenaAPI, queryID, driverConfig, obs, 0)
+}
+
+// newRows is to create a new Rows of a query returning at most limit rows, or any number of rows if limit is 0.
+func newRows(ctx context.Context, athenaAPI athenaiface.AthenaAPI, queryID string, driverConfig *Config,
+	obs *DriverTracer, limit int) (*Rows, error) {
 	r := Rows{
 		athena:    athenaAPI,
 		ctx:       ctx,
@@ -78,14 +113,69 @@ func NewRows(ctx context.Context, athenaAPI athenaiface.AthenaAPI, queryID strin
 		config:    driverConfig,
 		tracer:    obs,
 		pageCount: -1,
+		limit:     limit,
 	}
 	if err := r.fetchNextPage(nil); err != nil {
 		return nil, err
 	}
 	r.initColumnTypes()
+	if depth := driverConfig.GetResultPrefetch(); depth > 0 && r.ResultOutput.NextToken != nil &&
+		*r.ResultOutput.NextToken != "" && !r.limitInPage() {
+		r.startPrefetch(*r.ResultOutput.NextToken, depth)
+	}
 	return &r, nil
 }
 
+// startPrefetch is to fetch the pages after token in the background, at most depth pages ahead of Next.
+func (r *Rows) startPrefetch(token string, depth int) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.cancelPrefetch = cancel
+	r.prefetched = make(chan resultPage, depth)
+	go func() {
+		defer close(r.prefetched)
+		next := aws.String(token)
+		for next != nil && *next != "" {
+			output, err := r.fetchResultPage(ctx, next)
+			select {
+			case r.prefetched <- resultPage{output: output, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+			next = output.NextToken
+		}
+	}()
+}
+
+// fetchResultPage is to call GetQueryResults for the result page of token.
+func (r *Rows) fetchResultPage(ctx context.Context, token *string) (*athena.GetQueryResultsOutput, error) {
+	ctx, span := startSpan(ctx, r.config, "athena.GetQueryResults",
+		attribute.String("athena.query_execution_id", r.queryID))
+	output, err := r.athena.GetQueryResultsWithContext(ctx, &athena.GetQueryResultsInput{
+		QueryExecutionId: aws.String(r.queryID),
+		NextToken:        token,
+	})
+	endSpan(span, err)
+	return output, err
+}
+
+// getQueryResults is to get the result page of token, from the prefetched pages if prefetch is started.
+func (r *Rows) getQueryResults(token *string) (*athena.GetQueryResultsOutput, error) {
+	if r.prefetched == nil {
+		return r.fetchResultPage(r.ctx, token)
+	}
+	page, ok := <-r.prefetched
+	if !ok {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	return page.output, page.err
+}
+
 // Columns return Columns metadata.
 func (r *Rows) Columns() []string {
 	var columns []string
@@ -95,10 +185,52 @@ func (r *Rows) Columns() []string {
 	return columns
 }
 
+// QueryExecutionID is to get the ID of the Athena query execution of the rows, to find it in the Athena console.
+// database/sql wraps the driver.Rows of sql.DB.QueryContext, so it is reached by calling Connection.QueryContext
+// in the function of sql.Conn.Raw, or collected with WithStats.
+func (r *Rows) QueryExecutionID() string {
+	return r.queryID
+}
+
+// ColumnTypeScanType is to get the Go type of the values of a column, like int64, float64 or time.Time.
 func (r *Rows) ColumnTypeScanType(index int) reflect.Type {
 	return r.columnType[index]
 }
 
+// ColumnTypeLength is to get the length of variable length column types, like varchar(n).
+// The length is math.MaxInt64 if the type has no limit.
+func (r *Rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	colInfo := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[index]
+	switch aws.StringValue(colInfo.Type) {
+	case "char", "varchar", "varbinary", "string", "binary", "json":
+		if precision := aws.Int64Value(colInfo.Precision); precision > 0 && precision < math.MaxInt32 {
+			return precision, true
+		}
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
+
+// ColumnTypeNullable is to get whether a column may be null, ok is false if Athena doesn't know.
+func (r *Rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	switch aws.StringValue(r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[index].Nullable) {
+	case athena.ColumnNullableNullable:
+		return true, true
+	case athena.ColumnNullableNotNull:
+		return false, true
+	}
+	return false, false
+}
+
+// ColumnTypePrecisionScale is to get the precision and scale of decimal columns.
+func (r *Rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	colInfo := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[index]
+	if aws.StringValue(colInfo.Type) != "decimal" {
+		return 0, 0, false
+	}
+	return aws.Int64Value(colInfo.Precision), aws.Int64Value(colInfo.Scale), true
+}
+
 // ColumnTypeDatabaseTypeName will be called by sql framework.
 func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
 	colInfo := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo[index]
@@ -112,50 +244,90 @@ func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
 
 // Next is to get next result set page.
 func (r *Rows) Next(dest []driver.Value) error {
+	if r.unload != nil && !r.reachedLastPage {
+		return r.nextUnloaded(dest)
+	}
+	data, err := r.nextData()
+	if err != nil {
+		return err
+	}
+	return r.convertRow(r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo, data, dest, r.config)
+}
+
+// nextData is to get the raw data of the next row in ResultModeAPI and ResultModeDL, recording the rows for
+// the result cache.
+func (r *Rows) nextData() ([]*athena.Datum, error) {
+	data, err := r.readData()
+	if r.recorder != nil {
+		if err != nil {
+			r.storeResult(err)
+		} else {
+			r.recordRow(data)
+		}
+	}
+	return data, err
+}
+
+// readData is to get the raw data of the next row, from the downloaded result or the result pages.
+func (r *Rows) readData() ([]*athena.Datum, error) {
 	if r.reachedLastPage {
-		return io.EOF
+		return nil, io.EOF
+	}
+	if r.download != nil {
+		return r.nextDownloaded()
+	}
+	if r.limit > 0 && r.returned >= r.limit {
+		// the remaining pages, if any, can only be empty, so they are not fetched
+		r.reachedLastPage = true
+		if r.cancelPrefetch != nil {
+			r.cancelPrefetch()
+		}
+		return nil, io.EOF
 	}
 	if len(r.ResultOutput.ResultSet.Rows) == 0 {
 		if r.ResultOutput.NextToken == nil || *r.ResultOutput.NextToken == "" {
 			// this means we reach the last page - no token and no rows
 			r.reachedLastPage = true
-			return io.EOF
+			return nil, io.EOF
 		}
 
 		if err := r.fetchNextPage(r.ResultOutput.NextToken); err != nil {
-			return err
+			return nil, err
 		}
 		if r.reachedLastPage {
-			return io.EOF
+			return nil, io.EOF
 		}
 	}
 
 	// Shift to next row
 	cur := r.ResultOutput.ResultSet.Rows[0]
-	columns := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo
-	if err := r.convertRow(columns, cur.Data, dest, r.config); err != nil {
-		return err
-	}
 	r.ResultOutput.ResultSet.Rows = r.ResultOutput.ResultSet.Rows[1:]
-	return nil
+	r.returned++
+	return cur.Data, nil
+}
+
+// limitInPage is to check if the rows up to the limit of the query are all in the current page.
+func (r *Rows) limitInPage() bool {
+	return r.limit > 0 && r.returned+len(r.ResultOutput.ResultSet.Rows) >= r.limit
 }
 
 // fetchNextPage is to get next result set page with a specific token.
 func (r *Rows) fetchNextPage(token *string) error {
 	var err error
-	r.ResultOutput, err = r.athena.GetQueryResultsWithContext(r.ctx,
-		&athena.GetQueryResultsInput{
-			QueryExecutionId: aws.String(r.queryID),
-			NextToken:        token,
-		})
+	r.ResultOutput, err = r.getQueryResults(token)
 	if err != nil {
 		r.tracer.Scope().Counter(DriverName + ".failure.fetchnextpage.getqueryresults").Inc(1)
 		r.tracer.Log(ErrorLevel, "GetQueryResults failed", zap.String("error", err.Error()))
 		r.reachedLastPage = true
-		return err
+		return classifyError(r.queryID, err)
 	}
 
 	r.pageCount++
+	r.tracer.Log(DebugLevel, "result page fetched",
+		zap.String("queryID", r.queryID),
+		zap.Int64("page", r.pageCount),
+		zap.Int("rows", len(r.ResultOutput.ResultSet.Rows)),
+		zap.Bool("lastPage", r.ResultOutput.NextToken == nil || *r.ResultOutput.NextToken == ""))
 	// First row of the first page contains header if the query is not DDL.
 	// These are also available in *athenaAPI.Row.ResultSetMetadata.
 	// Sometimes Athena go API will return row data without corresponding ColumnInfo. To circumvent this situation,
@@ -237,12 +409,30 @@ func (r *Rows) fetchNextPage(token *string) error {
 
 // Close is to close Rows after reading all data.
 func (r *Rows) Close() error {
-	if r.ResultOutput != nil && r.ResultOutput.NextToken != nil {
+	if !r.reachedLastPage && r.ResultOutput != nil && r.ResultOutput.NextToken != nil {
 		r.tracer.Log(WarnLevel, "rows close prematurely, queryID: "+r.queryID)
 		r.ResultOutput = nil
 	}
 	r.reachedLastPage = true
-	return nil
+	if r.cancelPrefetch != nil {
+		r.cancelPrefetch()
+	}
+	fields := []zap.Field{zap.String("queryID", r.queryID), zap.Int64("pages", r.pageCount)}
+	if r.downloaded != nil {
+		fields = append(fields, zap.Int64("downloadedBytes", r.downloaded.n))
+	}
+	r.tracer.Log(DebugLevel, "rows closed", fields...)
+	var err error
+	if r.download != nil {
+		err = r.download.Close()
+	} else if r.unload != nil {
+		err = r.unload.Close()
+	}
+	if r.resultLocation != "" {
+		r.deleteResult()
+		r.resultLocation = ""
+	}
+	return err
 }
 
 // convertRow is to convert data from Athena type to Golang SQL type and put them into an array of driver.Value.
@@ -284,6 +474,9 @@ func (r *Rows) athenaTypeToGoType(columnInfo *athena.ColumnInfo, rawValue *strin
 	}
 	if rawValue == nil {
 		r.tracer.Scope().Counter(DriverName + ".missingvalue").Inc(1)
+		if driverConfig.IsMissingAsNil() {
+			return nil, nil
+		}
 		r.tracer.Log(ErrorLevel, "missing data",
 			zap.String("columnInfo.Name", *columnInfo.Name),
 			zap.String("queryID", r.queryID),
@@ -291,7 +484,7 @@ func (r *Rows) athenaTypeToGoType(columnInfo *athena.ColumnInfo, rawValue *strin
 		if driverConfig.IsMissingAsEmptyString() {
 			return "", nil
 		} else if driverConfig.IsMissingAsDefault() {
-			return r.getDefaultValueForColumnType(*columnInfo.Type), nil
+			return r.missingDefaultValue(columnInfo, driverConfig)
 		}
 		r.tracer.Scope().Counter(DriverName + ".failure.convertvalue.config").Inc(1)
 		r.tracer.Log(ErrorLevel, "missing data", zap.String("columnInfo.Name", *columnInfo.Name))
@@ -336,12 +529,51 @@ func (r *Rows) athenaTypeToGoType(columnInfo *athena.ColumnInfo, rawValue *strin
 			return nil, err
 		}
 		return f, nil
-	// for binary, we assume all chars are 0 or 1; for json,
-	// we assume the json syntax is correct. Leave to caller to verify it.
-	case "json", "char", "varchar", "varbinary", "row", "string", "binary",
-		"struct", "interval year to month", "interval day to second", "decimal",
-		"ipaddress", "map", "unknown":
+	case "char", "varchar", "string", "ipaddress", "unknown":
+		return val, nil
+	case "interval year to month":
+		return parseYearMonthInterval(val)
+	case "interval day to second":
+		return parseDaySecondInterval(val)
+	case "json":
+		if !jcf.Valid([]byte(val)) {
+			return val, nil
+		}
+		if driverConfig.IsUnmarshalJSON() {
+			var v interface{}
+			if err = jcf.UnmarshalFromString(val, &v); err != nil {
+				return nil, err
+			}
+			return v, nil
+		}
+		return json.RawMessage(val), nil
+	case "geometry":
+		if driverConfig.IsGeometryWKB() {
+			return WKTToWKB(val)
+		}
 		return val, nil
+	case "varbinary", "binary":
+		if driverConfig.IsRawBinary() {
+			return val, nil
+		}
+		// Athena returns binary values in hex, like `68 65 6c 6c 6f`
+		b, err := hex.DecodeString(strings.Replace(val, " ", "", -1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex value of binary column %s: %w", *columnInfo.Name, err)
+		}
+		return b, nil
+	case "map":
+		if driverConfig.IsRawComplexTypes() || !isEnclosed(val, '{', '}') {
+			return val, nil
+		}
+		return parseComplexValue(val), nil
+	case "row", "struct":
+		if driverConfig.IsRawComplexTypes() {
+			return val, nil
+		}
+		return parseRowValue(val)
+	case "decimal":
+		return convertDecimal(val, driverConfig)
 	case "boolean":
 		if val == "true" {
 			return true, nil
@@ -352,7 +584,7 @@ func (r *Rows) athenaTypeToGoType(columnInfo *athena.ColumnInfo, rawValue *strin
 		r.tracer.Log(ErrorLevel, "boolean data error", zap.String("val", val))
 		return nil, fmt.Errorf("unknown value `%s` for boolean", val)
 	case "date", "time", "time with time zone", "timestamp", "timestamp with time zone":
-		vv, err := scanTime(val)
+		vv, err := scanTimeInLocation(val, driverConfig.GetSessionTimeZone())
 		if !vv.Valid {
 			r.tracer.Scope().Counter(DriverName + ".failure.convertvalue." +
 				"time").Inc(1)
@@ -363,11 +595,17 @@ func (r *Rows) athenaTypeToGoType(columnInfo *athena.ColumnInfo, rawValue *strin
 		}
 		return vv.Time, err
 	case "array":
+		if driverConfig.IsRawComplexTypes() {
+			return val, nil
+		}
 		iter := jcf.BorrowIterator([]byte(val))
 		defer jcf.ReturnIterator(iter)
 		var result []interface{}
 		iter.ReadVal(&result)
 		if iter.Error != nil {
+			if isEnclosed(val, '[', ']') {
+				return parseComplexValue(val), nil
+			}
 			return []interface{}{val}, nil
 		} else {
 			return result, nil
@@ -379,6 +617,15 @@ func (r *Rows) athenaTypeToGoType(columnInfo *athena.ColumnInfo, rawValue *strin
 	}
 }
 
+// missingDefaultValue is the value of a NULL cell in missingAsDefault mode, the missing value set for
+// the column type in Config, or the default value of the column type.
+func (r *Rows) missingDefaultValue(columnInfo *athena.ColumnInfo, driverConfig *Config) (interface{}, error) {
+	if val, ok := driverConfig.GetMissingValue(*columnInfo.Type); ok {
+		return r.athenaTypeToGoType(columnInfo, &val, driverConfig)
+	}
+	return r.getDefaultValueForColumnType(*columnInfo.Type), nil
+}
+
 // getDefaultValueForColumnType is used internally by athenaTypeToGoType to get default value for a column type.
 // This is helpful when column has missing value and we want to display it anyway.
 func (r *Rows) getDefaultValueForColumnType(athenaType string) interface{} {
@@ -393,7 +640,7 @@ func (r *Rows) getDefaultValueForColumnType(athenaType string) interface{} {
 		return time.Time{}
 	case "json", "char", "varchar", "varbinary", "row", "string", "binary",
 		"struct", "interval year to month", "interval day to second", "decimal",
-		"ipaddress", "map", "unknown":
+		"ipaddress", "map", "unknown", "geometry":
 		return ""
 	case "array":
 		return []interface{}{}
@@ -408,8 +655,62 @@ func (r *Rows) initColumnTypes() {
 	columnInfos := r.ResultOutput.ResultSet.ResultSetMetadata.ColumnInfo
 	r.columnType = make([]reflect.Type, len(columnInfos))
 	for i, columnInfo := range columnInfos {
-		val := r.getDefaultValueForColumnType(*columnInfo.Type)
-		r.columnType[i] = reflect.TypeOf(val)
+		r.columnType[i] = r.scanTypeOfColumnType(*columnInfo.Type)
 	}
+}
 
+// scanTypeOfColumnType is to get the Go type of the values athenaTypeToGoType returns for a column type.
+func (r *Rows) scanTypeOfColumnType(athenaType string) reflect.Type {
+	switch athenaType {
+	case "tinyint":
+		return reflect.TypeOf(int8(0))
+	case "smallint":
+		return reflect.TypeOf(int16(0))
+	case "integer":
+		return reflect.TypeOf(int32(0))
+	case "bigint":
+		return reflect.TypeOf(int64(0))
+	case "float", "real":
+		return reflect.TypeOf(float32(0))
+	case "double":
+		return reflect.TypeOf(float64(0))
+	case "boolean":
+		return reflect.TypeOf(false)
+	case "date", "time", "time with time zone", "timestamp", "timestamp with time zone":
+		return reflect.TypeOf(time.Time{})
+	case "array", "map", "row", "struct":
+		if r.config.IsRawComplexTypes() {
+			return reflect.TypeOf("")
+		}
+		switch athenaType {
+		case "array":
+			return reflect.TypeOf([]interface{}{})
+		case "map":
+			return reflect.TypeOf(map[string]interface{}{})
+		}
+		return reflect.TypeOf(json.RawMessage{})
+	case "decimal":
+		return decimalScanType(r.config)
+	case "json":
+		if r.config.IsUnmarshalJSON() {
+			return reflect.TypeOf((*interface{})(nil)).Elem()
+		}
+		return reflect.TypeOf(json.RawMessage{})
+	case "interval year to month":
+		return reflect.TypeOf(YearMonthInterval{})
+	case "interval day to second":
+		return reflect.TypeOf(time.Duration(0))
+	case "geometry":
+		if r.config.IsGeometryWKB() {
+			return reflect.TypeOf([]byte(nil))
+		}
+		return reflect.TypeOf("")
+	case "varbinary", "binary":
+		if r.config.IsRawBinary() {
+			return reflect.TypeOf("")
+		}
+		return reflect.TypeOf([]byte(nil))
+	default:
+		return reflect.TypeOf(r.getDefaultValueForColumnType(athenaType))
+	}
 }
@@ -22,12 +22,18 @@ package athenadriver
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"io"
+	"math"
 	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/athena"
 	"github.com/stretchr/testify/assert"
 )
@@ -358,9 +364,9 @@ func TestRows_AthenaTypeToGoType(t *testing.T) {
 	assert.Nil(t, g)
 
 	// string-like
-	for _, s := range []string{"json", "char", "varchar", "varbinary", "row",
-		"string", "binary",
-		"struct", "interval year to month", "interval day to second", "decimal",
+	for _, s := range []string{"json", "char", "varchar", "row",
+		"string",
+		"struct", "decimal",
 		"ipaddress", "map", "unknown"} {
 		c = newColumnInfo("a", s)
 		rv = "012"
@@ -368,6 +374,14 @@ func TestRows_AthenaTypeToGoType(t *testing.T) {
 		assert.Nil(t, e)
 		assert.Equal(t, "012", g)
 	}
+	// binary values are hex
+	for _, s := range []string{"varbinary", "binary"} {
+		c = newColumnInfo("a", s)
+		rv = "012"
+		g, e = r.athenaTypeToGoType(c, &rv, testConf)
+		assert.NotNil(t, e)
+		assert.Nil(t, g)
+	}
 
 	c = newColumnInfo("a", "array")
 	rv = "[\"a\",\"b\"]"
@@ -432,12 +446,28 @@ func TestRows_AthenaTypeToGoType(t *testing.T) {
 	assert.Nil(t, e)
 	assert.Equal(t, g, 0)
 
+	testConf.SetMissingValue("integer", "-1")
+	g, e = r.athenaTypeToGoType(c, nil, testConf)
+	assert.Nil(t, e)
+	assert.Equal(t, int32(-1), g)
+	testConf.SetMissingValue("integer", "x")
+	_, e = r.athenaTypeToGoType(c, nil, testConf)
+	assert.NotNil(t, e)
+
 	testConf.SetMissingAsEmptyString(false)
 	testConf.SetMissingAsDefault(false)
 	g, e = r.athenaTypeToGoType(c, nil, testConf)
 	assert.NotNil(t, e)
 	assert.Nil(t, g)
 
+	testConf.SetMissingAsNil(true)
+	testConf.SetMissingAsEmptyString(true)
+	g, e = r.athenaTypeToGoType(c, nil, testConf)
+	assert.Nil(t, e)
+	assert.Nil(t, g)
+	testConf.SetMissingAsNil(false)
+	testConf.SetMissingAsEmptyString(false)
+
 	// masked column
 	testConf.SetMaskedColumnValue("a", "xxx")
 	g, e = r.athenaTypeToGoType(c, nil, testConf)
@@ -573,3 +603,213 @@ func TestRows_NewRows(t *testing.T) {
 	}
 
 }
+
+func TestRows_Prefetch(t *testing.T) {
+	for _, depth := range []int{1, 3} {
+		testConf := NewNoOpsConfig()
+		testConf.SetResultPrefetch(depth)
+		r, err := NewRows(context.Background(), newMockAthenaClient(), "SELECT_OK",
+			testConf, NewDefaultObservability(testConf))
+		assert.Nil(t, err)
+		assert.NotNil(t, r.prefetched)
+
+		var testArray, firstName, lastName string
+		var active bool
+		var uid int
+		var registerDate, registerTS time.Time
+		cnt := 0
+		for {
+			err = r.Next(variadicToSlice(&testArray, &active, &firstName, &lastName,
+				&uid, &registerDate, &registerTS))
+			if err != nil {
+				break
+			}
+			cnt++
+		}
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, 35, cnt)
+		assert.Nil(t, r.Close())
+	}
+}
+
+func TestRows_Prefetch_CloseEarly(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetResultPrefetch(2)
+	r, err := NewRows(context.Background(), newMockAthenaClient(), "SELECT_OK",
+		testConf, NewDefaultObservability(testConf))
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	// the background fetch stops and closes the page channel once Rows is closed
+	for range r.prefetched {
+	}
+	assert.Equal(t, io.EOF, r.Next(make([]driver.Value, 7)))
+}
+
+// pageCountingAthenaClient counts the GetQueryResults pages fetched.
+type pageCountingAthenaClient struct {
+	*mockAthenaClient
+	pages int32
+}
+
+func (m *pageCountingAthenaClient) GetQueryResultsWithContext(ctx aws.Context, input *athena.GetQueryResultsInput,
+	opts ...request.Option) (*athena.GetQueryResultsOutput, error) {
+	atomic.AddInt32(&m.pages, 1)
+	return m.mockAthenaClient.GetQueryResultsWithContext(ctx, input, opts...)
+}
+
+func TestRows_Limit(t *testing.T) {
+	tests := []struct {
+		limit, prefetch int
+		expectedRows    int
+		expectedPages   int32
+	}{
+		{limit: 0, expectedRows: 35, expectedPages: 5},
+		{limit: 5, expectedRows: 5, expectedPages: 1},
+		{limit: 5, prefetch: 2, expectedRows: 5, expectedPages: 1},
+		{limit: 8, expectedRows: 8, expectedPages: 2},
+		{limit: 100, expectedRows: 35, expectedPages: 5},
+	}
+	for _, test := range tests {
+		testConf := NewNoOpsConfig()
+		testConf.SetResultPrefetch(test.prefetch)
+		client := &pageCountingAthenaClient{mockAthenaClient: newMockAthenaClient()}
+		r, err := newRows(context.Background(), client, "SELECT_OK", testConf, NewDefaultObservability(testConf),
+			test.limit)
+		assert.Nil(t, err)
+		cnt := 0
+		dest := make([]driver.Value, 7)
+		for r.Next(dest) == nil {
+			cnt++
+		}
+		assert.Equal(t, test.expectedRows, cnt)
+		assert.Nil(t, r.Close())
+		assert.Equal(t, test.expectedPages, atomic.LoadInt32(&client.pages))
+	}
+}
+
+func TestRows_ColumnTypes(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	columns := []*athena.ColumnInfo{
+		newColumnInfo("b", "bigint"),
+		newColumnInfo("d", "double"),
+		newColumnInfo("ts", "timestamp"),
+		newColumnInfo("v", "varchar"),
+		newColumnInfo("c", "char"),
+		newColumnInfo("n", "decimal"),
+		newColumnInfo("a", "array"),
+	}
+	columns[1].Nullable = aws.String(athena.ColumnNullableNotNull)
+	columns[3].Nullable = aws.String(athena.ColumnNullableNullable)
+	columns[3].Precision = aws.Int64(math.MaxInt32)
+	columns[4].Precision = aws.Int64(3)
+	columns[5].Precision, columns[5].Scale = aws.Int64(10), aws.Int64(2)
+	r := &Rows{
+		config: testConf,
+		tracer: NewDefaultObservability(testConf),
+		ResultOutput: &athena.GetQueryResultsOutput{
+			ResultSet: &athena.ResultSet{ResultSetMetadata: &athena.ResultSetMetadata{ColumnInfo: columns}},
+		},
+	}
+	r.initColumnTypes()
+
+	assert.Equal(t, reflect.TypeOf(int64(0)), r.ColumnTypeScanType(0))
+	assert.Equal(t, reflect.TypeOf(float64(0)), r.ColumnTypeScanType(1))
+	assert.Equal(t, reflect.TypeOf(time.Time{}), r.ColumnTypeScanType(2))
+	assert.Equal(t, reflect.TypeOf(""), r.ColumnTypeScanType(3))
+	assert.Equal(t, reflect.TypeOf([]interface{}{}), r.ColumnTypeScanType(6))
+
+	length, ok := r.ColumnTypeLength(0)
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), length)
+	length, ok = r.ColumnTypeLength(3)
+	assert.True(t, ok)
+	assert.Equal(t, int64(math.MaxInt64), length)
+	length, ok = r.ColumnTypeLength(4)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), length)
+
+	nullable, ok := r.ColumnTypeNullable(0)
+	assert.False(t, ok)
+	assert.False(t, nullable)
+	nullable, ok = r.ColumnTypeNullable(1)
+	assert.True(t, ok)
+	assert.False(t, nullable)
+	nullable, ok = r.ColumnTypeNullable(3)
+	assert.True(t, ok)
+	assert.True(t, nullable)
+
+	precision, scale, ok := r.ColumnTypePrecisionScale(5)
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), precision)
+	assert.Equal(t, int64(2), scale)
+	_, _, ok = r.ColumnTypePrecisionScale(1)
+	assert.False(t, ok)
+}
+
+func TestRows_MissingAsNil(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetMissingAsNil(true)
+	r, err := NewRows(context.Background(), newMockAthenaClient(), "missing_data_resp",
+		testConf, NewDefaultObservability(testConf))
+	assert.Nil(t, err)
+	dest := []driver.Value{"x"}
+	assert.Nil(t, r.Next(dest))
+	assert.Nil(t, dest[0])
+
+	var n sql.NullInt64
+	assert.Nil(t, n.Scan(dest[0]))
+	assert.False(t, n.Valid)
+}
+
+func TestRows_AthenaTypeToGoType_Varbinary(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	r := &Rows{config: testConf, tracer: NewDefaultObservability(testConf)}
+	c := newColumnInfo("b", "varbinary")
+	val := "68 65 6c 6c 6f"
+	g, err := r.athenaTypeToGoType(c, &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), g)
+	assert.Equal(t, reflect.TypeOf([]byte(nil)), r.scanTypeOfColumnType("varbinary"))
+
+	val = ""
+	g, err = r.athenaTypeToGoType(c, &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{}, g)
+
+	// values which aren't hex fail
+	val = "xyz"
+	g, err = r.athenaTypeToGoType(c, &val, testConf)
+	assert.NotNil(t, err)
+	assert.Nil(t, g)
+
+	testConf.SetRawBinary(true)
+	val = "68 65 6c 6c 6f"
+	g, err = r.athenaTypeToGoType(c, &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, val, g)
+	assert.Equal(t, reflect.TypeOf(""), r.scanTypeOfColumnType("varbinary"))
+}
+
+func TestRows_AthenaTypeToGoType_JSON(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	r := &Rows{config: testConf, tracer: NewDefaultObservability(testConf)}
+	c := newColumnInfo("j", "json")
+	val := `{"a":[1,2],"b":"x"}`
+	g, err := r.athenaTypeToGoType(c, &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, json.RawMessage(val), g)
+	assert.Equal(t, reflect.TypeOf(json.RawMessage{}), r.scanTypeOfColumnType("json"))
+
+	// invalid json is returned as it is
+	val = "{a=1}"
+	g, err = r.athenaTypeToGoType(c, &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, "{a=1}", g)
+
+	testConf.SetUnmarshalJSON(true)
+	val = `{"a":[1,2],"b":"x"}`
+	g, err = r.athenaTypeToGoType(c, &val, testConf)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": []interface{}{1.0, 2.0}, "b": "x"}, g)
+	assert.Equal(t, reflect.TypeOf((*interface{})(nil)).Elem(), r.scanTypeOfColumnType("json"))
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"go.uber.org/zap"
+)
+
+// newResultS3API is to create the S3 client of the query results, with the credentials of the result S3 role
+// if it is set in Config, and sending the requests on each bucket to the region of the bucket if the bucket
+// region detection is enabled.
+func newResultS3API(sess *session.Session, config *Config, obs *DriverTracer) s3iface.S3API {
+	clientConfig := aws.NewConfig()
+	if roleARN, _ := config.GetResultS3Role(); roleARN != "" {
+		clientConfig.Credentials = newResultS3Credentials(sess, config)
+	}
+	s3API := s3.New(sess, clientConfig)
+	if !config.IsResultBucketRegionDetection() {
+		return s3API
+	}
+	return newBucketRegionS3API(s3API, obs, func(ctx context.Context, bucket string) (string, error) {
+		return s3manager.GetBucketRegionWithClient(ctx, s3API, bucket)
+	}, func(region string) s3iface.S3API {
+		return s3.New(sess, clientConfig.Copy().WithRegion(region))
+	})
+}
+
+// bucketRegionS3API is an S3 client sending the requests on the result objects to the region of their bucket,
+// which is looked up once per bucket. The other requests, and the requests on a bucket whose region couldn't be
+// looked up, are sent by the embedded client.
+type bucketRegionS3API struct {
+	s3iface.S3API
+	tracer       *DriverTracer
+	bucketRegion func(ctx context.Context, bucket string) (string, error)
+	newClient    func(region string) s3iface.S3API
+
+	mu sync.Mutex
+	// buckets has the client of each bucket, regions the client of each region.
+	buckets map[string]s3iface.S3API
+	regions map[string]s3iface.S3API
+}
+
+func newBucketRegionS3API(s3API s3iface.S3API, obs *DriverTracer,
+	bucketRegion func(ctx context.Context, bucket string) (string, error),
+	newClient func(region string) s3iface.S3API) *bucketRegionS3API {
+	return &bucketRegionS3API{
+		S3API:        s3API,
+		tracer:       obs,
+		bucketRegion: bucketRegion,
+		newClient:    newClient,
+		buckets:      map[string]s3iface.S3API{},
+		regions:      map[string]s3iface.S3API{},
+	}
+}
+
+// client is to get the client of the region of bucket. The bucket is looked up again next time if the lookup
+// fails, the embedded client is used in the meantime.
+func (b *bucketRegionS3API) client(ctx context.Context, bucket *string) s3iface.S3API {
+	name := aws.StringValue(bucket)
+	b.mu.Lock()
+	client, ok := b.buckets[name]
+	b.mu.Unlock()
+	if ok {
+		return client
+	}
+	region, err := b.bucketRegion(ctx, name)
+	if err != nil {
+		b.tracer.Scope().Counter(DriverName + ".failure.bucketregion").Inc(1)
+		b.tracer.Log(WarnLevel, "bucket region lookup failed", zap.String("bucket", name), zap.Error(err))
+		return b.S3API
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if client, ok = b.regions[region]; !ok {
+		client = b.newClient(region)
+		b.regions[region] = client
+	}
+	b.buckets[name] = client
+	return client
+}
+
+// HeadObjectWithContext is to send the request to the region of the bucket.
+func (b *bucketRegionS3API) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput,
+	opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	return b.client(ctx, input.Bucket).HeadObjectWithContext(ctx, input, opts...)
+}
+
+// GetObjectWithContext is to send the request to the region of the bucket.
+func (b *bucketRegionS3API) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput,
+	opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return b.client(ctx, input.Bucket).GetObjectWithContext(ctx, input, opts...)
+}
+
+// ListObjectsV2PagesWithContext is to send the requests to the region of the bucket.
+func (b *bucketRegionS3API) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input,
+	fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	return b.client(ctx, input.Bucket).ListObjectsV2PagesWithContext(ctx, input, fn, opts...)
+}
+
+// DeleteObjectsWithContext is to send the request to the region of the bucket.
+func (b *bucketRegionS3API) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput,
+	opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	return b.client(ctx, input.Bucket).DeleteObjectsWithContext(ctx, input, opts...)
+}
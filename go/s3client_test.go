@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// regionS3Client records the buckets of the objects got through it.
+type regionS3Client struct {
+	s3iface.S3API
+	region  string
+	buckets []string
+}
+
+func (m *regionS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput,
+	opts ...request.Option) (*s3.GetObjectOutput, error) {
+	m.buckets = append(m.buckets, aws.StringValue(input.Bucket))
+	return &s3.GetObjectOutput{}, nil
+}
+
+func TestBucketRegionS3API(t *testing.T) {
+	defaultClient := &regionS3Client{region: "us-east-1"}
+	clients := map[string]*regionS3Client{}
+	lookups := 0
+	s3API := newBucketRegionS3API(defaultClient, NewNoOpsObservability(),
+		func(ctx context.Context, bucket string) (string, error) {
+			lookups++
+			switch bucket {
+			case "eu-results", "eu-results-2":
+				return "eu-west-1", nil
+			case "us-results":
+				return "us-east-2", nil
+			}
+			return "", errors.New("NotFound")
+		}, func(region string) s3iface.S3API {
+			clients[region] = &regionS3Client{region: region}
+			return clients[region]
+		})
+
+	for _, bucket := range []string{"eu-results", "us-results", "eu-results", "eu-results-2", "missing"} {
+		_, err := s3API.GetObjectWithContext(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String("q.csv"),
+		})
+		assert.Nil(t, err)
+	}
+	// a client per region, a lookup per bucket
+	assert.Len(t, clients, 2)
+	assert.Equal(t, []string{"eu-results", "eu-results", "eu-results-2"}, clients["eu-west-1"].buckets)
+	assert.Equal(t, []string{"us-results"}, clients["us-east-2"].buckets)
+	assert.Equal(t, []string{"missing"}, defaultClient.buckets)
+	assert.Equal(t, 4, lookups)
+
+	// failed lookups are retried
+	_, err := s3API.GetObjectWithContext(context.Background(), &s3.GetObjectInput{Bucket: aws.String("missing")})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, lookups)
+}
+
+func TestNewResultS3API(t *testing.T) {
+	sess, err := session.NewSession(aws.NewConfig().WithRegion("us-east-1").
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))
+	assert.Nil(t, err)
+	config := NewNoOpsConfig()
+	client, ok := newResultS3API(sess, config, NewNoOpsObservability()).(*s3.S3)
+	assert.True(t, ok)
+	assert.Equal(t, sess.Config.Credentials, client.Config.Credentials)
+
+	config.SetResultS3Role("arn:aws:iam::123456789012:role/results", "ext")
+	client, ok = newResultS3API(sess, config, NewNoOpsObservability()).(*s3.S3)
+	assert.True(t, ok)
+	assert.NotEqual(t, sess.Config.Credentials, client.Config.Credentials)
+
+	config.SetResultBucketRegionDetection(true)
+	regional, ok := newResultS3API(sess, config, NewNoOpsObservability()).(*bucketRegionS3API)
+	assert.True(t, ok)
+	assert.NotEqual(t, sess.Config.Credentials, regional.S3API.(*s3.S3).Config.Credentials)
+	assert.Equal(t, "eu-west-1", *regional.newClient("eu-west-1").(*s3.S3).Config.Region)
+}
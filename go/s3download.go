@@ -0,0 +1,160 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// openObject is to get the content of an S3 object. With a download concurrency above 1 in Config,
+// objects larger than the download part size are downloaded in parts with parallel ranged requests.
+func openObject(ctx context.Context, s3API s3iface.S3API, bucket string, key string,
+	config *Config) (body io.ReadCloser, err error) {
+	ctx, span := startSpan(ctx, config, "s3.Download",
+		attribute.String("s3.bucket", bucket), attribute.String("s3.key", key))
+	defer func() { endSpan(span, err) }()
+	concurrency, partSize := config.GetDownloadConcurrency(), config.GetDownloadPartSize()
+	if concurrency > 1 {
+		head, err := s3API.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket:              aws.String(bucket),
+			Key:                 aws.String(key),
+			ExpectedBucketOwner: config.expectedBucketOwner(),
+			RequestPayer:        config.requestPayer(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if size := aws.Int64Value(head.ContentLength); size > partSize {
+			return newPartsReader(ctx, s3API, bucket, key, config, size, partSize, concurrency), nil
+		}
+	}
+	object, err := s3API.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: config.expectedBucketOwner(),
+		RequestPayer:        config.requestPayer(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return object.Body, nil
+}
+
+// part is a downloaded part of an S3 object.
+type part struct {
+	data []byte
+	err  error
+}
+
+// partsReader reads an S3 object downloaded in parts by parallel ranged requests.
+// The parts are read in order, at most `concurrency` parts are downloaded or buffered at the same time.
+type partsReader struct {
+	cancel context.CancelFunc
+	// parts has the pending parts in order, each of them is sent to its channel once downloaded.
+	parts chan chan part
+	cur   *bytes.Reader
+	err   error
+}
+
+func newPartsReader(ctx context.Context, s3API s3iface.S3API, bucket string, key string, config *Config,
+	size int64, partSize int64, concurrency int) *partsReader {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &partsReader{
+		cancel: cancel,
+		parts:  make(chan chan part, concurrency-1),
+		cur:    bytes.NewReader(nil),
+	}
+	go func() {
+		defer close(r.parts)
+		for off := int64(0); off < size; off += partSize {
+			end := off + partSize
+			if end > size {
+				end = size
+			}
+			ch := make(chan part, 1)
+			select {
+			case r.parts <- ch:
+			case <-ctx.Done():
+				return
+			}
+			go func(off, end int64) {
+				ch <- downloadPart(ctx, s3API, bucket, key, config, off, end)
+			}(off, end)
+		}
+	}()
+	return r
+}
+
+// downloadPart is to download the bytes [off, end) of an S3 object.
+func downloadPart(ctx context.Context, s3API s3iface.S3API, bucket string, key string, config *Config,
+	off int64, end int64) part {
+	object, err := s3API.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		Range:               aws.String(fmt.Sprintf("bytes=%d-%d", off, end-1)),
+		ExpectedBucketOwner: config.expectedBucketOwner(),
+		RequestPayer:        config.requestPayer(),
+	})
+	if err != nil {
+		return part{err: err}
+	}
+	defer object.Body.Close()
+	data := make([]byte, end-off)
+	if _, err = io.ReadFull(object.Body, data); err != nil {
+		return part{err: err}
+	}
+	return part{data: data}
+}
+
+// Read is to implement io.Reader.
+func (r *partsReader) Read(p []byte) (int, error) {
+	for r.err == nil && r.cur.Len() == 0 {
+		ch, ok := <-r.parts
+		if !ok {
+			r.err = io.EOF
+			break
+		}
+		next := <-ch
+		if next.err != nil {
+			r.err = next.err
+			break
+		}
+		r.cur.Reset(next.data)
+	}
+	if r.cur.Len() > 0 {
+		return r.cur.Read(p)
+	}
+	return 0, r.err
+}
+
+// Close is to stop downloading the parts.
+func (r *partsReader) Close() error {
+	r.cancel()
+	return nil
+}
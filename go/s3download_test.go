@@ -0,0 +1,169 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+type rangedS3Client struct {
+	s3iface.S3API
+	data []byte
+	// failAt is the offset of the part failing to download, if positive.
+	failAt int
+
+	mu          sync.Mutex
+	ranges      []string
+	owners      []string
+	payers      []string
+	inFlight    int
+	maxInFlight int
+}
+
+func (m *rangedS3Client) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput,
+	opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(m.data)))}, nil
+}
+
+func (m *rangedS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput,
+	opts ...request.Option) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	m.ranges = append(m.ranges, aws.StringValue(input.Range))
+	m.owners = append(m.owners, aws.StringValue(input.ExpectedBucketOwner))
+	m.payers = append(m.payers, aws.StringValue(input.RequestPayer))
+	m.inFlight++
+	if m.inFlight > m.maxInFlight {
+		m.maxInFlight = m.inFlight
+	}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.inFlight--
+		m.mu.Unlock()
+	}()
+	time.Sleep(time.Millisecond)
+
+	if input.Range == nil {
+		return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(m.data))}, nil
+	}
+	var start, end int
+	if _, err := fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end); err != nil {
+		return nil, err
+	}
+	if m.failAt > 0 && start == m.failAt {
+		return nil, errors.New("part failed")
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(m.data[start : end+1]))}, nil
+}
+
+func TestOpenObject_Parts(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	s3Client := &rangedS3Client{data: data}
+	config := NewNoOpsConfig()
+	config.SetDownloadConcurrency(4)
+	config.SetDownloadPartSize(64)
+
+	body, err := openObject(context.Background(), s3Client, "results", "q.csv", config)
+	assert.Nil(t, err)
+	got, err := ioutil.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Nil(t, body.Close())
+	assert.Equal(t, data, got)
+	assert.Len(t, s3Client.ranges, 16)
+	assert.Contains(t, s3Client.ranges, "bytes=960-999")
+	assert.True(t, s3Client.maxInFlight > 1)
+	assert.True(t, s3Client.maxInFlight <= 4)
+
+	// a failed part fails the read
+	s3Client = &rangedS3Client{data: data, failAt: 512}
+	body, err = openObject(context.Background(), s3Client, "results", "q.csv", config)
+	assert.Nil(t, err)
+	got, err = ioutil.ReadAll(body)
+	assert.EqualError(t, err, "part failed")
+	assert.Len(t, got, 512)
+	assert.Nil(t, body.Close())
+}
+
+func TestOpenObject_SingleRequest(t *testing.T) {
+	s3Client := &rangedS3Client{data: []byte("\"id\"\n\"1\"\n")}
+	config := NewNoOpsConfig()
+	body, err := openObject(context.Background(), s3Client, "results", "q.csv", config)
+	assert.Nil(t, err)
+	got, _ := ioutil.ReadAll(body)
+	assert.Equal(t, s3Client.data, got)
+	assert.Equal(t, []string{""}, s3Client.ranges)
+
+	// objects no larger than a part are downloaded with a single request too
+	config.SetDownloadConcurrency(4)
+	body, err = openObject(context.Background(), s3Client, "results", "q.csv", config)
+	assert.Nil(t, err)
+	got, _ = ioutil.ReadAll(body)
+	assert.Equal(t, s3Client.data, got)
+	assert.Equal(t, []string{"", ""}, s3Client.ranges)
+}
+
+func TestOpenObject_ExpectedBucketOwner(t *testing.T) {
+	s3Client := &rangedS3Client{data: make([]byte, 100)}
+	config := NewNoOpsConfig()
+	assert.Nil(t, config.SetResultBucketOwner("123456789012"))
+	body, err := openObject(context.Background(), s3Client, "results", "q.csv", config)
+	assert.Nil(t, err)
+	assert.Nil(t, body.Close())
+
+	config.SetDownloadConcurrency(2)
+	config.SetDownloadPartSize(64)
+	body, err = openObject(context.Background(), s3Client, "results", "q.csv", config)
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Nil(t, body.Close())
+	assert.Equal(t, []string{"123456789012", "123456789012", "123456789012"}, s3Client.owners)
+}
+
+func TestOpenObject_RequesterPays(t *testing.T) {
+	s3Client := &rangedS3Client{data: make([]byte, 100)}
+	config := NewNoOpsConfig()
+	config.SetResultRequesterPays(true)
+	config.SetDownloadConcurrency(2)
+	config.SetDownloadPartSize(64)
+	body, err := openObject(context.Background(), s3Client, "results", "q.csv", config)
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Nil(t, body.Close())
+	assert.Equal(t, []string{s3.RequestPayerRequester, s3.RequestPayerRequester}, s3Client.payers)
+}
@@ -0,0 +1,75 @@
+//go:build go1.21
+
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNewSlogZapLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newSlogZapLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	logger.Debug("not logged")
+	logger.With(zap.String("workgroup", "batch")).Warn("query failed",
+		zap.String("queryID", "qid"), zap.Duration("timeout", time.Second), zap.Int64("scannedBytes", 10))
+	var record map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "query failed", record["msg"])
+	assert.Equal(t, "batch", record["workgroup"])
+	assert.Equal(t, "qid", record["queryID"])
+	assert.Equal(t, float64(time.Second), record["timeout"])
+	assert.Equal(t, float64(10), record["scannedBytes"])
+
+	buf.Reset()
+	logger.Error("failed")
+	assert.Contains(t, buf.String(), `"level":"ERROR"`)
+}
+
+func TestSQLConnector_Connect_SlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	c := NoopsSQLConnector()
+	c.config.SetLogging(true)
+	c.config.SetSlogLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	_, err := c.Connect(context.Background())
+	assert.Nil(t, err)
+	c.tracer.Log(WarnLevel, "from config")
+	assert.Contains(t, buf.String(), "msg=\"from config\"")
+
+	var ctxBuf bytes.Buffer
+	ctx := WithSlogLogger(context.Background(), slog.New(slog.NewTextHandler(&ctxBuf, nil)))
+	_, err = c.Connect(ctx)
+	assert.Nil(t, err)
+	c.tracer.Log(WarnLevel, "from context")
+	assert.Contains(t, ctxBuf.String(), "msg=\"from context\"")
+	assert.NotContains(t, buf.String(), "from context")
+}
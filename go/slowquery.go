@@ -0,0 +1,60 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// reportSlowQuery is to count and log the attempt of query started at start if it ran longer than the slow
+// query threshold of Config. Only the sampled slow queries are logged.
+func (c *Connection) reportSlowQuery(obs *DriverTracer, query string, wgName string, queryID string,
+	start time.Time) {
+	threshold := c.connector.config.GetSlowQueryThreshold()
+	elapsed := time.Since(start)
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+	obs.Scope().Counter(DriverName + ".query.slow").Inc(1)
+	if rand.Float64() >= c.connector.config.GetSlowQuerySampleRate() {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("workgroup", wgName),
+		zap.String("queryID", queryID),
+		zap.String("query", c.connector.config.redactQuery(query)),
+		zap.Duration("elapsed", elapsed),
+		zap.Duration("threshold", threshold),
+	}
+	if stats := c.lastStats; stats != nil {
+		fields = append(fields,
+			zap.String("state", stats.State),
+			zap.Int64("scannedBytes", stats.DataScannedInBytes),
+			zap.Int64("queueTimeMillis", stats.QueryQueueTimeMillis),
+			zap.Int64("planningTimeMillis", stats.QueryPlanningTimeMillis),
+			zap.Int64("engineExecutionTimeMillis", stats.EngineExecutionTimeMillis),
+			zap.Int64("serviceProcessingTimeMillis", stats.ServiceProcessingTimeMillis))
+	}
+	obs.Log(WarnLevel, "slow query", fields...)
+}
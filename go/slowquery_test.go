@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestConnection_QueryContext_SlowQuery(t *testing.T) {
+	core, logs := observer.New(WarnLevel)
+	c := &Connection{
+		athenaAPI: &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetLogging(true)
+	c.connector.config.SetMetrics(true)
+	c.connector.config.SetQueryRedaction(true)
+	scope := tally.NewTestScope("", nil)
+	c.connector.tracer = NewObservability(c.connector.config, zap.New(core), scope)
+	slowQueries := func() int64 {
+		var n int64
+		for k, counter := range scope.Snapshot().Counters() {
+			if strings.HasPrefix(k, DriverName+".query.slow+") {
+				n += counter.Value()
+			}
+		}
+		return n
+	}
+
+	// queries aren't slow by default
+	_, err := c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), slowQueries())
+
+	c.connector.config.SetSlowQueryThreshold(time.Nanosecond)
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), slowQueries())
+	slow := logs.FilterMessage("slow query").All()
+	if assert.Len(t, slow, 1) {
+		fields := slow[0].ContextMap()
+		assert.Equal(t, "PING_OK_QID", fields["queryID"])
+		assert.Equal(t, "SELECT ?", fields["query"])
+		assert.Equal(t, "SUCCEEDED", fields["state"])
+	}
+
+	// the slow queries which aren't sampled are only counted
+	c.connector.config.SetSlowQuerySampleRate(0)
+	_, err = c.QueryContext(context.Background(), "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), slowQueries())
+	assert.Equal(t, 1, logs.FilterMessage("slow query").Len())
+}
+
+func TestConfig_SetSlowQueryThreshold(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, time.Duration(0), testConf.GetSlowQueryThreshold())
+	assert.Equal(t, 1.0, testConf.GetSlowQuerySampleRate())
+	testConf.SetSlowQueryThreshold(time.Minute)
+	testConf.SetSlowQuerySampleRate(0.25)
+	assert.Equal(t, time.Minute, testConf.GetSlowQueryThreshold())
+	assert.Equal(t, 0.25, testConf.GetSlowQuerySampleRate())
+	testConf.SetSlowQuerySampleRate(2)
+	assert.Equal(t, 1.0, testConf.GetSlowQuerySampleRate())
+}
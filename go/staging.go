@@ -0,0 +1,197 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// stagingTablePrefix is the prefix of the names of the tables the subqueries of the queries too long are
+// staged in.
+const stagingTablePrefix = "athenadriver_staging_"
+
+// namedSubquery is a subquery of a WITH clause, like name AS (query).
+type namedSubquery struct {
+	name  string
+	query string
+}
+
+// splitWithClause is to split a query starting with a WITH clause into the subqueries of the clause and
+// the query after it. ok is false for other queries, and for the clauses which can't be split: recursive
+// ones and the ones with column lists.
+func splitWithClause(query string) (subqueries []namedSubquery, body string, ok bool) {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	i := skipSpaceAndComments(query, 0)
+	if !hasKeyword(query[i:], "with") {
+		return nil, "", false
+	}
+	i += len("with")
+	for {
+		i = skipSpaceAndComments(query, i)
+		start := i
+		for i < len(query) && isPlaceholderNameByte(query[i], i == start) {
+			i++
+		}
+		name := query[start:i]
+		if name == "" || strings.EqualFold(name, "recursive") {
+			return nil, "", false
+		}
+		i = skipSpaceAndComments(query, i)
+		if !hasKeyword(query[i:], "as") {
+			return nil, "", false
+		}
+		i = skipSpaceAndComments(query, i+len("as"))
+		if i >= len(query) || query[i] != '(' {
+			return nil, "", false
+		}
+		end := closingParen(query, i)
+		if end < 0 {
+			return nil, "", false
+		}
+		subqueries = append(subqueries, namedSubquery{name: name, query: strings.TrimSpace(query[i+1 : end])})
+		i = skipSpaceAndComments(query, end+1)
+		if i < len(query) && query[i] == ',' {
+			i++
+			continue
+		}
+		body = strings.TrimSpace(query[i:])
+		return subqueries, body, body != ""
+	}
+}
+
+// withQuery is to build the query of body with the WITH clause of subqueries.
+func withQuery(subqueries []namedSubquery, body string) string {
+	if len(subqueries) == 0 {
+		return body
+	}
+	clauses := make([]string, len(subqueries))
+	for i, s := range subqueries {
+		clauses[i] = s.name + " AS (" + s.query + ")"
+	}
+	return "WITH " + strings.Join(clauses, ", ") + " " + body
+}
+
+// hasKeyword is to check if s starts with keyword, in any case, followed by a character which isn't part of
+// an identifier.
+func hasKeyword(s, keyword string) bool {
+	return len(s) >= len(keyword) && strings.EqualFold(s[:len(keyword)], keyword) &&
+		(len(s) == len(keyword) || !isPlaceholderNameByte(s[len(keyword)], false))
+}
+
+// skipSpaceAndComments is to get the index of the first character of query from i which isn't a space nor in
+// a comment.
+func skipSpaceAndComments(query string, i int) int {
+	for i < len(query) {
+		switch {
+		case query[i] == ' ' || query[i] == '\t' || query[i] == '\n' || query[i] == '\r':
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// closingParen is to get the index of the parenthesis closing the one at open in query, skipping the ones in
+// string literals, quoted identifiers and comments, or -1 if there is none.
+func closingParen(query string, open int) int {
+	depth := 0
+	for i := open; i < len(query); i++ {
+		switch ch := query[i]; {
+		case ch == '\'' || ch == '"' || ch == '`':
+			// quotes are escaped by doubling them, which closes and opens the quotes again
+			for i++; i < len(query) && query[i] != ch; i++ {
+			}
+		case ch == '-' || ch == '/':
+			if next := skipSpaceAndComments(query, i); next > i {
+				i = next - 1
+			}
+		case ch == '(':
+			depth++
+		case ch == ')':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// stagedQueryContext is to run query, too long for Athena, with the subqueries of its WITH clause staged in
+// temporary tables, from the first one, until the query is short enough. The tables are dropped along with
+// their data once the query completes, its results are in the output location then.
+func (c *Connection) stagedQueryContext(ctx context.Context, query string) (driver.Rows, error) {
+	var obs = c.queryTracer(ctx)
+	subqueries, body, ok := splitWithClause(query)
+	if !ok {
+		return nil, &QueryTooLongError{Length: len(query)}
+	}
+	// the query is checked to be short enough with all its subqueries staged, before any of them is
+	staged := make([]namedSubquery, len(subqueries))
+	for i, s := range subqueries {
+		staged[i] = namedSubquery{name: s.name, query: "SELECT * FROM " + stagingTablePrefix + randString(16)}
+	}
+	if len(withQuery(staged, body)) >= MAXQueryStringLength {
+		return nil, &QueryTooLongError{Length: len(query)}
+	}
+	var tables, locations []string
+	defer func() {
+		for i, table := range tables {
+			c.cleanupCTAS(table, locations[i])
+		}
+	}()
+	for i := 0; ; i++ {
+		query = withQuery(subqueries, body)
+		if len(query) < MAXQueryStringLength {
+			break
+		}
+		table := stagingTablePrefix + strings.ToLower(randString(16))
+		result, err := c.CreateTableAs(ctx, table, "PARQUET", nil, withQuery(subqueries[:i], subqueries[i].query))
+		if err != nil {
+			obs.Scope().Counter(DriverName + ".failure.query.staging").Inc(1)
+			return nil, err
+		}
+		tables, locations = append(tables, table), append(locations, result.Location)
+		subqueries[i].query = "SELECT * FROM " + table
+	}
+	obs.Log(DebugLevel, "query subqueries staged",
+		zap.Strings("tables", tables),
+		zap.Int("length", len(query)))
+	obs.Scope().Counter(DriverName + ".query.staged").Inc(int64(len(tables)))
+	// the staging tables are new each time, so the rows would never be served again
+	return c.QueryContext(WithoutResultCache(ctx), query, nil)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitWithClause(t *testing.T) {
+	// quoted names are not split
+	_, _, ok := splitWithClause(`with a AS (SELECT 1), "b" AS (SELECT 2) SELECT * FROM a, b`)
+	assert.False(t, ok)
+
+	subqueries, body, ok := splitWithClause(`-- report
+with a AS (SELECT ')' AS x /* ) */), b_2 AS (SELECT (1) FROM a)
+ SELECT * FROM a, b_2;`)
+	assert.True(t, ok)
+	assert.Equal(t, []namedSubquery{
+		{name: "a", query: "SELECT ')' AS x /* ) */"},
+		{name: "b_2", query: "SELECT (1) FROM a"},
+	}, subqueries)
+	assert.Equal(t, "SELECT * FROM a, b_2", body)
+	assert.Equal(t, 18, closingParen(`(SELECT 'C:\' AS p)`, 0))
+	assert.Equal(t, 18, closingParen(`(SELECT ')''' AS p)`, 0))
+	assert.Equal(t, "WITH a AS (SELECT ')' AS x /* ) */), b_2 AS (SELECT (1) FROM a) SELECT * FROM a, b_2",
+		withQuery(subqueries, body))
+
+	for _, query := range []string{
+		"SELECT 1",
+		"WITH RECURSIVE t(n) AS (SELECT 1) SELECT * FROM t",
+		"WITH t(n) AS (SELECT 1) SELECT * FROM t",
+		"WITH t AS (SELECT 1",
+		"WITH t AS (SELECT 1)",
+		"WITHt AS (SELECT 1) SELECT 1",
+	} {
+		_, _, ok = splitWithClause(query)
+		assert.False(t, ok, query)
+	}
+}
+
+func TestConnection_QueryContext_QueryStaging(t *testing.T) {
+	athenaClient := &ctasAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	long := strings.Repeat("x", MAXQueryStringLength/2)
+	query := "WITH a AS (SELECT '" + long + "' AS x), b AS (SELECT '" + long + "' AS y) SELECT * FROM a, b"
+
+	_, err := c.QueryContext(context.Background(), query, nil)
+	assert.True(t, errors.Is(err, ErrQueryTooLong))
+	assert.Empty(t, athenaClient.inputs)
+
+	c.connector.config.SetQueryStaging(true)
+	rows, err := c.QueryContext(context.Background(), query, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, rows.Close())
+	if assert.Len(t, athenaClient.inputs, 3) {
+		ctas := *athenaClient.inputs[0].QueryString
+		assert.True(t, strings.HasPrefix(ctas, "CREATE TABLE "+stagingTablePrefix), ctas)
+		assert.True(t, strings.HasSuffix(ctas, " AS SELECT '"+long+"' AS x"))
+		table := strings.Fields(ctas)[2]
+		assert.Equal(t, "WITH a AS (SELECT * FROM "+table+"), b AS (SELECT '"+long+"' AS y) SELECT * FROM a, b",
+			*athenaClient.inputs[1].QueryString)
+		assert.Equal(t, "DROP TABLE IF EXISTS "+table, *athenaClient.inputs[2].QueryString)
+	}
+
+	// the query is too long even with the subqueries staged
+	athenaClient.inputs = nil
+	query = "WITH a AS (SELECT 1) SELECT '" + long + long + "'"
+	_, err = c.QueryContext(context.Background(), query, nil)
+	assert.Equal(t, &QueryTooLongError{Length: len(query)}, err)
+	assert.Len(t, athenaClient.inputs, 0)
+}
@@ -23,15 +23,27 @@ package athenadriver
 import (
 	"context"
 	"database/sql/driver"
+	"fmt"
 	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"go.uber.org/zap"
 )
 
+// preparedStatementPrefix is the prefix of the names of Athena prepared statements created by the driver.
+const preparedStatementPrefix = "athenadriver_"
+
 // Statement is to implement Go's database/sql Statement.
 type Statement struct {
 	connection *Connection
 	closed     bool
 	query      string
 	numInput   int
+	// name is the name of the Athena prepared statement, if it is prepared server-side.
+	name string
+	// wgName is the workgroup of the Athena prepared statement, where it is run.
+	wgName string
 }
 
 // Close is to close an open statement.
@@ -42,10 +54,14 @@ func (s *Statement) Close() error {
 		// See also Issue #450 and golang/go#16019.
 		return driver.ErrBadConn
 	}
+	var err error
+	if s.name != "" {
+		err = s.deallocate(context.Background())
+	}
 	s.query = ""
 	s.closed = true
 	s.numInput = 0
-	return nil
+	return err
 }
 
 // NumInput returns the number of prepared arguments.
@@ -54,6 +70,9 @@ func (s *Statement) Close() error {
 // will not sanity check Exec or Query argument counts.
 // -- From Go `sql/driver`
 func (s *Statement) NumInput() int {
+	if len(namedPlaceholders(s.query)) > 0 {
+		return -1
+	}
 	if s.numInput == 0 {
 		s.numInput = strings.Count(s.query, "?")
 	}
@@ -67,22 +86,191 @@ func (s *Statement) ColumnConverter(idx int) driver.ValueConverter {
 
 // Exec is to execute a prepared statement.
 func (s *Statement) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valueToNamedValue(args))
+}
+
+// Query is to query based on a prepared statement.
+func (s *Statement) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valueToNamedValue(args))
+}
+
+// ExecContext is to execute a prepared statement, with named args supported (StmtExecContext interface).
+func (s *Statement) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
 	if s.closed {
 		return nil, driver.ErrBadConn
 	}
-	r, e := s.connection.ExecContext(context.Background(), s.query,
-		valueToNamedValue(args))
+	if s.name != "" {
+		query, err := s.execute(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.connection.ExecContext(WithWorkgroup(ctx, s.wgName), query, nil)
+	}
+	r, e := s.connection.ExecContext(ctx, s.query, args)
 	s.closed = true
 	return r, e
 }
 
-// Query is to query based on a prepared statement.
-func (s *Statement) Query(args []driver.Value) (driver.Rows, error) {
+// QueryContext is to query based on a prepared statement, with named args supported (StmtQueryContext interface).
+func (s *Statement) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
 	if s.closed {
 		return nil, driver.ErrBadConn
 	}
-	r, e := s.connection.QueryContext(context.Background(), s.query,
-		valueToNamedValue(args))
+	if s.name != "" {
+		query, err := s.execute(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.connection.QueryContext(WithWorkgroup(ctx, s.wgName), query, nil)
+	}
+	r, e := s.connection.QueryContext(ctx, s.query, args)
 	s.closed = true
 	return r, e
 }
+
+// prepare is to create the statement as an Athena prepared statement in the workgroup of the queries with ctx,
+// like `PREPARE name FROM query`. The statement can be run any number of times until it is closed then, in the
+// same workgroup, as Athena prepared statements belong to a workgroup.
+func (s *Statement) prepare(ctx context.Context) error {
+	c := s.connection
+	config := c.connector.config
+	if config.IsReadOnly() && !isReadOnlyStatement(s.query) {
+		c.connector.tracer.Scope().Counter(DriverName + ".failure.prepare.writeviolation").Inc(1)
+		c.connector.tracer.Log(WarnLevel, "write db violation", zap.String("query", config.redactQuery(s.query)))
+		return fmt.Errorf("writing to Athena database is disallowed in read-only mode")
+	}
+	name := preparedStatementPrefix + randString(16)
+	wgName := getWorkgroup(ctx, config).Name
+	if wgName == "" {
+		wgName = DefaultWGName
+	}
+	_, err := c.athenaAPI.CreatePreparedStatementWithContext(ctx, &athena.CreatePreparedStatementInput{
+		StatementName:  aws.String(name),
+		QueryStatement: aws.String(replaceNamedPlaceholders(s.query)),
+		WorkGroup:      aws.String(wgName),
+	})
+	if err != nil {
+		c.connector.tracer.Scope().Counter(DriverName + ".failure.prepare").Inc(1)
+		return err
+	}
+	if c.preparedStatements == nil {
+		c.preparedStatements = make(map[string]bool)
+	}
+	c.preparedStatements[name] = true
+	s.name, s.wgName = name, wgName
+	return nil
+}
+
+// execute is to get the `EXECUTE name USING args` query of the prepared statement.
+func (s *Statement) execute(args []driver.NamedValue) (string, error) {
+	query, args, err := bindNamedArgs(s.query, args)
+	if err != nil {
+		return "", err
+	}
+	params, err := s.connection.executionParameters(query, namedValueToValue(args))
+	if err != nil {
+		return "", err
+	}
+	if len(params) == 0 {
+		return "EXECUTE " + s.name, nil
+	}
+	return "EXECUTE " + s.name + " USING " + strings.Join(aws.StringValueSlice(params), ", "), nil
+}
+
+// deallocate is to delete the Athena prepared statement, like `DEALLOCATE PREPARE name`.
+func (s *Statement) deallocate(ctx context.Context) error {
+	c := s.connection
+	delete(c.preparedStatements, s.name)
+	_, err := c.athenaAPI.DeletePreparedStatementWithContext(ctx, &athena.DeletePreparedStatementInput{
+		StatementName: aws.String(s.name),
+		WorkGroup:     aws.String(s.wgName),
+	})
+	s.name, s.wgName = "", ""
+	return err
+}
+
+// executedStatementName is to get the name of the prepared statement run by an `EXECUTE name` query.
+func executedStatementName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "EXECUTE") {
+		return ""
+	}
+	return fields[1]
+}
+
+// placeholder is a named placeholder in a query, like :name or @name.
+type placeholder struct {
+	start, end int
+	name       string
+}
+
+// namedPlaceholders is to find the :name and @name placeholders of the query,
+// skipping string literals and quoted identifiers.
+func namedPlaceholders(query string) []placeholder {
+	var placeholders []placeholder
+	for i := 0; i < len(query); i++ {
+		switch ch := query[i]; ch {
+		case '\'', '"', '`':
+			if end := strings.IndexByte(query[i+1:], ch); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case ':', '@':
+			j := i + 1
+			for j < len(query) && isPlaceholderNameByte(query[j], j == i+1) {
+				j++
+			}
+			if j > i+1 {
+				placeholders = append(placeholders, placeholder{start: i, end: j, name: query[i+1 : j]})
+				i = j - 1
+			}
+		}
+	}
+	return placeholders
+}
+
+func isPlaceholderNameByte(b byte, first bool) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || !first && b >= '0' && b <= '9'
+}
+
+// replaceNamedPlaceholders is to replace the named placeholders of the query with ?.
+func replaceNamedPlaceholders(query string) string {
+	var b strings.Builder
+	last := 0
+	for _, p := range namedPlaceholders(query) {
+		b.WriteString(query[last:p.start])
+		b.WriteByte('?')
+		last = p.end
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+// bindNamedArgs is to replace the named placeholders of the query with ?, and return the args in
+// the order of the placeholders, so they are bound like positional ones.
+// Queries with positional args only are returned as they are.
+func bindNamedArgs(query string, args []driver.NamedValue) (string, []driver.NamedValue, error) {
+	named := make(map[string]driver.NamedValue, len(args))
+	for _, arg := range args {
+		if arg.Name != "" {
+			named[arg.Name] = arg
+		}
+	}
+	if len(named) == 0 {
+		return query, args, nil
+	}
+	if len(named) != len(args) {
+		return "", nil, ErrQueryMixedArgs
+	}
+	bound := make([]driver.NamedValue, 0, len(args))
+	for _, p := range namedPlaceholders(query) {
+		arg, ok := named[p.name]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s", ErrQueryNamedArgMissing, query[p.start:p.end])
+		}
+		arg.Ordinal = len(bound) + 1
+		bound = append(bound, arg)
+	}
+	return replaceNamedPlaceholders(query), bound, nil
+}
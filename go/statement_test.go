@@ -22,9 +22,15 @@ package athenadriver
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -182,3 +188,162 @@ func TestStatement_Close_AfterConnectionClose(t *testing.T) {
 	err := st.Close()
 	assert.Equal(t, err, driver.ErrBadConn)
 }
+
+func TestBindNamedArgs(t *testing.T) {
+	args := []driver.NamedValue{
+		{Name: "id", Ordinal: 1, Value: int64(7)},
+		{Name: "day", Ordinal: 2, Value: "2022-03-04"},
+	}
+	q, bound, err := bindNamedArgs("SELECT * FROM t WHERE day = @day AND id = :id AND (:id IS NULL OR id > 0)", args)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE day = ? AND id = ? AND (? IS NULL OR id > 0)", q)
+	assert.Equal(t, []driver.NamedValue{
+		{Name: "day", Ordinal: 1, Value: "2022-03-04"},
+		{Name: "id", Ordinal: 2, Value: int64(7)},
+		{Name: "id", Ordinal: 3, Value: int64(7)},
+	}, bound)
+
+	// placeholders in string literals and quoted identifiers are kept
+	q, bound, err = bindNamedArgs(`SELECT '10:id', "a:id", 'it''s :id' FROM t WHERE id = :id`, args)
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT '10:id', "a:id", 'it''s :id' FROM t WHERE id = ?`, q)
+	assert.Len(t, bound, 1)
+
+	// positional args are kept as they are
+	positional := []driver.NamedValue{{Ordinal: 1, Value: int64(7)}}
+	q, bound, err = bindNamedArgs("SELECT * FROM t WHERE id = ?", positional)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE id = ?", q)
+	assert.Equal(t, positional, bound)
+
+	_, _, err = bindNamedArgs("SELECT * FROM t WHERE id = :id AND day = ?", append(positional, args[0]))
+	assert.Equal(t, ErrQueryMixedArgs, err)
+	_, _, err = bindNamedArgs("SELECT * FROM t WHERE id = :uid", args)
+	assert.True(t, errors.Is(err, ErrQueryNamedArgMissing))
+	assert.Contains(t, err.Error(), ":uid")
+}
+
+func TestStatement_NamedArgs(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	conn := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	st := &Statement{
+		connection: conn,
+		query:      "SELECT * FROM t WHERE id = :id",
+	}
+	assert.Equal(t, -1, st.NumInput())
+	_, err := st.QueryContext(context.Background(), []driver.NamedValue{
+		{Name: "id", Ordinal: 1, Value: int64(7)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM t WHERE id = 7", *athenaClient.inputs[0].QueryString)
+
+	db := sql.OpenDB(&SQLConnector{
+		config:    conn.connector.config,
+		tracer:    conn.connector.tracer,
+		athenaAPI: athenaClient,
+	})
+	defer db.Close()
+	_, err = db.Exec("INSERT INTO t VALUES (@id, @name)", sql.Named("name", "gopher"), sql.Named("id", 8))
+	assert.Nil(t, err)
+	assert.Equal(t, "INSERT INTO t VALUES (8, 'gopher')", *athenaClient.inputs[1].QueryString)
+}
+
+// preparedStatementAthenaClient records the prepared statements by workgroup and name.
+type preparedStatementAthenaClient struct {
+	queryContextAthenaClient
+	prepared map[string]string
+}
+
+func (m *preparedStatementAthenaClient) CreatePreparedStatementWithContext(ctx aws.Context,
+	input *athena.CreatePreparedStatementInput, opts ...request.Option) (*athena.CreatePreparedStatementOutput, error) {
+	m.prepared[*input.StatementName] = *input.QueryStatement
+	m.prepared[*input.WorkGroup+"/"+*input.StatementName] = *input.QueryStatement
+	return &athena.CreatePreparedStatementOutput{}, nil
+}
+
+func (m *preparedStatementAthenaClient) DeletePreparedStatementWithContext(ctx aws.Context,
+	input *athena.DeletePreparedStatementInput, opts ...request.Option) (*athena.DeletePreparedStatementOutput, error) {
+	if _, ok := m.prepared[*input.WorkGroup+"/"+*input.StatementName]; !ok {
+		return nil, ErrTestMockGeneric
+	}
+	delete(m.prepared, *input.StatementName)
+	delete(m.prepared, *input.WorkGroup+"/"+*input.StatementName)
+	return &athena.DeletePreparedStatementOutput{}, nil
+}
+
+func TestStatement_ServerSidePrepared(t *testing.T) {
+	athenaClient := &preparedStatementAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		prepared:                 map[string]string{},
+	}
+	conn := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	conn.connector.config.SetServerSidePreparedStatements(true)
+	conn.connector.config.SetReadOnly(true)
+
+	stmt, err := conn.Prepare("SELECT * FROM t WHERE id = ? AND name = ?")
+	assert.Nil(t, err)
+	st := stmt.(*Statement)
+	assert.True(t, strings.HasPrefix(st.name, preparedStatementPrefix))
+	assert.Equal(t, "SELECT * FROM t WHERE id = ? AND name = ?", athenaClient.prepared[st.name])
+	assert.Equal(t, 2, st.NumInput())
+
+	// the statement can be run more than once, even in read-only mode
+	_, err = st.Query([]driver.Value{int64(7), "it's"})
+	assert.Nil(t, err)
+	_, err = st.Exec([]driver.Value{int64(8), "go"})
+	assert.Nil(t, err)
+	assert.Equal(t, "EXECUTE "+st.name+" USING 7, 'it''s'", *athenaClient.inputs[0].QueryString)
+	assert.Equal(t, "EXECUTE "+st.name+" USING 8, 'go'", *athenaClient.inputs[1].QueryString)
+	_, err = st.Exec([]driver.Value{int64(8)})
+	assert.Equal(t, ErrInvalidQuery, err)
+
+	name := st.name
+	assert.Nil(t, st.Close())
+	assert.NotContains(t, athenaClient.prepared, name)
+	_, err = conn.QueryContext(context.Background(), "EXECUTE "+name, nil)
+	assert.NotNil(t, err)
+
+	// named placeholders are bound by name on every run
+	stmt, err = conn.Prepare("SELECT * FROM t WHERE id = :id OR parent = :id")
+	assert.Nil(t, err)
+	st = stmt.(*Statement)
+	assert.Equal(t, "SELECT * FROM t WHERE id = ? OR parent = ?", athenaClient.prepared[st.name])
+	_, err = st.QueryContext(context.Background(), []driver.NamedValue{{Name: "id", Ordinal: 1, Value: int64(9)}})
+	assert.Nil(t, err)
+	assert.Equal(t, "EXECUTE "+st.name+" USING 9, 9", *athenaClient.inputs[2].QueryString)
+	assert.Nil(t, st.Close())
+
+	_, err = conn.Prepare("INSERT INTO t VALUES (?)")
+	assert.NotNil(t, err)
+	assert.Empty(t, athenaClient.prepared)
+}
+
+func TestStatement_ServerSidePrepared_Workgroup(t *testing.T) {
+	athenaClient := &preparedStatementAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		prepared:                 map[string]string{},
+	}
+	conn := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	conn.connector.config.SetServerSidePreparedStatements(true)
+	athenaClient.GetWGStatus = true
+
+	stmt, err := conn.PrepareContext(WithWorkgroup(context.Background(), "etl"), "SELECT * FROM t WHERE id = ?")
+	assert.Nil(t, err)
+	st := stmt.(*Statement)
+	assert.Contains(t, athenaClient.prepared, "etl/"+st.name)
+	// the statement is run in the workgroup it's prepared in
+	_, err = st.Query([]driver.Value{int64(7)})
+	assert.Nil(t, err)
+	assert.Equal(t, "etl", *athenaClient.inputs[0].WorkGroup)
+	assert.Nil(t, st.Close())
+	assert.Empty(t, athenaClient.prepared)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// QueryStats are the statistics of a query execution, as reported by Athena when the query is complete.
+type QueryStats struct {
+	QueryExecutionID            string
+	State                       string
+	DataScannedInBytes          int64
+	EngineExecutionTimeMillis   int64
+	QueryQueueTimeMillis        int64
+	QueryPlanningTimeMillis     int64
+	ServiceProcessingTimeMillis int64
+	TotalExecutionTimeMillis    int64
+}
+
+// StatsCollector collects the QueryStats of the queries run with a context set with WithStats, so they can be
+// logged without calling GetQueryExecution again. It is safe for concurrent use.
+type StatsCollector struct {
+	mu    sync.Mutex
+	stats []QueryStats
+}
+
+// NewStatsCollector is to create an empty StatsCollector.
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{}
+}
+
+// Last is to get the stats of the last query complete, false if no query is complete yet.
+func (s *StatsCollector) Last() (QueryStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.stats) == 0 {
+		return QueryStats{}, false
+	}
+	return s.stats[len(s.stats)-1], true
+}
+
+// All is to get the stats of all the queries complete, in the order they completed, like the statements
+// of a script run with multiple statements enabled.
+func (s *StatsCollector) All() []QueryStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]QueryStats(nil), s.stats...)
+}
+
+// Reset is to remove the stats collected, so the collector can be reused.
+func (s *StatsCollector) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = nil
+}
+
+func (s *StatsCollector) add(stats QueryStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = append(s.stats, stats)
+}
+
+// newQueryStats is to get the QueryStats of execution.
+func newQueryStats(execution *athena.QueryExecution) QueryStats {
+	stats := QueryStats{QueryExecutionID: aws.StringValue(execution.QueryExecutionId)}
+	if execution.Status != nil {
+		stats.State = aws.StringValue(execution.Status.State)
+	}
+	if s := execution.Statistics; s != nil {
+		stats.DataScannedInBytes = aws.Int64Value(s.DataScannedInBytes)
+		stats.EngineExecutionTimeMillis = aws.Int64Value(s.EngineExecutionTimeInMillis)
+		stats.QueryQueueTimeMillis = aws.Int64Value(s.QueryQueueTimeInMillis)
+		stats.QueryPlanningTimeMillis = aws.Int64Value(s.QueryPlanningTimeInMillis)
+		stats.ServiceProcessingTimeMillis = aws.Int64Value(s.ServiceProcessingTimeInMillis)
+		stats.TotalExecutionTimeMillis = aws.Int64Value(s.TotalExecutionTimeInMillis)
+	}
+	return stats
+}
+
+// reportStats is to add the stats of a query execution which is complete to the StatsCollector in context
+// under StatsKey, and keep them for the Hooks.
+func (c *Connection) reportStats(ctx context.Context, o *athena.GetQueryExecutionOutput) {
+	if o == nil || o.QueryExecution == nil {
+		return
+	}
+	stats := newQueryStats(o.QueryExecution)
+	c.lastStats = &stats
+	if collector, ok := ctx.Value(StatsKey).(*StatsCollector); ok && collector != nil {
+		collector.add(stats)
+	}
+}
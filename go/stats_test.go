@@ -0,0 +1,93 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewQueryStats(t *testing.T) {
+	stats := newQueryStats(&athena.QueryExecution{
+		QueryExecutionId: aws.String("qid"),
+		Status:           &athena.QueryExecutionStatus{State: aws.String(athena.QueryExecutionStateSucceeded)},
+		Statistics: &athena.QueryExecutionStatistics{
+			DataScannedInBytes:            aws.Int64(1024),
+			EngineExecutionTimeInMillis:   aws.Int64(1500),
+			QueryQueueTimeInMillis:        aws.Int64(200),
+			QueryPlanningTimeInMillis:     aws.Int64(300),
+			ServiceProcessingTimeInMillis: aws.Int64(50),
+			TotalExecutionTimeInMillis:    aws.Int64(1750),
+		},
+	})
+	assert.Equal(t, QueryStats{
+		QueryExecutionID:            "qid",
+		State:                       athena.QueryExecutionStateSucceeded,
+		DataScannedInBytes:          1024,
+		EngineExecutionTimeMillis:   1500,
+		QueryQueueTimeMillis:        200,
+		QueryPlanningTimeMillis:     300,
+		ServiceProcessingTimeMillis: 50,
+		TotalExecutionTimeMillis:    1750,
+	}, stats)
+	assert.Equal(t, QueryStats{QueryExecutionID: "qid"}, newQueryStats(&athena.QueryExecution{
+		QueryExecutionId: aws.String("qid"),
+	}))
+}
+
+func TestConnection_QueryContext_WithStats(t *testing.T) {
+	c := &Connection{
+		athenaAPI: &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		connector: NoopsSQLConnector(),
+	}
+	stats := NewStatsCollector()
+	_, ok := stats.Last()
+	assert.False(t, ok)
+
+	ctx := WithStats(context.Background(), stats)
+	_, err := c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	_, err = c.QueryContext(ctx, "SELECT 2", nil)
+	assert.Nil(t, err)
+	last, ok := stats.Last()
+	assert.True(t, ok)
+	assert.Equal(t, QueryStats{QueryExecutionID: "PING_OK_QID", State: athena.QueryExecutionStateSucceeded}, last)
+	assert.Len(t, stats.All(), 2)
+	stats.Reset()
+	assert.Empty(t, stats.All())
+
+	// stopped queries have stats too
+	athenaClient := &scanningAthenaClient{runningAthenaClient: runningAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}}
+	c.athenaAPI = athenaClient
+	c.connector.config.SetPollInterval(time.Millisecond)
+	c.connector.config.SetMaxScannedBytes(150)
+	_, err = c.QueryContext(ctx, "SELECT 1", nil)
+	assert.NotNil(t, err)
+	last, _ = stats.Last()
+	assert.Equal(t, athena.QueryExecutionStateCancelled, last.State)
+	assert.Equal(t, int64(300), last.DataScannedInBytes)
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeTravelClausePattern is to find the FROM and JOIN clauses of a query, followed by their relations.
+var timeTravelClausePattern = regexp.MustCompile(`(?i)\s(?:from|join)\b\s*`)
+
+// timeTravelCallPattern is to skip the table functions, like UNNEST(a), which are not tables.
+var timeTravelCallPattern = regexp.MustCompile(`^\s*\(`)
+
+// timeTravelForPattern is to skip the tables read at a snapshot already.
+var timeTravelForPattern = regexp.MustCompile(`(?i)^\s*for\s`)
+
+// cteNamePattern is to find the names of the common table expressions of a query, which are not tables.
+var cteNamePattern = regexp.MustCompile(`(?i)(?:\bwith|,)\s+"?(\w+)"?\s+as\s*\(`)
+
+// relationEndKeywords are the keywords ending the list of relations of a FROM clause.
+var relationEndKeywords = map[string]bool{
+	"cross": true, "except": true, "fetch": true, "full": true, "group": true, "having": true, "inner": true,
+	"intersect": true, "join": true, "left": true, "limit": true, "natural": true, "offset": true, "on": true,
+	"order": true, "right": true, "union": true, "using": true, "where": true, "window": true,
+}
+
+// distinctFromPattern is to skip the FROM of IS DISTINCT FROM, which is not a clause.
+var distinctFromPattern = regexp.MustCompile(`(?i)\bdistinct\s*$`)
+
+// nonCallKeywords are the keywords before the parentheses of subqueries and expressions, which are not function
+// calls.
+var nonCallKeywords = map[string]bool{
+	"all": true, "and": true, "any": true, "as": true, "by": true, "else": true, "except": true, "exists": true,
+	"from": true, "having": true, "in": true, "intersect": true, "join": true, "lateral": true, "not": true,
+	"on": true, "or": true, "select": true, "some": true, "then": true, "union": true, "using": true,
+	"values": true, "when": true, "where": true, "with": true,
+}
+
+// sqlCode is to get the query with its string literals and comments blanked out, so the patterns don't match in
+// them, with the same byte offsets, and which bytes of it are in the arguments of a function call, like
+// EXTRACT(YEAR FROM ts) or TRIM(BOTH FROM s), where FROM is not a clause.
+func sqlCode(query string) (string, []bool) {
+	code := []byte(query)
+	inCall := make([]bool, len(code))
+	var parens []bool
+	calls := 0
+	blank := func(from, to int) {
+		for ; from < to && from < len(code); from++ {
+			code[from] = ' '
+		}
+	}
+	for i := 0; i < len(code); i++ {
+		switch {
+		case code[i] == '\'':
+			j := i + 1
+			for ; j < len(code); j++ {
+				if code[j] == '\'' {
+					if j+1 < len(code) && code[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			blank(i, j+1)
+			i = j
+		case code[i] == '-' && i+1 < len(code) && code[i+1] == '-':
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(code) - i
+			}
+			blank(i, i+j)
+			i += j
+		case code[i] == '/' && i+1 < len(code) && code[i+1] == '*':
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				j = len(code)
+			}
+			blank(i, i+j+4)
+			i += j + 3
+		case code[i] == '(':
+			call := isCallParen(code[:i])
+			parens = append(parens, call)
+			if call {
+				calls++
+			}
+		case code[i] == ')' && len(parens) > 0:
+			if parens[len(parens)-1] {
+				calls--
+			}
+			parens = parens[:len(parens)-1]
+		}
+		if i < len(code) {
+			inCall[i] = calls > 0
+		}
+	}
+	return string(code), inCall
+}
+
+// isCallParen is to check if the parenthesis after code opens the arguments of a function call, which it does
+// after a name which isn't a keyword.
+func isCallParen(code []byte) bool {
+	end := len(code)
+	for end > 0 && (code[end-1] == ' ' || code[end-1] == '\t' || code[end-1] == '\n' || code[end-1] == '\r') {
+		end--
+	}
+	start := end
+	for start > 0 && isPlaceholderNameByte(code[start-1], false) {
+		start--
+	}
+	return start < end && !nonCallKeywords[strings.ToLower(string(code[start:end]))]
+}
+
+// timeTravel is the snapshots of the Iceberg tables read by the queries with a context, by table name.
+type timeTravel struct {
+	snapshotIDs map[string]int64
+	asOf        time.Time
+	// asOfTables are the tables read as of asOf, all of them if empty.
+	asOfTables []string
+}
+
+// qualifiedTableName is to get the name of table as database.table in lower case, in db if it's unqualified.
+// The data catalog of catalog.database.table is left out.
+func qualifiedTableName(table string, db string) string {
+	database, table := splitTableName(strings.ToLower(table), strings.ToLower(db))
+	return database + "." + table
+}
+
+// relationName is to get the end of the name of the relation at i of code, like db."t", and the name without
+// its quotes. end is -1 if there is no name at i.
+func relationName(code string, i int) (end int, name string) {
+	var parts []string
+	for {
+		if i < len(code) && code[i] == '"' {
+			var part strings.Builder
+			j := i + 1
+			for ; j < len(code); j++ {
+				if code[j] == '"' {
+					if j+1 < len(code) && code[j+1] == '"' {
+						j++
+					} else {
+						break
+					}
+				}
+				part.WriteByte(code[j])
+			}
+			if j == len(code) {
+				return -1, ""
+			}
+			parts, i = append(parts, part.String()), j+1
+		} else {
+			j := i
+			for j < len(code) && isIdentifierChar(code[j]) {
+				j++
+			}
+			if j == i {
+				return -1, ""
+			}
+			parts, i = append(parts, code[i:j]), j
+		}
+		if i == len(code) || code[i] != '.' {
+			return i, strings.Join(parts, ".")
+		}
+		i++
+	}
+}
+
+// nextRelation is to get the index of the relation after the one ending at i in the list of a FROM clause of
+// code, skipping its alias and its sample, or -1 if it is the last one.
+func nextRelation(code string, i int) int {
+	for i < len(code) {
+		switch ch := code[i]; {
+		case ch == ',':
+			return skipSpaceAndComments(code, i+1)
+		case ch == ')' || ch == ';':
+			return -1
+		case ch == '(' || ch == '"':
+			if ch == '(' {
+				i = closingParen(code, i)
+			} else {
+				i, _ = relationName(code, i)
+			}
+			if i < 0 {
+				return -1
+			}
+			if ch == '(' {
+				i++
+			}
+		case isIdentifierChar(ch):
+			j := i
+			for j < len(code) && isIdentifierChar(code[j]) {
+				j++
+			}
+			if relationEndKeywords[strings.ToLower(code[i:j])] {
+				return -1
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// timeTravelQuery is to add the FOR VERSION AS OF and FOR TIMESTAMP AS OF clauses of the snapshots in ctx to
+// the tables of the query, each of the relations of the FROM and JOIN clauses. It fails with ErrInvalidQuery
+// if one of them can't be read, rather than reading its current snapshot.
+func timeTravelQuery(ctx context.Context, config *Config, query string) (string, error) {
+	tt := getTimeTravel(ctx)
+	if (len(tt.snapshotIDs) == 0 && tt.asOf.IsZero()) || !isUnloadable(query) {
+		return query, nil
+	}
+	db := getDatabase(ctx, config)
+	snapshotIDs := make(map[string]int64, len(tt.snapshotIDs))
+	for table, id := range tt.snapshotIDs {
+		snapshotIDs[qualifiedTableName(table, db)] = id
+	}
+	asOfTables := make(map[string]bool, len(tt.asOfTables))
+	for _, table := range tt.asOfTables {
+		asOfTables[qualifiedTableName(table, db)] = true
+	}
+	code, inCall := sqlCode(query)
+	ctes := map[string]bool{}
+	for _, m := range cteNamePattern.FindAllStringSubmatch(code, -1) {
+		ctes[strings.ToLower(m[1])] = true
+	}
+	// the clauses after the ends of the names of the tables, not in the order of the query with subqueries
+	type insertion struct {
+		at     int
+		clause string
+	}
+	var insertions []insertion
+	for _, m := range timeTravelClausePattern.FindAllStringIndex(code, -1) {
+		if inCall[m[0]+1] || distinctFromPattern.MatchString(code[:m[0]+1]) {
+			continue
+		}
+		for i := m[1]; i >= 0 && i < len(code); i = nextRelation(code, i) {
+			if code[i] == '(' {
+				// a subquery, its tables are in its own FROM clauses
+				if i = closingParen(code, i); i < 0 {
+					break
+				}
+				i++
+				continue
+			}
+			end, table := relationName(code, i)
+			if end < 0 {
+				return "", fmt.Errorf("%w: can't read the snapshot of the relation at %d of the query",
+					ErrInvalidQuery, i)
+			}
+			if timeTravelCallPattern.MatchString(code[end:]) {
+				if i = closingParen(code, strings.IndexByte(code[end:], '(')+end); i < 0 {
+					break
+				}
+				i++
+				continue
+			}
+			i = end
+			if ctes[strings.ToLower(table)] || timeTravelForPattern.MatchString(code[end:]) {
+				continue
+			}
+			name := qualifiedTableName(table, db)
+			if id, ok := snapshotIDs[name]; ok {
+				insertions = append(insertions, insertion{end, fmt.Sprintf(" FOR VERSION AS OF %d", id)})
+			} else if !tt.asOf.IsZero() && (len(asOfTables) == 0 || asOfTables[name]) {
+				insertions = append(insertions, insertion{end, " FOR TIMESTAMP AS OF TIMESTAMP '" +
+					tt.asOf.UTC().Format("2006-01-02 15:04:05.000") + " UTC'"})
+			}
+		}
+	}
+	sort.Slice(insertions, func(i, j int) bool { return insertions[i].at < insertions[j].at })
+	var b strings.Builder
+	last := 0
+	for _, in := range insertions {
+		b.WriteString(query[last:in.at])
+		b.WriteString(in.clause)
+		last = in.at
+	}
+	b.WriteString(query[last:])
+	return b.String(), nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeTravelQuery(t *testing.T) {
+	config := NewNoOpsConfig()
+	config.SetDB("sales")
+	rewrite := func(ctx context.Context, config *Config, query string) string {
+		rewritten, err := timeTravelQuery(ctx, config, query)
+		assert.Nil(t, err, query)
+		return rewritten
+	}
+	ctx := context.Background()
+	assert.Equal(t, "SELECT * FROM orders", rewrite(ctx, config, "SELECT * FROM orders"))
+
+	ctx = WithSnapshotID(ctx, "orders", 949530903748831860)
+	assert.Equal(t, "SELECT * FROM orders FOR VERSION AS OF 949530903748831860 o JOIN users u ON o.uid = u.id",
+		rewrite(ctx, config, "SELECT * FROM orders o JOIN users u ON o.uid = u.id"))
+	assert.Equal(t, "SELECT * FROM awsdatacatalog.Sales.Orders FOR VERSION AS OF 949530903748831860",
+		rewrite(ctx, config, "SELECT * FROM awsdatacatalog.Sales.Orders"))
+	assert.Equal(t, "SELECT * FROM other.orders", rewrite(ctx, config, "SELECT * FROM other.orders"))
+	// only the reads are rewritten
+	assert.Equal(t, "DELETE FROM orders WHERE id = 1", rewrite(ctx, config, "DELETE FROM orders WHERE id = 1"))
+
+	asOf := time.Date(2022, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	all := WithAsOfTimestamp(ctx, asOf)
+	assert.Equal(t, "WITH recent AS (SELECT * FROM events FOR TIMESTAMP AS OF TIMESTAMP '2022-05-01 10:30:00.000 UTC') "+
+		"SELECT * FROM recent JOIN orders FOR VERSION AS OF 949530903748831860 ON true "+
+		"CROSS JOIN UNNEST(tags) AS t(tag)",
+		rewrite(all, config, "WITH recent AS (SELECT * FROM events) "+
+			"SELECT * FROM recent JOIN orders ON true CROSS JOIN UNNEST(tags) AS t(tag)"))
+	assert.Equal(t, "SELECT * FROM events FOR VERSION AS OF 1",
+		rewrite(all, config, "SELECT * FROM events FOR VERSION AS OF 1"))
+
+	some := WithAsOfTimestamp(context.Background(), asOf, "sales.events")
+	assert.Equal(t, "SELECT * FROM events FOR TIMESTAMP AS OF TIMESTAMP '2022-05-01 10:30:00.000 UTC', users",
+		rewrite(some, config, "SELECT * FROM events, users"))
+	assert.Equal(t, "SELECT * FROM users", rewrite(some, config, "SELECT * FROM users"))
+
+	// the FROM of functions and expressions, in literals and in comments are not the ones of tables
+	clause := " FOR TIMESTAMP AS OF TIMESTAMP '2022-05-01 10:30:00.000 UTC'"
+	for _, c := range []struct{ query, expected string }{
+		{"SELECT EXTRACT(YEAR FROM created_at) FROM events", "SELECT EXTRACT(YEAR FROM created_at) FROM events" + clause},
+		{"SELECT * FROM events WHERE a IS DISTINCT FROM b", "SELECT * FROM events" + clause + " WHERE a IS DISTINCT FROM b"},
+		{"SELECT SUBSTRING(name FROM 2), TRIM(BOTH FROM name) FROM events",
+			"SELECT SUBSTRING(name FROM 2), TRIM(BOTH FROM name) FROM events" + clause},
+		{"SELECT 'it''s from x' AS a FROM events", "SELECT 'it''s from x' AS a FROM events" + clause},
+		{"SELECT 1 -- from x\nFROM events /* join y */", "SELECT 1 -- from x\nFROM events" + clause + " /* join y */"},
+		{"SELECT * FROM (SELECT * FROM events) WHERE id IN (SELECT id FROM users)",
+			"SELECT * FROM (SELECT * FROM events" + clause + ") WHERE id IN (SELECT id FROM users" + clause + ")"},
+		{"SELECT count(*) FROM events WHERE EXISTS (SELECT 1 FROM users)",
+			"SELECT count(*) FROM events" + clause + " WHERE EXISTS (SELECT 1 FROM users" + clause + ")"},
+	} {
+		assert.Equal(t, c.expected, rewrite(WithAsOfTimestamp(context.Background(), asOf), config, c.query))
+	}
+
+	// each relation of a FROM list is rewritten, quoted ones too
+	for _, c := range []struct{ query, expected string }{
+		{"SELECT * FROM events, users", "SELECT * FROM events" + clause + ", users" + clause},
+		{"SELECT * FROM events e, sales.users AS u, (SELECT 1) x, UNNEST(e.tags) AS t(tag) WHERE true",
+			"SELECT * FROM events" + clause + " e, sales.users" + clause + " AS u, (SELECT 1) x, " +
+				"UNNEST(e.tags) AS t(tag) WHERE true"},
+		{`SELECT * FROM "events"`, `SELECT * FROM "events"` + clause},
+		{`SELECT * FROM "sales"."Events" e JOIN"users" ON true`,
+			`SELECT * FROM "sales"."Events"` + clause + ` e JOIN"users"` + clause + ` ON true`},
+		{`WITH "recent" AS (SELECT 1) SELECT * FROM "recent", events`,
+			`WITH "recent" AS (SELECT 1) SELECT * FROM "recent", events` + clause},
+	} {
+		assert.Equal(t, c.expected, rewrite(WithAsOfTimestamp(context.Background(), asOf), config, c.query))
+	}
+
+	// the relations which can't be read fail the query instead of reading the current snapshot
+	for _, query := range []string{"SELECT * FROM `events`", `SELECT * FROM events, "users`} {
+		_, err := timeTravelQuery(WithAsOfTimestamp(context.Background(), asOf), config, query)
+		assert.True(t, errors.Is(err, ErrInvalidQuery), query)
+	}
+}
+
+func TestSQLCode(t *testing.T) {
+	code, inCall := sqlCode("SELECT f(a, 'x)'), (b) /* ( */ FROM t")
+	assert.Equal(t, "SELECT f(a,     ), (b)         FROM t", code)
+	assert.True(t, inCall[strings.Index(code, "a,")])
+	assert.False(t, inCall[strings.Index(code, "b)")])
+	assert.False(t, inCall[strings.Index(code, "FROM")])
+}
+
+func TestWithSnapshotID(t *testing.T) {
+	ctx := WithSnapshotID(context.Background(), "orders", 1)
+	other := WithSnapshotID(ctx, "users", 2)
+	assert.Equal(t, map[string]int64{"orders": 1}, getTimeTravel(ctx).snapshotIDs)
+	assert.Equal(t, map[string]int64{"orders": 1, "users": 2}, getTimeTravel(other).snapshotIDs)
+}
+
+func TestConnection_QueryContext_TimeTravel(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	_, err := c.QueryContext(WithSnapshotID(context.Background(), "default.events", 42), "SELECT * FROM events", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM events FOR VERSION AS OF 42", *athenaClient.inputs[0].QueryString)
+
+	_, err = c.QueryContext(WithSnapshotID(context.Background(), "default.events", 42), "SELECT * FROM `events`", nil)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	assert.Len(t, athenaClient.inputs, 1)
+}
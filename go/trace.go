@@ -21,6 +21,8 @@
 package athenadriver
 
 import (
+	"context"
+
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -130,3 +132,39 @@ func (c *DriverTracer) Log(lvl zapcore.Level, msg string, fields ...zap.Field) {
 
 	}
 }
+
+// withContext is to get the tracer of the queries with ctx, logging from the level set with WithLogLevel if
+// there is one, whatever the level of the logger.
+func (c *DriverTracer) withContext(ctx context.Context) *DriverTracer {
+	level, ok := getLogLevel(ctx)
+	if !ok {
+		return c
+	}
+	o := *c
+	o.logger = c.logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, level: level}
+	}))
+	return &o
+}
+
+// levelCore is a zapcore.Core writing the entries from level to the core it wraps, even if the core is
+// at a higher level.
+type levelCore struct {
+	zapcore.Core
+	level zapcore.Level
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return level >= c.level
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
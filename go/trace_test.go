@@ -21,11 +21,13 @@
 package athenadriver
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestObservability_Config(t *testing.T) {
@@ -84,3 +86,29 @@ func TestObservability_NewObservability(t *testing.T) {
 	assert.NotNil(t, obs.Logger())
 	assert.Equal(t, obs.Logger(), zap.NewNop())
 }
+
+func TestObservability_WithContext(t *testing.T) {
+	core, logs := observer.New(InfoLevel)
+	config := NewNoOpsConfig()
+	config.SetLogging(true)
+	obs := NewObservability(config, zap.New(core), tally.NoopScope)
+	assert.Equal(t, obs, obs.withContext(context.Background()))
+
+	obs.Log(DebugLevel, "not logged")
+	assert.Equal(t, 0, logs.Len())
+
+	debug := obs.withContext(WithLogLevel(context.Background(), DebugLevel))
+	debug.Log(DebugLevel, "logged", zap.String("queryID", "qid"))
+	if assert.Equal(t, 1, logs.Len()) {
+		assert.Equal(t, "logged", logs.All()[0].Message)
+		assert.Equal(t, "qid", logs.All()[0].ContextMap()["queryID"])
+	}
+	// the level of the tracer of the connector doesn't change
+	obs.Log(DebugLevel, "not logged")
+	assert.Equal(t, 1, logs.Len())
+
+	quiet := obs.withContext(WithLogLevel(context.Background(), ErrorLevel))
+	quiet.Log(WarnLevel, "not logged")
+	quiet.Log(ErrorLevel, "logged")
+	assert.Equal(t, 2, logs.Len())
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ErrTxStatement is returned for the statements of an emulated transaction which can't be staged, only
+// INSERT INTO statements and the read-only ones can be run in a transaction.
+var ErrTxStatement = errors.New("only INSERT INTO and read-only statements can be run in a transaction")
+
+// txInsertPattern is for the INSERT INTO statements of a transaction, and their table.
+var txInsertPattern = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+([A-Za-z0-9_]+(?:\.[A-Za-z0-9_]+)?)(\s|\(|$)`)
+
+// stagedTable is the Iceberg table where the rows inserted into a table by a transaction are staged.
+type stagedTable struct {
+	table   string
+	staging string
+}
+
+// emulatedTx is a transaction emulated with staging tables: the rows inserted into a table in the
+// transaction are inserted into an Iceberg staging table instead, created by the first of them, and inserted
+// into the table at Commit. The staging tables are dropped at Commit or Rollback. Each table gets the rows
+// of the transaction at once, but the tables are not updated together, and the statements in the
+// transaction don't see the rows it inserted.
+type emulatedTx struct {
+	conn   *Connection
+	suffix string
+	staged []*stagedTable
+}
+
+// Begin is to start a transaction emulated with staging tables if set in Config, or a fake one, Athena doesn't
+// support transactions. See SetTransactionEmulation and SetFakeTransactions.
+func (c *Connection) Begin() (driver.Tx, error) {
+	if c.connector != nil && !c.connector.config.IsTransactionEmulation() && c.connector.config.IsFakeTransactions() {
+		c.connector.tracer.Log(WarnLevel, "fake transaction begins, its statements are not rolled back")
+		c.connector.tracer.Scope().Counter(DriverName + ".tx.fake").Inc(1)
+		return fakeTx{}, nil
+	}
+	if c.connector == nil || !c.connector.config.IsTransactionEmulation() {
+		return nil, ErrAthenaTransactionUnsupported
+	}
+	if c.tx != nil {
+		return nil, fmt.Errorf("%w: a transaction is in progress", ErrAthenaTransactionUnsupported)
+	}
+	c.tx = &emulatedTx{
+		conn:   c,
+		suffix: "_tx_" + strings.ToLower(randString(12)),
+	}
+	c.connector.tracer.Scope().Counter(DriverName + ".tx.begin").Inc(1)
+	return c.tx, nil
+}
+
+// fakeTx is a transaction which doesn't do anything: its statements are run as they are, and Commit and
+// Rollback succeed without undoing them.
+type fakeTx struct{}
+
+// Commit is to implement driver.Tx.
+func (fakeTx) Commit() error {
+	return nil
+}
+
+// Rollback is to implement driver.Tx, the statements of the transaction are not undone.
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+// statement is to get the statement run in the transaction instead of query: an INSERT INTO the staging
+// table of its table, which is created if it's the first one. Read-only statements are run as they are.
+func (tx *emulatedTx) statement(ctx context.Context, query string) (string, error) {
+	if isReadOnlyStatement(query) {
+		return query, nil
+	}
+	match := txInsertPattern.FindStringSubmatchIndex(query)
+	if match == nil {
+		return "", fmt.Errorf("%w: %s", ErrTxStatement, tx.conn.connector.config.redactQuery(query))
+	}
+	table := query[match[2]:match[3]]
+	staged, err := tx.staging(ctx, table)
+	if err != nil {
+		return "", err
+	}
+	return query[:match[2]] + staged.staging + query[match[3]:], nil
+}
+
+// staging is to get the staging table of table, created like table if it doesn't exist yet.
+func (tx *emulatedTx) staging(ctx context.Context, table string) (*stagedTable, error) {
+	for _, staged := range tx.staged {
+		if strings.EqualFold(staged.table, table) {
+			return staged, nil
+		}
+	}
+	staged := &stagedTable{table: table, staging: table + tx.suffix}
+	// the data of Iceberg tables is deleted with them
+	query := fmt.Sprintf("CREATE TABLE %s WITH (table_type = 'ICEBERG', is_external = false, location = '%s') "+
+		"AS SELECT * FROM %s WHERE false", staged.staging, newCTASLocation(ctx, tx.conn.connector.config,
+		staged.staging), table)
+	if err := tx.exec(ctx, query); err != nil {
+		tx.conn.connector.tracer.Scope().Counter(DriverName + ".failure.tx.staging").Inc(1)
+		return nil, err
+	}
+	tx.staged = append(tx.staged, staged)
+	return staged, nil
+}
+
+// exec is to run query outside the transaction.
+func (tx *emulatedTx) exec(ctx context.Context, query string) error {
+	c := tx.conn
+	c.tx = nil
+	defer func() { c.tx = tx }()
+	_, err := c.ExecContext(WithoutResultCache(ctx), query, nil)
+	return err
+}
+
+// Commit is to insert the rows staged for each table into it, one table after the other, and drop the
+// staging tables. If the rows of a table fail to be inserted, the tables before it keep theirs, and the
+// rows staged for the others are dropped. The inserts are bounded by the transaction timeout of Config.
+func (tx *emulatedTx) Commit() error {
+	var obs = tx.conn.connector.tracer
+	defer tx.end()
+	ctx, cancel := context.WithTimeout(context.Background(), tx.conn.connector.config.GetTxTimeout())
+	defer cancel()
+	for i, staged := range tx.staged {
+		if err := tx.exec(ctx, "INSERT INTO "+staged.table+" SELECT * FROM "+staged.staging); err != nil {
+			obs.Log(WarnLevel, "transaction commit failed",
+				zap.String("table", staged.table),
+				zap.Int("committed", i),
+				zap.Int("tables", len(tx.staged)),
+				zap.String("error", err.Error()))
+			obs.Scope().Counter(DriverName + ".failure.tx.commit").Inc(1)
+			return err
+		}
+	}
+	obs.Scope().Counter(DriverName + ".tx.commit").Inc(1)
+	return nil
+}
+
+// Rollback is to drop the staging tables, with the rows staged for the tables.
+func (tx *emulatedTx) Rollback() error {
+	defer tx.end()
+	tx.conn.connector.tracer.Scope().Counter(DriverName + ".tx.rollback").Inc(1)
+	return nil
+}
+
+// end is to drop the staging tables, within the transaction timeout of Config, and end the transaction. The
+// tables failing to be dropped are logged, the transaction is complete already.
+func (tx *emulatedTx) end() {
+	ctx, cancel := context.WithTimeout(context.Background(), tx.conn.connector.config.GetTxTimeout())
+	defer cancel()
+	for _, staged := range tx.staged {
+		if err := tx.exec(ctx, "DROP TABLE IF EXISTS "+staged.staging); err != nil {
+			tx.conn.connector.tracer.Log(WarnLevel, "transaction failed to drop staging table",
+				zap.String("table", staged.staging),
+				zap.String("error", err.Error()))
+			tx.conn.connector.tracer.Scope().Counter(DriverName + ".failure.tx.drop").Inc(1)
+		}
+	}
+	tx.staged = nil
+	tx.conn.tx = nil
+}
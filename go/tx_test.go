@@ -0,0 +1,206 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/stretchr/testify/assert"
+)
+
+func queryStrings(client *queryContextAthenaClient) []string {
+	queries := make([]string, len(client.inputs))
+	for i, input := range client.inputs {
+		queries[i] = *input.QueryString
+	}
+	return queries
+}
+
+func TestConnection_Begin_TransactionEmulation(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetTransactionEmulation(true)
+	ctx := context.Background()
+
+	tx, err := c.Begin()
+	assert.Nil(t, err)
+	_, err = c.Begin()
+	assert.True(t, errors.Is(err, ErrAthenaTransactionUnsupported))
+	suffix := c.tx.suffix
+	for _, query := range []string{"INSERT INTO db.t VALUES (1)", "insert into db.t(id) VALUES (2)",
+		"INSERT INTO u SELECT 3", "SELECT 4"} {
+		_, err = c.ExecContext(ctx, query, nil)
+		assert.Nil(t, err, query)
+	}
+	_, err = c.ExecContext(ctx, "DELETE FROM db.t", nil)
+	assert.True(t, errors.Is(err, ErrTxStatement))
+	assert.Nil(t, tx.Commit())
+	assert.Nil(t, c.tx)
+
+	queries := queryStrings(athenaClient)
+	if assert.Len(t, queries, 10) {
+		assert.True(t, strings.HasPrefix(queries[0], "CREATE TABLE db.t"+suffix+" WITH (table_type = 'ICEBERG', "+
+			"is_external = false, location = '"), queries[0])
+		assert.True(t, strings.HasSuffix(queries[0], "') AS SELECT * FROM db.t WHERE false"), queries[0])
+		assert.Equal(t, []string{
+			"INSERT INTO db.t" + suffix + " VALUES (1)",
+			"insert into db.t" + suffix + "(id) VALUES (2)",
+		}, queries[1:3])
+		assert.True(t, strings.HasPrefix(queries[3], "CREATE TABLE u"+suffix+" WITH"), queries[3])
+		assert.Equal(t, []string{
+			"INSERT INTO u" + suffix + " SELECT 3",
+			"SELECT 4",
+			"INSERT INTO db.t SELECT * FROM db.t" + suffix,
+			"INSERT INTO u SELECT * FROM u" + suffix,
+			"DROP TABLE IF EXISTS db.t" + suffix,
+			"DROP TABLE IF EXISTS u" + suffix,
+		}, queries[4:])
+	}
+
+	athenaClient.inputs = nil
+	tx, err = c.Begin()
+	assert.Nil(t, err)
+	_, err = c.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Rollback())
+	queries = queryStrings(athenaClient)
+	if assert.Len(t, queries, 3) {
+		assert.True(t, strings.HasPrefix(queries[2], "DROP TABLE IF EXISTS t_tx_"), queries[2])
+	}
+	// the statements after the transaction are not staged
+	_, err = c.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "INSERT INTO t VALUES (1)", *athenaClient.inputs[3].QueryString)
+}
+
+func TestConnection_Transaction_Emulation(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetTransactionEmulation(true)
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	db := sql.OpenDB(NewConnectorWithClient(testConf, athenaClient))
+	defer db.Close()
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	_, err = tx.Exec("INSERT INTO t VALUES (1)")
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Commit())
+	assert.Len(t, athenaClient.inputs, 4)
+}
+
+func TestConnection_Begin_FakeTransactions(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetFakeTransactions(true)
+	tx, err := c.Begin()
+	assert.Nil(t, err)
+	assert.Nil(t, c.tx)
+	_, err = c.ExecContext(context.Background(), "DELETE FROM t", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Rollback())
+	assert.Equal(t, []string{"DELETE FROM t"}, queryStrings(athenaClient))
+
+	// transaction emulation takes precedence
+	c.connector.config.SetTransactionEmulation(true)
+	tx, err = c.Begin()
+	assert.Nil(t, err)
+	assert.NotNil(t, c.tx)
+	assert.Nil(t, tx.Rollback())
+}
+
+func TestConnection_Transaction_Fake(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	testConf.SetFakeTransactions(true)
+	db := sql.OpenDB(NewConnectorWithClient(testConf, newMockAthenaClient()))
+	defer db.Close()
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Commit())
+}
+
+// ctxAthenaClient fails the queries started with a context which is done, like the AWS SDK.
+type ctxAthenaClient struct {
+	queryContextAthenaClient
+}
+
+func (m *ctxAthenaClient) StartQueryExecutionWithContext(ctx aws.Context, s *athena.StartQueryExecutionInput,
+	opts ...request.Option) (*athena.StartQueryExecutionOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.queryContextAthenaClient.StartQueryExecutionWithContext(ctx, s, opts...)
+}
+
+func TestConnection_Commit_TxTimeout(t *testing.T) {
+	athenaClient := &ctxAthenaClient{queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetTransactionEmulation(true)
+	assert.Equal(t, DefaultTxTimeout*time.Second, c.connector.config.GetTxTimeout())
+	tx, err := c.Begin()
+	assert.Nil(t, err)
+	_, err = c.ExecContext(context.Background(), "INSERT INTO t VALUES (1)", nil)
+	assert.Nil(t, err)
+	c.connector.config.SetTxTimeout(time.Nanosecond)
+	err = tx.Commit()
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	assert.Nil(t, c.tx)
+}
+
+func TestConnection_InsertRows_Transaction(t *testing.T) {
+	athenaClient := &queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	c.connector.config.SetTransactionEmulation(true)
+	ctx := context.Background()
+	tx, err := c.Begin()
+	assert.Nil(t, err)
+	rows := [][]interface{}{{1}, {2}}
+	_, err = c.InsertRows(ctx, "t", nil, rows, 2)
+	assert.True(t, errors.Is(err, ErrAthenaTransactionUnsupported))
+	assert.Nil(t, athenaClient.inputs)
+
+	inserted, err := c.InsertRows(ctx, "t", nil, rows, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), inserted)
+	assert.Nil(t, tx.Rollback())
+	queries := queryStrings(athenaClient)
+	if assert.Len(t, queries, 3) {
+		assert.Equal(t, "INSERT INTO t"+tx.(*emulatedTx).suffix+" VALUES (1), (2)", queries[1])
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// compressionPattern is for the compression of UNLOAD, like GZIP or SNAPPY.
+var compressionPattern = regexp.MustCompile(`^[A-Za-z0-9_]*$`)
+
+// Unload is to write the result of query to files in format under s3Prefix, compressed if compression is set.
+// UNLOAD supports the same formats as CTAS. The call waits for the query to complete and returns the S3 URIs
+// of the written files, read from the data manifest of the query.
+// It is reached from database/sql with sql.Conn.Raw.
+func (c *Connection) Unload(ctx context.Context, query, s3Prefix, format, compression string) ([]string, error) {
+	if c.s3API == nil {
+		return nil, ErrS3NilAPI
+	}
+	if !strings.HasPrefix(s3Prefix, "s3://") {
+		return nil, fmt.Errorf("%w: UNLOAD location must start with s3://", ErrInvalidQuery)
+	}
+	if !strings.HasSuffix(s3Prefix, "/") {
+		s3Prefix += "/"
+	}
+	format = strings.ToUpper(format)
+	if !isCTASFormat(format) {
+		return nil, fmt.Errorf("%w: unsupported UNLOAD format %q", ErrInvalidQuery, format)
+	}
+	compression = strings.ToUpper(compression)
+	if !compressionPattern.MatchString(compression) {
+		return nil, fmt.Errorf("%w: invalid UNLOAD compression %q", ErrInvalidQuery, compression)
+	}
+	query = strings.TrimSpace(query)
+	if !isUnloadable(query) {
+		return nil, fmt.Errorf("%w: UNLOAD needs a SELECT query", ErrInvalidQuery)
+	}
+	driverRows, err := c.QueryContext(ctx, formatUnloadQuery(query, s3Prefix, format, compression), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer driverRows.Close()
+	// the query ran in the region of the Athena client of the Rows, which may be a fallback region
+	rows := driverRows.(*Rows)
+	statusResp, err := rows.athena.GetQueryExecutionWithContext(ctx, &athena.GetQueryExecutionInput{
+		QueryExecutionId: aws.String(rows.queryID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.connector.tracer.Scope().Counter(DriverName + ".unload").Inc(1)
+	statistics := statusResp.QueryExecution.Statistics
+	if statistics == nil || aws.StringValue(statistics.DataManifestLocation) == "" {
+		return []string{}, nil
+	}
+	return c.readManifest(ctx, aws.StringValue(statistics.DataManifestLocation))
+}
+
+// readManifest is to get the S3 URIs listed in the data manifest at location, one per line.
+func (c *Connection) readManifest(ctx context.Context, location string) ([]string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	body, err := openObject(ctx, c.s3API, u.Host, strings.TrimPrefix(u.Path, "/"), c.connector.config)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	objects := []string{}
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			objects = append(objects, line)
+		}
+	}
+	return objects, scanner.Err()
+}
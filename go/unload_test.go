@@ -0,0 +1,112 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// manifestAthenaClient sets the data manifest location of the query executions.
+type manifestAthenaClient struct {
+	queryContextAthenaClient
+	manifest string
+}
+
+func (m *manifestAthenaClient) GetQueryExecutionWithContext(ctx aws.Context, input *athena.GetQueryExecutionInput,
+	opts ...request.Option) (*athena.GetQueryExecutionOutput, error) {
+	out, err := m.mockAthenaClient.GetQueryExecutionWithContext(ctx, input, opts...)
+	if err == nil && out != nil && m.manifest != "" {
+		out.QueryExecution.Statistics = &athena.QueryExecutionStatistics{
+			DataManifestLocation: aws.String(m.manifest),
+		}
+	}
+	return out, err
+}
+
+// manifestS3Client serves the data manifest.
+type manifestS3Client struct {
+	s3iface.S3API
+	key     string
+	content string
+}
+
+func (m *manifestS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput,
+	opts ...request.Option) (*s3.GetObjectOutput, error) {
+	if *input.Bucket+"/"+*input.Key != m.key {
+		return nil, ErrTestMockGeneric
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(m.content))}, nil
+}
+
+func TestConnection_Unload(t *testing.T) {
+	athenaClient := &manifestAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		manifest:                 "s3://results/PING_OK_QID-manifest.csv",
+	}
+	s3Client := &manifestS3Client{
+		key:     "results/PING_OK_QID-manifest.csv",
+		content: "s3://bucket/export/a.gz\ns3://bucket/export/b.gz\n",
+	}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		s3API:     s3Client,
+		connector: NoopsSQLConnector(),
+	}
+	objects, err := c.Unload(context.Background(), "SELECT a FROM t;", "s3://bucket/export", "json", "gzip")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s3://bucket/export/a.gz", "s3://bucket/export/b.gz"}, objects)
+	assert.Equal(t, "UNLOAD (SELECT a FROM t) TO 's3://bucket/export/' WITH (format = 'JSON', compression = 'GZIP')",
+		*athenaClient.inputs[0].QueryString)
+
+	// nothing was written without a manifest
+	athenaClient.manifest = ""
+	objects, err = c.Unload(context.Background(), "SELECT a FROM t WHERE false", "s3://bucket/none/", "PARQUET", "")
+	assert.Nil(t, err)
+	assert.Empty(t, objects)
+	assert.Equal(t, "UNLOAD (SELECT a FROM t WHERE false) TO 's3://bucket/none/' WITH (format = 'PARQUET')",
+		*athenaClient.inputs[1].QueryString)
+
+	for _, args := range [][]string{
+		{"SELECT 1", "bucket/export/", "PARQUET", ""},
+		{"SELECT 1", "s3://bucket/export/", "CSV", ""},
+		{"SELECT 1", "s3://bucket/export/", "PARQUET", "gzip')"},
+		{"DROP TABLE t", "s3://bucket/export/", "PARQUET", ""},
+	} {
+		_, err = c.Unload(context.Background(), args[0], args[1], args[2], args[3])
+		assert.True(t, errors.Is(err, ErrInvalidQuery))
+	}
+	assert.Len(t, athenaClient.inputs, 2)
+
+	c.s3API = nil
+	_, err = c.Unload(context.Background(), "SELECT 1", "s3://bucket/export/", "PARQUET", "")
+	assert.Equal(t, ErrS3NilAPI, err)
+}
@@ -28,6 +28,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"net/url"
 	"os"
 	"regexp"
 	"strconv"
@@ -307,6 +308,22 @@ func isInsertStatement(query string) bool {
 	return strings.Index(nQuery, "insert") == 0
 }
 
+// queryLimit is to get the row count n of a query ending with `LIMIT n`, or 0 if there is no such limit.
+// Limits of subqueries are not returned, as they don't limit the rows of the query.
+func queryLimit(query string) int {
+	query = multiLineCommentPattern.ReplaceAllString(query, "")
+	query = oneLineCommentPattern.ReplaceAllString(query, "")
+	m := limitPattern.FindStringSubmatch(query)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
 func newColumnInfo(colName string, colType interface{}) *athena.ColumnInfo {
 	caseSensitive := false
 	catalogName := "hive"
@@ -644,6 +661,31 @@ func escapeStringBackslash(buf []byte, v string) []byte {
 	return escapeBytesBackslash(buf, []byte(v))
 }
 
+// escapeBytesQuotes escapes []byte by doubling the single quotes ('), the only escape in the string
+// literals of Athena, where backslashes are characters like the others.
+func escapeBytesQuotes(buf, v []byte) []byte {
+	pos := len(buf)
+	buf = reserveBuffer(buf, len(v)*2)
+
+	for _, c := range v {
+		if c == '\'' {
+			buf[pos] = '\''
+			buf[pos+1] = '\''
+			pos += 2
+		} else {
+			buf[pos] = c
+			pos++
+		}
+	}
+
+	return buf[:pos]
+}
+
+// escapeStringQuotes is similar to escapeBytesQuotes but for string.
+func escapeStringQuotes(buf []byte, v string) []byte {
+	return escapeBytesQuotes(buf, []byte(v))
+}
+
 // reserveBuffer checks cap(buf) and expand buffer to len(buf) + appendSize.
 // If cap(buf) is not enough, reallocate new buffer.
 func reserveBuffer(buf []byte, appendSize int) []byte {
@@ -703,10 +745,17 @@ func isQueryTimeOut(startOfStartQueryExecution time.Time, queryType string, serv
 	}
 }
 
-// isQueryValid is to check the validity of Query, now only string length check.
+// validateQuery is to check the validity of query, now only string length check. It is a QueryTooLongError
+// if Athena would reject it as too long.
 // https://docs.aws.amazon.com/athena/latest/ug/service-limits.html
-func isQueryValid(query string) bool {
-	return len(query) < MAXQueryStringLength && len(query) > 4
+func validateQuery(query string) error {
+	if len(query) >= MAXQueryStringLength {
+		return &QueryTooLongError{Length: len(query)}
+	}
+	if len(query) <= 4 {
+		return ErrInvalidQuery
+	}
+	return nil
 }
 
 // GetFromEnvVal is to get environmental variable value by keys.
@@ -762,8 +811,55 @@ var multiLineCommentPattern = regexp.MustCompile(`\/\*(.*)\*/\s*`)
 var oneLineCommentPattern = regexp.MustCompile(`(^\-\-[^\n]+|\s--[^\n]+)`)
 var getTableNamePattern = regexp.MustCompile(`(?i)\s+(?:from|join)\s+([\w.]+)`)
 var dualPattern = regexp.MustCompile(`from dual`)
+var limitPattern = regexp.MustCompile(`(?i)\slimit\s+(\d+)\s*;?\s*$`)
 var qIDPattern = regexp.MustCompile(`^[0-9a-f-]{36}$`)
 
+// encodeKeyValues is to encode the key values of a map, like the query labels, in a DSN value.
+func encodeKeyValues(m map[string]string) string {
+	values := url.Values{}
+	for k, v := range m {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+// decodeKeyValues is to decode the key values encoded by encodeKeyValues, and in env like `team=data,service=api`.
+func decodeKeyValues(s string) map[string]string {
+	m := map[string]string{}
+	values, _ := url.ParseQuery(strings.ReplaceAll(s, ",", "&"))
+	for k := range values {
+		m[strings.TrimSpace(k)] = strings.TrimSpace(values.Get(k))
+	}
+	return m
+}
+
+// splitTableName is to get the database and the table of a name like [catalog.]database.table in a query, db if
+// it's unqualified.
+func splitTableName(name string, db string) (database string, table string) {
+	names := strings.Split(name, ".")
+	if len(names) == 1 {
+		return db, names[0]
+	}
+	return names[len(names)-2], names[len(names)-1]
+}
+
+// containsName is to check if name is in s as a whole name, not part of another one, case-insensitively.
+func containsName(s string, name string) bool {
+	s, name = strings.ToLower(s), strings.ToLower(name)
+	for i := 0; name != ""; {
+		j := strings.Index(s[i:], name)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(name)
+		if (start == 0 || !isIdentifierChar(s[start-1])) && (end == len(s) || !isIdentifierChar(s[end])) {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
 // GetTableNamesInQuery is a pessimistic function to return tables involved in query in format of DB.TABLE
 // https://regoio.herokuapp.com/
 // https://golang.org/pkg/regexp/syntax/
@@ -23,6 +23,7 @@ package athenadriver
 import (
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"math"
 	"os"
 	"strconv"
@@ -123,6 +124,15 @@ func TestIsInsetStatement(t *testing.T) {
 	assert.True(t, isInsertStatement("insert"))
 }
 
+func TestQueryLimit(t *testing.T) {
+	assert.Equal(t, 10, queryLimit("SELECT * FROM t LIMIT 10"))
+	assert.Equal(t, 10, queryLimit("select * from t\nlimit 10;\n"))
+	assert.Equal(t, 5, queryLimit("SELECT * FROM t ORDER BY a OFFSET 2 LIMIT 5 -- top 5"))
+	assert.Equal(t, 0, queryLimit("SELECT * FROM (SELECT * FROM t LIMIT 10) u"))
+	assert.Equal(t, 0, queryLimit("SELECT * FROM t LIMIT ALL"))
+	assert.Equal(t, 0, queryLimit("SELECT * FROM t"))
+}
+
 func TestRandInt8(t *testing.T) {
 	s := randInt8()
 	i, err := strconv.ParseInt(*s, 10, 8)
@@ -251,6 +261,27 @@ func TestEscapeBytesBackslash(t *testing.T) {
 	assert.Equal(t, string(r), `x`)
 }
 
+func TestSplitTableName(t *testing.T) {
+	database, table := splitTableName("t", "db")
+	assert.Equal(t, []string{"db", "t"}, []string{database, table})
+	database, table = splitTableName("awsdatacatalog.sales.orders", "db")
+	assert.Equal(t, []string{"sales", "orders"}, []string{database, table})
+}
+
+func TestContainsName(t *testing.T) {
+	assert.True(t, containsName("dt = '' AND x > 1", "DT"))
+	assert.True(t, containsName("a.dt=1", "dt"))
+	assert.False(t, containsName("dt_2 = 1 AND odt = 2", "dt"))
+	assert.True(t, containsName("dt_2 = 1 AND dt = 2", "dt"))
+	assert.False(t, containsName("dt = 1", ""))
+}
+
+func TestEscapeStringQuotes(t *testing.T) {
+	assert.Equal(t, `it''s`, string(escapeStringQuotes([]byte{}, "it's")))
+	assert.Equal(t, `C:\ ''''`, string(escapeStringQuotes([]byte{}, `C:\ ''`)))
+	assert.Equal(t, `a\nb`, string(escapeBytesQuotes([]byte{}, []byte(`a\nb`))))
+}
+
 func TestGetFromEnvVal(t *testing.T) {
 	os.Setenv("henrywu_test", "1")
 	assert.Equal(t, GetFromEnvVal([]string{"henrywu_test"}), "1")
@@ -454,6 +485,16 @@ func TestUtils_IsQID(t *testing.T) {
 	assert.False(t, IsQID("a44f8e61"))
 }
 
+func TestUtils_ValidateQuery(t *testing.T) {
+	assert.Nil(t, validateQuery("SELECT 1"))
+	assert.Equal(t, ErrInvalidQuery, validateQuery("S"))
+	err := validateQuery(randString(MAXQueryStringLength))
+	assert.Equal(t, &QueryTooLongError{Length: MAXQueryStringLength}, err)
+	assert.True(t, errors.Is(err, ErrQueryTooLong))
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+	assert.Equal(t, "query is 262144 bytes, Athena allows less than 262144 bytes", err.Error())
+}
+
 func Test_newHeaderResultPage(t *testing.T) {
 	colName := "_col0"
 	qid := "123"
@@ -22,10 +22,28 @@ package athenadriver
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/service/athena"
 	"github.com/aws/aws-sdk-go/service/athena/athenaiface"
+	"go.uber.org/zap"
+)
+
+// WGReconcileMode is what the driver does when the configuration of an existing workgroup drifted from
+// the one in Config.
+type WGReconcileMode string
+
+const (
+	// WGReconcileOff uses existing workgroups as they are. It is the default mode.
+	WGReconcileOff WGReconcileMode = ""
+
+	// WGReconcileUpdate updates the drifted workgroups to the configuration in Config with UpdateWorkGroup.
+	WGReconcileUpdate WGReconcileMode = "update"
+
+	// WGReconcileStrict fails the queries in drifted workgroups with a *WGDriftError.
+	WGReconcileStrict WGReconcileMode = "strict"
 )
 
 // Workgroup is a wrapper of Athena Workgroup.
@@ -61,6 +79,22 @@ func NewWG(name string, config *athena.WorkGroupConfiguration, tags *WGTags) *Wo
 	}
 }
 
+// withBytesScannedCutoff is to get a copy of config with the max scanned bytes as the data usage control of
+// its queries, so Athena cancels them too. It is config itself if its cutoff is lower already, or if maxBytes
+// is under MinBytesScannedCutoffPerQuery.
+func withBytesScannedCutoff(config *athena.WorkGroupConfiguration, maxBytes int64) *athena.WorkGroupConfiguration {
+	if maxBytes < MinBytesScannedCutoffPerQuery ||
+		(config != nil && config.BytesScannedCutoffPerQuery != nil && *config.BytesScannedCutoffPerQuery <= maxBytes) {
+		return config
+	}
+	withCutoff := athena.WorkGroupConfiguration{}
+	if config != nil {
+		withCutoff = *config
+	}
+	withCutoff.BytesScannedCutoffPerQuery = aws.Int64(maxBytes)
+	return &withCutoff
+}
+
 // getWG is to get Athena Workgroup from AWS remotely.
 func getWG(ctx context.Context, athenaService athenaiface.AthenaAPI, Name string) (*athena.WorkGroup, error) {
 	if athenaService == nil {
@@ -80,6 +114,9 @@ func getWG(ctx context.Context, athenaService athenaiface.AthenaAPI, Name string
 func (w *Workgroup) CreateWGRemotely(athenaService athenaiface.AthenaAPI) error {
 	tags := w.Tags.Get()
 	var err error
+	if err = w.Tags.Validate(); err != nil {
+		return err
+	}
 	if len(tags) == 0 {
 		_, err = athenaService.CreateWorkGroup(&athena.CreateWorkGroupInput{
 			Configuration: w.Config,
@@ -94,3 +131,252 @@ func (w *Workgroup) CreateWGRemotely(athenaService athenaiface.AthenaAPI) error
 	}
 	return err
 }
+
+// WGARN is to get the ARN of the Athena Workgroup name in the region and the AWS account, which TagRemotely
+// and UntagRemotely need.
+func WGARN(region string, accountID string, name string) string {
+	partition := endpoints.AwsPartitionID
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		partition = p.ID()
+	}
+	return "arn:" + partition + ":athena:" + region + ":" + accountID + ":workgroup/" + name
+}
+
+// TagRemotely is to add the Tags of the existing Workgroup of resourceARN remotely, or to update the values
+// of the ones it has already. Its other tags are kept.
+func (w *Workgroup) TagRemotely(athenaService athenaiface.AthenaAPI, resourceARN string) error {
+	if athenaService == nil {
+		return ErrAthenaNilAPI
+	}
+	if err := w.Tags.Validate(); err != nil {
+		return err
+	}
+	if w.Tags == nil || len(w.Tags.Get()) == 0 {
+		return nil
+	}
+	_, err := athenaService.TagResource(&athena.TagResourceInput{
+		ResourceARN: aws.String(resourceARN),
+		Tags:        w.Tags.Get(),
+	})
+	return err
+}
+
+// UntagRemotely is to remove the tags of keys from the existing Workgroup of resourceARN remotely.
+func (w *Workgroup) UntagRemotely(athenaService athenaiface.AthenaAPI, resourceARN string, keys ...string) error {
+	if athenaService == nil {
+		return ErrAthenaNilAPI
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := athenaService.UntagResource(&athena.UntagResourceInput{
+		ResourceARN: aws.String(resourceARN),
+		TagKeys:     aws.StringSlice(keys),
+	})
+	return err
+}
+
+// UpdateRemotely is to update the configuration of the Workgroup remotely to its Config. The output location
+// and the encryption of the query results are only updated if Config has a ResultConfiguration.
+func (w *Workgroup) UpdateRemotely(athenaService athenaiface.AthenaAPI) error {
+	if athenaService == nil {
+		return ErrAthenaNilAPI
+	}
+	if w.Config == nil {
+		return nil
+	}
+	_, err := athenaService.UpdateWorkGroup(&athena.UpdateWorkGroupInput{
+		WorkGroup:            aws.String(w.Name),
+		ConfigurationUpdates: wgConfigurationUpdates(w.Config),
+	})
+	return err
+}
+
+// DeleteWGRemotely is to delete the Workgroup remotely. If recursive is true, the named queries and
+// prepared statements in it are deleted too, otherwise Athena fails to delete a Workgroup which has any.
+func (w *Workgroup) DeleteWGRemotely(athenaService athenaiface.AthenaAPI, recursive bool) error {
+	if athenaService == nil {
+		return ErrAthenaNilAPI
+	}
+	_, err := athenaService.DeleteWorkGroup(&athena.DeleteWorkGroupInput{
+		WorkGroup:             aws.String(w.Name),
+		RecursiveDeleteOption: aws.Bool(recursive),
+	})
+	return err
+}
+
+// WGSummary is the name and the state of an Athena Workgroup, as listed by ListWorkgroups.
+type WGSummary struct {
+	Name  string
+	State string
+}
+
+// ListWorkgroups is to list the names and the states (ENABLED or DISABLED) of all Athena Workgroups remotely.
+func ListWorkgroups(ctx context.Context, athenaService athenaiface.AthenaAPI) ([]WGSummary, error) {
+	if athenaService == nil {
+		return nil, ErrAthenaNilAPI
+	}
+	var workgroups []WGSummary
+	err := athenaService.ListWorkGroupsPagesWithContext(ctx, &athena.ListWorkGroupsInput{},
+		func(page *athena.ListWorkGroupsOutput, lastPage bool) bool {
+			for _, wg := range page.WorkGroups {
+				workgroups = append(workgroups, WGSummary{
+					Name:  aws.StringValue(wg.Name),
+					State: aws.StringValue(wg.State),
+				})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	return workgroups, nil
+}
+
+// wgConfigurationUpdates is to get the updates of a workgroup to config.
+func wgConfigurationUpdates(config *athena.WorkGroupConfiguration) *athena.WorkGroupConfigurationUpdates {
+	updates := &athena.WorkGroupConfigurationUpdates{
+		EnforceWorkGroupConfiguration:   config.EnforceWorkGroupConfiguration,
+		PublishCloudWatchMetricsEnabled: config.PublishCloudWatchMetricsEnabled,
+		RequesterPaysEnabled:            config.RequesterPaysEnabled,
+		EngineVersion:                   config.EngineVersion,
+	}
+	if config.BytesScannedCutoffPerQuery != nil {
+		updates.BytesScannedCutoffPerQuery = config.BytesScannedCutoffPerQuery
+	} else {
+		updates.RemoveBytesScannedCutoffPerQuery = aws.Bool(true)
+	}
+	if rc := config.ResultConfiguration; rc != nil {
+		updates.ResultConfigurationUpdates = &athena.ResultConfigurationUpdates{
+			OutputLocation:          rc.OutputLocation,
+			EncryptionConfiguration: rc.EncryptionConfiguration,
+		}
+		if rc.EncryptionConfiguration == nil {
+			updates.ResultConfigurationUpdates.RemoveEncryptionConfiguration = aws.Bool(true)
+		}
+	}
+	return updates
+}
+
+// wgDrift is to get the names of the settings of the remote workgroup configuration which differ from
+// desired. The settings desired doesn't have are not compared, like the engine version Athena chooses.
+func wgDrift(remote *athena.WorkGroupConfiguration, desired *athena.WorkGroupConfiguration) []string {
+	if desired == nil {
+		return nil
+	}
+	if remote == nil {
+		remote = &athena.WorkGroupConfiguration{}
+	}
+	var drift []string
+	if aws.Int64Value(remote.BytesScannedCutoffPerQuery) != aws.Int64Value(desired.BytesScannedCutoffPerQuery) {
+		drift = append(drift, "BytesScannedCutoffPerQuery")
+	}
+	for _, b := range []struct {
+		name            string
+		remote, desired *bool
+	}{
+		{"EnforceWorkGroupConfiguration", remote.EnforceWorkGroupConfiguration, desired.EnforceWorkGroupConfiguration},
+		{"PublishCloudWatchMetricsEnabled", remote.PublishCloudWatchMetricsEnabled, desired.PublishCloudWatchMetricsEnabled},
+		{"RequesterPaysEnabled", remote.RequesterPaysEnabled, desired.RequesterPaysEnabled},
+	} {
+		if b.desired != nil && aws.BoolValue(b.remote) != *b.desired {
+			drift = append(drift, b.name)
+		}
+	}
+	if desired.EngineVersion != nil && desired.EngineVersion.SelectedEngineVersion != nil {
+		current := ""
+		if remote.EngineVersion != nil {
+			current = aws.StringValue(remote.EngineVersion.SelectedEngineVersion)
+		}
+		if current != *desired.EngineVersion.SelectedEngineVersion {
+			drift = append(drift, "EngineVersion")
+		}
+	}
+	if rc := desired.ResultConfiguration; rc != nil {
+		current := remote.ResultConfiguration
+		if current == nil {
+			current = &athena.ResultConfiguration{}
+		}
+		if rc.OutputLocation != nil && aws.StringValue(current.OutputLocation) != *rc.OutputLocation {
+			drift = append(drift, "OutputLocation")
+		}
+		want, got := rc.EncryptionConfiguration, current.EncryptionConfiguration
+		if want == nil {
+			want = &athena.EncryptionConfiguration{}
+		}
+		if got == nil {
+			got = &athena.EncryptionConfiguration{}
+		}
+		if aws.StringValue(want.EncryptionOption) != aws.StringValue(got.EncryptionOption) ||
+			aws.StringValue(want.KmsKey) != aws.StringValue(got.KmsKey) {
+			drift = append(drift, "EncryptionConfiguration")
+		}
+	}
+	return drift
+}
+
+// reconcileWG is to check the configuration of the existing workgroup remote against the one of wg, with the
+// max scanned bytes of Config as its cutoff, and update or reject the workgroup if it drifted, depending on
+// the reconcile mode of Config.
+func (c *Connection) reconcileWG(obs *DriverTracer, athenaAPI athenaiface.AthenaAPI, wg Workgroup,
+	remote *athena.WorkGroup) error {
+	mode := c.connector.config.GetWGReconcileMode()
+	if mode == WGReconcileOff {
+		return nil
+	}
+	wg.Config = withBytesScannedCutoff(wg.Config, c.connector.config.GetMaxScannedBytes())
+	drift := wgDrift(remote.Configuration, wg.Config)
+	if len(drift) == 0 {
+		return nil
+	}
+	obs.Log(WarnLevel, "workgroup configuration drifted",
+		zap.String("workgroup", wg.Name),
+		zap.Strings("settings", drift))
+	if mode == WGReconcileStrict {
+		obs.Scope().Counter(DriverName + ".failure.querycontext.wgdrift").Inc(1)
+		return &WGDriftError{Workgroup: wg.Name, Settings: drift}
+	}
+	if err := wg.UpdateRemotely(athenaAPI); err != nil {
+		obs.Scope().Counter(DriverName + ".failure.querycontext.updatewgremotely").Inc(1)
+		return err
+	}
+	obs.Scope().Counter(DriverName + ".querycontext.wgupdated").Inc(1)
+	obs.Log(DebugLevel, "workgroup "+wg.Name+" is updated successfully.")
+	return nil
+}
+
+// prepareWG is to get the workgroup wg from Athena of athenaAPI, which is the one of the region running the
+// query, and create it if it doesn't exist and Config allows it, or reconcile it if it does. The errors of an
+// unavailable Athena are returned as they are, so the query fails over to another region.
+func (c *Connection) prepareWG(ctx context.Context, obs *DriverTracer, athenaAPI athenaiface.AthenaAPI,
+	wg Workgroup) error {
+	if wg.Name == DefaultWGName {
+		return nil
+	}
+	athenaWG, err := getWG(ctx, athenaAPI, wg.Name)
+	if err != nil {
+		obs.Scope().Counter(DriverName + ".failure.querycontext.getwg").Inc(1)
+		obs.Log(WarnLevel, "Didn't find workgroup "+wg.Name+" due to: "+err.Error())
+		if isRegionOutageError(err, regionOutageFailures) {
+			return err
+		}
+		if !c.connector.config.IsWGRemoteCreationAllowed() {
+			obs.Log(WarnLevel, "workgroup "+DefaultWGName+" is used for "+wg.Name+".")
+			return fmt.Errorf("workgroup %q doesn't exist and workgroup remote creation is disabled", wg.Name)
+		}
+		wg.Config = withBytesScannedCutoff(wg.Config, c.connector.config.GetMaxScannedBytes())
+		if err = wg.CreateWGRemotely(athenaAPI); err != nil {
+			obs.Scope().Counter(DriverName + ".failure.querycontext.createwgremotely").Inc(1)
+			return err
+		}
+		obs.Log(DebugLevel, "workgroup "+wg.Name+" is created successfully.")
+		return nil
+	}
+	if *athenaWG.State != athena.WorkGroupStateEnabled {
+		obs.Log(WarnLevel, "workgroup "+DefaultWGName+" is disabled.")
+		obs.Scope().Counter(DriverName + ".failure.querycontext.wgdisabled").Inc(1)
+		return fmt.Errorf("workgroup %q is disabled", wg.Name)
+	}
+	obs.Log(DebugLevel, "workgroup "+DefaultWGName+" is enabled.")
+	return c.reconcileWG(obs, athenaAPI, wg, athenaWG)
+}
@@ -22,8 +22,12 @@ package athenadriver
 
 import (
 	"context"
+	"errors"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/athena"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -77,3 +81,251 @@ func TestWorkgroup_CreateWGRemotely2(t *testing.T) {
 	e = wg.CreateWGRemotely(athenaClient)
 	assert.Nil(t, e)
 }
+
+func TestWithBytesScannedCutoff(t *testing.T) {
+	config := GetDefaultWGConfig()
+	assert.Same(t, config, withBytesScannedCutoff(config, 0))
+	assert.Same(t, config, withBytesScannedCutoff(config, MinBytesScannedCutoffPerQuery-1))
+	assert.Same(t, config, withBytesScannedCutoff(config, 1<<40))
+
+	withCutoff := withBytesScannedCutoff(config, 1<<20*100)
+	assert.Equal(t, int64(1<<20*100), *withCutoff.BytesScannedCutoffPerQuery)
+	assert.Equal(t, int64(DefaultBytesScannedCutoffPerQuery), *config.BytesScannedCutoffPerQuery)
+	assert.Equal(t, config.EnforceWorkGroupConfiguration, withCutoff.EnforceWorkGroupConfiguration)
+
+	assert.Equal(t, int64(1<<30), *withBytesScannedCutoff(nil, 1<<30).BytesScannedCutoffPerQuery)
+}
+
+// remoteWGAthenaClient has a workgroup with a remote configuration, which UpdateWorkGroup updates.
+type remoteWGAthenaClient struct {
+	queryContextAthenaClient
+	remote  *athena.WorkGroupConfiguration
+	updates []*athena.UpdateWorkGroupInput
+}
+
+func (m *remoteWGAthenaClient) GetWorkGroupWithContext(ctx aws.Context, input *athena.GetWorkGroupInput,
+	opts ...request.Option) (*athena.GetWorkGroupOutput, error) {
+	return &athena.GetWorkGroupOutput{WorkGroup: &athena.WorkGroup{
+		Name:          input.WorkGroup,
+		State:         aws.String(athena.WorkGroupStateEnabled),
+		Configuration: m.remote,
+	}}, nil
+}
+
+func (m *remoteWGAthenaClient) UpdateWorkGroup(input *athena.UpdateWorkGroupInput) (
+	*athena.UpdateWorkGroupOutput, error) {
+	m.updates = append(m.updates, input)
+	u := input.ConfigurationUpdates
+	m.remote = &athena.WorkGroupConfiguration{
+		BytesScannedCutoffPerQuery:      u.BytesScannedCutoffPerQuery,
+		EnforceWorkGroupConfiguration:   u.EnforceWorkGroupConfiguration,
+		PublishCloudWatchMetricsEnabled: u.PublishCloudWatchMetricsEnabled,
+		RequesterPaysEnabled:            u.RequesterPaysEnabled,
+		EngineVersion:                   u.EngineVersion,
+	}
+	return &athena.UpdateWorkGroupOutput{}, nil
+}
+
+func TestWgDrift(t *testing.T) {
+	desired := GetDefaultWGConfig()
+	assert.Empty(t, wgDrift(GetDefaultWGConfig(), desired))
+	assert.Nil(t, wgDrift(nil, nil))
+	assert.Equal(t, []string{"BytesScannedCutoffPerQuery", "EnforceWorkGroupConfiguration",
+		"PublishCloudWatchMetricsEnabled"}, wgDrift(nil, desired))
+
+	// the engine version Athena chooses is not compared
+	remote := GetDefaultWGConfig()
+	remote.EngineVersion = &athena.EngineVersion{SelectedEngineVersion: aws.String("AUTO")}
+	assert.Empty(t, wgDrift(remote, desired))
+	desired.EngineVersion = &athena.EngineVersion{SelectedEngineVersion: aws.String("Athena engine version 3")}
+	assert.Equal(t, []string{"EngineVersion"}, wgDrift(remote, desired))
+
+	desired = GetDefaultWGConfig()
+	desired.ResultConfiguration = &athena.ResultConfiguration{
+		OutputLocation: aws.String("s3://results/"),
+		EncryptionConfiguration: &athena.EncryptionConfiguration{
+			EncryptionOption: aws.String(athena.EncryptionOptionSseS3),
+		},
+	}
+	assert.Equal(t, []string{"OutputLocation", "EncryptionConfiguration"}, wgDrift(GetDefaultWGConfig(), desired))
+}
+
+func TestWorkgroup_UpdateRemotely(t *testing.T) {
+	wg := NewWG("henry_wu", nil, nil)
+	assert.Equal(t, ErrAthenaNilAPI, wg.UpdateRemotely(nil))
+	athenaClient := &remoteWGAthenaClient{}
+	assert.Nil(t, wg.UpdateRemotely(athenaClient))
+	assert.Empty(t, athenaClient.updates)
+
+	wg.Config = NewWGConfig(0, true, false, false, &athena.ResultConfiguration{
+		OutputLocation: aws.String("s3://results/"),
+	})
+	wg.Config.BytesScannedCutoffPerQuery = nil
+	assert.Nil(t, wg.UpdateRemotely(athenaClient))
+	if assert.Len(t, athenaClient.updates, 1) {
+		updates := athenaClient.updates[0].ConfigurationUpdates
+		assert.Equal(t, "henry_wu", *athenaClient.updates[0].WorkGroup)
+		assert.True(t, *updates.RemoveBytesScannedCutoffPerQuery)
+		assert.False(t, *updates.PublishCloudWatchMetricsEnabled)
+		assert.Equal(t, "s3://results/", *updates.ResultConfigurationUpdates.OutputLocation)
+		assert.True(t, *updates.ResultConfigurationUpdates.RemoveEncryptionConfiguration)
+	}
+}
+
+func TestConnection_QueryContext_WGReconcile(t *testing.T) {
+	drifted := GetDefaultWGConfig()
+	drifted.BytesScannedCutoffPerQuery = aws.Int64(1 << 40)
+	athenaClient := &remoteWGAthenaClient{
+		queryContextAthenaClient: queryContextAthenaClient{mockAthenaClient: newMockAthenaClient()},
+		remote:                   drifted,
+	}
+	c := &Connection{
+		athenaAPI: athenaClient,
+		connector: NoopsSQLConnector(),
+	}
+	ctx := WithWorkgroup(context.Background(), "analytics")
+
+	// drifted workgroups are used as they are by default
+	_, err := c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+
+	c.connector.config.SetWGReconcileMode(WGReconcileStrict)
+	_, err = c.QueryContext(ctx, "SELECT 1", nil)
+	var driftErr *WGDriftError
+	assert.True(t, errors.As(err, &driftErr))
+	assert.True(t, errors.Is(err, ErrWGDrift))
+	assert.Equal(t, "analytics", driftErr.Workgroup)
+	assert.Equal(t, []string{"BytesScannedCutoffPerQuery"}, driftErr.Settings)
+	assert.Empty(t, athenaClient.updates)
+
+	c.connector.config.SetWGReconcileMode(WGReconcileUpdate)
+	_, err = c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.updates, 1)
+	assert.Equal(t, int64(DefaultBytesScannedCutoffPerQuery), *athenaClient.remote.BytesScannedCutoffPerQuery)
+	_, err = c.QueryContext(ctx, "SELECT 1", nil)
+	assert.Nil(t, err)
+	assert.Len(t, athenaClient.updates, 1)
+}
+
+func TestConfig_SetWGReconcileMode(t *testing.T) {
+	testConf := NewNoOpsConfig()
+	assert.Equal(t, WGReconcileOff, testConf.GetWGReconcileMode())
+	testConf.SetWGReconcileMode(WGReconcileStrict)
+	assert.Equal(t, WGReconcileStrict, testConf.GetWGReconcileMode())
+	testConf.SetWGReconcileMode("unknown")
+	assert.Equal(t, WGReconcileOff, testConf.GetWGReconcileMode())
+}
+
+// lifecycleWGAthenaClient deletes and lists workgroups in pages of two.
+type lifecycleWGAthenaClient struct {
+	*mockAthenaClient
+	workgroups []*athena.WorkGroupSummary
+	deletes    []*athena.DeleteWorkGroupInput
+}
+
+func (m *lifecycleWGAthenaClient) DeleteWorkGroup(input *athena.DeleteWorkGroupInput) (
+	*athena.DeleteWorkGroupOutput, error) {
+	m.deletes = append(m.deletes, input)
+	return &athena.DeleteWorkGroupOutput{}, nil
+}
+
+func (m *lifecycleWGAthenaClient) ListWorkGroupsPagesWithContext(ctx aws.Context, input *athena.ListWorkGroupsInput,
+	fn func(*athena.ListWorkGroupsOutput, bool) bool, opts ...request.Option) error {
+	for i := 0; i < len(m.workgroups); i += 2 {
+		end := i + 2
+		if end > len(m.workgroups) {
+			end = len(m.workgroups)
+		}
+		if !fn(&athena.ListWorkGroupsOutput{WorkGroups: m.workgroups[i:end]}, end == len(m.workgroups)) {
+			break
+		}
+	}
+	return nil
+}
+
+func TestWorkgroup_DeleteWGRemotely(t *testing.T) {
+	wg := NewWG("henry_wu", nil, nil)
+	assert.Equal(t, ErrAthenaNilAPI, wg.DeleteWGRemotely(nil, false))
+	athenaClient := &lifecycleWGAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	assert.Nil(t, wg.DeleteWGRemotely(athenaClient, false))
+	assert.Nil(t, wg.DeleteWGRemotely(athenaClient, true))
+	if assert.Len(t, athenaClient.deletes, 2) {
+		assert.Equal(t, "henry_wu", *athenaClient.deletes[0].WorkGroup)
+		assert.False(t, *athenaClient.deletes[0].RecursiveDeleteOption)
+		assert.True(t, *athenaClient.deletes[1].RecursiveDeleteOption)
+	}
+}
+
+func TestListWorkgroups(t *testing.T) {
+	_, err := ListWorkgroups(context.Background(), nil)
+	assert.Equal(t, ErrAthenaNilAPI, err)
+
+	athenaClient := &lifecycleWGAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	workgroups, err := ListWorkgroups(context.Background(), athenaClient)
+	assert.Nil(t, err)
+	assert.Empty(t, workgroups)
+
+	for _, wg := range []WGSummary{{"primary", "ENABLED"}, {"henry_wu", "ENABLED"}, {"old", "DISABLED"}} {
+		athenaClient.workgroups = append(athenaClient.workgroups, &athena.WorkGroupSummary{
+			Name:  aws.String(wg.Name),
+			State: aws.String(wg.State),
+		})
+	}
+	workgroups, err = ListWorkgroups(context.Background(), athenaClient)
+	assert.Nil(t, err)
+	assert.Equal(t, []WGSummary{{"primary", "ENABLED"}, {"henry_wu", "ENABLED"}, {"old", "DISABLED"}}, workgroups)
+}
+
+// taggingWGAthenaClient records the tagging of workgroups.
+type taggingWGAthenaClient struct {
+	*mockAthenaClient
+	tags   []*athena.TagResourceInput
+	untags []*athena.UntagResourceInput
+}
+
+func (m *taggingWGAthenaClient) TagResource(input *athena.TagResourceInput) (*athena.TagResourceOutput, error) {
+	m.tags = append(m.tags, input)
+	return &athena.TagResourceOutput{}, nil
+}
+
+func (m *taggingWGAthenaClient) UntagResource(input *athena.UntagResourceInput) (*athena.UntagResourceOutput, error) {
+	m.untags = append(m.untags, input)
+	return &athena.UntagResourceOutput{}, nil
+}
+
+func TestWGARN(t *testing.T) {
+	assert.Equal(t, "arn:aws:athena:us-east-1:123456789012:workgroup/henry_wu",
+		WGARN("us-east-1", "123456789012", "henry_wu"))
+	assert.Equal(t, "arn:aws-cn:athena:cn-north-1:123456789012:workgroup/henry_wu",
+		WGARN("cn-north-1", "123456789012", "henry_wu"))
+}
+
+func TestWorkgroup_TagRemotely(t *testing.T) {
+	arn := WGARN("us-east-1", "123456789012", "henry_wu")
+	tags := NewWGTags()
+	wg := NewWG("henry_wu", nil, tags)
+	assert.Equal(t, ErrAthenaNilAPI, wg.TagRemotely(nil, arn))
+	assert.Equal(t, ErrAthenaNilAPI, wg.UntagRemotely(nil, arn, "Uber User"))
+
+	athenaClient := &taggingWGAthenaClient{mockAthenaClient: newMockAthenaClient()}
+	assert.Nil(t, wg.TagRemotely(athenaClient, arn))
+	assert.Nil(t, wg.UntagRemotely(athenaClient, arn))
+	assert.Empty(t, athenaClient.tags)
+	assert.Empty(t, athenaClient.untags)
+
+	tags.AddTag("Uber User", "henry.wu")
+	assert.Nil(t, wg.TagRemotely(athenaClient, arn))
+	assert.Nil(t, wg.UntagRemotely(athenaClient, arn, "Uber Asset", "Owner"))
+	if assert.Len(t, athenaClient.tags, 1) && assert.Len(t, athenaClient.untags, 1) {
+		assert.Equal(t, arn, *athenaClient.tags[0].ResourceARN)
+		assert.Equal(t, tags.Get(), athenaClient.tags[0].Tags)
+		assert.Equal(t, arn, *athenaClient.untags[0].ResourceARN)
+		assert.Equal(t, []string{"Uber Asset", "Owner"}, aws.StringValueSlice(athenaClient.untags[0].TagKeys))
+	}
+
+	tags.AddTag("aws:reserved", "v")
+	assert.True(t, errors.Is(wg.TagRemotely(athenaClient, arn), ErrWGTagInvalid))
+	assert.True(t, errors.Is(wg.CreateWGRemotely(athenaClient), ErrWGTagInvalid))
+	assert.Len(t, athenaClient.tags, 1)
+}
@@ -20,7 +20,10 @@
 
 package athenadriver
 
-import "github.com/aws/aws-sdk-go/service/athena"
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/athena"
+)
 
 // WGConfig wraps WorkGroupConfiguration.
 type WGConfig struct {
@@ -56,3 +59,32 @@ func NewWGConfig(bytesScannedCutoffPerQuery int64,
 		ResultConfiguration:             resultConfiguration,
 	}
 }
+
+// getWGConfig is to get the configuration of the workgroups created remotely, the default one with the
+// workgroup settings of c.
+func (c *Config) getWGConfig() *athena.WorkGroupConfiguration {
+	wgConfig := GetDefaultWGConfig()
+	if cutoff := c.GetWGBytesScannedCutoff(); cutoff > 0 {
+		wgConfig.BytesScannedCutoffPerQuery = aws.Int64(cutoff)
+	}
+	if val := c.values.Get("wgEnforceConfiguration"); val != "" {
+		wgConfig.EnforceWorkGroupConfiguration = aws.Bool(val == "true")
+	}
+	if val := c.values.Get("wgPublishCloudWatchMetrics"); val != "" {
+		wgConfig.PublishCloudWatchMetricsEnabled = aws.Bool(val == "true")
+	}
+	if version := c.GetWGEngineVersion(); version != "" {
+		wgConfig.EngineVersion = &athena.EngineVersion{SelectedEngineVersion: aws.String(version)}
+	}
+	if option, kmsKey := c.GetWGResultEncryption(); option != "" {
+		encryption := &athena.EncryptionConfiguration{EncryptionOption: aws.String(option)}
+		if kmsKey != "" {
+			encryption.KmsKey = aws.String(kmsKey)
+		}
+		wgConfig.ResultConfiguration = &athena.ResultConfiguration{
+			OutputLocation:          aws.String(c.GetOutputBucket()),
+			EncryptionConfiguration: encryption,
+		}
+	}
+	return wgConfig
+}
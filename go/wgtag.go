@@ -20,7 +20,25 @@
 
 package athenadriver
 
-import "github.com/aws/aws-sdk-go/service/athena"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/service/athena"
+)
+
+// The AWS constraints of the tags of a resource.
+const (
+	MaxWGTags           = 50
+	MaxWGTagKeyLength   = 128
+	MaxWGTagValueLength = 256
+)
+
+// wgTagCharsRegexp matches the characters AWS allows in tag keys and values: letters, numbers, spaces and
+// _ . : / = + - @.
+var wgTagCharsRegexp = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
 
 // WGTags is a wrapper of []*athena.Tag.
 type WGTags struct {
@@ -41,5 +59,45 @@ func (t *WGTags) AddTag(k string, v string) {
 
 // Get is a getter.
 func (t *WGTags) Get() []*athena.Tag {
+	if t == nil {
+		return nil
+	}
 	return t.tags
 }
+
+// Validate is to check the tags against the AWS constraints: at most MaxWGTags unique keys of 1 to
+// MaxWGTagKeyLength characters, values of up to MaxWGTagValueLength characters, only allowed characters,
+// and no keys starting with the reserved aws: prefix. The error is ErrWGTagInvalid for errors.Is.
+func (t *WGTags) Validate() error {
+	if t == nil {
+		return nil
+	}
+	if len(t.tags) > MaxWGTags {
+		return fmt.Errorf("%w: %d tags, more than the max of %d", ErrWGTagInvalid, len(t.tags), MaxWGTags)
+	}
+	seen := make(map[string]bool, len(t.tags))
+	for _, tag := range t.tags {
+		if tag.Key == nil || tag.Value == nil {
+			return fmt.Errorf("%w: key and value are required", ErrWGTagInvalid)
+		}
+		k, v := *tag.Key, *tag.Value
+		if n := utf8.RuneCountInString(k); n == 0 || n > MaxWGTagKeyLength {
+			return fmt.Errorf("%w: key %q must be 1 to %d characters", ErrWGTagInvalid, k, MaxWGTagKeyLength)
+		}
+		if utf8.RuneCountInString(v) > MaxWGTagValueLength {
+			return fmt.Errorf("%w: value of %q must be at most %d characters", ErrWGTagInvalid, k, MaxWGTagValueLength)
+		}
+		if !wgTagCharsRegexp.MatchString(k) || !wgTagCharsRegexp.MatchString(v) {
+			return fmt.Errorf("%w: %q=%q has characters other than letters, numbers, spaces and _.:/=+-@",
+				ErrWGTagInvalid, k, v)
+		}
+		if strings.HasPrefix(strings.ToLower(k), "aws:") {
+			return fmt.Errorf("%w: key %q has the reserved aws: prefix", ErrWGTagInvalid, k)
+		}
+		if seen[k] {
+			return fmt.Errorf("%w: duplicate key %q", ErrWGTagInvalid, k)
+		}
+		seen[k] = true
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package athenadriver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWGTags_Validate(t *testing.T) {
+	var nilTags *WGTags
+	assert.Nil(t, nilTags.Validate())
+	tags := NewWGTags()
+	assert.Nil(t, tags.Validate())
+	tags.AddTag("Uber User", "henry.wu@uber.com")
+	tags.AddTag("team:owner/é", "a+b=c-d_e")
+	tags.AddTag("empty", "")
+	assert.Nil(t, tags.Validate())
+
+	for _, tag := range [][2]string{
+		{"", "v"},
+		{strings.Repeat("k", MaxWGTagKeyLength+1), "v"},
+		{"k", strings.Repeat("v", MaxWGTagValueLength+1)},
+		{"k#", "v"},
+		{"k", "v;"},
+		{"aws:createdBy", "v"},
+		{"Uber User", "duplicate"},
+	} {
+		tags := NewWGTags()
+		tags.AddTag("Uber User", "henry.wu@uber.com")
+		tags.AddTag(tag[0], tag[1])
+		assert.True(t, errors.Is(tags.Validate(), ErrWGTagInvalid), tag)
+	}
+
+	tags = NewWGTags()
+	for i := 0; i <= MaxWGTags; i++ {
+		tags.AddTag(strings.Repeat("k", i+1), "v")
+	}
+	assert.True(t, errors.Is(tags.Validate(), ErrWGTagInvalid))
+}